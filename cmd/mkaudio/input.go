@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	errFormat      = errors.New("unsupported audio file")
+	errUnsupported = errors.New("only uncompressed PCM with one or two channels is supported")
+)
+
+// audio holds decoded 16-bit PCM samples, interleaved if there are two
+// channels.
+type audio struct {
+	samples  []int16
+	channels int
+	rate     int
+}
+
+// parse decodes the WAV, AIFF or AIFF-C file name, the format is chosen by
+// its extension.
+func parse(name string, data []byte) (*audio, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".aif", ".aiff", ".aifc":
+		return parseAIFF(data)
+	default:
+		return parseWAV(data)
+	}
+}
+
+// chunks calls fn for every chunk in a RIFF or IFF container.
+func chunks(data []byte, order binary.ByteOrder, fn func(id string, chunk []byte)) {
+	for len(data) >= 8 {
+		id := string(data[:4])
+		size := int(order.Uint32(data[4:]))
+		data = data[8:]
+		size = min(size, len(data))
+		fn(id, data[:size])
+		size += size & 1 // chunks are padded to even size
+		data = data[min(size, len(data)):]
+	}
+}
+
+// decodePCM converts samples of the given bit depth to 16-bit.  Samples with
+// more than 16 bits are truncated, 8-bit samples are unsigned if signed is
+// false.  An incomplete frame at the end of a truncated file is dropped.
+func decodePCM(data []byte, channels, bits int, order binary.ByteOrder, signed bool) ([]int16, error) {
+	if bits%8 != 0 || bits < 8 || bits > 32 {
+		return nil, errUnsupported
+	}
+	width := bits / 8
+	data = data[:len(data)-len(data)%(width*channels)]
+	samples := make([]int16, 0, len(data)/width)
+	for ; len(data) >= width; data = data[width:] {
+		switch {
+		case width == 1 && signed:
+			samples = append(samples, int16(int8(data[0]))<<8)
+		case width == 1:
+			samples = append(samples, int16(int(data[0])-128)<<8)
+		case order == binary.BigEndian:
+			samples = append(samples, int16(order.Uint16(data)))
+		default:
+			samples = append(samples, int16(order.Uint16(data[width-2:])))
+		}
+	}
+	return samples, nil
+}
+
+func parseWAV(data []byte) (*audio, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, errFormat
+	}
+
+	const formatPCM, formatExtensible = 1, 0xfffe
+	var (
+		a      audio
+		bits   int
+		format = -1
+		pcm    []byte
+	)
+	chunks(data[12:], binary.LittleEndian, func(id string, chunk []byte) {
+		switch id {
+		case "fmt ":
+			if len(chunk) < 16 {
+				return
+			}
+			format = int(binary.LittleEndian.Uint16(chunk[0:]))
+			a.channels = int(binary.LittleEndian.Uint16(chunk[2:]))
+			a.rate = int(binary.LittleEndian.Uint32(chunk[4:]))
+			bits = int(binary.LittleEndian.Uint16(chunk[14:]))
+			if format == formatExtensible {
+				// the subformat GUID starts with the actual format
+				format = -1
+				if len(chunk) >= 26 {
+					format = int(binary.LittleEndian.Uint16(chunk[24:]))
+				}
+			}
+		case "data":
+			pcm = chunk
+		}
+	})
+
+	if format != formatPCM {
+		return nil, errUnsupported
+	}
+	if a.channels != 1 && a.channels != 2 {
+		return nil, errUnsupported
+	}
+
+	var err error
+	a.samples, err = decodePCM(pcm, a.channels, bits, binary.LittleEndian, false)
+	return &a, err
+}
+
+func parseAIFF(data []byte) (*audio, error) {
+	if len(data) < 12 || string(data[:4]) != "FORM" {
+		return nil, errFormat
+	}
+	var compressed bool
+	switch string(data[8:12]) {
+	case "AIFF":
+	case "AIFC":
+		// only uncompressed AIFF-C is supported, which is checked below
+		compressed = true
+	default:
+		return nil, errFormat
+	}
+
+	var (
+		a    audio
+		bits int
+		pcm  []byte
+		err  error
+	)
+	chunks(data[12:], binary.BigEndian, func(id string, chunk []byte) {
+		switch id {
+		case "COMM":
+			if len(chunk) < 18 {
+				err = errFormat
+				return
+			}
+			a.channels = int(binary.BigEndian.Uint16(chunk[0:]))
+			bits = int(binary.BigEndian.Uint16(chunk[6:]))
+			a.rate = int(extended(chunk[8:18]))
+			if compressed {
+				// AIFF-C adds the compression type
+				if len(chunk) < 22 {
+					err = errFormat
+				} else if c := string(chunk[18:22]); c != "NONE" && c != "twos" {
+					err = errUnsupported
+				}
+			}
+		case "SSND":
+			if len(chunk) < 8 {
+				err = errFormat
+				return
+			}
+			offset := int(binary.BigEndian.Uint32(chunk[0:]))
+			pcm = chunk[8+min(offset, len(chunk)-8):]
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if a.channels != 1 && a.channels != 2 {
+		return nil, errUnsupported
+	}
+
+	a.samples, err = decodePCM(pcm, a.channels, bits, binary.BigEndian, true)
+	return &a, err
+}
+
+// extended converts an 80-bit IEEE 754 extended precision float.
+func extended(b []byte) float64 {
+	exp := int(binary.BigEndian.Uint16(b[0:]) & 0x7fff)
+	mant := binary.BigEndian.Uint64(b[2:])
+	v := math.Ldexp(float64(mant), exp-16383-63)
+	if b[0]&0x80 != 0 {
+		v = -v
+	}
+	return v
+}
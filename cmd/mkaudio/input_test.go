@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// The testdata files were written with Python's wave and aifc modules.
+func TestParse(t *testing.T) {
+	tests := map[string]struct {
+		audio audio
+		err   error
+	}{
+		"mono8.wav":     {audio{[]int16{0, 127 << 8, -128 << 8, -64 << 8}, 1, 8000}, nil},
+		"stereo16.wav":  {audio{[]int16{1, -1, 1000, -1000, 32767, -32768}, 2, 22050}, nil},
+		"mono24.wav":    {audio{[]int16{0x1234, -1}, 1, 44100}, nil},
+		"mono16.aiff":   {audio{[]int16{1, 2, -3}, 1, 32000}, nil},
+		"stereo8.aiff":  {audio{[]int16{1 << 8, -1 << 8, 127 << 8, -128 << 8}, 2, 11025}, nil},
+		"stereo16.aifc": {audio{[]int16{100, -100, 200, -200}, 2, 48000}, nil},
+		"ulaw.aifc":     {err: errUnsupported},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", name))
+			if err != nil {
+				t.Fatal("missing testdata:", err)
+			}
+			a, err := parse(name, data)
+			if err != tc.err {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if a.channels != tc.audio.channels || a.rate != tc.audio.rate {
+				t.Errorf("expected %d channels at %d Hz, got %d at %d Hz",
+					tc.audio.channels, tc.audio.rate, a.channels, a.rate)
+			}
+			if !slices.Equal(a.samples, tc.audio.samples) {
+				t.Errorf("expected %v, got %v", tc.audio.samples, a.samples)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	wav, err := os.ReadFile(filepath.Join("testdata", "stereo16.wav"))
+	if err != nil {
+		t.Fatal("missing testdata:", err)
+	}
+	aifc, err := os.ReadFile(filepath.Join("testdata", "stereo16.aifc"))
+	if err != nil {
+		t.Fatal("missing testdata:", err)
+	}
+
+	tests := map[string]struct {
+		name string
+		data []byte
+		err  error
+	}{
+		"Empty":       {"empty.wav", nil, errFormat},
+		"WAVAsAIFF":   {"wav.aiff", wav, errFormat},
+		"AIFCAsWAV":   {"aifc.wav", aifc, errFormat},
+		"AIFCNoType":  {"notype.aifc", cutCOMM(t, aifc), errFormat},
+		"WAVFloat":    {"float.wav", setWAVFormat(wav, 3), errUnsupported},
+		"WAVChannels": {"surround.wav", setWAVChannels(wav, 6), errUnsupported},
+		"WAVExtFloat": {"float.wav", extensibleWAV(wav, 40, 3), errUnsupported},
+		"WAVExtShort": {"short.wav", extensibleWAV(wav, 18, 1), errUnsupported},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parse(tc.name, tc.data); err != tc.err {
+				t.Errorf("expected %v, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestParseExtensible(t *testing.T) {
+	wav, err := os.ReadFile(filepath.Join("testdata", "stereo16.wav"))
+	if err != nil {
+		t.Fatal("missing testdata:", err)
+	}
+
+	a, err := parse("stereo16.wav", extensibleWAV(wav, 40, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []int16{1, -1, 1000, -1000, 32767, -32768}
+	if a.channels != 2 || a.rate != 22050 || !slices.Equal(a.samples, expected) {
+		t.Errorf("expected %v, got %d channels at %d Hz, %v", expected, a.channels, a.rate, a.samples)
+	}
+}
+
+func TestParseTruncated(t *testing.T) {
+	wav, err := os.ReadFile(filepath.Join("testdata", "stereo16.wav"))
+	if err != nil {
+		t.Fatal("missing testdata:", err)
+	}
+
+	// Cutting into the last frame must not leave a sample for only one
+	// channel.
+	expected := []int16{1, -1, 1000, -1000}
+	for _, n := range []int{1, 2, 3} {
+		a, err := parse("stereo16.wav", wav[:len(wav)-n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(a.samples, expected) {
+			t.Errorf("truncated by %d bytes: expected %v, got %v", n, expected, a.samples)
+		}
+	}
+}
+
+// cutCOMM returns a copy of the AIFF-C file data with the compression type and
+// name removed from its COMM chunk, which leaves a plain AIFF COMM chunk.
+func cutCOMM(t *testing.T, data []byte) []byte {
+	t.Helper()
+	i := bytes.Index(data, []byte("COMM"))
+	if i < 0 {
+		t.Fatal("damaged testdata: no COMM chunk")
+	}
+	size := int(data[i+7])
+	out := slices.Clone(data[:i+8+18])
+	out[i+7] = 18
+	return append(out, data[i+8+size:]...)
+}
+
+func setWAVFormat(wav []byte, format byte) []byte {
+	wav = slices.Clone(wav)
+	wav[20] = format // fmt chunk directly follows the RIFF header
+	return wav
+}
+
+func setWAVChannels(wav []byte, channels byte) []byte {
+	wav = slices.Clone(wav)
+	wav[22] = channels
+	return wav
+}
+
+// extensibleWAV returns a copy of the WAV file data with a WAVE_FORMAT_EXTENSIBLE
+// fmt chunk of size bytes, whose subformat GUID starts with subformat.
+func extensibleWAV(wav []byte, size int, subformat uint16) []byte {
+	ext := make([]byte, 40)
+	copy(ext, wav[20:36]) // fmt chunk directly follows the RIFF header
+	binary.LittleEndian.PutUint16(ext[0:], 0xfffe)
+	binary.LittleEndian.PutUint16(ext[16:], 22)
+	binary.LittleEndian.PutUint16(ext[18:], 16) // valid bits
+	binary.LittleEndian.PutUint32(ext[20:], 3)  // front left and right
+	binary.LittleEndian.PutUint16(ext[24:], subformat)
+	copy(ext[26:], "\x00\x00\x00\x00\x10\x00\x80\x00\x00\xaa\x00\x38\x9b\x71")
+
+	out := slices.Clone(wav[:16])
+	out = binary.LittleEndian.AppendUint32(out, uint32(size))
+	out = append(out, ext[:size]...)
+	out = append(out, wav[36:]...)
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out
+}
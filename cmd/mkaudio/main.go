@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/drpaneas/n64/drivers/mixer/vadpcm"
+)
+
+const usageString = `WAV/AIFF/AIFF-C to VADPCM converter.
+
+Usage: %s [flags] <audiofile>
+
+`
+
+var (
+	infile     string
+	outfile    = flag.String("o", "", "output file (default <audiofile>.vadpcm)")
+	order      = flag.Int("order", 2, "predictor order, 1 to 8")
+	predictors = flag.Int("predictors", 4, "number of predictors, 1 to 16")
+	loop       = flag.Int("loop", -1, "sample where playback continues after the end, -1 disables looping")
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), usageString, os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 1 {
+		infile = flag.Arg(0)
+	} else {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *outfile == "" {
+		*outfile = strings.TrimSuffix(infile, filepath.Ext(infile)) + ".vadpcm"
+	}
+
+	pcm := must(parse(infile, must(os.ReadFile(infile))))
+
+	sound := must(vadpcm.Encode(pcm.samples, pcm.channels, pcm.rate, *order, *predictors))
+	if *loop >= sound.Samples {
+		fmt.Println("loop start beyond end of sound")
+		os.Exit(1)
+	}
+	sound.LoopStart = *loop
+
+	must(0, os.WriteFile(*outfile, must(sound.MarshalBinary()), 0644))
+}
+
+func must[T any](ret T, err error) T {
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return ret
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+)
+
+// cic is the lockout chip of the cartridge, e.g. 6102.  The 61xx chips are
+// used by NTSC and the 71xx chips by PAL consoles.  Each variant expects its
+// own IPL3 boot code and checks the ROM with a different checksum.
+type cic int
+
+type cicInfo struct {
+	seed       uint32 // initial value of the checksum
+	ipl3CRC    uint32 // CRC-32 of the IPL3 boot code
+	bootOffset uint32 // IPL3 subtracts this from the header's boot address
+}
+
+// https://n64brew.dev/wiki/CIC-NUS
+var cics = map[cic]cicInfo{
+	6101: {0xf8ca4ddc, 0x6170a4a1, 0},
+	6102: {0xf8ca4ddc, 0x90bb6cb5, 0},
+	6103: {0xa3886759, 0x0b050ee0, 0x100000},
+	6105: {0xdf26f436, 0x98bc2c86, 0},
+	6106: {0x1fea617a, 0xacc8580a, 0x200000},
+	7101: {0xf8ca4ddc, 0x90bb6cb5, 0},
+	7102: {0xf8ca4ddc, 0x009e9ea3, 0},
+	7103: {0xa3886759, 0x0b050ee0, 0x100000},
+	7105: {0xdf26f436, 0x98bc2c86, 0},
+	7106: {0x1fea617a, 0xacc8580a, 0x200000},
+}
+
+func parseCIC(s string) (cic, error) {
+	n, err := strconv.Atoi(s)
+	if _, ok := cics[cic(n)]; err != nil || !ok {
+		return 0, fmt.Errorf("unknown CIC %q", s)
+	}
+	return cic(n), nil
+}
+
+// detectCIC returns the CIC matching the IPL3 boot code.  Most PAL chips
+// share the IPL3 with their NTSC counterpart, which is returned then.  Only
+// 7102 has its own IPL3.
+func detectCIC(ipl3 []byte) (cic, bool) {
+	sum := crc32.ChecksumIEEE(ipl3)
+	for _, c := range []cic{6101, 6102, 6103, 6105, 6106, 7102} {
+		if cics[c].ipl3CRC == sum {
+			return c, true
+		}
+	}
+	return 0, false
+}
+
+// https://n64brew.dev/wiki/ROM_Header#Destination_Code
+var regions = map[string]byte{
+	"all":         'A',
+	"brazil":      'B',
+	"china":       'C',
+	"germany":     'D',
+	"usa":         'E',
+	"france":      'F',
+	"netherlands": 'H',
+	"italy":       'I',
+	"japan":       'J',
+	"korea":       'K',
+	"canada":      'N',
+	"europe":      'P',
+	"spain":       'S',
+	"australia":   'U',
+	"scandinavia": 'W',
+}
+
+// romHeader holds the configurable fields of the ROM header.
+type romHeader struct {
+	title   string
+	gameID  string // category, unique code and destination code
+	region  string // destination code or region name, overrides gameID
+	version uint
+	clock   uint
+	boot    uint
+	cic     cic
+
+	compressed bool // program is loaded by the boot stage, checked by rt0
+}
+
+var errHeaderField = errors.New("invalid header field")
+
+// write sets the header fields in hdr.  The checksum is not touched.
+func (h *romHeader) write(hdr *[0x40]byte) error {
+	title := h.title
+	if len(title) > 20 || strings.IndexFunc(title, func(r rune) bool { return r < ' ' || r > '~' }) >= 0 {
+		return fmt.Errorf("%w: title %q must be up to 20 ASCII characters", errHeaderField, title)
+	}
+	if len(h.gameID) != 4 {
+		return fmt.Errorf("%w: game code %q must be 4 characters", errHeaderField, h.gameID)
+	}
+	id := []byte(h.gameID)
+	if h.region != "" {
+		if code, ok := regions[strings.ToLower(h.region)]; ok {
+			id[3] = code
+		} else if len(h.region) == 1 {
+			id[3] = h.region[0]
+		} else {
+			return fmt.Errorf("%w: unknown region %q", errHeaderField, h.region)
+		}
+	}
+	if h.version > 0xff || h.clock > 0xffffffff || h.boot > 0xffffffff {
+		return fmt.Errorf("%w: value out of range", errHeaderField)
+	}
+
+	binary.BigEndian.PutUint32(hdr[0x04:], uint32(h.clock))
+	binary.BigEndian.PutUint32(hdr[0x08:], uint32(h.boot)+cics[h.cic].bootOffset)
+	copy(hdr[0x20:0x34], title+strings.Repeat(" ", 20-len(title)))
+	copy(hdr[0x3b:0x3f], id)
+	hdr[0x3f] = uint8(h.version)
+	var compressed uint32
+	if h.compressed {
+		compressed = 1
+	}
+	binary.BigEndian.PutUint32(hdr[0x1c:], compressed)
+	return nil
+}
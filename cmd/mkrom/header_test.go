@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// random returns n bytes of a deterministic pseudo random sequence.
+func random(n int) []byte {
+	b := make([]byte, n)
+	x := uint32(1)
+	for i := range b {
+		x = x*1103515245 + 12345
+		b[i] = uint8(x >> 16)
+	}
+	return b
+}
+
+// The expected checksums were computed independently with a Python port of
+// CalculateCRC from n64crc.c by Parasyte, which reads the words of the whole
+// ROM image, i.e. the header, the IPL3 and the program at 0x1000.
+func TestCRC(t *testing.T) {
+	ipl3 := make([]byte, n64IPL3Len)
+	for i := range ipl3 {
+		ipl3[i] = uint8(i * 13)
+	}
+	data := random(n64ChecksumLen)
+	ones := bytes.Repeat([]byte{0xff}, n64ChecksumLen)
+	counter := make([]byte, n64ChecksumLen)
+	for i := 0; i < len(counter); i += 4 {
+		binary.BigEndian.PutUint32(counter[i:], uint32(i/4))
+	}
+
+	tests := map[string]struct {
+		cic  cic
+		data []byte
+		crc  [2]uint32
+	}{
+		"6101":        {6101, data, [2]uint32{0x466b7a33, 0x6a1e10fe}},
+		"6102":        {6102, data, [2]uint32{0x466b7a33, 0x6a1e10fe}},
+		"7101":        {7101, data, [2]uint32{0x466b7a33, 0x6a1e10fe}},
+		"6103":        {6103, data, [2]uint32{0x362959cf, 0x72578a12}},
+		"7103":        {7103, data, [2]uint32{0x362959cf, 0x72578a12}},
+		"6105":        {6105, data, [2]uint32{0x6cc7a6cd, 0x4f587f69}},
+		"6106":        {6106, data, [2]uint32{0xc42b537a, 0x7db76f32}},
+		"6102Ones":    {6102, ones, [2]uint32{0xf8c24ddc, 0xc1544ddc}},
+		"6103Ones":    {6103, ones, [2]uint32{0xa3906759, 0x06226759}},
+		"6105Ones":    {6105, ones, [2]uint32{0xdf2ef436, 0xdd1af436}},
+		"6106Ones":    {6106, ones, [2]uint32{0x04100f9e, 0xf83e0f9e}},
+		"6102Counter": {6102, counter, [2]uint32{0xf8c84de4, 0xb04e75e2}},
+		"6103Counter": {6103, counter, [2]uint32{0xa3966791, 0xdf4ef328}},
+		"6105Counter": {6105, counter, [2]uint32{0xdf24f43e, 0x3f0e5b0a}},
+		"6106Counter": {6106, counter, [2]uint32{0x405f1b6e, 0x4e9e6da0}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			crc := n64CRC(tc.cic, ipl3, tc.data)
+			if crc != tc.crc {
+				t.Errorf("expected %#08x, got %#08x", tc.crc, crc)
+			}
+		})
+	}
+}
+
+func TestDetectCIC(t *testing.T) {
+	c, ok := detectCIC(n64IPL3)
+	if !ok || c != 6102 {
+		t.Errorf("expected 6102, got %v (known %v)", c, ok)
+	}
+	if _, ok := detectCIC(make([]byte, n64IPL3Len)); ok {
+		t.Error("expected unknown IPL3")
+	}
+}
+
+func TestHeader(t *testing.T) {
+	// Fields as found in commercial ROMs
+	tests := map[string]struct {
+		hdr   romHeader
+		title string
+		id    string
+		boot  uint32
+		ver   uint8
+	}{
+		"NTSC": {
+			romHeader{title: "SUPER MARIO 64", gameID: "NSME", clock: 0xf, boot: 0x80246000, cic: 6102},
+			"SUPER MARIO 64      ", "NSME", 0x80246000, 0,
+		},
+		"Region": {
+			romHeader{title: "ZELDA MAJORA'S MASK", gameID: "NZSE", region: "europe", version: 1, clock: 0xf, boot: 0x80080000, cic: 7105},
+			"ZELDA MAJORA'S MASK ", "NZSP", 0x80080000, 1,
+		},
+		"RegionCode": {
+			romHeader{title: "F-ZERO X", gameID: "CFZ ", region: "J", clock: 0xf, boot: 0x80000400, cic: 6106},
+			"F-ZERO X            ", "CFZJ", 0x80200400, 0,
+		},
+		"6103": {
+			romHeader{title: "PAPER MARIO", gameID: "NMQE", clock: 0xf, boot: 0x80000400, cic: 6103},
+			"PAPER MARIO         ", "NMQE", 0x80100400, 0,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var hdr [0x40]byte
+			if err := tc.hdr.write(&hdr); err != nil {
+				t.Fatal(err)
+			}
+			if title := string(hdr[0x20:0x34]); title != tc.title {
+				t.Errorf("expected title %q, got %q", tc.title, title)
+			}
+			if id := string(hdr[0x3b:0x3f]); id != tc.id {
+				t.Errorf("expected game code %q, got %q", tc.id, id)
+			}
+			if boot := binary.BigEndian.Uint32(hdr[0x08:]); boot != tc.boot {
+				t.Errorf("expected boot address %#x, got %#x", tc.boot, boot)
+			}
+			if clock := binary.BigEndian.Uint32(hdr[0x04:]); clock != 0xf {
+				t.Errorf("expected clock rate %#x, got %#x", 0xf, clock)
+			}
+			if hdr[0x3f] != tc.ver {
+				t.Errorf("expected version %d, got %d", tc.ver, hdr[0x3f])
+			}
+		})
+	}
+}
+
+func TestHeaderInvalid(t *testing.T) {
+	tests := map[string]romHeader{
+		"TitleLength": {title: "A TITLE LONGER THAN TWENTY", gameID: "N   "},
+		"TitleASCII":  {title: "café", gameID: "N   "},
+		"GameID":      {gameID: "NSM"},
+		"Region":      {gameID: "N   ", region: "atlantis"},
+		"Version":     {gameID: "N   ", version: 256},
+	}
+	for name, hdr := range tests {
+		t.Run(name, func(t *testing.T) {
+			var b [0x40]byte
+			if err := hdr.write(&b); !errors.Is(err, errHeaderField) {
+				t.Errorf("expected %v, got %v", errHeaderField, err)
+			}
+			if !bytes.Equal(b[:], make([]byte, 0x40)) {
+				t.Error("expected header to be unchanged")
+			}
+		})
+	}
+}
+
+func TestParseCIC(t *testing.T) {
+	if c, err := parseCIC("7102"); err != nil || c != 7102 {
+		t.Errorf("expected 7102, got %v, %v", c, err)
+	}
+	for _, s := range []string{"6104", "x", ""} {
+		if _, err := parseCIC(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
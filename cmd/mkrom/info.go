@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+)
+
+var errNotROM = errors.New("not an N64 ROM")
+
+// romInfo holds the header fields of a ROM and the results of checking it.
+type romInfo struct {
+	order    byteOrder
+	size     int
+	title    string
+	gameID   string
+	version  uint8
+	clock    uint32
+	boot     uint32 // as stored in the header
+	crc      [2]uint32
+	ipl3CRC  uint32
+	cic      cic  // detected from the IPL3, zero if unknown
+	crcCIC   cic  // CIC whose checksum matches the header, zero if none
+	checked  bool // ROM is large enough to compute the checksum
+	fsOffset uint32
+
+	compressed    bool
+	symbolsOffset uint32
+}
+
+// parseROM reads the header of a ROM in any byte order.  The ROM is converted
+// to z64 in place.
+func parseROM(rom []byte) (*romInfo, error) {
+	order, ok := n64DetectByteOrder(rom)
+	if !ok || len(rom) < 0x1000 || len(rom)%4 != 0 {
+		return nil, errNotROM
+	}
+	n64SwapBytes(rom, order)
+
+	info := &romInfo{
+		order:    order,
+		size:     len(rom),
+		title:    strings.TrimRight(string(rom[0x20:0x34]), " \x00"),
+		gameID:   string(rom[0x3b:0x3f]),
+		version:  rom[0x3f],
+		clock:    binary.BigEndian.Uint32(rom[0x04:]),
+		boot:     binary.BigEndian.Uint32(rom[0x08:]),
+		crc:      [2]uint32{binary.BigEndian.Uint32(rom[0x10:]), binary.BigEndian.Uint32(rom[0x14:])},
+		fsOffset: binary.BigEndian.Uint32(rom[0x18:]),
+
+		compressed:    rom[0x1f]&1 != 0,
+		symbolsOffset: binary.BigEndian.Uint32(rom[0x1c:]) &^ (n64DataAlign - 1),
+	}
+	ipl3 := rom[0x40:0x1000]
+	info.ipl3CRC = crc32.ChecksumIEEE(ipl3)
+	info.cic, _ = detectCIC(ipl3)
+
+	if len(rom) < 0x1000+n64ChecksumLen {
+		return info, nil
+	}
+	info.checked = true
+	candidates := []cic{info.cic}
+	if info.cic == 0 {
+		// Custom IPL3, try the checksums of all CICs
+		candidates = []cic{6102, 6103, 6105, 6106}
+	}
+	for _, c := range candidates {
+		if n64CRC(c, ipl3, rom[0x1000:0x1000+n64ChecksumLen]) == info.crc {
+			info.crcCIC = c
+			break
+		}
+	}
+	return info, nil
+}
+
+func (info *romInfo) print(w io.Writer) {
+	fmt.Fprintf(w, "byte order:   %s\n", info.order)
+	fmt.Fprintf(w, "size:         %d bytes\n", info.size)
+	fmt.Fprintf(w, "title:        %q\n", info.title)
+	fmt.Fprintf(w, "game code:    %q\n", info.gameID)
+	fmt.Fprintf(w, "version:      %d\n", info.version)
+	fmt.Fprintf(w, "clock rate:   %#08x\n", info.clock)
+	fmt.Fprintf(w, "boot address: %#08x", info.boot)
+	if off := cics[info.cic].bootOffset; off != 0 {
+		fmt.Fprintf(w, " (entry %#08x)", info.boot-off)
+	}
+	fmt.Fprintln(w)
+	if info.cic != 0 {
+		fmt.Fprintf(w, "CIC:          %d (IPL3 CRC-32 %#08x)\n", info.cic, info.ipl3CRC)
+	} else {
+		fmt.Fprintf(w, "CIC:          unknown (IPL3 CRC-32 %#08x)\n", info.ipl3CRC)
+	}
+	fmt.Fprintf(w, "checksum:     %#08x %#08x", info.crc[0], info.crc[1])
+	switch {
+	case !info.checked:
+		fmt.Fprintln(w, " (not checked, ROM too small)")
+	case info.crcCIC == 0:
+		fmt.Fprintln(w, " (invalid)")
+	case info.cic == 0:
+		fmt.Fprintf(w, " (valid for CIC %d)\n", info.crcCIC)
+	default:
+		fmt.Fprintln(w, " (valid)")
+	}
+	if info.compressed {
+		fmt.Fprintln(w, "compressed:   yes")
+	}
+	if info.fsOffset != 0 {
+		fmt.Fprintf(w, "filesystem:   %#x\n", info.fsOffset)
+	}
+	if info.symbolsOffset != 0 {
+		fmt.Fprintf(w, "symbols:      %#x\n", info.symbolsOffset)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func buildROM(t *testing.T, fsImage []byte) []byte {
+	t.Helper()
+	hdr := &romHeader{title: "TEST", gameID: "NTSE", version: 2, clock: 0xf, boot: 0x80000400, cic: 6102}
+	rom, err := n64BuildROM(hdr, bytes.NewBuffer(random(1000)), fsImage, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rom
+}
+
+func TestSwapBytes(t *testing.T) {
+	tests := map[string]struct {
+		order byteOrder
+		out   []byte
+	}{
+		"z64": {z64, []byte{0x80, 0x37, 0x12, 0x40, 1, 2, 3, 4}},
+		"v64": {v64, []byte{0x37, 0x80, 0x40, 0x12, 2, 1, 4, 3}},
+		"n64": {n64, []byte{0x40, 0x12, 0x37, 0x80, 4, 3, 2, 1}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rom := []byte{0x80, 0x37, 0x12, 0x40, 1, 2, 3, 4}
+			n64SwapBytes(rom, tc.order)
+			if !bytes.Equal(rom, tc.out) {
+				t.Fatalf("expected %x, got %x", tc.out, rom)
+			}
+			if order, ok := n64DetectByteOrder(rom); !ok || order != tc.order {
+				t.Errorf("expected %v, got %v (detected %v)", tc.order, order, ok)
+			}
+			n64SwapBytes(rom, tc.order)
+			if !bytes.Equal(rom[:4], []byte{0x80, 0x37, 0x12, 0x40}) {
+				t.Errorf("expected z64 after swapping back, got %x", rom)
+			}
+		})
+	}
+}
+
+func TestParseROM(t *testing.T) {
+	z64rom := buildROM(t, []byte("fs"))
+	invalid := bytes.Clone(z64rom)
+	invalid[0x2000]++
+
+	tests := map[string]struct {
+		rom   []byte
+		order byteOrder
+		valid bool
+	}{
+		"z64":     {bytes.Clone(z64rom), z64, true},
+		"v64":     {bytes.Clone(z64rom), v64, true},
+		"n64":     {bytes.Clone(z64rom), n64, true},
+		"Invalid": {invalid, z64, false},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rom := append(tc.rom, make([]byte, -len(tc.rom)&3)...)
+			n64SwapBytes(rom, tc.order)
+			info, err := parseROM(rom)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.order != tc.order {
+				t.Errorf("expected byte order %v, got %v", tc.order, info.order)
+			}
+			if info.title != "TEST" || info.gameID != "NTSE" || info.version != 2 ||
+				info.clock != 0xf || info.boot != 0x80000400 {
+				t.Errorf("unexpected header fields %+v", info)
+			}
+			if info.cic != 6102 || info.ipl3CRC != 0x90bb6cb5 {
+				t.Errorf("expected CIC 6102, got %d", info.cic)
+			}
+			if !info.checked || (info.crcCIC != 0) != tc.valid {
+				t.Errorf("expected valid checksum %v, got CIC %d", tc.valid, info.crcCIC)
+			}
+			if info.fsOffset == 0 || string(rom[info.fsOffset:][:2]) != "fs" {
+				t.Errorf("expected filesystem offset, got %#x", info.fsOffset)
+			}
+		})
+	}
+}
+
+func TestParseROMCustomIPL3(t *testing.T) {
+	rom := buildROM(t, nil)
+	// Changing the IPL3 doesn't change the checksum of the program
+	rom[0x40] ^= 0xff
+	info, err := parseROM(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.cic != 0 || info.crcCIC != 6102 {
+		t.Errorf("expected unknown CIC with 6102 checksum, got %d and %d", info.cic, info.crcCIC)
+	}
+}
+
+func TestParseROMInvalid(t *testing.T) {
+	tests := map[string][]byte{
+		"Empty":     nil,
+		"Magic":     make([]byte, 0x2000),
+		"Truncated": binary.BigEndian.AppendUint32(nil, 0x80371240),
+	}
+	for name, rom := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseROM(rom); err != errNotROM {
+				t.Errorf("expected %v, got %v", errNotROM, err)
+			}
+		})
+	}
+}
+
+func TestParseROMSymbols(t *testing.T) {
+	hdr := &romHeader{gameID: "N   ", boot: 0x80000400, cic: 6102, compressed: true}
+	rom, err := n64BuildROM(hdr, bytes.NewBuffer(random(1000)), []byte("fs"), []byte("N64S"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := parseROM(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.compressed {
+		t.Error("expected compressed flag")
+	}
+	if info.symbolsOffset <= info.fsOffset || string(rom[info.symbolsOffset:]) != "N64S" {
+		t.Errorf("expected symbol table after filesystem, got %#x", info.symbolsOffset)
+	}
+}
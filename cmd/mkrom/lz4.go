@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// LZ4 block format, see
+// https://github.com/lz4/lz4/blob/dev/doc/lz4_Block_format.md
+//
+// A block is a sequence of token, literal length, literals, match offset and
+// match length.  The token holds the lengths in its nibbles, lengths of 15 or
+// more continue in the following bytes.  The last sequence has literals only.
+const (
+	lz4MinMatch     = 4
+	lz4MaxOffset    = 0xffff
+	lz4LastLiterals = 5  // the block ends with at least this many literals
+	lz4MFLimit      = 12 // the last match starts at least this far from the end
+	lz4HashBits     = 16
+)
+
+var errLZ4Corrupt = errors.New("lz4: corrupt data")
+
+// lz4Compress compresses src greedily, using a hash table of the last
+// position of each 4 byte sequence.
+func lz4Compress(src []byte) []byte {
+	var table [1 << lz4HashBits]int32 // position + 1
+	dst := make([]byte, 0, len(src))
+	anchor := 0
+	for i := 0; i+lz4MFLimit <= len(src); {
+		seq := binary.LittleEndian.Uint32(src[i:])
+		h := seq * 2654435761 >> (32 - lz4HashBits)
+		cand := int(table[h]) - 1
+		table[h] = int32(i + 1)
+		if cand < 0 || i-cand > lz4MaxOffset || binary.LittleEndian.Uint32(src[cand:]) != seq {
+			i++
+			continue
+		}
+
+		n := lz4MinMatch
+		for i+n < len(src)-lz4LastLiterals && src[cand+n] == src[i+n] {
+			n++
+		}
+		dst = lz4AppendSequence(dst, src[anchor:i], i-cand, n)
+		i += n
+		anchor = i
+	}
+	return lz4AppendSequence(dst, src[anchor:], 0, 0)
+}
+
+// lz4AppendSequence appends literals followed by a match, or literals only if
+// matchLen is zero.
+func lz4AppendSequence(dst, literals []byte, offset, matchLen int) []byte {
+	token := byte(min(len(literals), 15)) << 4
+	if matchLen > 0 {
+		token |= byte(min(matchLen-lz4MinMatch, 15))
+	}
+	dst = append(dst, token)
+	dst = lz4AppendLength(dst, len(literals))
+	dst = append(dst, literals...)
+	if matchLen == 0 {
+		return dst
+	}
+	dst = append(dst, byte(offset), byte(offset>>8))
+	return lz4AppendLength(dst, matchLen-lz4MinMatch)
+}
+
+func lz4AppendLength(dst []byte, n int) []byte {
+	if n < 15 {
+		return dst
+	}
+	for n -= 15; n >= 255; n -= 255 {
+		dst = append(dst, 255)
+	}
+	return append(dst, byte(n))
+}
+
+// lz4Decompress decompresses src, which must decompress to size bytes.  It
+// works like the boot stage and is used to validate the compressed program.
+func lz4Decompress(src []byte, size int) ([]byte, error) {
+	dst := make([]byte, 0, size)
+	i := 0
+	readLength := func(n int) (int, error) {
+		if n < 15 {
+			return n, nil
+		}
+		for {
+			if i >= len(src) {
+				return 0, errLZ4Corrupt
+			}
+			b := src[i]
+			i++
+			n += int(b)
+			if b != 255 {
+				return n, nil
+			}
+		}
+	}
+
+	for i < len(src) {
+		token := src[i]
+		i++
+		lit, err := readLength(int(token >> 4))
+		if err != nil {
+			return nil, err
+		}
+		if lit > len(src)-i || len(dst)+lit > size {
+			return nil, errLZ4Corrupt
+		}
+		dst = append(dst, src[i:i+lit]...)
+		i += lit
+		if i == len(src) {
+			break
+		}
+
+		if i+2 > len(src) {
+			return nil, errLZ4Corrupt
+		}
+		offset := int(src[i]) | int(src[i+1])<<8
+		i += 2
+		n, err := readLength(int(token & 15))
+		if err != nil {
+			return nil, err
+		}
+		n += lz4MinMatch
+		if offset == 0 || offset > len(dst) || len(dst)+n > size {
+			return nil, errLZ4Corrupt
+		}
+		for range n {
+			dst = append(dst, dst[len(dst)-offset])
+		}
+	}
+	if len(dst) != size {
+		return nil, errLZ4Corrupt
+	}
+	return dst, nil
+}
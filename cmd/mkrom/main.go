@@ -5,21 +5,63 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+
+	"github.com/drpaneas/n64/drivers/romfs"
 )
 
 const usageString = `ELF to n64 ROM converter.
 
+With -fs, the files of a directory are appended to the ROM and can be read at
+runtime with romfs.Mount().
+
+The embedded IPL3 boot code is for the 6102 and 7101 CICs.  For other CICs,
+pass their boot code with -ipl3.  The CIC is detected from known boot code,
+otherwise -cic selects it.
+
+With -compress, the program is compressed with LZ4 and decompressed at boot
+by a stage loaded in place of the program.  This speeds up booting programs
+larger than the 1 MiB loaded by the IPL3.
+
+With -symbols, function names and lines are appended to the ROM, so machine
+can symbolize exception reports and tracebacks even in stripped builds.
+
+With -map, a report of the sections of the program, their ROM offsets and
+padding, and the largest packages and symbols is written as text or, if the
+file name ends with .json, as JSON.  The program must fit in the GOTEXT and,
+including .bss, GOMEM regions of the build.cfg next to the ELF file or passed
+with -cfg.
+
 Usage: %s [flags] <elffile>
+       %[1]s info <romfile>
+
+The info command prints the header of a ROM in z64, v64 or n64 byte order and
+checks its IPL3 and checksum.
 
 `
 
 var (
 	infile string
-	format = flag.String("format", "z64", "z64 | uf2")
+	format = flag.String("format", "z64", "z64 | v64 | n64 | uf2")
+	fsDir  = flag.String("fs", "", "directory to append as ROM filesystem")
+	lz4    = flag.Bool("compress", false, "compress the program, which is decompressed by a boot stage")
+	syms   = flag.Bool("symbols", false, "append a symbol table for symbolized exception and panic reports")
+	mapOut = flag.String("map", "", "write a memory map and size report to `file` (.json for JSON)")
+	cfg    = flag.String("cfg", "", "build.cfg with the GOTEXT and GOMEM budgets (default next to <elffile>, if any)")
+
+	title   = flag.String("title", "", "game title, up to 20 characters (default <elffile> name)")
+	gameID  = flag.String("id", "N   ", "game code: category, 2 character unique code, destination")
+	region  = flag.String("region", "", "destination code or region, e.g. E or usa, J or japan, P or europe")
+	version = flag.Uint("version", 0, "ROM version")
+	clock   = flag.Uint("clock", 0xf, "clock rate")
+	boot    = flag.Uint("boot", 0x80000400, "boot address")
+	cicType = flag.String("cic", "", "6101, 6102, 6103, 6105, 6106, 7101, 7102, 7103, 7105 or 7106 (default detected from IPL3)")
+	ipl3    = flag.String("ipl3", "", "file with the IPL3 boot code (ROM offset 0x40 to 0x1000)")
 )
 
 func usage() {
@@ -31,6 +73,15 @@ func main() {
 	flag.Usage = usage
 	flag.Parse()
 
+	if flag.NArg() == 2 && flag.Arg(0) == "info" {
+		info := must(parseROM(must(os.ReadFile(flag.Arg(1)))))
+		info.print(os.Stdout)
+		if info.checked && info.crcCIC == 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
 	if flag.NArg() == 1 {
 		infile = flag.Arg(0)
 	} else {
@@ -41,8 +92,63 @@ func main() {
 	outfile, _ := strings.CutSuffix(infile, ".elf")
 	outfile += "." + *format
 
-	obj := objcopy(infile)
-	n64WriteROMFile(outfile, *format, obj)
+	if *title == "" {
+		*title = strings.TrimSuffix(filepath.Base(infile), ".elf")
+		*title = (*title)[:min(len(*title), 20)]
+	}
+	hdr := &romHeader{
+		title:   *title,
+		gameID:  *gameID,
+		region:  *region,
+		version: *version,
+		clock:   *clock,
+		boot:    *boot,
+	}
+	if *ipl3 != "" {
+		n64IPL3 = must(os.ReadFile(*ipl3))
+		if len(n64IPL3) != n64IPL3Len {
+			fmt.Printf("%s: expected %d bytes of IPL3, got %d\n", *ipl3, n64IPL3Len, len(n64IPL3))
+			os.Exit(1)
+		}
+	}
+	detected, known := detectCIC(n64IPL3)
+	switch {
+	case *cicType != "":
+		hdr.cic = must(parseCIC(*cicType))
+		if known && cics[hdr.cic].ipl3CRC != cics[detected].ipl3CRC {
+			fmt.Printf("IPL3 is for CIC %d, not %d\n", detected, hdr.cic)
+			os.Exit(1)
+		}
+	case known:
+		hdr.cic = detected
+	default:
+		fmt.Println("unknown IPL3, select the CIC with -cic")
+		os.Exit(1)
+	}
+
+	obj, sections := objcopy(infile)
+	memMap := newROMMap(infile, sections, obj.Len())
+	must(0, memMap.setBudgets(must(readBuildCfg(*cfg, infile))))
+	if *lz4 {
+		stage, addr, err := compressProgram(obj.Bytes(), uint32(hdr.boot))
+		must(0, err)
+		obj, hdr.boot, hdr.compressed = bytes.NewBuffer(stage), uint(addr), true
+	}
+	var fsImage bytes.Buffer
+	if *fsDir != "" {
+		must(0, romfs.Write(&fsImage, os.DirFS(*fsDir)))
+	}
+	var symbolTable []byte
+	if *syms {
+		symbolTable = symbols(infile)
+	}
+	rom := must(n64BuildROM(hdr, obj, fsImage.Bytes(), symbolTable))
+	memMap.setROM(rom, hdr.compressed)
+	if *mapOut != "" {
+		must(0, memMap.write(*mapOut))
+	}
+	must(0, memMap.checkBudgets())
+	n64WriteROMFile(outfile, *format, rom)
 }
 
 func must[T any](ret T, err error) T {
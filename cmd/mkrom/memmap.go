@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// mapTop is the number of largest packages and symbols in the report.
+const mapTop = 20
+
+// romMap is the memory map and size report of a ROM, written by -map.
+type romMap struct {
+	Sections      []mapSection `json:"sections"`
+	ProgramSize   int          `json:"programSize"` // uncompressed program image
+	Compressed    bool         `json:"compressed"`
+	ROMSize       int          `json:"romSize"`
+	FSOffset      uint32       `json:"fsOffset,omitempty"`
+	SymbolsOffset uint32       `json:"symbolsOffset,omitempty"`
+	TextEnd       uint64       `json:"textEnd"` // end address of the program image
+	RAMEnd        uint64       `json:"ramEnd"`  // end address of all allocated sections
+	Budgets       []mapBudget  `json:"budgets,omitempty"`
+	Packages      []mapSize    `json:"packages"`
+	Symbols       []mapSize    `json:"symbols"`
+}
+
+// mapSection is an allocated section of the program.  ROMOffset is -1 for
+// sections that aren't loaded from the ROM, like .bss, and for all sections
+// of a compressed program.
+type mapSection struct {
+	Name      string `json:"name"`
+	Addr      uint64 `json:"addr"`
+	ROMOffset int64  `json:"romOffset"`
+	Size      uint64 `json:"size"`
+	Padding   int    `json:"padding"` // inserted after the section
+}
+
+type mapSize struct {
+	Name string `json:"name"`
+	Size uint64 `json:"size"`
+}
+
+// mapBudget is a memory region of build.cfg and how much of it the program
+// uses.
+type mapBudget struct {
+	Name string `json:"name"`
+	Base uint64 `json:"base"`
+	Size uint64 `json:"size"`
+	Used uint64 `json:"used"`
+}
+
+// newROMMap returns the map of an ELF file, whose loadable sections were
+// copied to an image of imageSize bytes by objcopy.
+func newROMMap(elfFile string, sections []*section, imageSize int) *romMap {
+	f := must(elf.Open(elfFile))
+	defer f.Close()
+
+	m := &romMap{ProgramSize: imageSize}
+	for _, s := range sections {
+		m.Sections = append(m.Sections, mapSection{
+			Name:      s.name,
+			Addr:      s.addr,
+			ROMOffset: 0x1000 + s.offset,
+			Size:      uint64(len(s.data)),
+			Padding:   s.pad,
+		})
+	}
+	if len(sections) > 0 {
+		m.TextEnd = sections[0].addr + uint64(imageSize)
+		m.RAMEnd = m.TextEnd
+	}
+	for _, s := range f.Sections {
+		if s.Flags&elf.SHF_ALLOC == 0 || s.Size == 0 {
+			continue
+		}
+		m.RAMEnd = max(m.RAMEnd, s.Addr+s.Size)
+		if s.Type != elf.SHT_PROGBITS {
+			m.Sections = append(m.Sections, mapSection{Name: s.Name, Addr: s.Addr, ROMOffset: -1, Size: s.Size})
+		}
+	}
+	slices.SortStableFunc(m.Sections, func(a, b mapSection) int { return cmp.Compare(a.Addr, b.Addr) })
+
+	var syms []elf.Symbol
+	for _, s := range must(f.Symbols()) {
+		t := elf.ST_TYPE(s.Info)
+		if (t == elf.STT_FUNC || t == elf.STT_OBJECT) && s.Size > 0 &&
+			int(s.Section) < len(f.Sections) && f.Sections[s.Section].Flags&elf.SHF_ALLOC != 0 {
+			syms = append(syms, s)
+		}
+	}
+	m.Packages, m.Symbols = largest(syms)
+	return m
+}
+
+// largest returns the mapTop largest packages and symbols.
+func largest(syms []elf.Symbol) (pkgs, symbols []mapSize) {
+	sizes := make(map[string]uint64)
+	for _, s := range syms {
+		symbols = append(symbols, mapSize{s.Name, s.Size})
+		sizes[symbolPackage(s.Name)] += s.Size
+	}
+	for name, size := range sizes {
+		pkgs = append(pkgs, mapSize{name, size})
+	}
+	bySize := func(a, b mapSize) int {
+		return cmp.Or(cmp.Compare(b.Size, a.Size), cmp.Compare(a.Name, b.Name))
+	}
+	slices.SortFunc(pkgs, bySize)
+	slices.SortFunc(symbols, bySize)
+	return pkgs[:min(len(pkgs), mapTop)], symbols[:min(len(symbols), mapTop)]
+}
+
+// symbolPackage returns the package of a Go symbol, e.g. "fmt" for
+// "fmt.(*pp).printArg".  Linker generated symbols like "type:int" are grouped
+// by their prefix and symbols without a package, like those of assembly
+// files, by an empty name.
+func symbolPackage(name string) string {
+	if i := strings.IndexByte(name, ':'); i > 0 && !strings.ContainsAny(name[:i], "./") {
+		return name[:i+1]
+	}
+	name, _, _ = strings.Cut(name, "[") // type arguments
+	slash := strings.LastIndexByte(name, '/') + 1
+	if dot := strings.IndexByte(name[slash:], '.'); dot > 0 {
+		return name[:slash+dot]
+	}
+	return ""
+}
+
+// setROM adds the layout of the built ROM to the map.
+func (m *romMap) setROM(rom []byte, compressed bool) {
+	m.ROMSize = len(rom)
+	m.Compressed = compressed
+	m.FSOffset = binary.BigEndian.Uint32(rom[0x18:])
+	m.SymbolsOffset = binary.BigEndian.Uint32(rom[0x1c:]) &^ (n64DataAlign - 1)
+	if compressed {
+		for i := range m.Sections {
+			m.Sections[i].ROMOffset = -1
+		}
+	}
+}
+
+var errBudget = errors.New("memory budget exceeded")
+
+// setBudgets adds the GOTEXT and GOMEM regions of a build.cfg to the map.
+// GOTEXT limits the program image and GOMEM all allocated sections,
+// including .bss.
+func (m *romMap) setBudgets(cfg map[string]string) error {
+	for _, b := range []struct {
+		name string
+		end  uint64
+	}{{"GOTEXT", m.TextEnd}, {"GOMEM", m.RAMEnd}} {
+		v, ok := cfg[b.name]
+		if !ok {
+			continue
+		}
+		base, size, err := parseRegion(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", b.name, err)
+		}
+		if b.end < base {
+			return fmt.Errorf("%w: program ends at %#x, before %s at %#x", errBudget, b.end, b.name, base)
+		}
+		m.Budgets = append(m.Budgets, mapBudget{b.name, base, size, b.end - base})
+	}
+	return nil
+}
+
+// checkBudgets returns an error if the program doesn't fit in a region of
+// build.cfg.
+func (m *romMap) checkBudgets() error {
+	for _, b := range m.Budgets {
+		if b.Used > b.Size {
+			return fmt.Errorf("%w: %s uses %d bytes of %d", errBudget, b.Name, b.Used, b.Size)
+		}
+	}
+	return nil
+}
+
+// write writes the map as text or, if name ends with .json, as JSON.
+func (m *romMap) write(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if filepath.Ext(name) == ".json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		err = enc.Encode(m)
+	} else {
+		m.print(w)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+func (m *romMap) print(w io.Writer) {
+	fmt.Fprintf(w, "ROM size:     %d bytes\n", m.ROMSize)
+	fmt.Fprintf(w, "program:      %d bytes", m.ProgramSize)
+	if m.Compressed {
+		fmt.Fprint(w, " (compressed)")
+	}
+	fmt.Fprintln(w)
+	if m.FSOffset != 0 {
+		fmt.Fprintf(w, "filesystem:   %#x\n", m.FSOffset)
+	}
+	if m.SymbolsOffset != 0 {
+		fmt.Fprintf(w, "symbols:      %#x\n", m.SymbolsOffset)
+	}
+	for _, b := range m.Budgets {
+		fmt.Fprintf(w, "%-14s%d of %d bytes (%d%%)\n", b.Name+":", b.Used, b.Size, b.Used*100/max(b.Size, 1))
+	}
+
+	fmt.Fprintf(w, "\n%-20s %10s %10s %10s %10s\n", "section", "address", "offset", "size", "padding")
+	for _, s := range m.Sections {
+		off := "-"
+		if s.ROMOffset >= 0 {
+			off = fmt.Sprintf("%#x", s.ROMOffset)
+		}
+		fmt.Fprintf(w, "%-20s %#10x %10s %10d %10d\n", s.Name, s.Addr, off, s.Size, s.Padding)
+	}
+
+	fmt.Fprintf(w, "\n%10s  %s\n", "size", "package")
+	for _, p := range m.Packages {
+		name := p.Name
+		if name == "" {
+			name = "(none)"
+		}
+		fmt.Fprintf(w, "%10d  %s\n", p.Size, name)
+	}
+	fmt.Fprintf(w, "\n%10s  %s\n", "size", "symbol")
+	for _, s := range m.Symbols {
+		fmt.Fprintf(w, "%10d  %s\n", s.Size, s.Name)
+	}
+}
+
+// readBuildCfg returns the variables of a build.cfg file.  If name is empty,
+// the build.cfg next to the ELF file is read, if any.
+func readBuildCfg(name, elfFile string) (map[string]string, error) {
+	if name == "" {
+		name = filepath.Join(filepath.Dir(elfFile), "build.cfg")
+		if _, err := os.Stat(name); errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseBuildCfg(f)
+}
+
+// parseBuildCfg parses lines of KEY = value.  Lines starting with # are
+// comments.
+func parseBuildCfg(r io.Reader) (map[string]string, error) {
+	cfg := make(map[string]string)
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		key, val, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("build.cfg:%d: expected KEY = value", n)
+		}
+		val = strings.TrimSpace(val)
+		if v, err := strconv.Unquote(val); err == nil {
+			val = v
+		}
+		cfg[strings.TrimSpace(key)] = val
+	}
+	return cfg, s.Err()
+}
+
+// parseRegion parses a memory region of build.cfg: base:size, where size may
+// have a K or M suffix.
+func parseRegion(s string) (base, size uint64, err error) {
+	b, sz, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid region %q", s)
+	}
+	shift := 0
+	switch {
+	case strings.HasSuffix(sz, "K"):
+		shift = 10
+	case strings.HasSuffix(sz, "M"):
+		shift = 20
+	}
+	if shift != 0 {
+		sz = sz[:len(sz)-1]
+	}
+	base, err = strconv.ParseUint(strings.TrimSpace(b), 0, 64)
+	if err == nil {
+		size, err = strconv.ParseUint(strings.TrimSpace(sz), 0, 64)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid region %q", s)
+	}
+	return base, size << shift, nil
+}
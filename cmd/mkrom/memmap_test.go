@@ -0,0 +1,119 @@
+package main
+
+import (
+	"debug/elf"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSymbolPackage(t *testing.T) {
+	tests := map[string]string{
+		"main.main":                          "main",
+		"fmt.(*pp).printArg":                 "fmt",
+		"github.com/drpaneas/n64/rcp/vi.Set": "github.com/drpaneas/n64/rcp/vi",
+		"example.com/a.b/c.(*T).M":           "example.com/a.b/c",
+		"slices.Sort[go.shape.[]uint8]":      "slices",
+		"type:*github.com/x/y.T":             "type:",
+		"go:func.*":                          "go:",
+		"_rt0_mips64_noos":                   "",
+	}
+	for name, pkg := range tests {
+		if got := symbolPackage(name); got != pkg {
+			t.Errorf("%s: expected %q, got %q", name, pkg, got)
+		}
+	}
+}
+
+func TestLargest(t *testing.T) {
+	var syms []elf.Symbol
+	for i := range mapTop + 5 {
+		syms = append(syms, elf.Symbol{Name: "a.f" + string(rune('A'+i)), Size: uint64(i + 1)})
+	}
+	syms = append(syms, elf.Symbol{Name: "b.g", Size: 100}, elf.Symbol{Name: "b.h", Size: 400})
+
+	pkgs, symbols := largest(syms)
+	if len(pkgs) != 2 || pkgs[0] != (mapSize{"b", 500}) || pkgs[1] != (mapSize{"a", 325}) {
+		t.Errorf("unexpected packages %v", pkgs)
+	}
+	if len(symbols) != mapTop || symbols[0].Name != "b.h" || symbols[2].Size != 25 {
+		t.Errorf("unexpected symbols %v", symbols)
+	}
+}
+
+func TestParseRegion(t *testing.T) {
+	tests := map[string]struct {
+		in         string
+		base, size uint64
+		ok         bool
+	}{
+		"Mega":     {"0x00000000:8M", 0, 8 << 20, true},
+		"Kilo":     {"0x400:512K", 0x400, 512 << 10, true},
+		"Bytes":    {"0x80000400 : 0x1000", 0x80000400, 0x1000, true},
+		"NoSize":   {"0x400", 0, 0, false},
+		"BadSize":  {"0x400:8X", 0, 0, false},
+		"BadBase":  {"base:8M", 0, 0, false},
+		"NoSuffix": {"0x400:M", 0, 0, false},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			base, size, err := parseRegion(tc.in)
+			if (err == nil) != tc.ok {
+				t.Fatalf("expected ok %v, got %v", tc.ok, err)
+			}
+			if base != tc.base || size != tc.size {
+				t.Errorf("expected %#x:%#x, got %#x:%#x", tc.base, tc.size, base, size)
+			}
+		})
+	}
+}
+
+func TestParseBuildCfg(t *testing.T) {
+	cfg, err := parseBuildCfg(strings.NewReader(`GOTARGET = n64
+GOMEM = 0x00000000:8M
+#ISRNAMES = "github.com/drpaneas/n64/hal/irq"
+
+GOTEXT="0x00000400:4M"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg) != 3 || cfg["GOTARGET"] != "n64" || cfg["GOMEM"] != "0x00000000:8M" || cfg["GOTEXT"] != "0x00000400:4M" {
+		t.Errorf("unexpected config %q", cfg)
+	}
+	if _, err := parseBuildCfg(strings.NewReader("GOMEM 8M\n")); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestBudgets(t *testing.T) {
+	cfg := map[string]string{"GOTEXT": "0x400:1M", "GOMEM": "0x0:2M"}
+	tests := map[string]struct {
+		cfg             map[string]string
+		textEnd, ramEnd uint64
+		err             error
+	}{
+		"Fits":     {cfg, 0x400 + 1<<20, 2 << 20, nil},
+		"Text":     {cfg, 0x401 + 1<<20, 0x401 + 1<<20, errBudget},
+		"RAM":      {cfg, 0x1000, 2<<20 + 1, errBudget},
+		"NoBudget": {nil, 16 << 20, 16 << 20, nil},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := &romMap{TextEnd: tc.textEnd, RAMEnd: tc.ramEnd}
+			if err := m.setBudgets(tc.cfg); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.checkBudgets(); !errors.Is(err, tc.err) {
+				t.Errorf("expected %v, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestBudgetBelowRegion(t *testing.T) {
+	m := &romMap{TextEnd: 0x200, RAMEnd: 0x200}
+	if err := m.setBudgets(map[string]string{"GOTEXT": "0x400:1M"}); !errors.Is(err, errBudget) {
+		t.Errorf("expected %v, got %v", errBudget, err)
+	}
+}
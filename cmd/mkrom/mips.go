@@ -0,0 +1,106 @@
+package main
+
+import "encoding/binary"
+
+// mipsAsm assembles the few MIPS instructions needed by the boot stage.
+// Branches refer to labels, which are resolved by link.
+type mipsAsm struct {
+	code     []uint32
+	labels   []int       // instruction index of each label
+	branches map[int]int // instruction index to label
+}
+
+type mipsReg uint32
+
+// Registers named after the o32 ABI
+const (
+	regZero mipsReg = 0
+	regA0   mipsReg = 4
+	regA1   mipsReg = 5
+	regA2   mipsReg = 6
+	regA3   mipsReg = 7
+	regT0   mipsReg = 8
+	regT1   mipsReg = 9
+	regT2   mipsReg = 10
+	regT3   mipsReg = 11
+	regT4   mipsReg = 12
+	regT8   mipsReg = 24
+	regT9   mipsReg = 25
+)
+
+func (a *mipsAsm) newLabel() int {
+	a.labels = append(a.labels, -1)
+	return len(a.labels) - 1
+}
+
+func (a *mipsAsm) bind(label int) {
+	a.labels[label] = len(a.code)
+}
+
+func (a *mipsAsm) immediate(op uint32, rs, rt mipsReg, imm uint16) {
+	a.code = append(a.code, op<<26|uint32(rs)<<21|uint32(rt)<<16|uint32(imm))
+}
+
+func (a *mipsAsm) special(rs, rt, rd mipsReg, sa, funct uint32) {
+	a.code = append(a.code, uint32(rs)<<21|uint32(rt)<<16|uint32(rd)<<11|sa<<6|funct)
+}
+
+func (a *mipsAsm) branch(op uint32, rs, rt mipsReg, label int) {
+	if a.branches == nil {
+		a.branches = make(map[int]int)
+	}
+	a.branches[len(a.code)] = label
+	a.immediate(op, rs, rt, 0)
+}
+
+// link resolves the branches and returns the big endian machine code.
+func (a *mipsAsm) link() []byte {
+	for i, label := range a.branches {
+		a.code[i] |= uint32(uint16(a.labels[label] - i - 1))
+	}
+	b := make([]byte, 0, 4*len(a.code))
+	for _, instr := range a.code {
+		b = binary.BigEndian.AppendUint32(b, instr)
+	}
+	return b
+}
+
+func (a *mipsAsm) nop()                                    { a.code = append(a.code, 0) }
+func (a *mipsAsm) lui(rt mipsReg, imm uint16)              { a.immediate(0x0f, 0, rt, imm) }
+func (a *mipsAsm) ori(rt, rs mipsReg, imm uint16)          { a.immediate(0x0d, rs, rt, imm) }
+func (a *mipsAsm) andi(rt, rs mipsReg, imm uint16)         { a.immediate(0x0c, rs, rt, imm) }
+func (a *mipsAsm) addiu(rt, rs mipsReg, imm int16)         { a.immediate(0x09, rs, rt, uint16(imm)) }
+func (a *mipsAsm) lbu(rt mipsReg, off int16, base mipsReg) { a.immediate(0x24, base, rt, uint16(off)) }
+func (a *mipsAsm) sb(rt mipsReg, off int16, base mipsReg)  { a.immediate(0x28, base, rt, uint16(off)) }
+func (a *mipsAsm) lw(rt mipsReg, off int16, base mipsReg)  { a.immediate(0x23, base, rt, uint16(off)) }
+func (a *mipsAsm) sw(rt mipsReg, off int16, base mipsReg)  { a.immediate(0x2b, base, rt, uint16(off)) }
+func (a *mipsAsm) cache(op uint32, off int16, base mipsReg) {
+	a.immediate(0x2f, base, mipsReg(op), uint16(off))
+}
+func (a *mipsAsm) beq(rs, rt mipsReg, label int) { a.branch(0x04, rs, rt, label) }
+func (a *mipsAsm) bne(rs, rt mipsReg, label int) { a.branch(0x05, rs, rt, label) }
+func (a *mipsAsm) sll(rd, rt mipsReg, sa uint32) { a.special(0, rt, rd, sa, 0x00) }
+func (a *mipsAsm) srl(rd, rt mipsReg, sa uint32) { a.special(0, rt, rd, sa, 0x02) }
+func (a *mipsAsm) jr(rs mipsReg)                 { a.special(rs, 0, 0, 0, 0x08) }
+func (a *mipsAsm) addu(rd, rs, rt mipsReg)       { a.special(rs, rt, rd, 0, 0x21) }
+func (a *mipsAsm) subu(rd, rs, rt mipsReg)       { a.special(rs, rt, rd, 0, 0x23) }
+func (a *mipsAsm) or(rd, rs, rt mipsReg)         { a.special(rs, rt, rd, 0, 0x25) }
+func (a *mipsAsm) sltu(rd, rs, rt mipsReg)       { a.special(rs, rt, rd, 0, 0x2b) }
+
+// li loads a 32-bit constant, always with two instructions.
+func (a *mipsAsm) li(rt mipsReg, v uint32) {
+	a.lui(rt, uint16(v>>16))
+	a.ori(rt, rt, uint16(v))
+}
+
+// cacheAll applies a cache index operation to all lines of a cache.
+func (a *mipsAsm) cacheAll(op uint32, size, line int16) {
+	loop := a.newLabel()
+	a.lui(regT0, 0x8000)
+	a.addiu(regT1, regT0, size)
+	a.bind(loop)
+	a.cache(op, 0, regT0)
+	a.addiu(regT0, regT0, line)
+	a.bne(regT0, regT1, loop)
+	a.nop()
+}
@@ -15,9 +15,11 @@ import (
 var ones []byte
 
 type section struct {
+	name   string
 	addr   uint64
 	offset int64
 	data   []byte
+	pad    int // bytes of padding inserted after the section
 }
 
 func padBytes(cache *[]byte, n int, b byte) []byte {
@@ -30,7 +32,9 @@ func padBytes(cache *[]byte, n int, b byte) []byte {
 	return (*cache)[:n]
 }
 
-func objcopy(elfFile string) *bytes.Buffer {
+// objcopy returns the image of the loadable sections of an ELF file and the
+// sections in the order of the image.
+func objcopy(elfFile string) (*bytes.Buffer, []*section) {
 	r := must(os.Open(elfFile))
 	defer r.Close()
 	f := must(elf.NewFile(r))
@@ -47,10 +51,10 @@ func objcopy(elfFile string) *bytes.Buffer {
 			continue
 		}
 		data := must(s.Data())
-		sections = append(sections, &section{s.Addr, int64(s.Offset), data})
+		sections = append(sections, &section{name: s.Name, addr: s.Addr, offset: int64(s.Offset), data: data})
 	}
 	if len(sections) == 0 {
-		return bytes.NewBuffer([]byte(""))
+		return bytes.NewBuffer([]byte("")), nil
 	}
 	sort.Slice(
 		sections,
@@ -67,15 +71,14 @@ func objcopy(elfFile string) *bytes.Buffer {
 	w := bytes.NewBuffer(make([]byte, 0, n64ChecksumLen))
 	for i, s := range sections {
 		must(w.Write(s.data))
-		pad := 0
 		if i+1 < len(sections) {
-			pad = int(sections[i+1].offset-s.offset) - len(s.data)
+			s.pad = int(sections[i+1].offset-s.offset) - len(s.data)
 		}
-		if pad == 0 {
+		if s.pad == 0 {
 			continue
 		}
-		must(w.Write(padBytes(&ones, pad, 0xff)))
+		must(w.Write(padBytes(&ones, s.pad, 0xff)))
 	}
 
-	return w
+	return w, sections
 }
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Compressed programs are prepended by a boot stage, which the IPL3 loads
+// instead of the program.  The stage is placed right after the program's
+// location in RDRAM.  It loads the rest of the compressed program if it
+// exceeds the 1 MiB loaded by the IPL3, decompresses it to the program's
+// boot address and jumps there.
+//
+//	ROM 0x1000   stage | compressed program
+//	RAM boot     program (decompressed)     | stage | compressed program
+const (
+	n64RAMEnd = 0x8040_0000 // 4 MiB, without Expansion Pak
+
+	dcacheSize, dcacheLine = 0x2000, 16
+	icacheSize, icacheLine = 0x4000, 32
+
+	cacheIndexInvalidateI          = 0x00
+	cacheIndexWritebackInvalidateD = 0x01
+)
+
+var errProgramSize = errors.New("compressed program doesn't fit into RAM")
+
+// compressProgram returns the boot stage followed by the compressed program
+// and the address the stage must be loaded to.
+func compressProgram(prog []byte, boot uint32) ([]byte, uint32, error) {
+	comp := lz4Compress(prog)
+	if out, err := lz4Decompress(comp, len(prog)); err != nil || !bytes.Equal(out, prog) {
+		return nil, 0, fmt.Errorf("compressed program failed validation: %v", err)
+	}
+
+	p := stageParams{
+		addr:  (boot + uint32(len(prog)) + 15) &^ 15,
+		entry: boot,
+		size:  uint32(len(comp)),
+	}
+	// The length of the stage doesn't depend on the values it loads, so the
+	// first pass determines the offset of the compressed program.  The DMA
+	// is only needed if the stage and program exceed what the IPL3 loads.
+	p.dma = len(p.assemble())+len(comp) > n64ChecksumLen
+	p.offset = uint32(len(p.assemble()))
+	stage := p.assemble()
+
+	end := uint64(p.addr) + uint64(max(len(stage)+len(comp), n64ChecksumLen))
+	if end > n64RAMEnd {
+		return nil, 0, errProgramSize
+	}
+	return append(stage, comp...), p.addr, nil
+}
+
+type stageParams struct {
+	addr   uint32 // load address of the stage
+	entry  uint32 // boot address of the program
+	size   uint32 // size of the compressed program
+	offset uint32 // offset of the compressed program from the stage
+	dma    bool   // load the part not loaded by the IPL3
+}
+
+// assemble returns the machine code of the stage.
+func (p *stageParams) assemble() []byte {
+	var a mipsAsm
+	// Stale lines must not cover the compressed program, when it is read
+	// after the DMA.
+	a.cacheAll(cacheIndexWritebackInvalidateD, dcacheSize, dcacheLine)
+
+	if p.dma {
+		a.li(regT0, 0xa460_0000) // PI registers
+		a.li(regT1, p.addr&0x1fff_ffff+n64ChecksumLen)
+		a.sw(regT1, 0x00, regT0) // PI_DRAM_ADDR
+		a.li(regT1, 0x1000_1000+n64ChecksumLen)
+		a.sw(regT1, 0x04, regT0) // PI_CART_ADDR
+		a.li(regT1, p.offset+p.size-n64ChecksumLen-1)
+		a.sw(regT1, 0x0c, regT0) // PI_WR_LEN
+		wait := a.newLabel()
+		a.bind(wait)
+		a.lw(regT1, 0x10, regT0) // PI_STATUS
+		a.andi(regT1, regT1, 3)  // DMA or IO busy
+		a.bne(regT1, regZero, wait)
+		a.nop()
+	}
+
+	src := p.addr + p.offset
+	a.li(regA0, src)
+	a.li(regA1, src+p.size)
+	a.li(regA2, p.entry)
+	a.li(regA3, p.entry)
+	a.addiu(regT8, regZero, 0xff)
+	a.addiu(regT9, regZero, 15)
+
+	sequence, literals, match, matchCopy, done := a.newLabel(), a.newLabel(), a.newLabel(), a.newLabel(), a.newLabel()
+	a.bind(sequence)
+	a.lbu(regT0, 0, regA0) // token
+	a.addiu(regA0, regA0, 1)
+	a.srl(regT1, regT0, 4)
+	stageLength(&a, regT1)
+	a.beq(regT1, regZero, match)
+	a.nop()
+	a.bind(literals)
+	a.lbu(regT2, 0, regA0)
+	a.addiu(regA0, regA0, 1)
+	a.addiu(regT1, regT1, -1)
+	a.sb(regT2, 0, regA2)
+	a.bne(regT1, regZero, literals)
+	a.addiu(regA2, regA2, 1)
+
+	a.bind(match)
+	a.sltu(regT2, regA0, regA1)
+	a.beq(regT2, regZero, done) // the last sequence has no match
+	a.nop()
+	a.lbu(regT2, 0, regA0) // little endian offset
+	a.lbu(regT3, 1, regA0)
+	a.addiu(regA0, regA0, 2)
+	a.sll(regT3, regT3, 8)
+	a.or(regT2, regT2, regT3)
+	a.subu(regT4, regA2, regT2)
+	a.andi(regT1, regT0, 15)
+	stageLength(&a, regT1)
+	a.addiu(regT1, regT1, lz4MinMatch)
+	a.bind(matchCopy)
+	a.lbu(regT2, 0, regT4)
+	a.addiu(regT4, regT4, 1)
+	a.addiu(regT1, regT1, -1)
+	a.sb(regT2, 0, regA2)
+	a.bne(regT1, regZero, matchCopy)
+	a.addiu(regA2, regA2, 1)
+	a.beq(regZero, regZero, sequence)
+	a.nop()
+
+	a.bind(done)
+	a.cacheAll(cacheIndexWritebackInvalidateD, dcacheSize, dcacheLine)
+	a.cacheAll(cacheIndexInvalidateI, icacheSize, icacheLine)
+	a.jr(regA3)
+	a.nop()
+	return a.link()
+}
+
+// length adds the extension bytes of an LZ4 length to n, if its nibble is
+// 15.  It expects 15 in t9 and 255 in t8, and reads the bytes from a0.
+func stageLength(a *mipsAsm, n mipsReg) {
+	end, loop := a.newLabel(), a.newLabel()
+	a.bne(n, regT9, end)
+	a.nop()
+	a.bind(loop)
+	a.lbu(regT2, 0, regA0)
+	a.addiu(regA0, regA0, 1)
+	a.beq(regT2, regT8, loop)
+	a.addu(n, n, regT2) // delay slot
+	a.bind(end)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// mipsSim interprets the instructions used by the boot stage, with 4 MiB of
+// RDRAM and a PI, whose DMA completes immediately.
+type mipsSim struct {
+	gpr   [32]uint32
+	pc    uint32
+	rdram []byte
+	rom   []byte
+	pi    [4]uint32 // DRAM_ADDR, CART_ADDR, RD_LEN, WR_LEN
+}
+
+var errSimUnsupported = errors.New("unsupported instruction")
+
+func (s *mipsSim) mem(addr uint32, n int) []byte {
+	phys := addr & 0x1fff_ffff
+	if int(phys)+n > len(s.rdram) {
+		panic(fmt.Sprintf("access outside of RDRAM at %#x", addr))
+	}
+	return s.rdram[phys : int(phys)+n]
+}
+
+func (s *mipsSim) store32(addr, v uint32) {
+	if phys := addr & 0x1fff_ffff; phys&^0xff == 0x0460_0000 {
+		s.pi[phys>>2&3] = v
+		if phys == 0x0460_000c {
+			dram, cart := s.pi[0]&0x00ff_ffff, s.pi[1]-0x1000_0000
+			copy(s.rdram[dram:], s.rom[cart:][:v+1])
+		}
+		return
+	}
+	binary.BigEndian.PutUint32(s.mem(addr, 4), v)
+}
+
+func (s *mipsSim) load32(addr uint32) uint32 {
+	if phys := addr & 0x1fff_ffff; phys&^0xff == 0x0460_0000 {
+		return 0 // PI_STATUS not busy
+	}
+	return binary.BigEndian.Uint32(s.mem(addr, 4))
+}
+
+// run executes instructions until the PC reaches stop.
+func (s *mipsSim) run(stop uint32, maxSteps int) error {
+	next := s.pc + 4
+	for range maxSteps {
+		if s.pc == stop {
+			return nil
+		}
+		instr := s.load32(s.pc)
+		s.pc, next = next, next+4
+
+		op, rs, rt := instr>>26, instr>>21&31, instr>>16&31
+		rd, sa, imm := instr>>11&31, instr>>6&31, instr&0xffff
+		simm := uint32(int32(int16(imm)))
+		addr := s.gpr[rs] + simm
+		branch := func(taken bool) {
+			if taken {
+				next = s.pc + simm<<2
+			}
+		}
+		switch op {
+		case 0x00:
+			switch instr & 0x3f {
+			case 0x00:
+				s.gpr[rd] = s.gpr[rt] << sa
+			case 0x02:
+				s.gpr[rd] = s.gpr[rt] >> sa
+			case 0x08:
+				next = s.gpr[rs]
+			case 0x21:
+				s.gpr[rd] = s.gpr[rs] + s.gpr[rt]
+			case 0x23:
+				s.gpr[rd] = s.gpr[rs] - s.gpr[rt]
+			case 0x25:
+				s.gpr[rd] = s.gpr[rs] | s.gpr[rt]
+			case 0x2b:
+				s.gpr[rd] = 0
+				if s.gpr[rs] < s.gpr[rt] {
+					s.gpr[rd] = 1
+				}
+			default:
+				return fmt.Errorf("%w %#08x", errSimUnsupported, instr)
+			}
+		case 0x04:
+			branch(s.gpr[rs] == s.gpr[rt])
+		case 0x05:
+			branch(s.gpr[rs] != s.gpr[rt])
+		case 0x09:
+			s.gpr[rt] = s.gpr[rs] + simm
+		case 0x0c:
+			s.gpr[rt] = s.gpr[rs] & imm
+		case 0x0d:
+			s.gpr[rt] = s.gpr[rs] | imm
+		case 0x0f:
+			s.gpr[rt] = imm << 16
+		case 0x23:
+			s.gpr[rt] = s.load32(addr)
+		case 0x24:
+			s.gpr[rt] = uint32(s.mem(addr, 1)[0])
+		case 0x28:
+			s.mem(addr, 1)[0] = uint8(s.gpr[rt])
+		case 0x2b:
+			s.store32(addr, s.gpr[rt])
+		case 0x2f:
+			// cache operations have no effect on the simulated memory
+		default:
+			return fmt.Errorf("%w %#08x", errSimUnsupported, instr)
+		}
+		s.gpr[0] = 0
+	}
+	return errors.New("step limit exceeded")
+}
+
+func TestLZ4(t *testing.T) {
+	tests := map[string]struct {
+		data    []byte
+		maxSize int
+	}{
+		"Empty":    {[]byte{}, 1},
+		"Short":    {[]byte("hello"), 6},
+		"Repeated": {bytes.Repeat([]byte("abcd"), 1000), 30},
+		"Zeros":    {make([]byte, 70000), 300},
+		"Random":   {random(5000), 5030},
+		"Overlap":  {append(random(65535), random(1000)...), 65535 + 300},
+		"Mixed":    {append(append(random(300), make([]byte, 300)...), bytes.Repeat([]byte("xy"), 300)...), 330},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			comp := lz4Compress(tc.data)
+			out, err := lz4Decompress(comp, len(tc.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out, tc.data) {
+				t.Fatal("expected decompressed data to equal the original")
+			}
+			if len(comp) > tc.maxSize {
+				t.Errorf("expected at most %d bytes, got %d", tc.maxSize, len(comp))
+			}
+		})
+	}
+}
+
+func TestLZ4Corrupt(t *testing.T) {
+	valid := lz4Compress(bytes.Repeat([]byte("abcdefgh"), 100))
+	tests := map[string]struct {
+		data []byte
+		size int
+	}{
+		"Size":      {valid, 799},
+		"Truncated": {valid[:len(valid)-3], 800},
+		"Offset":    {[]byte{0x14, 'a', 0x00, 0x00}, 5},
+		"Length":    {[]byte{0xf0}, 15},
+		"Literals":  {[]byte{0x50, 'a'}, 5},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := lz4Decompress(tc.data, tc.size); err != errLZ4Corrupt {
+				t.Errorf("expected %v, got %v", errLZ4Corrupt, err)
+			}
+		})
+	}
+}
+
+func TestStage(t *testing.T) {
+	const boot = 0x8000_0400
+
+	program := func(n int) []byte {
+		// Compressible like code, with some unique bytes
+		b := make([]byte, 0, n)
+		for len(b) < n {
+			b = append(b, random(64)...)
+			b = append(b, bytes.Repeat([]byte{0x24, 0x08, 0x00, 0x01}, 16)...)
+		}
+		return b[:n]
+	}
+	tests := map[string]struct {
+		prog []byte
+		dma  bool
+	}{
+		"Small":    {program(10000), false},
+		"Empty":    {nil, false},
+		"Random":   {random(1100 * 1024), true},
+		"Large":    {program(1500 * 1024), false},
+		"Literals": {random(300), false},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			stage, addr, err := compressProgram(tc.prog, boot)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The IPL3 loads 1 MiB of ROM to the boot address.
+			rom := make([]byte, 0x1000+max(len(stage), n64ChecksumLen))
+			copy(rom[0x1000:], stage)
+			sim := &mipsSim{rdram: make([]byte, 4<<20), rom: rom, pc: addr}
+			copy(sim.mem(addr, n64ChecksumLen), rom[0x1000:])
+
+			if err := sim.run(boot, 100_000_000); err != nil {
+				t.Fatal(err)
+			}
+			if got := sim.pi[3] != 0; got != tc.dma {
+				t.Errorf("expected DMA %v, got %v", tc.dma, got)
+			}
+			if out := sim.mem(boot, len(tc.prog)); !bytes.Equal(out, tc.prog) {
+				t.Error("expected decompressed program to equal the original")
+			}
+		})
+	}
+}
+
+func TestStageSize(t *testing.T) {
+	if _, _, err := compressProgram(random(3<<20), 0x8000_0400); err != errProgramSize {
+		t.Errorf("expected %v, got %v", errProgramSize, err)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"fmt"
+	"os"
+
+	"github.com/drpaneas/n64/debug/symtab"
+)
+
+// symbols returns the symbol table of an ELF file's functions and, if it has
+// DWARF information, its lines.
+func symbols(elfFile string) []byte {
+	f := must(elf.Open(elfFile))
+	defer f.Close()
+
+	var funcs []symtab.Func
+	for _, s := range must(f.Symbols()) {
+		if elf.ST_TYPE(s.Info) == elf.STT_FUNC && s.Size > 0 {
+			funcs = append(funcs, symtab.Func{Name: s.Name, Addr: uint32(s.Value), Size: uint32(s.Size)})
+		}
+	}
+
+	d, err := f.DWARF()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "symbols: no line information: %v\n", err)
+		return symtab.Marshal(funcs, nil)
+	}
+	var lines []symtab.Line
+	r := d.Reader()
+	for {
+		cu := must(r.Next())
+		if cu == nil {
+			break
+		}
+		r.SkipChildren()
+		if cu.Tag != dwarf.TagCompileUnit {
+			continue
+		}
+		lr := must(d.LineReader(cu))
+		if lr == nil {
+			continue
+		}
+		var e dwarf.LineEntry
+		for lr.Next(&e) == nil {
+			l := symtab.Line{Addr: uint32(e.Address)}
+			if !e.EndSequence && e.File != nil {
+				l.File, l.Line = e.File.Name, e.Line
+			}
+			lines = append(lines, l)
+		}
+	}
+	return symtab.Marshal(funcs, lines)
+}
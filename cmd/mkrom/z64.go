@@ -20,7 +20,8 @@ var n64Header = [0x40]byte{
 	0x08: 0x80, 0x00, 0x04, 0x00, // Boot Address
 	0x0c: 0x00, 0x00, 0x14, 0x44, // Libultra Version
 	//0x10: Check Code (8 bytes)
-	//0x18: Reserved (8 bytes)
+	//0x18: ROM filesystem offset, see drivers/romfs
+	//0x1c: Symbol table offset | compressed program flag (bit 0), see stage.go
 	//0x20: Game Title (20 bytes)
 	//0x34: Reserved (7 bytes)
 	0x3b: 'N',      // Category Code ('N' = 0x4e = "Game Pak"),
@@ -29,7 +30,10 @@ var n64Header = [0x40]byte{
 	0x3f: 0,   // ROM Version
 }
 
-const n64ChecksumLen = 1024 * 1024
+const (
+	n64ChecksumLen = 1024 * 1024
+	n64DataAlign   = 16 // of the filesystem and symbol table
+)
 
 // n64CRC is a loose translation to Go of the calculate_crc function from
 // the n64chain:
@@ -43,14 +47,18 @@ const n64ChecksumLen = 1024 * 1024
 //
 // This file is more or less a direct rip of chksum64:
 // Copyright 1997 Andreas Sterbenz <stan@sbox.tu-graz.ac.at>
-func n64CRC(buf []byte) (crc [2]uint32) {
-	const CIC_NUS6102_SEED uint32 = 0xF8CA4DDC
-	t1 := CIC_NUS6102_SEED
-	t2 := CIC_NUS6102_SEED
-	t3 := CIC_NUS6102_SEED
-	t4 := CIC_NUS6102_SEED
-	t5 := CIC_NUS6102_SEED
-	t6 := CIC_NUS6102_SEED
+//
+// The 6103, 6105 and 6106 variants follow n64crc by Parasyte.  The 6105
+// variant mixes in words of the IPL3 boot code at 0x710 plus the low byte of
+// the word's offset.
+func n64CRC(c cic, ipl3, buf []byte) (crc [2]uint32) {
+	seed := cics[c].seed
+	t1 := seed
+	t2 := seed
+	t3 := seed
+	t4 := seed
+	t5 := seed
+	t6 := seed
 
 	for i := 0; i < len(buf); i += 4 {
 		c1 := binary.BigEndian.Uint32(buf[i:])
@@ -68,31 +76,71 @@ func n64CRC(buf []byte) (crc [2]uint32) {
 		} else {
 			t2 ^= t6 ^ c1
 		}
-		t1 += c1 ^ t5
+		if c%100 == 5 {
+			t1 += binary.BigEndian.Uint32(ipl3[0x710+(i&0xff):]) ^ c1
+		} else {
+			t1 += c1 ^ t5
+		}
 	}
 
-	crc[0] = t6 ^ t4 ^ t3
-	crc[1] = t5 ^ t2 ^ t1
+	switch c % 100 {
+	case 3:
+		crc[0] = (t6 ^ t4) + t3
+		crc[1] = (t5 ^ t2) + t1
+	case 6:
+		crc[0] = t6*t4 + t3
+		crc[1] = t5*t2 + t1
+	default:
+		crc[0] = t6 ^ t4 ^ t3
+		crc[1] = t5 ^ t2 ^ t1
+	}
 	return
 }
 
-func n64WriteROMFile(obj, format string, buf *bytes.Buffer) {
+// n64BuildROM returns the z64 image of the program in buf, followed by the
+// optional filesystem image and symbol table.
+func n64BuildROM(hdr *romHeader, buf *bytes.Buffer, fsImage, symbols []byte) ([]byte, error) {
 	pad := n64ChecksumLen - buf.Len()
 	if pad > 0 {
 		buf.Write(padBytes(&ones, pad, 0xff))
 	}
-	crc := n64CRC(buf.Bytes()[:n64ChecksumLen])
+	if err := hdr.write(&n64Header); err != nil {
+		return nil, err
+	}
+	crc := n64CRC(hdr.cic, n64IPL3, buf.Bytes()[:n64ChecksumLen])
 	binary.BigEndian.PutUint32(n64Header[0x10:], crc[0])
 	binary.BigEndian.PutUint32(n64Header[0x14:], crc[1])
-	copy(n64Header[0x20:0x34], obj) // Game Title
-	rom := make([]byte, 0, len(n64Header)+len(n64IPL3)+buf.Len())
+	rom := make([]byte, 0, len(n64Header)+len(n64IPL3)+buf.Len()+
+		2*n64DataAlign+len(fsImage)+len(symbols))
 	rom = append(rom, n64Header[:]...)
 	rom = append(rom, n64IPL3...)
 	rom = append(rom, buf.Bytes()...)
 
+	// appendData appends data aligned and returns its offset
+	appendData := func(data []byte) uint32 {
+		rom = append(rom, padBytes(&ones, -len(rom)&(n64DataAlign-1), 0xff)...)
+		off := uint32(len(rom))
+		rom = append(rom, data...)
+		return off
+	}
+	if len(fsImage) > 0 {
+		binary.BigEndian.PutUint32(rom[0x18:], appendData(fsImage))
+	}
+	if len(symbols) > 0 {
+		off := appendData(symbols)
+		binary.BigEndian.PutUint32(rom[0x1c:], binary.BigEndian.Uint32(rom[0x1c:])|off)
+	}
+	return rom, nil
+}
+
+func n64WriteROMFile(obj, format string, rom []byte) {
 	switch format {
 	case "z64":
 		must(0, os.WriteFile(obj, rom, 0644))
+	case "v64", "n64":
+		rom = append(rom, padBytes(&ones, -len(rom)&3, 0xff)...)
+		n64SwapBytes(rom, byteOrders[format])
+		must(0, os.WriteFile(obj, rom, 0644))
 	case "uf2":
 		n64WriteUF2(obj, rom)
 	default:
@@ -101,7 +149,59 @@ func n64WriteROMFile(obj, format string, buf *bytes.Buffer) {
 	}
 }
 
-// 6102/7101 MD5=e24dd796b2fa16511521139d28c8356b
+// byteOrder is the layout of a ROM image, named after the file extension
+// commonly used for it.  z64 is the native big endian order, v64 swaps the
+// bytes of each 16-bit word and n64 the bytes of each 32-bit word.
+type byteOrder int
+
+const (
+	z64 byteOrder = iota
+	v64
+	n64
+)
+
+var byteOrders = map[string]byteOrder{"z64": z64, "v64": v64, "n64": n64}
+
+func (o byteOrder) String() string {
+	return [...]string{"z64", "v64", "n64"}[o]
+}
+
+// n64SwapBytes converts a ROM between z64 and the byte order o.  Swapping
+// twice restores the original, so it works in both directions.  The length of
+// rom must be a multiple of 4.
+func n64SwapBytes(rom []byte, o byteOrder) {
+	switch o {
+	case v64:
+		for i := 0; i+1 < len(rom); i += 2 {
+			rom[i], rom[i+1] = rom[i+1], rom[i]
+		}
+	case n64:
+		for i := 0; i+3 < len(rom); i += 4 {
+			rom[i], rom[i+1], rom[i+2], rom[i+3] = rom[i+3], rom[i+2], rom[i+1], rom[i]
+		}
+	}
+}
+
+// n64DetectByteOrder returns the byte order of a ROM from the PI
+// configuration in its first word.
+func n64DetectByteOrder(rom []byte) (byteOrder, bool) {
+	if len(rom) < 4 {
+		return 0, false
+	}
+	switch binary.BigEndian.Uint32(rom) {
+	case 0x80371240:
+		return z64, true
+	case 0x37804012:
+		return v64, true
+	case 0x40123780:
+		return n64, true
+	}
+	return 0, false
+}
+
+const n64IPL3Len = 0x1000 - 0x40
+
+// 6102/7101 MD5=e24dd796b2fa16511521139d28c8356b, replaced by -ipl3
 //
 //go:embed ipl3.bin
 var n64IPL3 []byte
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// writeGo writes a Go file of package pkg, which declares the texture file
+// data as the byte slice name.  Unlike go:embed, the bytes are aligned to
+// texture.AlignTexture by an uint64 field of the backing struct, so
+// texture.Load references them instead of copying.
+func writeGo(w io.Writer, pkg, name string, data []byte) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Code generated by mktex. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+	fmt.Fprintf(&b, "// %s is a texture file to be loaded with texture.Load.\n", name)
+	fmt.Fprintf(&b, "var %s = %sData.b[:]\n\n", name, unexported(name))
+	fmt.Fprintf(&b, "var %sData = struct {\n", unexported(name))
+	fmt.Fprintf(&b, "\t_ [0]uint64 // align to 8 bytes\n")
+	fmt.Fprintf(&b, "\tb [%d]byte\n", len(data))
+	fmt.Fprintf(&b, "}{b: [%d]byte{", len(data))
+	for i, v := range data {
+		if i%16 == 0 {
+			b.WriteString("\n\t")
+		} else {
+			b.WriteString(" ")
+		}
+		fmt.Fprintf(&b, "0x%02x,", v)
+	}
+	b.WriteString("\n}}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// identifier returns an exported Go identifier for a file name, e.g.
+// "brick_wall" becomes "BrickWall".
+func identifier(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if b.Len() == 0 && unicode.IsDigit(r) {
+			b.WriteString("Tex")
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	if b.Len() == 0 {
+		return "Texture"
+	}
+	return b.String()
+}
+
+func unexported(name string) string {
+	return strings.ToLower(name[:1]) + name[1:]
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	goformat "go/format"
+	"strings"
+	"testing"
+)
+
+func TestWriteGo(t *testing.T) {
+	var b strings.Builder
+	data := make([]byte, 20)
+	data[0], data[19] = 0x4e, 0xff
+	if err := writeGo(&b, "assets", "Brick", data); err != nil {
+		t.Fatal(err)
+	}
+
+	src := b.String()
+	formatted, err := goformat.Source([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(formatted) != src {
+		t.Errorf("output not gofmt'ed:\n%s", src)
+	}
+	for _, want := range []string{
+		"package assets\n",
+		"var Brick = brickData.b[:]\n",
+		"\t_ [0]uint64",
+		"\tb [20]byte\n",
+		"\n\t0x4e, 0x00,",
+		"\n\t0x00, 0x00, 0x00, 0xff,\n}}\n",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("expected %q in:\n%s", want, src)
+		}
+	}
+}
+
+func TestIdentifier(t *testing.T) {
+	tests := map[string]string{
+		"brick":      "Brick",
+		"brick_wall": "BrickWall",
+		"font-8x8":   "Font8x8",
+		"2d":         "Tex2d",
+		"--":         "Texture",
+	}
+	for name, want := range tests {
+		if got := identifier(name); got != want {
+			t.Errorf("%s: expected %s, got %s", name, want, got)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/drpaneas/n64/rcp/texture/texfile"
+)
+
+const usageString = `PNG/GIF to N64 texture converter.
+
+Converts an image into a texture file, which can be embedded into the ROM and
+loaded with texture.Load().  Formats are rgba16, rgba32, yuv16, ci4, ci8, ia4,
+ia8, ia16, i4 and i8.  Palettes of CI textures are taken from GIF and paletted
+PNG images if they have few enough colors, otherwise they are generated.
+
+Files embedded with go:embed aren't necessarily aligned, which makes
+texture.Load() copy them.  With -go the texture is written as a Go file
+instead, which declares it as an aligned byte slice that is referenced without
+copying.
+
+Usage: %s [flags] <imagefile>
+
+`
+
+var (
+	infile  string
+	outfile = flag.String("o", "", "output file (default <imagefile>.tex, or <imagefile>.go with -go)")
+	format  = flag.String("format", "rgba16", "texture format")
+	dither  = flag.Bool("dither", false, "dither colors reduced to less than 8 bits per channel")
+	mipmaps = flag.Int("mipmaps", 0, "number of additional mip map levels, each half the size")
+	colors  = flag.Int("colors", 0, "palette size of CI textures (default 16 for ci4, 256 for ci8)")
+	tmem    = flag.Bool("tmem", false, "fail if the texture and all its levels don't fit into TMEM at once")
+	goPkg   = flag.String("go", "", "write a Go file of package `pkg` instead of a texture file")
+	goName  = flag.String("name", "", "variable name in the Go file (default derived from <imagefile>)")
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), usageString, os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 1 {
+		infile = flag.Arg(0)
+	} else {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	base := strings.TrimSuffix(infile, filepath.Ext(infile))
+	if *outfile == "" {
+		*outfile = base + ".tex"
+		if *goPkg != "" {
+			*outfile = base + ".go"
+		}
+	}
+
+	f := must(os.Open(infile))
+	img, _, err := image.Decode(f)
+	f.Close()
+	must(0, err)
+
+	texFormat := must(texfile.ParseFormat(*format))
+	tex := must(texfile.Encode(img, texFormat, texfile.Options{
+		Dither:  *dither,
+		Mipmaps: *mipmaps,
+		Colors:  *colors,
+	}))
+
+	if *tmem {
+		limit := 4096
+		if texFormat.Colors() > 0 {
+			limit /= 2 // palettes occupy the upper half
+		}
+		if tex.TMEMSize() > limit {
+			fmt.Printf("texture needs %d bytes of TMEM, only %d available\n", tex.TMEMSize(), limit)
+			os.Exit(1)
+		}
+	}
+
+	data := must(tex.MarshalBinary())
+	if *goPkg == "" {
+		must(0, os.WriteFile(*outfile, data, 0644))
+		return
+	}
+
+	if *goName == "" {
+		*goName = identifier(filepath.Base(base))
+	}
+	out := must(os.Create(*outfile))
+	must(0, writeGo(out, *goPkg, *goName, data))
+	must(0, out.Close())
+}
+
+func must[T any](ret T, err error) T {
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return ret
+}
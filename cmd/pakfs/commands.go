@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/drpaneas/n64/drivers/controller/pakfs"
+)
+
+// bankSize is the size of a bank, a standard Controller Pak has one.
+const bankSize = 32 * 1024
+
+var errUsage = errors.New("invalid arguments")
+
+// command runs a subcommand with its arguments, writing its output to w.
+type command func(w io.Writer, args []string) error
+
+var commands = map[string]command{
+	"ls":     list,
+	"cp":     copyNote,
+	"rm":     remove,
+	"mv":     rename,
+	"format": format,
+	"fsck":   check,
+
+	"export":  exportNote,
+	"import":  importNotes,
+	"convert": convert,
+}
+
+func openImage(name string, write bool) (*os.File, *pakfs.FS, error) {
+	flag := os.O_RDONLY
+	if write {
+		flag = os.O_RDWR
+	}
+	f, err := os.OpenFile(name, flag, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	pfs, err := pakfs.Read(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return f, pfs, nil
+}
+
+// printable returns a game or company code as text, or in hex if it isn't
+// printable ASCII.
+func printable(code []byte) string {
+	for _, c := range code {
+		if c < 0x20 || c > 0x7e {
+			return fmt.Sprintf("%x", code)
+		}
+	}
+	return string(code)
+}
+
+func list(w io.Writer, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	img, pfs, err := openImage(args[0], false)
+	if err != nil {
+		return err
+	}
+	defer img.Close()
+
+	fmt.Fprintf(w, "%-4s %-8s %7s %s\n", "GAME", "COMPANY", "SIZE", "NAME")
+	for _, e := range pfs.ReadDirRoot() {
+		fi, err := pfs.Open(e.Name())
+		if err != nil {
+			return err
+		}
+		f := fi.(*pakfs.File)
+		game, company := f.GameCode(), f.CompanyCode()
+		fmt.Fprintf(w, "%-4s %-8s %7d %s\n", printable(game[:]), printable(company[:]), f.Size(), f.Name())
+	}
+	fmt.Fprintf(w, "%d of %d bytes free\n", pfs.Free(), pfs.Size())
+	return nil
+}
+
+// copyNote copies a file into or out of the image.  Notes are prefixed with a
+// colon.
+func copyNote(w io.Writer, args []string) error {
+	flags := flag.NewFlagSet("cp", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	game := flags.String("game", "", "game code of a copied in note, 4 characters")
+	company := flags.String("company", "", "company code of a copied in note, 2 characters")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 3 {
+		return errUsage
+	}
+	image, src, dst := flags.Arg(0), flags.Arg(1), flags.Arg(2)
+	if *game != "" && len(*game) != 4 || *company != "" && len(*company) != 2 {
+		return fmt.Errorf("%w: game code must be 4 and company code 2 characters", errUsage)
+	}
+
+	switch note, ok := strings.CutPrefix(src, ":"); {
+	case ok && !strings.HasPrefix(dst, ":"):
+		img, pfs, err := openImage(image, false)
+		if err != nil {
+			return err
+		}
+		defer img.Close()
+		data, err := fs.ReadFile(pfs, note)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(dst, data, 0666)
+
+	case !ok && strings.HasPrefix(dst, ":"):
+		if note := dst[1:]; note == "" || note == "." {
+			return &fs.PathError{Op: "cp", Path: note, Err: pakfs.ErrIsDir}
+		}
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		img, pfs, err := openImage(image, true)
+		if err != nil {
+			return err
+		}
+		defer img.Close()
+		return writeNote(pfs, dst[1:], data, *game, *company)
+	}
+	return fmt.Errorf("%w: either the source or the destination must be a :note", errUsage)
+}
+
+// writeNote creates or replaces the note name with data.
+func writeNote(pfs *pakfs.FS, name string, data []byte, game, company string) (err error) {
+	f, err := pfs.Create(name)
+	if errors.Is(err, fs.ErrExist) {
+		var fi fs.File
+		if fi, err = pfs.Open(name); err != nil {
+			return err
+		}
+		var ok bool
+		if f, ok = fi.(*pakfs.File); !ok {
+			return &fs.PathError{Op: "cp", Path: name, Err: pakfs.ErrIsDir}
+		}
+	} else if err == nil {
+		defer func() {
+			if err != nil {
+				pfs.Remove(name)
+			}
+		}()
+	}
+	if err != nil {
+		return err
+	}
+	if game != "" {
+		if err = f.SetGameCode([4]byte([]byte(game))); err != nil {
+			return err
+		}
+	}
+	if company != "" {
+		if err = f.SetCompanyCode([2]byte([]byte(company))); err != nil {
+			return err
+		}
+	}
+	if err = pfs.Truncate(name, int64(len(data))); err != nil {
+		return err
+	}
+	_, err = f.WriteAt(data, 0)
+	return err
+}
+
+func remove(w io.Writer, args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	img, pfs, err := openImage(args[0], true)
+	if err != nil {
+		return err
+	}
+	defer img.Close()
+	for _, name := range args[1:] {
+		if err := pfs.Remove(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func rename(w io.Writer, args []string) error {
+	if len(args) != 3 {
+		return errUsage
+	}
+	img, pfs, err := openImage(args[0], true)
+	if err != nil {
+		return err
+	}
+	defer img.Close()
+	return pfs.Rename(args[1], args[2])
+}
+
+func format(w io.Writer, args []string) error {
+	flags := flag.NewFlagSet("format", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	force := flags.Bool("f", false, "overwrite an existing image")
+	banks := flags.Int("banks", 1, "number of 32 KiB banks")
+	label := flags.String("label", "", "label of the pak, up to 32 bytes")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return errUsage
+	}
+	if *banks < 1 || *banks > pakfs.MaxBanks || len(*label) > 32 {
+		return fmt.Errorf("%w: banks must be 1 to %d and label up to 32 bytes", errUsage, pakfs.MaxBanks)
+	}
+	opts := &pakfs.FormatOptions{Banks: *banks}
+	copy(opts.Label[:], *label)
+	mode := os.O_RDWR | os.O_CREATE
+	if !*force {
+		mode |= os.O_EXCL
+	}
+	img, err := os.OpenFile(flags.Arg(0), mode, 0666)
+	if err != nil {
+		return err
+	}
+	defer img.Close()
+	if err := img.Truncate(int64(*banks) * bankSize); err != nil {
+		return err
+	}
+	return pakfs.Format(img, opts)
+}
+
+func check(w io.Writer, args []string) error {
+	flags := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	repair := flags.Bool("r", false, "repair from backup copies, remove broken notes and free orphaned pages")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return errUsage
+	}
+	mode := os.O_RDONLY
+	if *repair {
+		mode = os.O_RDWR
+	}
+	img, err := os.OpenFile(flags.Arg(0), mode, 0)
+	if err != nil {
+		return err
+	}
+	defer img.Close()
+
+	problems, err := pakfs.Check(img, *repair)
+	unrepaired := 0
+	for _, p := range problems {
+		fmt.Fprintln(w, p)
+		if !p.Repaired {
+			unrepaired++
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if unrepaired > 0 {
+		return fmt.Errorf("%s: %d problems found", flags.Arg(0), unrepaired)
+	}
+	return nil
+}
+
+func exportNote(w io.Writer, args []string) error {
+	if len(args) != 3 {
+		return errUsage
+	}
+	img, pfs, err := openImage(args[0], false)
+	if err != nil {
+		return err
+	}
+	defer img.Close()
+	fi, err := pfs.Open(args[1])
+	if err != nil {
+		return err
+	}
+	f, ok := fi.(*pakfs.File)
+	if !ok {
+		return fmt.Errorf("%s: %w", args[1], pakfs.ErrIsDir)
+	}
+	var buf bytes.Buffer
+	if err := f.Export(&buf); err != nil {
+		return err
+	}
+	return os.WriteFile(args[2], buf.Bytes(), 0666)
+}
+
+func importNotes(w io.Writer, args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	img, pfs, err := openImage(args[0], true)
+	if err != nil {
+		return err
+	}
+	defer img.Close()
+	for _, name := range args[1:] {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		f, err := pfs.Import(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		fmt.Fprintln(w, f.Name())
+	}
+	return nil
+}
+
+// convert converts between raw images and DexDrive .n64 files, selected by
+// the file extension.
+func convert(w io.Writer, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	isDex := func(name string) bool { return strings.EqualFold(filepath.Ext(name), ".n64") }
+	if isDex(args[0]) {
+		if data, err = pakfs.FromDexDrive(data); err != nil {
+			return fmt.Errorf("%s: %w", args[0], err)
+		}
+	}
+	if _, err := pakfs.Read(bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+	if isDex(args[1]) {
+		if data, err = pakfs.ToDexDrive(data); err != nil {
+			return fmt.Errorf("%s: %w", args[0], err)
+		}
+	}
+	return os.WriteFile(args[1], data, 0666)
+}
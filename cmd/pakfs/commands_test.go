@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drpaneas/n64/drivers/controller/pakfs"
+)
+
+// testImage returns a copy of the pakfs testdata image.
+func testImage(t *testing.T) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "..", "drivers", "controller", "pakfs", "testdata", "drpaneas.mpk"))
+	if err != nil {
+		t.Fatal("missing testdata:", err)
+	}
+	name := filepath.Join(t.TempDir(), "test.mpk")
+	if err := os.WriteFile(name, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func run(t *testing.T, cmd string, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	err := commands[cmd](&out, args)
+	return out.String(), err
+}
+
+func TestList(t *testing.T) {
+	out, err := run(t, "ls", testImage(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"NPDP 4Y          7168 PERFECT DARK\n",
+		"NVGP 52           256 V82, \"METIN\"\n",
+		" bytes free\n",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("expected %q in output:\n%s", line, out)
+		}
+	}
+}
+
+func TestCopy(t *testing.T) {
+	image := testImage(t)
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.bin")
+	out := filepath.Join(dir, "out.bin")
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	if err := os.WriteFile(in, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		args []string
+		note string
+		err  error
+	}{
+		"New":        {[]string{"-game", "NTST", "-company", "01", image, in, ":TEST.A"}, "TEST.A", nil},
+		"Replace":    {[]string{image, in, ":PERFECT DARK"}, "PERFECT DARK", nil},
+		"NoNote":     {[]string{image, in, out}, "", errUsage},
+		"BothNotes":  {[]string{image, ":PERFECT DARK", ":TEST.A"}, "", errUsage},
+		"GameCode":   {[]string{"-game", "NTS", image, in, ":TEST.B"}, "", errUsage},
+		"NotExist":   {[]string{image, ":MISSING", out}, "", fs.ErrNotExist},
+		"NoArgs":     {nil, "", errUsage},
+		"BadEncoded": {[]string{image, in, ":lower"}, "", errors.New("")},
+		"Root":       {[]string{"-game", "ABCD", "-company", "01", image, in, ":."}, "", pakfs.ErrIsDir},
+		"Empty":      {[]string{image, in, ":"}, "", pakfs.ErrIsDir},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := run(t, "cp", tc.args...)
+			if tc.err != nil {
+				if err == nil || (tc.err.Error() != "" && !errors.Is(err, tc.err)) {
+					t.Fatalf("expected %v, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := run(t, "cp", image, ":"+tc.note, out); err != nil {
+				t.Fatal(err)
+			}
+			got, _ := os.ReadFile(out)
+			// Notes are a multiple of the page size
+			if len(got) != 1024 || !bytes.Equal(got[:len(data)], data) {
+				t.Errorf("expected %d bytes of data, got %d", len(data), len(got))
+			}
+		})
+	}
+
+	listing, _ := run(t, "ls", image)
+	if !strings.Contains(listing, "NTST 01          1024 TEST.A\n") {
+		t.Errorf("expected codes of the new note, got:\n%s", listing)
+	}
+	if strings.Contains(listing, "lower") {
+		t.Errorf("expected no note after failed copy, got:\n%s", listing)
+	}
+}
+
+func TestRemoveRename(t *testing.T) {
+	image := testImage(t)
+	if _, err := run(t, "mv", image, "PERFECT DARK", "PD"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run(t, "rm", image, "PD", "V82, \"METIN\""); err != nil {
+		t.Fatal(err)
+	}
+	out, _ := run(t, "ls", image)
+	for _, name := range []string{"PERFECT DARK", "PD\n", "METIN"} {
+		if strings.Contains(out, name) {
+			t.Errorf("expected %q to be gone:\n%s", name, out)
+		}
+	}
+	if !strings.Contains(out, "PERFECT \n") {
+		t.Errorf("expected other notes to remain:\n%s", out)
+	}
+	if _, err := run(t, "rm", image, "PD"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected %v, got %v", fs.ErrNotExist, err)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	image := filepath.Join(t.TempDir(), "new.mpk")
+	if _, err := run(t, "format", image); err != nil {
+		t.Fatal(err)
+	}
+	out, err := run(t, "ls", image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "GAME COMPANY     SIZE NAME\n31488 of 31488 bytes free\n"; out != want {
+		t.Errorf("expected %q, got %q", want, out)
+	}
+	if _, err := run(t, "format", image); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("expected %v, got %v", fs.ErrExist, err)
+	}
+	if _, err := run(t, "format", "-f", image); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	image := testImage(t)
+	data, _ := os.ReadFile(image)
+	data[0x20] ^= 0xff  // ID sector
+	data[0x1ff] ^= 0xff // inode table
+	os.WriteFile(image, data, 0666)
+
+	out, err := run(t, "fsck", image)
+	if err == nil || strings.Count(out, "\n") != 2 {
+		t.Fatalf("expected 2 problems, got %v:\n%s", err, out)
+	}
+	out, err = run(t, "fsck", "-r", image)
+	if err != nil || strings.Count(out, "(repaired)") != 2 {
+		t.Fatalf("expected 2 repaired problems, got %v:\n%s", err, out)
+	}
+	if out, err = run(t, "fsck", image); err != nil || out != "" {
+		t.Errorf("expected clean image, got %v:\n%s", err, out)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	src := testImage(t)
+	dir := t.TempDir()
+	note := filepath.Join(dir, "pd.note")
+	if _, err := run(t, "export", src, "PERFECT DARK", note); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(dir, "dst.mpk")
+	if _, err := run(t, "format", dst); err != nil {
+		t.Fatal(err)
+	}
+	out, err := run(t, "import", dst, note)
+	if err != nil || out != "PERFECT DARK\n" {
+		t.Fatalf("expected imported note, got %v: %q", err, out)
+	}
+	listing, _ := run(t, "ls", dst)
+	if !strings.Contains(listing, "NPDP 4Y          7168 PERFECT DARK\n") {
+		t.Errorf("expected imported note in listing:\n%s", listing)
+	}
+	if _, err := run(t, "import", dst, note); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("expected %v, got %v", fs.ErrExist, err)
+	}
+	if _, err := run(t, "export", src, "MISSING", note); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected %v, got %v", fs.ErrNotExist, err)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	src := testImage(t)
+	dir := t.TempDir()
+	dex := filepath.Join(dir, "save.N64")
+	raw := filepath.Join(dir, "save.mpk")
+	if _, err := run(t, "convert", src, dex); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run(t, "convert", dex, raw); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := os.ReadFile(src)
+	got, _ := os.ReadFile(raw)
+	if !bytes.Equal(got, want) {
+		t.Error("expected original image after round trip")
+	}
+	if _, err := run(t, "convert", src, raw); err != nil {
+		t.Errorf("expected raw copy, got %v", err)
+	}
+	os.WriteFile(raw, make([]byte, 100), 0666)
+	if _, err := run(t, "convert", raw, dex); err == nil {
+		t.Error("expected error for invalid image")
+	}
+	if _, err := run(t, "convert", raw+".n64", raw); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
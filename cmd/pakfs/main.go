@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -27,7 +28,29 @@ Usage:
 
 The commands are:
 
-	mount <image> <dir>	serve pakfs image via fuse
+	mount <image> <dir>		serve pakfs image via fuse
+	ls <image>			list notes with game and company codes
+	cp [-game code] [-company code] <image> <src> <dst>
+					copy a note out of or into the image,
+					notes are prefixed with a colon
+	rm <image> <note>...		remove notes
+	mv <image> <old> <new>		rename a note
+	format [-f] [-banks n] [-label text] <image>
+					create an empty image, -f overwrites
+	fsck [-r] <image>		check the image, -r repairs it from
+					backup ID sectors and inode tables,
+					removes broken notes and frees
+					orphaned pages
+	export <image> <note> <file>	write a note in the single note format
+					of emulators and save managers
+	import <image> <file>...	add notes in the single note format
+	convert <src> <dst>		convert between raw images and DexDrive
+					files, which end with .n64
+
+Examples:
+
+	%[1]s cp save.mpk ":ZELDA.A" zelda.bin
+	%[1]s cp -game NZLE -company 01 save.mpk zelda.bin :ZELDA.A
 `
 
 func usage() {
@@ -44,11 +67,11 @@ func main() {
 		os.Exit(1)
 	}
 
-	sigintr := make(chan os.Signal)
-	signal.Notify(sigintr, os.Interrupt)
-
 	switch flag.Arg(0) {
 	case "mount":
+		sigintr := make(chan os.Signal, 1)
+		signal.Notify(sigintr, os.Interrupt)
+
 		if flag.NArg() < 3 {
 			flag.Usage()
 			os.Exit(1)
@@ -65,8 +88,20 @@ func main() {
 		cmd := exec.Command("/bin/umount", dir)
 		must(cmd.CombinedOutput())
 	default:
-		fmt.Fprintf(flag.CommandLine.Output(), "%s: unknown command\n", flag.Arg(0))
-		flag.Usage()
-		os.Exit(1)
+		cmd, ok := commands[flag.Arg(0)]
+		if !ok {
+			fmt.Fprintf(flag.CommandLine.Output(), "%s: unknown command\n", flag.Arg(0))
+			flag.Usage()
+			os.Exit(1)
+		}
+		err := cmd(os.Stdout, flag.Args()[1:])
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(flag.CommandLine.Output(), "%s: %v\n", flag.Arg(0), err)
+			flag.Usage()
+			os.Exit(1)
+		} else if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 	}
 }
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/drpaneas/n64/rcp/rdp/disasm"
+)
+
+const usageString = `RDP command list disassembler.
+
+Reads a dump of RDP commands in the console's big endian byte order and prints
+one command per line, followed by warnings about likely mistakes.  Reads from
+stdin if no file is given.  Exits with status 2 if there are warnings.
+
+Usage: %s [flags] [dumpfile]
+
+`
+
+var (
+	words    = flag.Bool("words", false, "print all words of multi word commands")
+	validate = flag.Bool("validate", true, "check commands for common mistakes")
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), usageString, os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	var data []byte
+	switch flag.NArg() {
+	case 0:
+		data = must(io.ReadAll(os.Stdin))
+	case 1:
+		data = must(os.ReadFile(flag.Arg(0)))
+	default:
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if len(data)%8 != 0 {
+		fmt.Printf("ignoring %d trailing bytes\n", len(data)%8)
+	}
+	list := make([]uint64, len(data)/8)
+	for i := range list {
+		list[i] = binary.BigEndian.Uint64(data[i*8:])
+	}
+
+	// A truncated last command is reported after the listing
+	cmds, err := disasm.Decode(list)
+
+	issues := make(map[int][]string)
+	if *validate {
+		for _, issue := range disasm.Validate(cmds) {
+			issues[issue.Command] = append(issues[issue.Command], issue.Message)
+		}
+	}
+
+	for i, c := range cmds {
+		fmt.Printf("%06x  %016x  %s\n", c.Offset, c.Words[0], c)
+		if *words {
+			for j, w := range c.Words[1:] {
+				fmt.Printf("%06x  %016x\n", c.Offset+8*(j+1), w)
+			}
+		}
+		for _, msg := range issues[i] {
+			fmt.Printf("        warning: %s\n", msg)
+		}
+	}
+
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if len(issues) > 0 {
+		os.Exit(2)
+	}
+}
+
+func must[T any](ret T, err error) T {
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return ret
+}
@@ -0,0 +1,623 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const memSize = 0x1000 // size of IMEM and DMEM
+
+type section int
+
+const (
+	text section = iota
+	data
+)
+
+// statement is a single source line after macro expansion.
+type statement struct {
+	line     int
+	labels   []string
+	mnemonic string
+	args     []string
+}
+
+type macro struct {
+	params []string
+	body   []string
+}
+
+// asmError is raised by panics while assembling a statement.
+type asmError struct{ msg string }
+
+type assembler struct {
+	final     bool // second pass, all symbols must be defined
+	symbols   map[string]int64
+	macros    map[string]*macro
+	li        map[int]bool // statements that need two instructions for li
+	stmt      int          // index of current statement
+	undefined bool         // last expression referenced an undefined symbol
+
+	section  section
+	out      [2][]byte
+	dataInit int // end of initialized data
+}
+
+// assemble translates RSP assembly into the contents of IMEM and DMEM.  The
+// text section starts at the beginning of IMEM and the data section at the
+// beginning of DMEM.  Uninitialized data at the end of the data section, as
+// reserved by .space and .align, is not included in the returned data.
+func assemble(src string) (imem, dmem []byte, err error) {
+	a := &assembler{
+		symbols: make(map[string]int64),
+		macros:  make(map[string]*macro),
+		li:      make(map[int]bool),
+	}
+
+	stmts, err := a.parse(strings.Split(src, "\n"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, final := range []bool{false, true} {
+		a.final = final
+		a.section = text
+		a.out = [2][]byte{}
+		a.dataInit = 0
+		for i, s := range stmts {
+			a.stmt = i
+			if err := a.statement(s); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	for i, s := range [2]string{"text", "data"} {
+		if len(a.out[i]) > memSize {
+			return nil, nil, fmt.Errorf("%s section exceeds %d bytes", s, memSize)
+		}
+	}
+
+	return a.out[text], a.out[data][:a.dataInit], nil
+}
+
+var (
+	labelRegexp = regexp.MustCompile(`^\s*([A-Za-z_.][\w.]*)\s*:`)
+	paramRegexp = regexp.MustCompile(`\\(\w+)`)
+)
+
+// parse splits the source into statements and expands macros.
+func (a *assembler) parse(lines []string) ([]statement, error) {
+	var (
+		stmts []statement
+		def   *macro
+	)
+	for n, line := range lines {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+
+		var labels []string
+		for {
+			m := labelRegexp.FindStringSubmatch(line)
+			if m == nil {
+				break
+			}
+			labels = append(labels, m[1])
+			line = line[len(m[0]):]
+		}
+
+		line = strings.TrimSpace(line)
+		mnemonic, args, _ := strings.Cut(line, " ")
+		if i := strings.IndexByte(mnemonic, '\t'); i >= 0 {
+			mnemonic, args = mnemonic[:i], mnemonic[i+1:]+" "+args
+		}
+		mnemonic = strings.ToLower(mnemonic)
+
+		if def != nil {
+			if mnemonic == ".endm" {
+				def = nil
+			} else {
+				def.body = append(def.body, lines[n])
+			}
+			continue
+		}
+
+		s := statement{line: n + 1, labels: labels, mnemonic: mnemonic, args: splitArgs(args)}
+		switch {
+		case mnemonic == ".macro":
+			if len(s.args) == 0 {
+				return nil, fmt.Errorf("line %d: missing macro name", s.line)
+			}
+			name, params, _ := strings.Cut(s.args[0], " ")
+			def = &macro{params: append(splitArgs(params), s.args[1:]...)}
+			a.macros[strings.ToLower(name)] = def
+		case a.macros[mnemonic] != nil:
+			expanded, err := a.expand(s)
+			if err != nil {
+				return nil, err
+			}
+			stmts = append(stmts, expanded...)
+		default:
+			stmts = append(stmts, s)
+		}
+	}
+	if def != nil {
+		return nil, errors.New("missing .endm")
+	}
+	return stmts, nil
+}
+
+// expand substitutes the arguments of a macro invocation into the macro's
+// body.
+func (a *assembler) expand(s statement) ([]statement, error) {
+	m := a.macros[s.mnemonic]
+	if len(s.args) != len(m.params) {
+		return nil, fmt.Errorf("line %d: macro %s expects %d arguments", s.line, s.mnemonic, len(m.params))
+	}
+
+	body := make([]string, len(m.body))
+	for i, line := range m.body {
+		body[i] = paramRegexp.ReplaceAllStringFunc(line, func(p string) string {
+			if i := slices.Index(m.params, p[1:]); i >= 0 {
+				return s.args[i]
+			}
+			return p
+		})
+	}
+
+	inner := &assembler{macros: a.macros}
+	expanded, err := inner.parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: in macro %s: %w", s.line, s.mnemonic, err)
+	}
+	for i := range expanded {
+		expanded[i].line = s.line
+	}
+	if len(expanded) > 0 {
+		expanded[0].labels = append(s.labels, expanded[0].labels...)
+	} else if len(s.labels) > 0 {
+		expanded = []statement{{line: s.line, labels: s.labels}}
+	}
+	return expanded, nil
+}
+
+// splitArgs splits operands at commas outside of parentheses.
+func splitArgs(s string) (args []string) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				args = append(args, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(args, strings.TrimSpace(s[start:]))
+}
+
+func (a *assembler) fail(format string, args ...any) {
+	panic(asmError{fmt.Sprintf(format, args...)})
+}
+
+func (a *assembler) statement(s statement) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(asmError)
+			if !ok {
+				panic(r)
+			}
+			err = fmt.Errorf("line %d: %s", s.line, e.msg)
+		}
+	}()
+
+	for _, label := range s.labels {
+		pc := int64(len(a.out[a.section]))
+		if v, ok := a.symbols[label]; ok && (!a.final || v != pc) {
+			a.fail("symbol %s redefined", label)
+		}
+		a.symbols[label] = pc
+	}
+
+	switch {
+	case s.mnemonic == "":
+	case strings.HasPrefix(s.mnemonic, "."):
+		a.directive(s)
+	case a.section != text:
+		a.fail("instruction %s outside of text section", s.mnemonic)
+	default:
+		a.instruction(s)
+	}
+	return nil
+}
+
+func (a *assembler) directive(s statement) {
+	switch s.mnemonic {
+	case ".text":
+		a.nargs(s, 0)
+		a.section = text
+	case ".data":
+		a.nargs(s, 0)
+		a.section = data
+	case ".set":
+		a.nargs(s, 2)
+		a.symbols[s.args[0]] = a.expr(s.args[1])
+	case ".byte", ".half", ".word":
+		size := map[string]int{".byte": 1, ".half": 2, ".word": 4}[s.mnemonic]
+		if len(s.args) == 0 {
+			a.fail("%s needs at least one value", s.mnemonic)
+		}
+		for _, arg := range s.args {
+			v := a.expr(arg)
+			a.checkRange(v, -1<<(size*8-1), 1<<(size*8)-1)
+			a.emitValue(uint32(v), size)
+		}
+	case ".space":
+		a.nargs(s, 1)
+		n := a.expr(s.args[0])
+		a.checkRange(n, 0, memSize)
+		a.out[a.section] = append(a.out[a.section], make([]byte, n)...)
+	case ".align":
+		a.nargs(s, 1)
+		n := int(a.expr(s.args[0]))
+		if n <= 0 || n&(n-1) != 0 {
+			a.fail("alignment must be a power of two")
+		}
+		for len(a.out[a.section])%n != 0 {
+			a.out[a.section] = append(a.out[a.section], 0)
+		}
+	default:
+		a.fail("unknown directive %s", s.mnemonic)
+	}
+}
+
+func (a *assembler) emitValue(v uint32, size int) {
+	switch size {
+	case 1:
+		a.out[a.section] = append(a.out[a.section], byte(v))
+	case 2:
+		a.out[a.section] = binary.BigEndian.AppendUint16(a.out[a.section], uint16(v))
+	case 4:
+		a.out[a.section] = binary.BigEndian.AppendUint32(a.out[a.section], v)
+	}
+	if a.section == data {
+		a.dataInit = len(a.out[data])
+	}
+}
+
+func (a *assembler) emit(instr uint32) {
+	a.emitValue(instr, 4)
+}
+
+func (a *assembler) nargs(s statement, n int) {
+	if len(s.args) != n {
+		a.fail("%s expects %d operands, got %d", s.mnemonic, n, len(s.args))
+	}
+}
+
+func (a *assembler) checkRange(v, min, max int64) {
+	if a.final && (v < min || v > max) {
+		a.fail("value %d out of range [%d, %d]", v, min, max)
+	}
+}
+
+func (a *assembler) instruction(s statement) {
+	m, args := s.mnemonic, s.args
+	pc := int64(len(a.out[text]))
+
+	if funct, ok := rType[m]; ok {
+		a.nargs(s, 3)
+		a.emit(rInstr(funct, a.gpr(args[1]), a.gpr(args[2]), a.gpr(args[0]), 0))
+	} else if funct, ok := shiftType[m]; ok {
+		a.nargs(s, 3)
+		sa := a.expr(args[2])
+		a.checkRange(sa, 0, 31)
+		a.emit(rInstr(funct, 0, a.gpr(args[1]), a.gpr(args[0]), uint32(sa)))
+	} else if funct, ok := shiftVarType[m]; ok {
+		a.nargs(s, 3)
+		a.emit(rInstr(funct, a.gpr(args[2]), a.gpr(args[1]), a.gpr(args[0]), 0))
+	} else if op, ok := iType[m]; ok {
+		a.nargs(s, 3)
+		imm := a.expr(args[2])
+		if op >= 0x0c { // logical operations zero extend
+			a.checkRange(imm, 0, 0xffff)
+		} else {
+			a.checkRange(imm, -0x8000, 0x7fff)
+		}
+		a.emit(iInstr(op, a.gpr(args[1]), a.gpr(args[0]), imm))
+	} else if op, ok := memType[m]; ok {
+		a.nargs(s, 2)
+		offset, base := a.mem(args[1])
+		a.checkRange(offset, -0x8000, 0x7fff)
+		a.emit(iInstr(op, base, a.gpr(args[0]), offset))
+	} else if op, ok := branch2Type[m]; ok {
+		a.nargs(s, 3)
+		a.emit(iInstr(op, a.gpr(args[0]), a.gpr(args[1]), a.branch(pc, args[2])))
+	} else if op, ok := branch1Type[m]; ok {
+		a.nargs(s, 2)
+		a.emit(iInstr(op, a.gpr(args[0]), 0, a.branch(pc, args[1])))
+	} else if rt, ok := regimmType[m]; ok {
+		a.nargs(s, 2)
+		a.emit(iInstr(opRegimm, a.gpr(args[0]), rt, a.branch(pc, args[1])))
+	} else if funct, ok := vuType[m]; ok {
+		a.vectorOp(s, funct)
+	} else if funct, ok := vuSingleType[m]; ok {
+		a.nargs(s, 2)
+		vd, vt := a.vreg(args[0]), a.vreg(args[1])
+		a.emit(vuInstr(funct, vt.broadcast(a), vt.n, vd.lane(a), vd.n))
+	} else if op, ok := vmemType[m]; ok {
+		a.nargs(s, 2)
+		vt := a.vreg(args[0])
+		offset, base := a.mem(args[1])
+		if offset%int64(op[1]) != 0 {
+			a.fail("offset %d is not a multiple of %d", offset, op[1])
+		}
+		offset /= int64(op[1])
+		a.checkRange(offset, -64, 63)
+		instr := uint32(opLWC2)
+		if m[0] == 's' {
+			instr = opSWC2
+		}
+		a.emit(vmemInstr(instr, base, vt.n, op[0], vt.byteOffset(a), offset))
+	} else {
+		a.special(s, pc)
+	}
+}
+
+func (a *assembler) vectorOp(s statement, funct uint32) {
+	args := s.args
+	if s.mnemonic == "vsar" {
+		// vsar vd, [vs, ]ACC_xx
+		if len(args) != 2 && len(args) != 3 {
+			a.nargs(s, 2)
+		}
+		e, ok := accNames[strings.ToUpper(args[len(args)-1])]
+		if !ok {
+			a.fail("expected accumulator slice, got %s", args[len(args)-1])
+		}
+		var vs uint32
+		if len(args) == 3 {
+			vs = a.vreg(args[1]).plain(a)
+		}
+		a.emit(vuInstr(funct, e, 0, vs, a.vreg(args[0]).plain(a)))
+		return
+	}
+
+	a.nargs(s, 3)
+	vd, vs, vt := a.vreg(args[0]), a.vreg(args[1]), a.vreg(args[2])
+	a.emit(vuInstr(funct, vt.broadcast(a), vt.n, vs.plain(a), vd.plain(a)))
+}
+
+// special assembles instructions with irregular operands and
+// pseudo-instructions.
+func (a *assembler) special(s statement, pc int64) {
+	m, args := s.mnemonic, s.args
+	switch m {
+	case "nop":
+		a.nargs(s, 0)
+		a.emit(0)
+	case "vnop":
+		a.nargs(s, 0)
+		a.emit(vuInstr(0x37, 0, 0, 0, 0))
+	case "break":
+		var code int64
+		if len(args) > 0 {
+			a.nargs(s, 1)
+			code = a.expr(args[0])
+			a.checkRange(code, 0, 0xfffff)
+		}
+		a.emit(rInstr(0x0d, 0, 0, 0, 0) | uint32(code)<<6)
+	case "move":
+		a.nargs(s, 2)
+		a.emit(rInstr(rType["addu"], a.gpr(args[1]), 0, a.gpr(args[0]), 0))
+	case "li", "la":
+		a.nargs(s, 2)
+		a.loadImmediate(a.gpr(args[0]), args[1])
+	case "lui":
+		a.nargs(s, 2)
+		imm := a.expr(args[1])
+		a.checkRange(imm, 0, 0xffff)
+		a.emit(iInstr(0x0f, 0, a.gpr(args[0]), imm))
+	case "b":
+		a.nargs(s, 1)
+		a.emit(iInstr(branch2Type["beq"], 0, 0, a.branch(pc, args[0])))
+	case "beqz", "bnez":
+		a.nargs(s, 2)
+		op := branch2Type["beq"]
+		if m == "bnez" {
+			op = branch2Type["bne"]
+		}
+		a.emit(iInstr(op, a.gpr(args[0]), 0, a.branch(pc, args[1])))
+	case "j", "jal":
+		a.nargs(s, 1)
+		target := a.expr(args[0])
+		if a.final && target&3 != 0 {
+			a.fail("misaligned jump target")
+		}
+		a.checkRange(target, 0, memSize-4)
+		op := uint32(0x02)
+		if m == "jal" {
+			op = 0x03
+		}
+		a.emit(jInstr(op, target))
+	case "jr":
+		a.nargs(s, 1)
+		a.emit(rInstr(0x08, a.gpr(args[0]), 0, 0, 0))
+	case "jalr":
+		rd := uint32(31)
+		if len(args) == 2 {
+			rd = a.gpr(args[0])
+			args = args[1:]
+		}
+		if len(args) != 1 {
+			a.nargs(s, 1)
+		}
+		a.emit(rInstr(0x09, a.gpr(args[0]), 0, rd, 0))
+	case "mfc0", "mtc0":
+		a.nargs(s, 2)
+		rs := map[string]uint32{"mfc0": 0, "mtc0": 4}[m]
+		a.emit(copInstr(opCop0, rs, a.gpr(args[0]), a.cop0(args[1]), 0))
+	case "mfc2", "mtc2":
+		a.nargs(s, 2)
+		rs := map[string]uint32{"mfc2": 0, "mtc2": 4}[m]
+		v := a.vreg(args[1])
+		a.emit(copInstr(opCop2, rs, a.gpr(args[0]), v.n, v.byteOffset(a)))
+	case "cfc2", "ctc2":
+		a.nargs(s, 2)
+		rs := map[string]uint32{"cfc2": 2, "ctc2": 6}[m]
+		name := strings.TrimPrefix(args[1], "$")
+		vcr, ok := vcrNames[strings.ToLower(name)]
+		if !ok {
+			a.fail("expected vector control register, got %s", args[1])
+		}
+		a.emit(copInstr(opCop2, rs, a.gpr(args[0]), vcr, 0))
+	default:
+		a.fail("unknown instruction %s", m)
+	}
+}
+
+// loadImmediate emits li, which needs one instruction for values that fit in
+// 16 bits and two otherwise.  The size is decided in the first pass and must
+// not change afterwards.
+func (a *assembler) loadImmediate(rt uint32, arg string) {
+	v := a.expr(arg)
+	if !a.final {
+		a.li[a.stmt] = a.undefined || v < -0x8000 || v > 0xffff
+	}
+	a.checkRange(v, -1<<31, 1<<32-1)
+
+	switch {
+	case a.li[a.stmt]:
+		a.emit(iInstr(0x0f, 0, rt, v>>16))
+		a.emit(iInstr(iType["ori"], rt, rt, v))
+	case v < 0:
+		a.emit(iInstr(iType["addiu"], 0, rt, v))
+	default:
+		a.emit(iInstr(iType["ori"], 0, rt, v))
+	}
+}
+
+func (a *assembler) branch(pc int64, arg string) int64 {
+	offset := a.expr(arg) - (pc + 4)
+	if offset&3 != 0 {
+		a.fail("misaligned branch target")
+	}
+	offset >>= 2
+	a.checkRange(offset, -0x8000, 0x7fff)
+	return offset
+}
+
+func (a *assembler) gpr(arg string) uint32 {
+	name, ok := strings.CutPrefix(arg, "$")
+	if !ok {
+		a.fail("expected register, got %s", arg)
+	}
+	if r, ok := gprNames[name]; ok {
+		return r
+	}
+	if n, err := strconv.Atoi(name); err == nil && n >= 0 && n < 32 {
+		return uint32(n)
+	}
+	a.fail("unknown register %s", arg)
+	return 0
+}
+
+func (a *assembler) cop0(arg string) uint32 {
+	name, ok := strings.CutPrefix(arg, "$c")
+	if n, err := strconv.Atoi(name); ok && err == nil && n >= 0 && n < 16 {
+		return uint32(n)
+	}
+	a.fail("expected cop0 register, got %s", arg)
+	return 0
+}
+
+// vreg is a vector register with an optional element suffix: .eN selects a
+// single lane, .hN and .qN select halves and quarters of lanes.
+type vreg struct {
+	n    uint32
+	kind byte // 0, 'e', 'h' or 'q'
+	idx  uint32
+}
+
+var vregRegexp = regexp.MustCompile(`^\$v(\d+)(?:\.([ehq])(\d))?$`)
+
+func (a *assembler) vreg(arg string) vreg {
+	m := vregRegexp.FindStringSubmatch(strings.ToLower(arg))
+	if m == nil {
+		a.fail("expected vector register, got %s", arg)
+	}
+	n, _ := strconv.Atoi(m[1])
+	idx, _ := strconv.Atoi(m[3])
+	v := vreg{n: uint32(n), idx: uint32(idx)}
+	if m[2] != "" {
+		v.kind = m[2][0]
+	}
+	limit := map[byte]int{0: 1, 'e': 8, 'h': 4, 'q': 2}[v.kind]
+	if n > 31 || idx >= limit {
+		a.fail("invalid vector register %s", arg)
+	}
+	return v
+}
+
+func (v vreg) plain(a *assembler) uint32 {
+	if v.kind != 0 {
+		a.fail("element not allowed for $v%d", v.n)
+	}
+	return v.n
+}
+
+// broadcast returns the element field of computational instructions.
+func (v vreg) broadcast(a *assembler) uint32 {
+	switch v.kind {
+	case 'q':
+		return 2 + v.idx
+	case 'h':
+		return 4 + v.idx
+	case 'e':
+		return 8 + v.idx
+	}
+	return 0
+}
+
+// lane returns the destination lane of single lane instructions.
+func (v vreg) lane(a *assembler) uint32 {
+	if v.kind != 0 && v.kind != 'e' {
+		a.fail("expected single lane for $v%d", v.n)
+	}
+	return v.idx
+}
+
+// byteOffset returns the element field of loads, stores and moves, which
+// address bytes instead of lanes.
+func (v vreg) byteOffset(a *assembler) uint32 {
+	return v.lane(a) * 2
+}
+
+// mem parses memory operands of the form offset(base).  The base register
+// defaults to $zero.
+func (a *assembler) mem(arg string) (offset int64, base uint32) {
+	if strings.HasSuffix(arg, ")") {
+		if i := strings.LastIndexByte(arg, '('); i >= 0 && strings.HasPrefix(arg[i+1:], "$") {
+			base = a.gpr(arg[i+1 : len(arg)-1])
+			arg = strings.TrimSpace(arg[:i])
+			if arg == "" {
+				return 0, base
+			}
+		}
+	}
+	return a.expr(arg), base
+}
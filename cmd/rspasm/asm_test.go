@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+)
+
+func words(b []byte) (w []uint32) {
+	for ; len(b) >= 4; b = b[4:] {
+		w = append(w, binary.BigEndian.Uint32(b))
+	}
+	return w
+}
+
+func TestEncoding(t *testing.T) {
+	tests := map[string]struct {
+		src  string
+		want []uint32
+	}{
+		"Nop":      {"nop", []uint32{0x00000000}},
+		"Addiu":    {"addiu $sp, $sp, -16", []uint32{0x27bdfff0}},
+		"Lui":      {"lui $t1, 0xa400", []uint32{0x3c09a400}},
+		"Lw":       {"lw $t1, 0($t1)", []uint32{0x8d290000}},
+		"Sw":       {"sw $t2, 0($at)", []uint32{0xac2a0000}},
+		"Absolute": {".set FOO, 0x20\nlw $t0, FOO+4", []uint32{0x8c080024}},
+		"Sll":      {"sll $t0, $t1, 4", []uint32{0x00094100}},
+		"Srlv":     {"srlv $t0, $t1, $t2", []uint32{0x01494006}},
+		"Or":       {"or $a0, $a1, $zero", []uint32{0x00a02025}},
+		"Move":     {"move $a0, $a1", []uint32{0x00a02021}},
+		"Jr":       {"jr $ra", []uint32{0x03e00008}},
+		"Break":    {"break", []uint32{0x0000000d}},
+		"J":        {"j 0x100", []uint32{0x08000040}},
+		"Jal":      {"nop\nfoo: jal foo", []uint32{0x00000000, 0x0c000001}},
+		"Branch":   {"loop: addiu $t0, $t0, -1\nbnez $t0, loop\nnop", []uint32{0x2508ffff, 0x1500fffe, 0}},
+		"Forward":  {"beq $t0, $t1, end\nnop\nend:", []uint32{0x11090001, 0}},
+		"Bgez":     {"x: bgez $a0, x", []uint32{0x0481ffff}},
+		"LiSmall":  {"li $t0, 0x1234", []uint32{0x34081234}},
+		"LiNeg":    {"li $t0, -2", []uint32{0x2408fffe}},
+		"LiLarge":  {"li $t0, 0x12345678", []uint32{0x3c081234, 0x35085678}},
+		"LiLabel":  {"li $t0, foo\nfoo:", []uint32{0x3c080000, 0x35080008}},
+		"Mtc0":     {"mtc0 $t0, $c4", []uint32{0x40882000}},
+		"Mfc0":     {"mfc0 $t9, $c6", []uint32{0x40193000}},
+		"Mtc2":     {"mtc2 $t0, $v1.e2", []uint32{0x48880a00}},
+		"Mfc2":     {"mfc2 $t0, $v31.e7", []uint32{0x4808ff00}},
+		"Cfc2":     {"cfc2 $t0, $vcc", []uint32{0x48480800}},
+		"Ctc2":     {"ctc2 $t0, $vcc", []uint32{0x48c80800}},
+		"Vxor":     {"vxor $v0, $v0, $v0", []uint32{0x4a00002c}},
+		"Vmudh":    {"vmudh $v1, $v2, $v3.e0", []uint32{0x4b031047}},
+		"Vmadn":    {"vmadn $v1, $v2, $v3.h1", []uint32{0x4aa3104e}},
+		"Vaddc":    {"vaddc $v4, $v5, $v6.q0", []uint32{0x4a462914}},
+		"Vsar":     {"vsar $v1, ACC_MD", []uint32{0x4b20005d}},
+		"Vrcp":     {"vrcp $v1.e3, $v2.e0", []uint32{0x4b021870}},
+		"Vrcph":    {"vrcph $v1.e0, $v0.e0", []uint32{0x4b000072}},
+		"Vnop":     {"vnop", []uint32{0x4a000037}},
+		"Lqv":      {"lqv $v1, 16($t0)", []uint32{0xc9012001}},
+		"Sqv":      {"sqv $v1, 0($t0)", []uint32{0xe9012000}},
+		"Ldv":      {"ldv $v2.e4, 8($t0)", []uint32{0xc9021c01}},
+		"Ssv":      {"ssv $v24.e2, 6($k0)", []uint32{0xeb580a03}},
+		"Slv":      {"slv $v3.e0, -4($t0)", []uint32{0xe903107f}},
+		"Luv":      {"luv $v28, 8($k1)", []uint32{0xcb7c3801}},
+		"Macro":    {".macro twice r\naddu \\r, \\r, \\r\naddu \\r, \\r, \\r\n.endm\ntwice $t0", []uint32{0x01084021, 0x01084021}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			text, _, err := assemble(tc.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := words(text); !slices.Equal(got, tc.want) {
+				t.Fatalf("expected %08x, got %08x", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestData(t *testing.T) {
+	src := `
+	.data
+a:	.word 0x11223344, b
+b:	.half 0x5566, -1
+	.byte 7
+	.align 4
+c:	.space 16
+	.text
+	lw $t0, c
+`
+	text, data, err := assemble(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0x11, 0x22, 0x33, 0x44, 0, 0, 0, 8, 0x55, 0x66, 0xff, 0xff, 7}
+	if !bytes.Equal(data, want) {
+		t.Fatalf("expected %x, got %x", want, data)
+	}
+	if got := words(text); !slices.Equal(got, []uint32{0x8c080010}) {
+		t.Fatalf("expected 8c080010, got %08x", got)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := map[string]string{
+		"Unknown":     "frob $t0",
+		"Register":    "addu $t0, $t1, $x9",
+		"Operands":    "addu $t0, $t1",
+		"Immediate":   "addiu $t0, $t0, 0x8000",
+		"Undefined":   "j nowhere",
+		"Redefined":   "a: nop\na: nop",
+		"Misaligned":  "lqv $v1, 8($t0)",
+		"Element":     "vadd $v1.e0, $v2, $v3",
+		"VectorRange": "vadd $v32, $v2, $v3",
+		"DataInstr":   ".data\nnop",
+		"MacroArgs":   ".macro m a\nnop\n.endm\nm",
+		"MissingEndm": ".macro m\nnop",
+	}
+
+	for name, src := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := assemble(src); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// binaryOps lists the binary operators by increasing precedence.
+var binaryOps = [][]string{
+	{"|"}, {"^"}, {"&"}, {"<<", ">>"}, {"+", "-"}, {"*", "/", "%"},
+}
+
+// exprParser evaluates integer expressions with C operators and precedence.
+type exprParser struct {
+	a   *assembler
+	src string
+	pos int
+}
+
+// expr evaluates an expression.  Undefined symbols evaluate to zero in the
+// first pass and are an error in the second pass.
+func (a *assembler) expr(src string) int64 {
+	a.undefined = false
+	p := &exprParser{a: a, src: src}
+	v := p.binary(0)
+	p.skipSpace()
+	if p.pos != len(p.src) {
+		a.fail("invalid expression %q", src)
+	}
+	return v
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *exprParser) operator(ops []string) string {
+	p.skipSpace()
+	for _, op := range ops {
+		if strings.HasPrefix(p.src[p.pos:], op) {
+			p.pos += len(op)
+			return op
+		}
+	}
+	return ""
+}
+
+func (p *exprParser) binary(level int) int64 {
+	if level == len(binaryOps) {
+		return p.unary()
+	}
+	v := p.binary(level + 1)
+	for {
+		op := p.operator(binaryOps[level])
+		if op == "" {
+			return v
+		}
+		w := p.binary(level + 1)
+		switch op {
+		case "|":
+			v |= w
+		case "^":
+			v ^= w
+		case "&":
+			v &= w
+		case "<<":
+			v <<= w
+		case ">>":
+			v >>= w
+		case "+":
+			v += w
+		case "-":
+			v -= w
+		case "*":
+			v *= w
+		case "/", "%":
+			if w == 0 {
+				p.a.fail("division by zero")
+			}
+			if op == "/" {
+				v /= w
+			} else {
+				v %= w
+			}
+		}
+	}
+}
+
+func (p *exprParser) unary() int64 {
+	switch p.operator([]string{"-", "~", "+", "("}) {
+	case "-":
+		return -p.unary()
+	case "~":
+		return ^p.unary()
+	case "+":
+		return p.unary()
+	case "(":
+		v := p.binary(0)
+		if p.operator([]string{")"}) == "" {
+			p.a.fail("missing ) in %q", p.src)
+		}
+		return v
+	}
+
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := rune(p.src[p.pos])
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '_' && c != '.' {
+			break
+		}
+		p.pos++
+	}
+	token := p.src[start:p.pos]
+	if token == "" {
+		p.a.fail("invalid expression %q", p.src)
+	}
+
+	if unicode.IsDigit(rune(token[0])) {
+		v, err := strconv.ParseInt(token, 0, 64)
+		if err != nil {
+			p.a.fail("invalid number %s", token)
+		}
+		return v
+	}
+
+	v, ok := p.a.symbols[token]
+	if !ok {
+		if p.a.final {
+			p.a.fail("undefined symbol %s", token)
+		}
+		p.a.undefined = true
+	}
+	return v
+}
@@ -0,0 +1,134 @@
+package main
+
+// Opcodes of the RSP's scalar unit, which implements a subset of MIPS R4000
+// without multiplication, division, 64-bit operations and most exceptions.
+const (
+	opSpecial = 0x00
+	opRegimm  = 0x01
+	opCop0    = 0x10
+	opCop2    = 0x12
+	opLWC2    = 0x32
+	opSWC2    = 0x3a
+)
+
+// Instructions by operand format.
+var (
+	// rd, rs, rt
+	rType = map[string]uint32{
+		"add": 0x20, "addu": 0x21, "sub": 0x22, "subu": 0x23,
+		"and": 0x24, "or": 0x25, "xor": 0x26, "nor": 0x27,
+		"slt": 0x2a, "sltu": 0x2b,
+	}
+
+	// rd, rt, sa
+	shiftType = map[string]uint32{
+		"sll": 0x00, "srl": 0x02, "sra": 0x03,
+	}
+
+	// rd, rt, rs
+	shiftVarType = map[string]uint32{
+		"sllv": 0x04, "srlv": 0x06, "srav": 0x07,
+	}
+
+	// rt, rs, imm
+	iType = map[string]uint32{
+		"addi": 0x08, "addiu": 0x09, "slti": 0x0a, "sltiu": 0x0b,
+		"andi": 0x0c, "ori": 0x0d, "xori": 0x0e,
+	}
+
+	// rt, offset(base)
+	memType = map[string]uint32{
+		"lb": 0x20, "lh": 0x21, "lw": 0x23, "lbu": 0x24, "lhu": 0x25,
+		"sb": 0x28, "sh": 0x29, "sw": 0x2b,
+	}
+
+	// rs, rt, label
+	branch2Type = map[string]uint32{
+		"beq": 0x04, "bne": 0x05,
+	}
+
+	// rs, label
+	branch1Type = map[string]uint32{
+		"blez": 0x06, "bgtz": 0x07,
+	}
+
+	// rs, label
+	regimmType = map[string]uint32{
+		"bltz": 0x00, "bgez": 0x01, "bltzal": 0x10, "bgezal": 0x11,
+	}
+
+	// vd, vs, vt[e]
+	vuType = map[string]uint32{
+		"vmulf": 0x00, "vmulu": 0x01, "vrndp": 0x02, "vmulq": 0x03,
+		"vmudl": 0x04, "vmudm": 0x05, "vmudn": 0x06, "vmudh": 0x07,
+		"vmacf": 0x08, "vmacu": 0x09, "vrndn": 0x0a, "vmacq": 0x0b,
+		"vmadl": 0x0c, "vmadm": 0x0d, "vmadn": 0x0e, "vmadh": 0x0f,
+		"vadd": 0x10, "vsub": 0x11, "vabs": 0x13, "vaddc": 0x14,
+		"vsubc": 0x15, "vsar": 0x1d,
+		"vlt": 0x20, "veq": 0x21, "vne": 0x22, "vge": 0x23,
+		"vcl": 0x24, "vch": 0x25, "vcr": 0x26, "vmrg": 0x27,
+		"vand": 0x28, "vnand": 0x29, "vor": 0x2a, "vnor": 0x2b,
+		"vxor": 0x2c, "vnxor": 0x2d,
+	}
+
+	// vd[de], vt[e]
+	vuSingleType = map[string]uint32{
+		"vrcp": 0x30, "vrcpl": 0x31, "vrcph": 0x32, "vmov": 0x33,
+		"vrsq": 0x34, "vrsql": 0x35, "vrsqh": 0x36,
+	}
+
+	// vt[e], offset(base), the value is the opcode and the access size
+	vmemType = map[string][2]uint32{
+		"lbv": {0, 1}, "lsv": {1, 2}, "llv": {2, 4}, "ldv": {3, 8},
+		"lqv": {4, 16}, "lrv": {5, 16}, "lpv": {6, 8}, "luv": {7, 8},
+		"lhv": {8, 16}, "lfv": {9, 16}, "ltv": {11, 16},
+		"sbv": {0, 1}, "ssv": {1, 2}, "slv": {2, 4}, "sdv": {3, 8},
+		"sqv": {4, 16}, "srv": {5, 16}, "spv": {6, 8}, "suv": {7, 8},
+		"shv": {8, 16}, "sfv": {9, 16}, "swv": {10, 16}, "stv": {11, 16},
+	}
+)
+
+var gprNames = map[string]uint32{
+	"zero": 0, "at": 1, "v0": 2, "v1": 3,
+	"a0": 4, "a1": 5, "a2": 6, "a3": 7,
+	"t0": 8, "t1": 9, "t2": 10, "t3": 11,
+	"t4": 12, "t5": 13, "t6": 14, "t7": 15,
+	"s0": 16, "s1": 17, "s2": 18, "s3": 19,
+	"s4": 20, "s5": 21, "s6": 22, "s7": 23,
+	"t8": 24, "t9": 25, "k0": 26, "k1": 27,
+	"gp": 28, "sp": 29, "fp": 30, "s8": 30, "ra": 31,
+}
+
+// Control registers of the vector unit
+var vcrNames = map[string]uint32{
+	"vco": 0, "vcc": 1, "vce": 2,
+}
+
+// Accumulator slices for vsar
+var accNames = map[string]uint32{
+	"ACC_HI": 8, "ACC_MD": 9, "ACC_LO": 10,
+}
+
+func rInstr(funct, rs, rt, rd, sa uint32) uint32 {
+	return opSpecial<<26 | rs<<21 | rt<<16 | rd<<11 | sa<<6 | funct
+}
+
+func iInstr(op, rs, rt uint32, imm int64) uint32 {
+	return op<<26 | rs<<21 | rt<<16 | uint32(imm)&0xffff
+}
+
+func jInstr(op uint32, target int64) uint32 {
+	return op<<26 | uint32(target>>2)&0x3ff_ffff
+}
+
+func copInstr(op, rs, rt, rd, element uint32) uint32 {
+	return op<<26 | rs<<21 | rt<<16 | rd<<11 | element<<7
+}
+
+func vuInstr(funct, e, vt, vs, vd uint32) uint32 {
+	return opCop2<<26 | 1<<25 | e<<21 | vt<<16 | vs<<11 | vd<<6 | funct
+}
+
+func vmemInstr(op, base, vt, opcode, element uint32, offset int64) uint32 {
+	return op<<26 | base<<21 | vt<<16 | opcode<<11 | element<<7 | uint32(offset)&0x7f
+}
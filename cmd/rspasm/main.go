@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const usageString = `RSP microcode assembler.
+
+Writes the text section, which is loaded into IMEM, and the data section,
+which is loaded into DMEM, to separate files.
+
+Usage: %s [flags] <sourcefile>
+
+`
+
+var (
+	infile   string
+	textfile = flag.String("text", "", "text section output (default <sourcefile>.text)")
+	datafile = flag.String("data", "", "data section output (default <sourcefile>.data)")
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), usageString, os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 1 {
+		infile = flag.Arg(0)
+	} else {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	base := strings.TrimSuffix(infile, filepath.Ext(infile))
+	if *textfile == "" {
+		*textfile = base + ".text"
+	}
+	if *datafile == "" {
+		*datafile = base + ".data"
+	}
+
+	src := must(os.ReadFile(infile))
+	text, data, err := assemble(string(src))
+	if err != nil {
+		fmt.Printf("%s: %v\n", infile, err)
+		os.Exit(1)
+	}
+
+	must(0, os.WriteFile(*textfile, text, 0644))
+	must(0, os.WriteFile(*datafile, data, 0644))
+}
+
+func must[T any](ret T, err error) T {
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return ret
+}
@@ -0,0 +1,217 @@
+// Package symtab implements the symbol table, which cmd/mkrom -symbols appends
+// to the ROM.  It maps program addresses to functions, files and lines, so
+// exceptions and panics can be reported with symbolized frames, even if
+// function names were stripped from the program with GOSTRIPFN.
+//
+// The table consists of 32-bit words only, because the CPU can't read single
+// bytes from the cartridge.  Lookups don't allocate, so they can be used by
+// exception handlers.
+package symtab
+
+import (
+	"cmp"
+	"encoding/binary"
+	"slices"
+)
+
+// Table layout, all values are big endian words:
+//
+//	0x00 magic "N64S"
+//	0x04 number of functions, lines, files
+//	0x10 functions, sorted by address: address, size, name offset, name length
+//	.... lines, sorted by address: address, file index<<20 | line
+//	.... files: name offset, name length
+//	.... names, padded to a multiple of 4 bytes
+//
+// A line applies from its address up to the address of the next line.  Line
+// zero marks addresses without line information.  Offsets are relative to
+// the start of the table.
+const (
+	Magic      = 0x4e363453 // "N64S"
+	headerSize = 0x10
+	funcSize   = 16
+	lineSize   = 8
+	fileSize   = 8
+
+	MaxFiles = 1 << 12
+	MaxLine  = 1<<20 - 1
+)
+
+// WordReader reads the word at an offset of the table.
+type WordReader interface {
+	Word(off uint32) uint32
+}
+
+// String is the location of a name in the table.
+type String struct {
+	Off, Len uint32
+}
+
+// Frame is the symbolized location of a program address.
+type Frame struct {
+	Func String
+	File String // zero length if unknown
+	Line int    // zero if unknown
+}
+
+// Valid reports whether r holds a symbol table.
+//
+//go:nosplit
+func Valid(r WordReader) bool {
+	return r.Word(0) == Magic
+}
+
+// Lookup returns the frame of the function containing pc.
+//
+//go:nosplit
+func Lookup(r WordReader, pc uint32) (f Frame, ok bool) {
+	nfuncs, nlines := r.Word(4), r.Word(8)
+	funcs := uint32(headerSize)
+	i, ok := search(r, funcs, funcSize, nfuncs, pc)
+	if !ok {
+		return f, false
+	}
+	e := funcs + i*funcSize
+	start := r.Word(e)
+	if pc-start >= r.Word(e+4) {
+		return f, false
+	}
+	f.Func = String{r.Word(e + 8), r.Word(e + 12)}
+
+	lines := funcs + nfuncs*funcSize
+	i, ok = search(r, lines, lineSize, nlines, pc)
+	if !ok || r.Word(lines+i*lineSize) < start {
+		return f, true
+	}
+	v := r.Word(lines + i*lineSize + 4)
+	if v&MaxLine == 0 {
+		return f, true
+	}
+	file := lines + nlines*lineSize + v>>20*fileSize
+	f.File = String{r.Word(file), r.Word(file + 4)}
+	f.Line = int(v & MaxLine)
+	return f, true
+}
+
+// search returns the index of the last of n entries starting at or before
+// pc.
+//
+//go:nosplit
+func search(r WordReader, base, size, n, pc uint32) (uint32, bool) {
+	lo, hi := uint32(0), n
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		if r.Word(base+mid*size) <= pc {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo - 1, lo > 0
+}
+
+// ReadString copies up to len(buf) bytes of s to buf and returns the number
+// of bytes copied.
+//
+//go:nosplit
+func ReadString(r WordReader, s String, buf []byte) int {
+	n := min(int(s.Len), len(buf))
+	for i := 0; i < n; i++ {
+		off := s.Off + uint32(i)
+		buf[i] = byte(r.Word(off&^3) >> (24 - 8*(off&3)))
+	}
+	return n
+}
+
+// Func is a function in the program.
+type Func struct {
+	Name       string
+	Addr, Size uint32
+}
+
+// Line is the start of the code of a source line.
+type Line struct {
+	Addr uint32
+	File string
+	Line int // zero for addresses without line information
+}
+
+// Marshal returns the table of funcs and lines.  Consecutive lines with the
+// same location are merged.  Lines of files beyond MaxFiles, or numbered
+// beyond MaxLine, are stored as unknown.
+func Marshal(funcs []Func, lines []Line) []byte {
+	funcs = slices.Clone(funcs)
+	slices.SortStableFunc(funcs, func(a, b Func) int { return cmp.Compare(a.Addr, b.Addr) })
+	lines = slices.Clone(lines)
+	slices.SortStableFunc(lines, func(a, b Line) int { return cmp.Compare(a.Addr, b.Addr) })
+
+	var names []byte
+	nameOffsets := make(map[string]uint32)
+	name := func(s string) uint32 {
+		off, ok := nameOffsets[s]
+		if !ok {
+			off = uint32(len(names))
+			nameOffsets[s] = off
+			names = append(names, s...)
+		}
+		return off
+	}
+
+	var files []string
+	fileIndex := make(map[string]uint32)
+	var rows [][2]uint32
+	for _, l := range lines {
+		var v uint32
+		if l.Line > 0 && l.Line <= MaxLine {
+			i, ok := fileIndex[l.File]
+			if !ok && len(files) < MaxFiles {
+				i, ok = uint32(len(files)), true
+				fileIndex[l.File] = i
+				files = append(files, l.File)
+			}
+			if ok {
+				v = i<<20 | uint32(l.Line)
+			}
+		}
+		if n := len(rows); n > 0 && rows[n-1][1] == v {
+			continue
+		}
+		if n := len(rows); n > 0 && rows[n-1][0] == l.Addr {
+			rows[n-1][1] = v
+			continue
+		}
+		rows = append(rows, [2]uint32{l.Addr, v})
+	}
+
+	b := binary.BigEndian.AppendUint32(nil, Magic)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(funcs)))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(rows)))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(files)))
+	namesStart := uint32(headerSize + len(funcs)*funcSize + len(rows)*lineSize + len(files)*fileSize)
+	for _, f := range funcs {
+		b = binary.BigEndian.AppendUint32(b, f.Addr)
+		b = binary.BigEndian.AppendUint32(b, f.Size)
+		b = binary.BigEndian.AppendUint32(b, namesStart+name(f.Name))
+		b = binary.BigEndian.AppendUint32(b, uint32(len(f.Name)))
+	}
+	for _, row := range rows {
+		b = binary.BigEndian.AppendUint32(b, row[0])
+		b = binary.BigEndian.AppendUint32(b, row[1])
+	}
+	for _, f := range files {
+		b = binary.BigEndian.AppendUint32(b, namesStart+name(f))
+		b = binary.BigEndian.AppendUint32(b, uint32(len(f)))
+	}
+	b = append(b, names...)
+	return append(b, make([]byte, -len(b)&3)...)
+}
+
+// Bytes implements WordReader for a table in memory.
+type Bytes []byte
+
+func (b Bytes) Word(off uint32) uint32 {
+	if uint64(off)+4 > uint64(len(b)) {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b[off:])
+}
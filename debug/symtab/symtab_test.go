@@ -0,0 +1,112 @@
+package symtab
+
+import (
+	"testing"
+)
+
+var (
+	testFuncs = []Func{
+		{"main.main", 0x1000, 0x40},
+		{"runtime.morestack", 0x400, 0x20},
+		{"main.(*T).Method", 0x1040, 0x10},
+		{"main.helper", 0x1080, 0x30}, // gap before
+	}
+	testLines = []Line{
+		{0x1000, "/src/main.go", 10},
+		{0x1008, "/src/main.go", 11},
+		{0x100c, "/src/main.go", 11}, // merged
+		{0x1010, "/src/util.go", 3},
+		{0x1020, "", 0},
+		{0x1040, "/src/main.go", 20},
+		{0x1080, "/src/main.go", MaxLine + 1},
+		{0x400, "/go/src/runtime/asm.s", 7},
+	}
+)
+
+func str(r WordReader, s String) string {
+	buf := make([]byte, s.Len)
+	return string(buf[:ReadString(r, s, buf)])
+}
+
+func TestLookup(t *testing.T) {
+	tab := Bytes(Marshal(testFuncs, testLines))
+	if !Valid(tab) {
+		t.Fatal("expected valid table")
+	}
+
+	tests := map[string]struct {
+		pc   uint32
+		fn   string
+		file string
+		line int
+	}{
+		"Start":      {0x1000, "main.main", "/src/main.go", 10},
+		"Middle":     {0x1004, "main.main", "/src/main.go", 10},
+		"NextLine":   {0x100c, "main.main", "/src/main.go", 11},
+		"OtherFile":  {0x101c, "main.main", "/src/util.go", 3},
+		"NoLine":     {0x1020, "main.main", "", 0},
+		"Method":     {0x104c, "main.(*T).Method", "/src/main.go", 20},
+		"LineRange":  {0x1080, "main.helper", "", 0},
+		"FirstFunc":  {0x41c, "runtime.morestack", "/go/src/runtime/asm.s", 7},
+		"LineBefore": {0x1090, "main.helper", "", 0},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, ok := Lookup(tab, tc.pc)
+			if !ok {
+				t.Fatal("expected frame")
+			}
+			if fn := str(tab, f.Func); fn != tc.fn {
+				t.Errorf("expected function %q, got %q", tc.fn, fn)
+			}
+			if file := str(tab, f.File); file != tc.file {
+				t.Errorf("expected file %q, got %q", tc.file, file)
+			}
+			if f.Line != tc.line {
+				t.Errorf("expected line %d, got %d", tc.line, f.Line)
+			}
+		})
+	}
+}
+
+func TestLookupMissing(t *testing.T) {
+	tab := Bytes(Marshal(testFuncs, testLines))
+	for _, pc := range []uint32{0, 0x3fc, 0x420, 0x1050, 0x10b0, 0xffffffff} {
+		if f, ok := Lookup(tab, pc); ok {
+			t.Errorf("%#x: expected no frame, got %+v", pc, f)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tab := Bytes(Marshal(testFuncs, testLines))
+	// 0x100c is merged into 0x1008
+	if lines := tab.Word(8); lines != 7 {
+		t.Errorf("expected 7 lines, got %d", lines)
+	}
+	if files := tab.Word(12); files != 3 {
+		t.Errorf("expected 3 files, got %d", files)
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	tab := Bytes(Marshal(nil, nil))
+	if !Valid(tab) {
+		t.Fatal("expected valid table")
+	}
+	if _, ok := Lookup(tab, 0x400); ok {
+		t.Error("expected no frame")
+	}
+	if Valid(Bytes(nil)) {
+		t.Error("expected empty data to be invalid")
+	}
+}
+
+func TestReadString(t *testing.T) {
+	tab := Bytes(Marshal(testFuncs, testLines))
+	f, _ := Lookup(tab, 0x1000)
+	buf := make([]byte, 4)
+	if n := ReadString(tab, f.Func, buf); n != 4 || string(buf) != "main" {
+		t.Errorf("expected %q, got %q", "main", buf[:n])
+	}
+}
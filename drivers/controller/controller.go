@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"github.com/drpaneas/n64/drivers/controller/rumble"
 	"github.com/drpaneas/n64/rcp/serial/joybus"
 )
 
@@ -32,6 +33,8 @@ type Controller struct {
 		yAxis int8
 	}
 
+	rumble *rumble.Player
+
 	err error
 }
 
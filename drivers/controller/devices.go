@@ -0,0 +1,293 @@
+package controller
+
+import (
+	"github.com/drpaneas/n64/debug"
+	"github.com/drpaneas/n64/rcp/serial"
+	"github.com/drpaneas/n64/rcp/serial/joybus"
+)
+
+// newPortCommand returns a command block with a single command for the
+// device at port, created by newCmd.
+func newPortCommand[T any](port uint8, newCmd func(joybus.Allocator) (T, error)) (*serial.CommandBlock, T) {
+	block := serial.NewCommandBlock(serial.CmdConfigureJoybus)
+	cmd, err := joybus.NewChannelCommand(block, port, newCmd)
+	debug.AssertErrNil(err)
+	return block, cmd
+}
+
+// Device returns the device connected to the port, e.g. joybus.Mouse, which
+// selects the driver to use.
+func (p *Port) Device() joybus.Device {
+	return p.current.device
+}
+
+// Mouse is an N64 Mouse.
+type Mouse struct {
+	block *serial.CommandBlock
+	cmd   joybus.MouseStateCommand
+
+	down, last joybus.ButtonMask
+	dx, dy     int8
+}
+
+func NewMouse(port uint8) *Mouse {
+	m := &Mouse{}
+	m.block, m.cmd = newPortCommand(port, joybus.NewMouseStateCommand)
+	return m
+}
+
+// Poll reads the buttons and the motion since the last poll.
+func (m *Mouse) Poll() (err error) {
+	m.cmd.Reset()
+	serial.Run(m.block)
+	m.last = m.down
+	m.down, m.dx, m.dy, err = m.cmd.State()
+	return
+}
+
+func (m *Mouse) Down() joybus.ButtonMask {
+	return m.down
+}
+
+func (m *Mouse) Pressed() joybus.ButtonMask {
+	return (m.down ^ m.last) & m.down
+}
+
+func (m *Mouse) Released() joybus.ButtonMask {
+	return (m.down ^ m.last) & m.last
+}
+
+// Motion returns the motion since the previous poll.  Positive dy is a
+// motion away from the user.
+func (m *Mouse) Motion() (dx, dy int8) {
+	return m.dx, m.dy
+}
+
+// Keyboard is a Randnet keyboard.
+type Keyboard struct {
+	block *serial.CommandBlock
+	cmd   joybus.KeyboardCommand
+
+	keys, last [3]joybus.Key
+	status     joybus.KeyboardStatus
+}
+
+func NewKeyboard(port uint8) *Keyboard {
+	k := &Keyboard{}
+	k.block, k.cmd = newPortCommand(port, joybus.NewKeyboardCommand)
+	return k
+}
+
+// SetLEDs sets the LEDs, which are sent by the next poll.
+func (k *Keyboard) SetLEDs(leds joybus.KeyboardLEDs) {
+	k.cmd.SetLEDs(leds)
+}
+
+// Poll reads the pressed keys.
+func (k *Keyboard) Poll() (err error) {
+	k.cmd.Reset()
+	serial.Run(k.block)
+	k.last = k.keys
+	k.keys, k.status, err = k.cmd.Keys()
+	return
+}
+
+// Keys returns up to three keys held down, in the order they were pressed.
+func (k *Keyboard) Keys() []joybus.Key {
+	keys := make([]joybus.Key, 0, len(k.keys))
+	for _, key := range k.keys {
+		if key != 0 {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func held(keys [3]joybus.Key, key joybus.Key) bool {
+	return key != 0 && (keys[0] == key || keys[1] == key || keys[2] == key)
+}
+
+func (k *Keyboard) Down(key joybus.Key) bool {
+	return held(k.keys, key)
+}
+
+func (k *Keyboard) Pressed(key joybus.Key) bool {
+	return held(k.keys, key) && !held(k.last, key)
+}
+
+func (k *Keyboard) Released(key joybus.Key) bool {
+	return !held(k.keys, key) && held(k.last, key)
+}
+
+// Home reports whether the Home key is held down.
+func (k *Keyboard) Home() bool {
+	return k.status&joybus.KeyboardHome != 0
+}
+
+// Overflow reports whether more keys are held down than reported.
+func (k *Keyboard) Overflow() bool {
+	return k.status&joybus.KeyboardOverflow != 0
+}
+
+// VRU is the Voice Recognition Unit.  Its memory is accessed in blocks of 2
+// or 36 bytes for reading and 4 or 20 bytes for writing, at addresses which
+// are multiples of 32.
+type VRU struct {
+	infoBlock       *serial.CommandBlock
+	infoCmd         joybus.InfoCommand
+	read2Block      *serial.CommandBlock
+	read2Cmd        joybus.VRUReadCommand
+	read36Block     *serial.CommandBlock
+	read36Cmd       joybus.VRUReadCommand
+	write4Block     *serial.CommandBlock
+	write4Cmd       joybus.VRUWriteCommand
+	write20Block    *serial.CommandBlock
+	write20Cmd      joybus.VRUWriteCommand
+	shortWriteBlock *serial.CommandBlock
+	shortWriteCmd   joybus.VRUShortWriteCommand
+}
+
+func NewVRU(port uint8) *VRU {
+	v := &VRU{}
+	v.infoBlock, v.infoCmd = newPortCommand(port, joybus.NewInfoCommand)
+	v.read2Block, v.read2Cmd = newPortCommand(port, joybus.NewVRURead2Command)
+	v.read36Block, v.read36Cmd = newPortCommand(port, joybus.NewVRURead36Command)
+	v.write4Block, v.write4Cmd = newPortCommand(port, joybus.NewVRUWrite4Command)
+	v.write20Block, v.write20Cmd = newPortCommand(port, joybus.NewVRUWrite20Command)
+	v.shortWriteBlock, v.shortWriteCmd = newPortCommand(port, joybus.NewVRUShortWriteCommand)
+	return v
+}
+
+// Status returns the status byte of the VRU.
+func (v *VRU) Status() (byte, error) {
+	v.infoCmd.Reset()
+	serial.Run(v.infoBlock)
+	_, status, err := v.infoCmd.Info()
+	return status, err
+}
+
+// Read reads 2 or 36 bytes at addr into p.
+func (v *VRU) Read(addr uint16, p []byte) error {
+	block, cmd := v.read2Block, v.read2Cmd
+	switch len(p) {
+	case 2:
+	case 36:
+		block, cmd = v.read36Block, v.read36Cmd
+	default:
+		return joybus.ErrDataLength
+	}
+	cmd.Reset()
+	cmd.SetAddress(addr)
+	serial.Run(block)
+	data, err := cmd.Data()
+	if err != nil {
+		return err
+	}
+	copy(p, data)
+	return nil
+}
+
+// Write writes 4 or 20 bytes of p at addr.
+func (v *VRU) Write(addr uint16, p []byte) error {
+	block, cmd := v.write4Block, &v.write4Cmd
+	switch len(p) {
+	case 4:
+	case 20:
+		block, cmd = v.write20Block, &v.write20Cmd
+	default:
+		return joybus.ErrDataLength
+	}
+	cmd.Reset()
+	if err := cmd.SetData(p); err != nil {
+		return err
+	}
+	cmd.SetAddress(addr)
+	serial.Run(block)
+	return cmd.Result()
+}
+
+// ShortWrite sends addr, whose upper bits hold the value, and returns the
+// status sent in response.
+func (v *VRU) ShortWrite(addr uint16) (byte, error) {
+	v.shortWriteCmd.Reset()
+	v.shortWriteCmd.SetAddress(addr)
+	serial.Run(v.shortWriteBlock)
+	return v.shortWriteCmd.Result()
+}
+
+// GameCube is a GameCube controller connected through an adapter.  The
+// sticks and triggers are reported relative to their position when the
+// controller was powered on.
+type GameCube struct {
+	block       *serial.CommandBlock
+	cmd         joybus.GameCubeStateCommand
+	originBlock *serial.CommandBlock
+	originCmd   joybus.GameCubeOriginCommand
+
+	origin        joybus.GameCubeState
+	hasOrigin     bool
+	current, last joybus.GameCubeState
+}
+
+func NewGameCube(port uint8) *GameCube {
+	g := &GameCube{}
+	g.block, g.cmd = newPortCommand(port, joybus.NewGameCubeStateCommand)
+	g.originBlock, g.originCmd = newPortCommand(port, joybus.NewGameCubeOriginCommand)
+	return g
+}
+
+// SetRumble switches the rumble motor, which is sent by the next poll.
+func (g *GameCube) SetRumble(on bool) {
+	g.cmd.SetRumble(on)
+}
+
+// Poll reads the state of the controller and, on the first poll, its
+// origin.
+func (g *GameCube) Poll() (err error) {
+	if !g.hasOrigin {
+		g.originCmd.Reset()
+		serial.Run(g.originBlock)
+		if g.origin, err = g.originCmd.Origin(); err != nil {
+			return
+		}
+		g.hasOrigin = true
+	}
+	g.cmd.Reset()
+	serial.Run(g.block)
+	g.last = g.current
+	g.current, err = g.cmd.State()
+	if err != nil {
+		g.hasOrigin = false // reread after reconnecting
+	}
+	return
+}
+
+func (g *GameCube) Down() joybus.GameCubeButtonMask {
+	return g.current.Buttons
+}
+
+func (g *GameCube) Pressed() joybus.GameCubeButtonMask {
+	return (g.current.Buttons ^ g.last.Buttons) & g.current.Buttons
+}
+
+func (g *GameCube) Released() joybus.GameCubeButtonMask {
+	return (g.current.Buttons ^ g.last.Buttons) & g.last.Buttons
+}
+
+// relative returns v relative to origin, clamped to int8.
+func relative(v, origin uint8) int8 {
+	return int8(min(max(int(v)-int(origin), -128), 127))
+}
+
+func (g *GameCube) Stick() (x, y int8) {
+	return relative(g.current.StickX, g.origin.StickX), relative(g.current.StickY, g.origin.StickY)
+}
+
+func (g *GameCube) CStick() (x, y int8) {
+	return relative(g.current.CStickX, g.origin.CStickX), relative(g.current.CStickY, g.origin.CStickY)
+}
+
+// Triggers returns how far the analog triggers are pressed.
+func (g *GameCube) Triggers() (l, r uint8) {
+	return uint8(max(int(g.current.L)-int(g.origin.L), 0)), uint8(max(int(g.current.R)-int(g.origin.R), 0))
+}
@@ -0,0 +1,229 @@
+// Package event turns the states read by polling the controller ports into
+// events: devices plugged and unplugged, paks inserted and removed, and
+// buttons pressed and released.
+//
+// Devices and paks are debounced, as the PIF reports no device or no pak
+// for a few polls while connectors settle on insertion.
+package event
+
+import (
+	"io"
+	"sync"
+
+	"github.com/drpaneas/n64/rcp/serial/joybus"
+)
+
+// Kind is the type of an event.
+type Kind int
+
+const (
+	Plugged     Kind = iota // Device was plugged into Port
+	Unplugged               // Device was unplugged
+	PakInserted             // Pak was inserted, Pak holds the probed pak
+	PakRemoved              // Pak was removed
+	Pressed                 // Button was pressed
+	Released                // Button was released
+)
+
+var kindNames = [...]string{"plugged", "unplugged", "pak inserted", "pak removed", "pressed", "released"}
+
+func (k Kind) String() string {
+	if k < 0 || int(k) >= len(kindNames) {
+		return "unknown"
+	}
+	return kindNames[k]
+}
+
+// Event is a change of the state of a port.
+type Event struct {
+	Kind   Kind
+	Port   int               // index of the port, 0-3
+	Device joybus.Device     // connected device
+	Button joybus.ButtonMask // single button of Pressed and Released
+
+	// Pak is the pak detected on PakInserted, e.g. a *controller.RumblePak,
+	// or nil if probing failed with Err.
+	Pak io.ReaderAt
+	Err error
+}
+
+// Snapshot is the state of a port read by a single poll.
+type Snapshot struct {
+	Device  joybus.Device
+	Pak     bool // pak inserted
+	Buttons joybus.ButtonMask
+	Err     error // e.g. joybus.ErrPIFNoResponse if no device is connected
+}
+
+// DefaultDebounce is the number of consecutive polls a device or pak state
+// must be read before it is reported.
+const DefaultDebounce = 3
+
+// debouncer reports a change of a value once it was read polls times in a
+// row.
+type debouncer[T comparable] struct {
+	stable, candidate T
+	n                 int
+}
+
+func (d *debouncer[T]) update(v T, polls int) bool {
+	if v == d.stable {
+		d.n = 0
+		return false
+	}
+	if v != d.candidate {
+		d.candidate, d.n = v, 0
+	}
+	d.n++
+	if d.n < polls {
+		return false
+	}
+	d.stable, d.n = v, 0
+	return true
+}
+
+type portState struct {
+	device  debouncer[joybus.Device] // zero if no device
+	pak     debouncer[bool]
+	buttons joybus.ButtonMask
+}
+
+// Source generates events from snapshots and delivers them to subscribers.
+type Source struct {
+	probe    func(port uint8) (io.ReaderAt, error)
+	debounce int
+
+	ports [4]portState
+
+	mtx  sync.Mutex
+	subs []*func(Event)
+}
+
+// NewSource returns a source, which calls probe to detect inserted paks, like
+// controller.ProbePak.  Probe may be nil.  As probing takes several joybus
+// transactions, it is skipped while there are no subscribers.
+func NewSource(probe func(port uint8) (io.ReaderAt, error)) *Source {
+	return &Source{probe: probe, debounce: DefaultDebounce}
+}
+
+// SetDebounce sets the number of consecutive polls a device or pak state
+// must be read before it is reported.
+func (s *Source) SetDebounce(polls int) {
+	s.debounce = max(polls, 1)
+}
+
+// Subscribe calls fn with every event until cancel is called.  Fn is called
+// by Update and must not block.
+func (s *Source) Subscribe(fn func(Event)) (cancel func()) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	sub := &fn
+	s.subs = append(s.subs, sub)
+	return func() {
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		for i, v := range s.subs {
+			if v == sub {
+				s.subs = append(s.subs[:i:i], s.subs[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Chan returns a channel receiving the events until cancel is called.  If
+// the channel is full, events are dropped.
+func (s *Source) Chan(size int) (events <-chan Event, cancel func()) {
+	ch := make(chan Event, size)
+	cancel = s.Subscribe(func(e Event) {
+		select {
+		case ch <- e:
+		default:
+		}
+	})
+	return ch, cancel
+}
+
+func (s *Source) subscribed() bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return len(s.subs) > 0
+}
+
+func (s *Source) emit(e Event) {
+	s.mtx.Lock()
+	subs := s.subs
+	s.mtx.Unlock()
+	for _, fn := range subs {
+		(*fn)(e)
+	}
+}
+
+// Update generates the events of port from the snapshot of a poll.  It must
+// not be called concurrently.
+func (s *Source) Update(port int, snap Snapshot) {
+	st := &s.ports[port]
+
+	var dev joybus.Device
+	if snap.Err == nil {
+		dev = snap.Device
+	}
+	last := st.device.stable
+	if st.device.update(dev, s.debounce) {
+		if last != 0 {
+			s.unplug(port, last)
+		}
+		if dev != 0 {
+			s.emit(Event{Kind: Plugged, Port: port, Device: dev})
+		}
+	}
+	dev = st.device.stable
+	if dev == 0 {
+		return
+	}
+
+	if st.pak.update(snap.Err == nil && snap.Pak, s.debounce) {
+		e := Event{Kind: PakRemoved, Port: port, Device: dev}
+		if st.pak.stable {
+			e.Kind = PakInserted
+			if s.probe != nil && s.subscribed() {
+				e.Pak, e.Err = s.probe(uint8(port))
+			}
+		}
+		s.emit(e)
+	}
+
+	if snap.Err == nil {
+		s.buttons(port, dev, snap.Buttons)
+	}
+}
+
+// unplug emits the removal of the pak, the release of all held buttons and
+// the unplugging of the device.
+func (s *Source) unplug(port int, dev joybus.Device) {
+	st := &s.ports[port]
+	inserted := st.pak.stable
+	st.pak = debouncer[bool]{}
+	if inserted {
+		s.emit(Event{Kind: PakRemoved, Port: port, Device: dev})
+	}
+	s.buttons(port, dev, 0)
+	s.emit(Event{Kind: Unplugged, Port: port, Device: dev})
+}
+
+func (s *Source) buttons(port int, dev joybus.Device, down joybus.ButtonMask) {
+	st := &s.ports[port]
+	changed := down ^ st.buttons
+	st.buttons = down
+	for b := joybus.ButtonMask(1 << 15); changed != 0; b >>= 1 {
+		if changed&b == 0 {
+			continue
+		}
+		changed &^= b
+		kind := Released
+		if down&b != 0 {
+			kind = Pressed
+		}
+		s.emit(Event{Kind: kind, Port: port, Device: dev, Button: b})
+	}
+}
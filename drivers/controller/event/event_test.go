@@ -0,0 +1,197 @@
+package event
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/drpaneas/n64/rcp/serial/joybus"
+)
+
+var (
+	none       = Snapshot{Err: joybus.ErrPIFNoResponse}
+	controller = Snapshot{Device: joybus.Controller}
+	withPak    = Snapshot{Device: joybus.Controller, Pak: true}
+	pressA     = Snapshot{Device: joybus.Controller, Buttons: joybus.ButtonA}
+	pressAB    = Snapshot{Device: joybus.Controller, Buttons: joybus.ButtonA | joybus.ButtonB}
+)
+
+var fakePak = bytes.NewReader(nil)
+
+func probe(port uint8) (io.ReaderAt, error) {
+	return fakePak, nil
+}
+
+// repeat returns n copies of snap.
+func repeat(snap Snapshot, n int) []Snapshot {
+	s := make([]Snapshot, n)
+	for i := range s {
+		s[i] = snap
+	}
+	return s
+}
+
+func concat(s ...[]Snapshot) (r []Snapshot) {
+	for _, v := range s {
+		r = append(r, v...)
+	}
+	return
+}
+
+func TestUpdate(t *testing.T) {
+	plugged := Event{Kind: Plugged, Port: 2, Device: joybus.Controller}
+	unplugged := Event{Kind: Unplugged, Port: 2, Device: joybus.Controller}
+	inserted := Event{Kind: PakInserted, Port: 2, Device: joybus.Controller, Pak: fakePak}
+	removed := Event{Kind: PakRemoved, Port: 2, Device: joybus.Controller}
+	button := func(kind Kind, b joybus.ButtonMask) Event {
+		return Event{Kind: kind, Port: 2, Device: joybus.Controller, Button: b}
+	}
+
+	tests := map[string]struct {
+		snaps    []Snapshot
+		expected []Event
+	}{
+		"Nothing": {
+			snaps: repeat(none, 10),
+		},
+		"Plug": {
+			snaps:    concat(repeat(none, 2), repeat(controller, 3)),
+			expected: []Event{plugged},
+		},
+		"PlugTooShort": {
+			snaps: concat(repeat(controller, 2), repeat(none, 3)),
+		},
+		"PlugFlicker": {
+			// Transient no device readings while the connector settles
+			snaps: concat(
+				repeat(controller, 1), repeat(none, 1),
+				repeat(controller, 2), repeat(none, 1),
+				repeat(controller, 3), repeat(none, 2), repeat(controller, 3)),
+			expected: []Event{plugged},
+		},
+		"Unplug": {
+			snaps:    concat(repeat(controller, 3), repeat(none, 3)),
+			expected: []Event{plugged, unplugged},
+		},
+		"PakInsert": {
+			snaps:    concat(repeat(controller, 3), repeat(withPak, 2), repeat(controller, 1), repeat(withPak, 3)),
+			expected: []Event{plugged, inserted},
+		},
+		"PluggedWithPak": {
+			snaps:    repeat(withPak, 6),
+			expected: []Event{plugged, inserted},
+		},
+		"PakRemove": {
+			snaps:    concat(repeat(withPak, 6), repeat(controller, 3)),
+			expected: []Event{plugged, inserted, removed},
+		},
+		"UnplugWithPak": {
+			snaps:    concat(repeat(pressA, 3), repeat(withPak, 3), repeat(none, 3)),
+			expected: []Event{plugged, button(Pressed, joybus.ButtonA), button(Released, joybus.ButtonA), inserted, removed, unplugged},
+		},
+		"Buttons": {
+			snaps: concat(repeat(controller, 3), repeat(pressA, 2), repeat(pressAB, 1), repeat(controller, 1)),
+			expected: []Event{
+				plugged,
+				button(Pressed, joybus.ButtonA),
+				button(Pressed, joybus.ButtonB),
+				button(Released, joybus.ButtonA),
+				button(Released, joybus.ButtonB),
+			},
+		},
+		"ButtonsHeldOnUnplug": {
+			snaps: concat(repeat(pressAB, 3), repeat(none, 3)),
+			expected: []Event{
+				plugged,
+				button(Pressed, joybus.ButtonA),
+				button(Pressed, joybus.ButtonB),
+				button(Released, joybus.ButtonA),
+				button(Released, joybus.ButtonB),
+				unplugged,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := NewSource(probe)
+			var events []Event
+			s.Subscribe(func(e Event) { events = append(events, e) })
+			for _, snap := range tc.snaps {
+				s.Update(2, snap)
+			}
+			if !reflect.DeepEqual(events, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, events)
+			}
+		})
+	}
+}
+
+func TestProbeError(t *testing.T) {
+	errProbe := errors.New("probe failed")
+	s := NewSource(func(port uint8) (io.ReaderAt, error) { return nil, errProbe })
+	s.SetDebounce(1)
+	ch, cancel := s.Chan(4)
+	defer cancel()
+
+	s.Update(0, withPak)
+	s.Update(0, withPak)
+	if e := <-ch; e.Kind != Plugged {
+		t.Errorf("expected %v, got %v", Plugged, e.Kind)
+	}
+	if e := <-ch; e.Kind != PakInserted || e.Err != errProbe || e.Pak != nil {
+		t.Errorf("expected %v with %v, got %v with %v", PakInserted, errProbe, e.Kind, e.Err)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	s := NewSource(nil)
+	s.SetDebounce(1)
+	var a, b int
+	cancelA := s.Subscribe(func(Event) { a++ })
+	s.Subscribe(func(Event) { b++ })
+
+	s.Update(0, controller)
+	cancelA()
+	s.Update(0, none)
+	if a != 1 || b != 2 {
+		t.Errorf("expected 1 and 2 events, got %d and %d", a, b)
+	}
+
+	// A full channel drops events instead of blocking Update
+	ch, cancel := s.Chan(1)
+	defer cancel()
+	s.Update(0, pressAB)
+	if len(ch) != 1 {
+		t.Errorf("expected 1 buffered event, got %d", len(ch))
+	}
+}
+
+func TestProbeSubscribed(t *testing.T) {
+	var probes int
+	s := NewSource(func(port uint8) (io.ReaderAt, error) {
+		probes++
+		return fakePak, nil
+	})
+	s.SetDebounce(1)
+
+	s.Update(0, controller)
+	s.Update(0, withPak)
+	if probes != 0 {
+		t.Errorf("expected no probe without subscribers, got %d", probes)
+	}
+
+	ch, cancel := s.Chan(4)
+	defer cancel()
+	s.Update(0, controller)
+	s.Update(0, withPak)
+	if probes != 1 {
+		t.Errorf("expected 1 probe, got %d", probes)
+	}
+	<-ch
+	if e := <-ch; e.Kind != PakInserted || e.Pak != fakePak {
+		t.Errorf("expected %v with pak, got %v with %v", PakInserted, e.Kind, e.Pak)
+	}
+}
@@ -6,6 +6,8 @@ import (
 
 	"github.com/drpaneas/n64/debug"
 	"github.com/drpaneas/n64/drivers/controller/pakfs"
+	"github.com/drpaneas/n64/drivers/controller/rumble"
+	"github.com/drpaneas/n64/drivers/controller/transferpak"
 	"github.com/drpaneas/n64/rcp/serial"
 	"github.com/drpaneas/n64/rcp/serial/joybus"
 )
@@ -19,10 +21,20 @@ const (
 
 const (
 	pakLabel  = 0x0000
+	pakBank   = 0x8000 // Controller Pak bank selection, shared with pakProbe
 	pakProbe  = 0x8000 + 0x1f
 	pakRumble = 0xC000 + 0x1f
 )
 
+// Controller Paks map a 32 KiB bank of SRAM to the start of the address space.
+// Third-party paks of up to 1 MiB select the bank by writing its number to
+// pakBank.
+const (
+	bankBits = 15
+	bankSize = 1 << bankBits
+	bankMask = bankSize - 1
+)
+
 // Values written to pakProbe to identify pak type.  If the pak is capable of
 // power on/off, writing the probe value also powers the pak on.
 const (
@@ -55,20 +67,9 @@ func NewPak(port uint8) (pak *Pak) {
 	}
 
 	var err error
-	for range pak.port {
-		err = joybus.ControlByte(&pak.readCmdBlock, joybus.CtrlSkip)
-		debug.AssertErrNil(err)
-	}
-	pak.readCmd, err = joybus.NewReadPakCommand(&pak.readCmdBlock)
-	err = joybus.ControlByte(&pak.readCmdBlock, joybus.CtrlAbort)
+	pak.readCmd, err = joybus.NewChannelCommand(&pak.readCmdBlock, port, joybus.NewReadPakCommand)
 	debug.AssertErrNil(err)
-
-	for range pak.port {
-		err = joybus.ControlByte(&pak.writeCmdBlock, joybus.CtrlSkip)
-		debug.AssertErrNil(err)
-	}
-	pak.writeCmd, err = joybus.NewWritePakCommand(&pak.writeCmdBlock)
-	err = joybus.ControlByte(&pak.writeCmdBlock, joybus.CtrlAbort)
+	pak.writeCmd, err = joybus.NewChannelCommand(&pak.writeCmdBlock, port, joybus.NewWritePakCommand)
 	debug.AssertErrNil(err)
 
 	return
@@ -148,10 +149,12 @@ func ProbePak(port uint8) (io.ReaderAt, error) {
 	pak := NewPak(port)
 
 	// Controller Pak is special as it does use pakProbe for SRAM bank
-	// selection.  Probe by looking for a filesystem instead.
-	_, errFS := pakfs.Read(pak)
+	// selection.  Probe by looking for a filesystem in the first bank
+	// instead.
+	mem := &MemPak{*pak, -1}
+	_, errFS := pakfs.Read(mem)
 	if errFS == nil {
-		return &MemPak{*pak}, nil
+		return mem, nil
 	}
 
 	data := [1]byte{}
@@ -159,7 +162,7 @@ func ProbePak(port uint8) (io.ReaderAt, error) {
 		probeVal byte
 		ctor     func(*Pak) (io.ReaderAt, error)
 	}{
-		{probeMem, nil}, // controller pak with damaged filesystem
+		{probeMem, newMemPak}, // controller pak with damaged filesystem
 		{probeRumble, newRumblePak},
 		{probeTransfer, newTransferPak},
 	}
@@ -177,9 +180,6 @@ func ProbePak(port uint8) (io.ReaderAt, error) {
 		}
 
 		if data[0] == t.probeVal {
-			if t.ctor == nil {
-				break
-			}
 			return t.ctor(pak)
 		}
 	}
@@ -188,12 +188,67 @@ func ProbePak(port uint8) (io.ReaderAt, error) {
 	return pak, nil
 }
 
+// MemPak is a Controller Pak.  If pakfs.Read fails on it, the filesystem is
+// damaged or it was never formatted.  Check can repair damaged filesystems
+// and Format initializes a new one.
+//
+// Offsets beyond the first 32 KiB address the further banks of large
+// third-party paks.
 type MemPak struct {
 	Pak
+	bank int // selected bank, -1 if unknown
+}
+
+// Format writes an empty filesystem to the pak, see pakfs.Format.
+func (pak *MemPak) Format(opts *pakfs.FormatOptions) error {
+	return pakfs.Format(pak, opts)
 }
 
 func newMemPak(pak *Pak) (io.ReaderAt, error) {
-	return &MemPak{*pak}, nil
+	// Probing changed the bank, so select it on first access
+	return &MemPak{*pak, -1}, nil
+}
+
+func (pak *MemPak) selectBank(bank int) error {
+	if bank == pak.bank {
+		return nil
+	}
+	var data [blockSize]byte
+	for i := range data {
+		data[i] = byte(bank)
+	}
+	pak.bank = -1
+	if _, err := pak.Pak.WriteAt(data[:], pakBank); err != nil {
+		return err
+	}
+	pak.bank = bank
+	return nil
+}
+
+// bankIO splits an access at off into accesses within banks.
+func (pak *MemPak) bankIO(p []byte, off int64, access func([]byte, int64) (int, error)) (n int, err error) {
+	for n < len(p) {
+		pos := off + int64(n)
+		if err = pak.selectBank(int(pos >> bankBits)); err != nil {
+			return
+		}
+		l := min(len(p)-n, bankSize-int(pos&bankMask))
+		var done int
+		done, err = access(p[n:n+l], pos&bankMask)
+		n += done
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (pak *MemPak) ReadAt(p []byte, off int64) (n int, err error) {
+	return pak.bankIO(p, off, pak.Pak.ReadAt)
+}
+
+func (pak *MemPak) WriteAt(p []byte, off int64) (n int, err error) {
+	return pak.bankIO(p, off, pak.Pak.WriteAt)
 }
 
 type RumblePak struct {
@@ -224,10 +279,52 @@ func (pak *RumblePak) Toggle() error {
 	return pak.Set(!pak.on)
 }
 
+// Rumble returns a player for rumble patterns on pak, which is inserted in
+// the controller.  States.Poll updates the player, producing the strength of
+// the pattern by duty cycling the motor.  When the pak is removed or the
+// controller unplugged, the player is detached and Rumble must be called
+// again for a newly inserted pak.  The previous player is stopped first, if
+// that fails its error is returned and it stays attached.
+func (c *Controller) Rumble(pak *RumblePak) (*rumble.Player, error) {
+	if c.rumble != nil {
+		if err := c.rumble.Stop(); err != nil {
+			return nil, err
+		}
+	}
+	c.rumble = rumble.NewPlayer(pak, nil)
+	return c.rumble, nil
+}
+
+// TransferPak is a Transfer Pak, which gives access to an inserted Game Boy
+// cartridge.  See package transferpak for the protocol.
 type TransferPak struct {
 	Pak
+	tpak *transferpak.Pak
 }
 
 func newTransferPak(pak *Pak) (io.ReaderAt, error) {
-	return &TransferPak{*pak}, nil
+	tp := &TransferPak{Pak: *pak}
+	tp.tpak = transferpak.New(&tp.Pak)
+	return tp, nil
+}
+
+// Open powers the pak on and returns the inserted cartridge, whose ROM and
+// RAM can then be accessed.  Closing the cartridge powers the pak off.
+func (pak *TransferPak) Open() (*transferpak.Cartridge, error) {
+	return pak.tpak.Open()
+}
+
+// SetPower powers the cartridge on or off.
+func (pak *TransferPak) SetPower(on bool) error {
+	return pak.tpak.SetPower(on)
+}
+
+// SetAccess enables or disables the access mode.
+func (pak *TransferPak) SetAccess(on bool) error {
+	return pak.tpak.SetAccess(on)
+}
+
+// Status returns the transferpak.Status bits of the pak.
+func (pak *TransferPak) Status() (byte, error) {
+	return pak.tpak.Status()
 }
@@ -0,0 +1,192 @@
+package pakfs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// ProblemKind classifies the problems found by Check.
+type ProblemKind int
+
+const (
+	BadID       ProblemKind = iota // ID sector with invalid checksum or bank count
+	BadINodes                      // inode table with invalid checksum
+	BadNote                        // note pointing to an invalid inode
+	CrossLinked                    // page used by more than one note
+	Orphaned                       // page neither free nor used by a note
+)
+
+// Problem is an inconsistency found by Check.
+type Problem struct {
+	Kind     ProblemKind
+	Desc     string
+	Repaired bool
+}
+
+func (p Problem) String() string {
+	if p.Repaired {
+		return p.Desc + " (repaired)"
+	}
+	return p.Desc
+}
+
+// Check checks the filesystem on dev and returns the problems found.
+//
+// With repair, damaged copies of the ID sector and inode table are restored
+// from valid ones, which requires dev to implement io.WriterAt.  If both
+// inode tables are valid but only the backup matches the notes, like after
+// an interrupted write, the backup is restored.  Notes pointing to invalid or
+// cross-linked pages are removed and orphaned pages freed.  If no valid copy
+// of the ID sector or inode table exists, ErrInconsistent is returned.
+func Check(dev io.ReaderAt, repair bool) (problems []Problem, err error) {
+	if _, ok := dev.(io.WriterAt); repair && !ok {
+		return nil, ErrReadOnly
+	}
+	p := &FS{dev: dev}
+	report := func(kind ProblemKind, repaired bool, format string, args ...any) {
+		problems = append(problems, Problem{kind, fmt.Sprintf(format, args...), repaired})
+	}
+
+	var badIDs []int64
+	validID := false
+	for _, base := range idBases {
+		var id idSector
+		r := io.NewSectionReader(dev, base, blockLen)
+		if err := binary.Read(r, binary.BigEndian, &id); err != nil {
+			return nil, err
+		}
+		if !id.valid() || id.BankCount == 0 || id.BankCount > MaxBanks {
+			badIDs = append(badIDs, base)
+		} else if !validID {
+			p.id, validID = id, true
+		}
+	}
+	if !validID {
+		report(BadID, false, "no valid ID sector")
+		return problems, ErrInconsistent
+	}
+	for _, base := range badIDs {
+		report(BadID, repair, "ID sector at %#x: invalid", base)
+	}
+	if repair && len(badIDs) > 0 {
+		if err := p.writeID(badIDs); err != nil {
+			return problems, err
+		}
+	}
+
+	r := io.NewSectionReader(dev, noteOffset(p.id.BankCount, 0), noteCnt<<noteBits)
+	if err := binary.Read(r, binary.BigEndian, &p.notes); err != nil {
+		return problems, err
+	}
+
+	// Of the valid inode tables, use the one with the fewest problems,
+	// preferring the primary
+	var tables [2]iNodes
+	var bad []string
+	best, bestProblems := -1, 0
+	for i, offsetFunc := range [...]func(uint8) (int64, int64){iNodesOffset, iNodesBakOffset} {
+		offset, n := offsetFunc(p.id.BankCount)
+		p.inodes = make(iNodes, n>>1)
+		r := io.NewSectionReader(dev, offset, n)
+		if err := binary.Read(r, binary.BigEndian, &p.inodes); err != nil {
+			return problems, err
+		}
+		tables[i] = p.inodes
+		if !p.iNodesChecksum(false) {
+			bad = append(bad, fmt.Sprintf("%s at %#x", [...]string{"inode table", "inode table backup"}[i], offset))
+			continue
+		}
+		if n := len(p.checkNotes(false)); best < 0 || n < bestProblems {
+			best, bestProblems = i, n
+		}
+	}
+	for _, table := range bad {
+		report(BadINodes, repair && best >= 0, "%s: invalid checksum", table)
+	}
+	if best < 0 {
+		return problems, ErrInconsistent
+	}
+	p.inodes = tables[best]
+	if best == 1 && len(bad) == 0 {
+		report(BadINodes, repair, "inode table: doesn't match notes, unlike backup")
+		bad = append(bad, "inode table")
+	}
+
+	noteProblems := p.checkNotes(repair)
+	problems = append(problems, noteProblems...)
+	if !repair || len(bad) == 0 && len(noteProblems) == 0 {
+		return problems, nil
+	}
+	if err := p.sync(); err != nil {
+		return problems, err
+	}
+	for i := range p.notes {
+		if err := newFile(p, i).sync(); err != nil {
+			return problems, err
+		}
+	}
+	return problems, nil
+}
+
+// checkNotes checks the pages of all notes.  With fix, notes pointing to
+// invalid pages or to pages of another note are removed and orphaned pages
+// freed.  The changes aren't written to the device.
+func (p *FS) checkNotes(fix bool) (problems []Problem) {
+	owner := make(map[uint16]int)
+	removed := make(map[uint16]bool)
+	for i := range p.notes {
+		if p.notes[i].StartPage == 0 {
+			continue
+		}
+		name := newFile(p, i).name()
+		var pages []uint16
+		var problem *Problem
+		for page := p.notes[i].StartPage; page != inodeLast; page = p.next(page) {
+			if !p.validPage(page) {
+				problem = &Problem{BadNote, fmt.Sprintf("note %q: invalid inode %d", name, page), fix}
+				break
+			}
+			if j, ok := owner[page]; ok {
+				other := newFile(p, j).name()
+				if j == i {
+					problem = &Problem{BadNote, fmt.Sprintf("note %q: page %d links back into the note", name, page), fix}
+				} else {
+					problem = &Problem{CrossLinked, fmt.Sprintf("note %q: page %d is used by %q", name, page, other), fix}
+				}
+				break
+			}
+			owner[page] = i
+			pages = append(pages, page)
+		}
+		if problem == nil {
+			continue
+		}
+		problems = append(problems, *problem)
+		if fix {
+			for _, page := range pages {
+				delete(owner, page)
+				removed[page] = true
+			}
+			p.notes[i] = note{}
+		}
+	}
+
+	orphans := 0
+	inodes(p)(func(page int, inode uint16) bool {
+		if _, ok := owner[pageNumber(page)]; ok || inode == inodeFree {
+			return true
+		}
+		if !removed[pageNumber(page)] {
+			orphans++
+		}
+		if fix {
+			p.inodes[page] = inodeFree
+		}
+		return true
+	})
+	if orphans > 0 {
+		problems = append(problems, Problem{Orphaned, fmt.Sprintf("%d orphaned pages", orphans), fix})
+	}
+	return problems
+}
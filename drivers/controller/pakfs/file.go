@@ -45,7 +45,7 @@ func (f *File) pages() ([]uint16, error) {
 			return nil, ErrInconsistent
 		}
 		pages = append(pages, page)
-		page = f.fs.inodes[page]
+		page = f.fs.next(page)
 	}
 	return pages, nil
 }
@@ -89,7 +89,7 @@ func (f *File) allocPages(pageCnt int) (err error) {
 	newPages := make([]uint16, 0)
 	inodes(f.fs)(func(page int, inode uint16) bool {
 		if inode == inodeFree {
-			newPages = append(newPages, uint16(page))
+			newPages = append(newPages, pageNumber(page))
 		}
 		if len(newPages) >= pageCnt {
 			return false
@@ -107,9 +107,9 @@ func (f *File) allocPages(pageCnt int) (err error) {
 	}
 
 	for i, page := range newPages[:len(newPages)-1] {
-		f.fs.inodes[page] = newPages[i+1]
+		f.fs.setNext(page, newPages[i+1])
 	}
-	f.fs.inodes[newPages[len(newPages)-1]] = inodeLast
+	f.fs.setNext(newPages[len(newPages)-1], inodeLast)
 	if len(pages) == 0 {
 		f.note.StartPage = newPages[0]
 		err = f.sync()
@@ -117,13 +117,13 @@ func (f *File) allocPages(pageCnt int) (err error) {
 			return
 		}
 	} else {
-		f.fs.inodes[pages[len(pages)-1]] = newPages[0]
+		f.fs.setNext(pages[len(pages)-1], newPages[0])
 	}
 
 	// write zeroes to new pages
 	var buf [pageSize]byte
 	for _, v := range newPages {
-		pageAddr := int64(v) << pageBits
+		pageAddr := pageOffset(v)
 		_, err = dev.WriteAt(buf[:], pageAddr)
 		if err != nil {
 			return
@@ -141,7 +141,7 @@ func (f *File) freePages(pageCnt int) (err error) {
 
 	pageCnt = min(pageCnt, len(pages))
 	for _, page := range pages[len(pages)-pageCnt:] {
-		f.fs.inodes[page] = inodeFree
+		f.fs.setNext(page, inodeFree)
 	}
 	pages = pages[:len(pages)-pageCnt]
 
@@ -152,7 +152,7 @@ func (f *File) freePages(pageCnt int) (err error) {
 			return
 		}
 	} else {
-		f.fs.inodes[pages[len(pages)-1]] = inodeLast
+		f.fs.setNext(pages[len(pages)-1], inodeLast)
 	}
 
 	return f.fs.sync()
@@ -188,7 +188,7 @@ func (f *File) ReadAt(b []byte, off int64) (n int, err error) {
 
 	pageOff := off & pageMask
 	for _, v := range pages {
-		pageAddr := int64(v) << pageBits
+		pageAddr := pageOffset(v)
 		l := min(pageSize-int(pageOff), len(b[n:]))
 		written, err := f.fs.dev.ReadAt(b[n:n+l], pageAddr+pageOff)
 		n += written
@@ -229,7 +229,7 @@ func (f *File) WriteAt(b []byte, off int64) (n int, err error) {
 
 	pageOff := off & pageMask
 	for _, v := range pages {
-		pageAddr := int64(v) << pageBits
+		pageAddr := pageOffset(v)
 		l := min(pageSize-int(pageOff), len(b[n:]))
 		written, err := dev.WriteAt(b[n:n+l], pageAddr+pageOff)
 		n += written
@@ -0,0 +1,94 @@
+package pakfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/fs"
+	"math/rand"
+)
+
+// ReadWriterAt is a device that can be formatted, e.g. a controller.Pak or an
+// image file.
+type ReadWriterAt interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// MaxBanks is the maximum number of 32 KiB banks of a filesystem.
+const MaxBanks = 62
+
+// FormatOptions configures Format.  The zero value formats a standard
+// Controller Pak.
+type FormatOptions struct {
+	Banks  int            // number of 32 KiB banks, 1 if zero
+	Label  [blockLen]byte // returned by FS.Label
+	Serial [16]byte       // identifies the pak, random if zero
+	Random uint32         // random if Serial is zero
+}
+
+// Format writes an empty filesystem to dev, which can be a blank or damaged
+// Controller Pak or a host image of at least opts.Banks * 32 KiB.  All notes
+// are lost.  The ID sector is written with its three backups.  Nil opts are
+// the same as zero ones.
+func Format(dev ReadWriterAt, opts *FormatOptions) error {
+	if opts == nil {
+		opts = &FormatOptions{}
+	}
+	banks := max(opts.Banks, 1)
+	if banks > MaxBanks {
+		return fs.ErrInvalid
+	}
+
+	p := &FS{dev: dev}
+	p.id = idSector{
+		Repaired:  0xffffffff,
+		Random:    opts.Random,
+		Serial:    opts.Serial,
+		DeviceId:  1,
+		BankCount: uint8(banks),
+	}
+	if p.id.Serial == [16]byte{} {
+		p.id.Random = rand.Uint32()
+		for i := range p.id.Serial {
+			p.id.Serial[i] = byte(rand.Uint32())
+		}
+	}
+	p.id.Checksum, p.id.ChecksumInv = p.id.checksum()
+
+	if _, err := dev.WriteAt(opts.Label[:], baseLabel); err != nil {
+		return err
+	}
+	if err := p.writeID(idBases[:]); err != nil {
+		return err
+	}
+
+	p.inodes = make(iNodes, int(p.id.BankCount)<<pagesPerBankBits)
+	inodes(p)(func(page int, _ uint16) bool {
+		p.inodes[page] = inodeFree
+		return true
+	})
+	if err := p.sync(); err != nil {
+		return err
+	}
+
+	var notes [noteCnt << noteBits]byte
+	_, err := dev.WriteAt(notes[:], noteOffset(p.id.BankCount, 0))
+	return err
+}
+
+// writeID writes the ID sector to the given offsets.
+func (p *FS) writeID(bases []int64) error {
+	dev, ok := p.dev.(io.WriterAt)
+	if !ok {
+		return ErrReadOnly
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, p.id)
+	for _, base := range bases {
+		if _, err := dev.WriteAt(buf.Bytes(), base); err != nil {
+			return err
+		}
+	}
+	return nil
+}
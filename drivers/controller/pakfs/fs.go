@@ -36,6 +36,8 @@ const (
 	baseIDBackup3 = 0x00c0
 )
 
+var idBases = [...]int64{baseID, baseIDBackup1, baseIDBackup2, baseIDBackup3}
+
 const (
 	noteCnt  = 16
 	noteBits = 5
@@ -94,7 +96,7 @@ type FS struct {
 func Read(dev io.ReaderAt) (fs *FS, err error) {
 	fs = &FS{dev: dev}
 
-	for _, base := range [...]int64{baseID, baseIDBackup1, baseIDBackup2, baseIDBackup3} {
+	for _, base := range idBases {
 		r := io.NewSectionReader(dev, base, blockLen)
 		err := binary.Read(r, binary.BigEndian, &fs.id)
 		if err != nil {
@@ -316,7 +318,10 @@ func (p *FS) Rename(oldpath, newpath string) (err error) {
 		return &fs.PathError{Op: "rename", Path: oldpath, Err: err}
 	}
 
-	return f.setName(newpath)
+	if err = f.setName(newpath); err != nil {
+		return
+	}
+	return f.sync()
 }
 
 func (p *FS) Truncate(name string, size int64) (err error) {
@@ -360,7 +365,7 @@ func (p *FS) Truncate(name string, size int64) (err error) {
 		lastPageIdx := len(pages) - 1 + pageDelta
 		if lastPageIdx >= 0 {
 			// write zeroes from `size` to end of last page
-			pageAddr := int64(pages[lastPageIdx]) << pageBits
+			pageAddr := pageOffset(pages[lastPageIdx])
 			zeroes := make([]byte, pageSize-(size&pageMask))
 			_, err = dev.WriteAt(zeroes, pageAddr+(size&pageMask))
 		}
@@ -394,17 +399,53 @@ func (p *FS) firstPage() int {
 	return 1 + int(p.id.BankCount)<<1 + 2
 }
 
+// validPage reports whether page is a data page.  The first page of each
+// bank holds the inode checksum, the first bank also the system area.
 func (p *FS) validPage(page uint16) bool {
-	return !(page < uint16(p.firstPage()) ||
-		page >= uint16(len(p.inodes)) ||
-		page&pageMask == 0)
+	bank, first := page>>8, uint16(1)
+	if bank == 0 {
+		first = uint16(p.firstPage())
+	}
+	return bank < uint16(p.id.BankCount) &&
+		page&pageMask >= first &&
+		page&pageMask < pagesPerBank
+}
+
+// Pages are numbered bank<<8 | page in bank in inodes and notes, like the
+// libultra inode_t.  Inodes are stored in a table per bank, which are
+// concatenated to an array indexed by bank<<pagesPerBankBits | page in bank.
+
+func pageNumber(index int) uint16 {
+	return uint16(index>>pagesPerBankBits)<<8 | uint16(index&(pagesPerBank-1))
+}
+
+func pageIndex(page uint16) int {
+	return int(page>>8)<<pagesPerBankBits | int(page&pageMask)
+}
+
+// pageOffset returns the device offset of a valid page.
+func pageOffset(page uint16) int64 {
+	return int64(pageIndex(page)) << pageBits
+}
+
+// next returns the inode of a valid page, which is the next page of its note,
+// inodeLast or inodeFree.
+func (p *FS) next(page uint16) uint16 {
+	return p.inodes[pageIndex(page)]
+}
+
+func (p *FS) setNext(page, inode uint16) {
+	p.inodes[pageIndex(page)] = inode
 }
 
+// iNodesChecksum checks or updates the checksums in the low byte of each
+// bank's first inode.  Like __osSumcalc of libultra, a checksum is the sum of
+// all bytes of the bank's inodes, except those of the system area.
 func (p *FS) iNodesChecksum(update bool) (valid bool) {
 	valid = true
 	var csum uint16
 	inodes(p)(func(page int, inode uint16) bool {
-		csum += inode
+		csum += inode>>8 + inode&0xff
 		if (page+1)%pagesPerBank == 0 { // last page in this bank
 			csumIdx := page &^ (pagesPerBank - 1)
 			if csum&0xff != p.inodes[csumIdx]&0xff {
@@ -0,0 +1,94 @@
+package pakfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+)
+
+var ErrFormat = errors.New("invalid file format")
+
+// Export writes the note in the single note format of emulators and save
+// managers like MPKEdit: the 32 byte entry of the note table, followed by the
+// pages of the note.
+func (f *File) Export(w io.Writer) error {
+	f.fs.mtx.RLock()
+	n := *f.note
+	f.fs.mtx.RUnlock()
+
+	data := make([]byte, f.Size())
+	if _, err := f.ReadAt(data, 0); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, n); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// Import creates a note from the single note format written by Export.  The
+// name, game and company codes are taken from the note entry, its start page
+// is ignored.
+func (p *FS) Import(r io.Reader) (*File, error) {
+	var n note
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, ErrFormat
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)&pageMask != 0 {
+		return nil, ErrFormat
+	}
+
+	name := (&File{note: &n}).name()
+	f, err := p.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	p.mtx.Lock()
+	n.StartPage = f.note.StartPage
+	*f.note = n
+	err = f.sync()
+	p.mtx.Unlock()
+	if err == nil {
+		_, err = f.WriteAt(data, 0)
+	}
+	if err != nil {
+		p.Remove(name)
+		return nil, &fs.PathError{Op: "import", Path: name, Err: err}
+	}
+	return f, nil
+}
+
+// The DexDrive .n64 format is a header with a comment per note, followed by
+// the raw image of a single bank.
+const (
+	dexMagic      = "123-456-STD"
+	dexComments   = 0x40
+	dexHeaderSize = dexComments + noteCnt*0x100
+	bankSize      = pagesPerBank << pageBits
+)
+
+// FromDexDrive returns the raw image in a DexDrive .n64 file.  The comments
+// of the notes are dropped.
+func FromDexDrive(data []byte) ([]byte, error) {
+	if len(data) != dexHeaderSize+bankSize || !bytes.HasPrefix(data, []byte(dexMagic)) {
+		return nil, ErrFormat
+	}
+	return data[dexHeaderSize:], nil
+}
+
+// ToDexDrive returns a DexDrive .n64 file with a raw image of a single bank.
+func ToDexDrive(image []byte) ([]byte, error) {
+	if len(image) != bankSize {
+		return nil, ErrFormat
+	}
+	data := make([]byte, dexHeaderSize, dexHeaderSize+bankSize)
+	copy(data, dexMagic)
+	return append(data, image...), nil
+}
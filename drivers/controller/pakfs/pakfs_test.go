@@ -1,10 +1,9 @@
 package pakfs
 
-// TODO add tests for file system with multiple banks
-
 import (
 	"bytes"
 	"crypto/sha1"
+	"encoding/binary"
 	"errors"
 	"io"
 	"io/fs"
@@ -666,3 +665,450 @@ func TestParallel(t *testing.T) {
 		t.Fatal("damaged testdata:", err)
 	}
 }
+
+// memDev is a pak image in memory.
+type memDev []byte
+
+func (d memDev) ReadAt(p []byte, off int64) (int, error) {
+	return bytes.NewReader(d).ReadAt(p, off)
+}
+
+func (d memDev) WriteAt(p []byte, off int64) (int, error) {
+	if off+int64(len(p)) > int64(len(d)) {
+		return 0, io.ErrShortWrite
+	}
+	return copy(d[off:], p), nil
+}
+
+func TestFormat(t *testing.T) {
+	tests := map[string]struct {
+		opts  *FormatOptions
+		pages int64
+		err   error
+	}{
+		"Nil":      {nil, 123, nil},
+		"Zero":     {&FormatOptions{}, 123, nil},
+		"Label":    {&FormatOptions{Label: [32]byte{'T', 'E', 'S', 'T'}, Serial: [16]byte{1}}, 123, nil},
+		"TwoBanks": {&FormatOptions{Banks: 2}, 248, nil},
+		"MaxBanks": {&FormatOptions{Banks: MaxBanks + 1}, 0, fs.ErrInvalid},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			dev := make(memDev, 4*32*1024)
+			for i := range dev {
+				dev[i] = 0xa5
+			}
+			err := Format(dev, tc.opts)
+			if err != tc.err {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+			if err != nil {
+				return
+			}
+			pfs, err := Read(dev)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := len(pfs.ReadDirRoot()); n != 0 {
+				t.Errorf("expected no files, got %d", n)
+			}
+			if pfs.Size() != tc.pages*pageSize || pfs.Free() != pfs.Size() {
+				t.Errorf("expected %d bytes free, got %d of %d", tc.pages*pageSize, pfs.Free(), pfs.Size())
+			}
+			// Free pages are 3, a single bank has 123 of them
+			if csum := uint16(3*(pagesPerBank-pfs.firstPage())) & 0xff; pfs.inodes[0]&0xff != csum {
+				t.Errorf("expected inode checksum %#x, got %#x", csum, pfs.inodes[0])
+			}
+			if tc.opts != nil && pfs.Label() != string(tc.opts.Label[:]) {
+				t.Errorf("expected label %q, got %q", tc.opts.Label, pfs.Label())
+			}
+			if pfs.id.Serial == [16]byte{} {
+				t.Error("expected serial")
+			}
+			if tc.opts != nil && tc.opts.Serial != [16]byte{} && pfs.id.Serial != tc.opts.Serial {
+				t.Errorf("expected serial %x, got %x", tc.opts.Serial, pfs.id.Serial)
+			}
+			problems, err := Check(dev, false)
+			if err != nil || len(problems) != 0 {
+				t.Errorf("expected clean filesystem, got %v, %v", problems, err)
+			}
+		})
+	}
+}
+
+func TestFormatWrite(t *testing.T) {
+	dev := make(memDev, 32*1024)
+	if err := Format(dev, nil); err != nil {
+		t.Fatal(err)
+	}
+	pfs, err := Read(dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := pfs.Create("NEW.NOTE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte(lorem), 0); err != nil {
+		t.Fatal(err)
+	}
+	if pfs.Free() != pfs.Size()-2*pageSize {
+		t.Errorf("expected 2 pages used, got %d bytes free", pfs.Free())
+	}
+}
+
+func TestCheck(t *testing.T) {
+	filename := path.Join("testdata", "drpaneas.mpk")
+	tests := map[string]struct {
+		flipBytes []int
+		problems  int
+		err       error
+	}{
+		"Valid":           {[]int{}, 0, nil},
+		"DamageId":        {[]int{0x20}, 1, nil},
+		"DamageIdBak":     {[]int{0x60, 0xc0}, 2, nil},
+		"DamageIdAll":     {[]int{0x20, 0x60, 0x80, 0xc0}, 1, ErrInconsistent},
+		"DamageInodes":    {[]int{0x1ff}, 1, nil},
+		"DamageInodesBak": {[]int{0x2ff}, 1, nil},
+		"DamageBoth":      {[]int{0x20, 0x1ff}, 2, nil},
+		"DamageAllInodes": {[]int{0x1ff, 0x2ff}, 2, ErrInconsistent},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := prepareRead(t, filename, tc.flipBytes).(*bytes.Reader)
+			dev := make(memDev, r.Size())
+			r.ReadAt(dev, 0)
+
+			problems, err := Check(dev, false)
+			if err != tc.err {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+			if len(problems) != tc.problems {
+				t.Fatalf("expected %d problems, got %v", tc.problems, problems)
+			}
+
+			problems, err = Check(dev, true)
+			if err != tc.err || len(problems) != tc.problems {
+				t.Fatalf("expected %v, got %v, %v", tc.err, problems, err)
+			}
+			for _, p := range problems {
+				if p.Repaired != (err == nil) {
+					t.Errorf("unexpected repair state %v", p)
+				}
+			}
+			if err != nil {
+				return
+			}
+			if problems, err := Check(dev, false); err != nil || len(problems) != 0 {
+				t.Errorf("expected repaired filesystem, got %v, %v", problems, err)
+			}
+		})
+	}
+}
+
+func TestCheckReadOnly(t *testing.T) {
+	r := prepareRead(t, path.Join("testdata", "drpaneas.mpk"), nil)
+	if _, err := Check(r, true); err != ErrReadOnly {
+		t.Errorf("expected %v, got %v", ErrReadOnly, err)
+	}
+}
+
+func TestCheckPages(t *testing.T) {
+	tests := map[string]struct {
+		// corrupt modifies the inode table of a pak with note A of three
+		// pages and B of two pages, which is written to both copies or, if
+		// primary is set, only to the primary table.
+		corrupt  func(inodes iNodes, a, b []uint16)
+		primary  bool
+		problems []ProblemKind
+		notes    int
+	}{
+		"CrossLinked": {func(inodes iNodes, a, b []uint16) { inodes[b[1]] = a[1] }, false, []ProblemKind{CrossLinked}, 1},
+		"Loop":        {func(inodes iNodes, a, b []uint16) { inodes[a[2]] = a[0] }, false, []ProblemKind{BadNote}, 1},
+		"Invalid":     {func(inodes iNodes, a, b []uint16) { inodes[a[1]] = 2 }, false, []ProblemKind{BadNote, Orphaned}, 1},
+		"Orphaned":    {func(inodes iNodes, a, b []uint16) { inodes[b[1]+1] = inodeLast }, false, []ProblemKind{Orphaned}, 2},
+		"Stale":       {func(inodes iNodes, a, b []uint16) { inodes[b[0]], inodes[b[1]] = inodeFree, inodeFree }, true, []ProblemKind{BadINodes}, 2},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			dev := make(memDev, 32*1024)
+			if err := Format(dev, nil); err != nil {
+				t.Fatal(err)
+			}
+			pfs, err := Read(dev)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var pages [2][]uint16
+			for i, size := range []int{3, 2} {
+				f, err := pfs.Create(string(rune('A' + i)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := f.WriteAt(make([]byte, size*pageSize), 0); err != nil {
+					t.Fatal(err)
+				}
+				pages[i], _ = f.pages()
+			}
+			tc.corrupt(pfs.inodes, pages[0], pages[1])
+			if tc.primary {
+				pfs.iNodesChecksum(true)
+				offset, _ := iNodesOffset(pfs.id.BankCount)
+				binary.Write(io.NewOffsetWriter(dev, offset), binary.BigEndian, pfs.inodes)
+			} else if err := pfs.sync(); err != nil {
+				t.Fatal(err)
+			}
+
+			problems, err := Check(dev, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var kinds []ProblemKind
+			for _, p := range problems {
+				kinds = append(kinds, p.Kind)
+			}
+			if !slices.Equal(kinds, tc.problems) {
+				t.Fatalf("expected problems %v, got %v", tc.problems, problems)
+			}
+
+			if _, err := Check(dev, true); err != nil {
+				t.Fatal(err)
+			}
+			if problems, err := Check(dev, false); err != nil || len(problems) != 0 {
+				t.Fatalf("expected repaired filesystem, got %v, %v", problems, err)
+			}
+			pfs, err = Read(dev)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := len(pfs.ReadDirRoot()); n != tc.notes {
+				t.Errorf("expected %d notes, got %d", tc.notes, n)
+			}
+			used := int64(0)
+			for _, e := range pfs.ReadDirRoot() {
+				fi, _ := e.Info()
+				used += fi.Size()
+			}
+			if pfs.Free() != pfs.Size()-used {
+				t.Errorf("expected %d bytes free, got %d", pfs.Size()-used, pfs.Free())
+			}
+		})
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	src, err := Read(prepareRead(t, path.Join("testdata", "drpaneas.mpk"), nil))
+	if err != nil {
+		t.Fatal("damaged testdata:", err)
+	}
+	dev := make(memDev, 32*1024)
+	if err := Format(dev, nil); err != nil {
+		t.Fatal(err)
+	}
+	dst, err := Read(dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range src.ReadDirRoot() {
+		fi, _ := src.Open(e.Name())
+		f := fi.(*File)
+		var buf bytes.Buffer
+		if err := f.Export(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if int64(buf.Len()) != 32+f.Size() {
+			t.Fatalf("%s: expected %d bytes, got %d", f.Name(), 32+f.Size(), buf.Len())
+		}
+
+		g, err := dst.Import(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: %v", f.Name(), err)
+		}
+		if g.Name() != f.Name() || g.GameCode() != f.GameCode() || g.CompanyCode() != f.CompanyCode() {
+			t.Errorf("expected %q %q %q, got %q %q %q", f.Name(), f.GameCode(), f.CompanyCode(), g.Name(), g.GameCode(), g.CompanyCode())
+		}
+		want, _ := fs.ReadFile(src, f.Name())
+		got, _ := fs.ReadFile(dst, g.Name())
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: imported data differs", f.Name())
+		}
+
+		if _, err := dst.Import(bytes.NewReader(buf.Bytes())); !errors.Is(err, fs.ErrExist) {
+			t.Errorf("expected %v, got %v", fs.ErrExist, err)
+		}
+	}
+	if problems, err := Check(dev, false); err != nil || len(problems) != 0 {
+		t.Errorf("expected clean filesystem, got %v, %v", problems, err)
+	}
+}
+
+func TestImportInvalid(t *testing.T) {
+	dev := make(memDev, 32*1024)
+	if err := Format(dev, nil); err != nil {
+		t.Fatal(err)
+	}
+	pfs, _ := Read(dev)
+	entry := make([]byte, 32)
+	entry[12], entry[16] = 26, 27 // extension A, name B
+	tests := map[string]struct {
+		data []byte
+		err  error
+	}{
+		"Empty":     {nil, ErrFormat},
+		"Truncated": {entry[:16], ErrFormat},
+		"Partial":   {append(slices.Clone(entry), 1, 2, 3), ErrFormat},
+		"NoSpace":   {append(slices.Clone(entry), make([]byte, 200*pageSize)...), ErrNoSpace},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := pfs.Import(bytes.NewReader(tc.data)); !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+			if n := len(pfs.ReadDirRoot()); n != 0 {
+				t.Errorf("expected no notes, got %d", n)
+			}
+		})
+	}
+
+	f, err := pfs.Import(bytes.NewReader(entry))
+	if err != nil || f.Name() != "B.A" || f.Size() != 0 {
+		t.Errorf("expected empty note B.A, got %v", err)
+	}
+}
+
+func TestDexDrive(t *testing.T) {
+	image, err := os.ReadFile(path.Join("testdata", "drpaneas.mpk"))
+	if err != nil {
+		t.Fatal("missing testdata:", err)
+	}
+	dex, err := ToDexDrive(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dex) != 0x1040+len(image) || string(dex[:11]) != "123-456-STD" {
+		t.Errorf("unexpected DexDrive header %q", dex[:16])
+	}
+	raw, err := FromDexDrive(dex)
+	if err != nil || !bytes.Equal(raw, image) {
+		t.Errorf("expected original image, got %v", err)
+	}
+
+	if _, err := ToDexDrive(image[:1000]); err != ErrFormat {
+		t.Errorf("expected %v, got %v", ErrFormat, err)
+	}
+	dex[0] = 'X'
+	if _, err := FromDexDrive(dex); err != ErrFormat {
+		t.Errorf("expected %v, got %v", ErrFormat, err)
+	}
+	if _, err := FromDexDrive(image); err != ErrFormat {
+		t.Errorf("expected %v, got %v", ErrFormat, err)
+	}
+}
+
+func TestMultiBank(t *testing.T) {
+	const banks = 4
+	dev := make(memDev, banks*32*1024)
+	if err := Format(dev, &FormatOptions{Banks: banks}); err != nil {
+		t.Fatal(err)
+	}
+	pfs, err := Read(dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first bank has 11 system pages, the others one for the checksum
+	if size := int64(128-11+3*127) * pageSize; pfs.Size() != size || pfs.Free() != size {
+		t.Fatalf("expected %d bytes free, got %d of %d", size, pfs.Free(), pfs.Size())
+	}
+
+	data := []byte(strings.Repeat(lorem, 200*pageSize/len(lorem)+1))[:200*pageSize]
+	f, err := pfs.Create("BIG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt(data, 0); err != nil {
+		t.Fatal(err)
+	}
+	pages, err := f.pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pages[0] != 11 || pages[116] != 127 || pages[117] != 0x0101 || pages[199] != 0x0153 {
+		t.Errorf("unexpected pages %x", pages)
+	}
+	// Inode of page 1 in the table of bank 1 links to page 2 of bank 1
+	offset, _ := iNodesOffset(banks)
+	if inode := binary.BigEndian.Uint16(dev[offset+pageSize+2:]); inode != 0x0102 {
+		t.Errorf("expected inode 0x0102, got %#x", inode)
+	}
+
+	pfs, err = Read(dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := fs.ReadFile(pfs, "BIG")
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("expected written data, got %v", err)
+	}
+	if problems, err := Check(dev, false); err != nil || len(problems) != 0 {
+		t.Errorf("expected clean filesystem, got %v, %v", problems, err)
+	}
+
+	// Fill the remaining pages of all banks
+	f, err = pfs.Create("REST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pfs.Truncate("REST", pfs.Free()); err != nil {
+		t.Fatal(err)
+	}
+	if pfs.Free() != 0 {
+		t.Errorf("expected full filesystem, got %d bytes free", pfs.Free())
+	}
+	if _, err := f.WriteAt([]byte{1}, f.Size()); err != ErrNoSpace {
+		t.Errorf("expected %v, got %v", ErrNoSpace, err)
+	}
+	if problems, err := Check(dev, false); err != nil || len(problems) != 0 {
+		t.Errorf("expected clean filesystem, got %v, %v", problems, err)
+	}
+}
+
+// TestINodesChecksum reads inode tables of two banks as libultra writes them,
+// where the checksums sum all bytes of the inodes.
+func TestINodesChecksum(t *testing.T) {
+	const banks = 2
+	dev := make(memDev, banks*32*1024)
+	if err := Format(dev, &FormatOptions{Banks: banks}); err != nil {
+		t.Fatal(err)
+	}
+	offset, n := iNodesOffset(banks)
+	table := dev[offset : offset+n]
+	put := func(index int, inode uint16) { binary.BigEndian.PutUint16(table[2*index:], inode) }
+
+	// A note on pages 7 and 8 of bank 0 and pages 1 and 2 of bank 1
+	put(7, 0x0008)
+	put(8, 0x0101)
+	put(pagesPerBank+1, 0x0102)
+	put(pagesPerBank+2, 0x0001)
+	table[1] = 0x6f          // 0x08 + 0x01+0x01 + 119 free pages * 0x03
+	table[pageSize+1] = 0x7b // 0x01+0x02 + 0x01 + 125 free pages * 0x03
+	bakOffset, _ := iNodesBakOffset(banks)
+	copy(dev[bakOffset:], table)
+
+	pfs, err := Read(dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inodes := slices.Clone(pfs.inodes)
+	if !pfs.iNodesChecksum(true) || !slices.Equal(pfs.inodes, inodes) {
+		t.Errorf("expected valid checksums %#x and %#x, got %#x and %#x",
+			inodes[0], inodes[pagesPerBank], pfs.inodes[0], pfs.inodes[pagesPerBank])
+	}
+
+	table[pageSize+1]--
+	copy(dev[bakOffset:], table)
+	if _, err := Read(dev); err != ErrInconsistent {
+		t.Errorf("expected %v, got %v", ErrInconsistent, err)
+	}
+}
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"github.com/drpaneas/n64/debug"
+	"github.com/drpaneas/n64/drivers/controller/event"
 	"github.com/drpaneas/n64/rcp/serial"
 	"github.com/drpaneas/n64/rcp/serial/joybus"
 )
@@ -42,6 +43,11 @@ type allControllers [4]Controller
 
 var States allControllers
 
+// Events emits the plug, pak and button events of all ports, generated by
+// States.Poll.  Inserted paks are detected by ProbePak, only while there are
+// subscribers.
+var Events = event.NewSource(ProbePak)
+
 func (p *allControllers) Poll() {
 	// poll info
 	for _, cmd := range cmdAllInfoPorts {
@@ -68,5 +74,20 @@ func (p *allControllers) Poll() {
 		p[i].last = p[i].current
 		cur := &p[i].current
 		cur.down, cur.xAxis, cur.yAxis, p[i].err = cmdAllStatesPorts[i].State()
+
+		if r := p[i].rumble; r != nil {
+			if p[i].PakRemoved() || p[i].Unplugged() {
+				r.Detach()
+				p[i].rumble = nil
+			} else {
+				r.Update() // errors stop the pattern, see Player.Err
+			}
+		}
+
+		snap := event.Snapshot{Device: dev, Pak: flags&pakInserted != 0, Buttons: cur.down, Err: err}
+		if snap.Err == nil {
+			snap.Err = p[i].err
+		}
+		Events.Update(i, snap)
 	}
 }
@@ -0,0 +1,224 @@
+// Package rumble plays vibration patterns on a Rumble Pak.
+//
+// The motor of the Rumble Pak can only be switched on and off.  Intermediate
+// strengths are produced by switching it on for a proportional share of the
+// time, which requires updating the motor regularly, e.g. on every
+// controller poll.
+package rumble
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrUnknownPreset = errors.New("rumble: unknown preset")
+
+// Motor is a rumble motor, like controller.RumblePak.
+type Motor interface {
+	Set(on bool) error
+}
+
+// Step drives the motor for Duration, fading linearly from the strength
+// Start to End.  Strengths range from 0 (off) to 1 (always on).
+type Step struct {
+	Duration   time.Duration
+	Start, End float32
+}
+
+// Const returns a step of constant strength.
+func Const(strength float32, d time.Duration) Step {
+	return Step{d, strength, strength}
+}
+
+// Fade returns a step fading from one strength to another.
+func Fade(from, to float32, d time.Duration) Step {
+	return Step{d, from, to}
+}
+
+// Pattern is a sequence of steps, played once or, with Loop, until stopped.
+type Pattern struct {
+	Steps []Step
+	Loop  bool
+}
+
+// Duration returns the length of a single run of the pattern.
+func (p Pattern) Duration() (d time.Duration) {
+	for _, s := range p.Steps {
+		d += s.Duration
+	}
+	return
+}
+
+// At returns the strength at time t after the start of the pattern.  It
+// returns false if the pattern ended before t.
+func (p Pattern) At(t time.Duration) (float32, bool) {
+	if d := p.Duration(); p.Loop && d > 0 {
+		t %= d
+	}
+	for _, s := range p.Steps {
+		if t < s.Duration {
+			frac := float32(t) / float32(s.Duration)
+			return s.Start + (s.End-s.Start)*frac, true
+		}
+		t -= s.Duration
+	}
+	return 0, false
+}
+
+// Presets are common patterns, looked up by name with Preset.
+var Presets = map[string]Pattern{
+	"tap": {Steps: []Step{Const(1, 60*time.Millisecond)}},
+	"hit": {Steps: []Step{
+		Const(1, 150*time.Millisecond),
+		Fade(1, 0, 200*time.Millisecond),
+	}},
+	"explosion": {Steps: []Step{
+		Const(1, 300*time.Millisecond),
+		Fade(1, 0.2, 600*time.Millisecond),
+		Fade(0.2, 0, 400*time.Millisecond),
+	}},
+	"heartbeat": {Loop: true, Steps: []Step{
+		Const(1, 80*time.Millisecond),
+		Const(0, 120*time.Millisecond),
+		Const(0.6, 80*time.Millisecond),
+		Const(0, 620*time.Millisecond),
+	}},
+	"engine idle": {Loop: true, Steps: []Step{
+		Const(0.3, 180*time.Millisecond),
+		Const(0.5, 70*time.Millisecond),
+	}},
+}
+
+// Preset returns the preset pattern name.
+func Preset(name string) (Pattern, error) {
+	p, ok := Presets[name]
+	if !ok {
+		return Pattern{}, ErrUnknownPreset
+	}
+	return p, nil
+}
+
+// maxDebt limits how much on or off time the duty cycling carries over, so
+// a strength change takes effect within a few updates.
+const maxDebt = 50 * time.Millisecond
+
+// Player plays patterns on a motor.  Update advances the pattern and must be
+// called regularly; the other methods may be called concurrently with it.
+type Player struct {
+	motor Motor
+	now   func() time.Time
+
+	mtx     sync.Mutex
+	pattern Pattern
+	playing bool
+	start   time.Time
+	last    time.Time
+	on      bool
+	debt    time.Duration // on time owed to the pattern, negative if ahead
+	err     error
+}
+
+// NewPlayer returns a player for motor.  If now is nil, time.Now is used.
+func NewPlayer(motor Motor, now func() time.Time) *Player {
+	if now == nil {
+		now = time.Now
+	}
+	return &Player{motor: motor, now: now}
+}
+
+// Play starts playing pattern, replacing the current one.  The motor is
+// switched by the next Update.
+func (p *Player) Play(pattern Pattern) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.pattern = pattern
+	p.playing = true
+	p.start = p.now()
+	p.last = p.start
+	p.debt = 0
+}
+
+// Playing reports whether a pattern is playing.
+func (p *Player) Playing() bool {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.playing
+}
+
+// Stop stops the current pattern and switches the motor off.
+func (p *Player) Stop() error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.playing = false
+	return p.set(false)
+}
+
+// Detach stops the player without accessing the motor, e.g. because the pak
+// was removed.  Further updates don't access the motor until Play is
+// called.
+func (p *Player) Detach() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.playing = false
+	p.on = false
+}
+
+// Err returns the error of the last motor access, which stopped the player.
+func (p *Player) Err() error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.err
+}
+
+// Update switches the motor according to the pattern and the time elapsed
+// since the last update.  The motor is only accessed if its state changes.
+// If the access fails, the pattern is stopped.
+func (p *Player) Update() error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if !p.playing {
+		return nil
+	}
+	now := p.now()
+	strength, ok := p.pattern.At(now.Sub(p.start))
+	if !ok {
+		p.playing = false
+		return p.set(false)
+	}
+
+	// Error diffusion: track how much the time the motor was on differs
+	// from the time the strength asks for, and switch to reduce it.
+	on := p.on
+	switch {
+	case strength <= 0:
+		on, p.debt = false, 0
+	case strength >= 1:
+		on, p.debt = true, 0
+	default:
+		dt := now.Sub(p.last)
+		actual := float32(0)
+		if p.on {
+			actual = 1
+		}
+		p.debt += time.Duration(float32(dt) * (strength - actual))
+		p.debt = min(max(p.debt, -maxDebt), maxDebt)
+		on = p.debt > 0
+	}
+	p.last = now
+	return p.set(on)
+}
+
+func (p *Player) set(on bool) error {
+	if on == p.on {
+		return nil
+	}
+	if err := p.motor.Set(on); err != nil {
+		p.playing = false
+		p.err = err
+		return err
+	}
+	p.on = on
+	p.err = nil
+	return nil
+}
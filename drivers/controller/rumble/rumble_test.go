@@ -0,0 +1,193 @@
+package rumble
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeMotor struct {
+	on   bool
+	sets int
+	err  error
+}
+
+func (m *fakeMotor) Set(on bool) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.on = on
+	m.sets++
+	return nil
+}
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+// frame is the poll interval of a game running at 60 fps.
+const frame = time.Second / 60
+
+// run updates p every frame for d and returns how long the motor was on.
+func run(t *testing.T, p *Player, m *fakeMotor, c *fakeClock, d time.Duration) (on time.Duration) {
+	t.Helper()
+	for end := c.t.Add(d); c.t.Before(end); c.t = c.t.Add(frame) {
+		if err := p.Update(); err != nil {
+			t.Fatal(err)
+		}
+		if m.on {
+			on += frame
+		}
+	}
+	return
+}
+
+func TestPatternAt(t *testing.T) {
+	p := Pattern{Steps: []Step{Const(1, 100*time.Millisecond), Fade(1, 0, 200*time.Millisecond)}}
+	loop := p
+	loop.Loop = true
+
+	tests := map[string]struct {
+		pattern  Pattern
+		at       time.Duration
+		expected float32
+		ok       bool
+	}{
+		"Start":     {p, 0, 1, true},
+		"Const":     {p, 99 * time.Millisecond, 1, true},
+		"FadeStart": {p, 100 * time.Millisecond, 1, true},
+		"FadeHalf":  {p, 200 * time.Millisecond, 0.5, true},
+		"End":       {p, 300 * time.Millisecond, 0, false},
+		"Loop":      {loop, 500 * time.Millisecond, 0.5, true},
+		"Empty":     {Pattern{Loop: true}, 0, 0, false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			s, ok := tc.pattern.At(tc.at)
+			if s != tc.expected || ok != tc.ok {
+				t.Errorf("expected %v, %v, got %v, %v", tc.expected, tc.ok, s, ok)
+			}
+		})
+	}
+}
+
+func TestDutyCycle(t *testing.T) {
+	tests := map[string]struct {
+		strength float32
+		maxSets  int
+	}{
+		"Off":     {0, 0},
+		"Quarter": {0.25, 60},
+		"Half":    {0.5, 60},
+		"Full":    {1, 1},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := &fakeMotor{}
+			c := &fakeClock{time.Unix(0, 0)}
+			p := NewPlayer(m, c.now)
+			p.Play(Pattern{Steps: []Step{Const(tc.strength, 2*time.Second)}})
+
+			on := run(t, p, m, c, time.Second)
+			expected := time.Duration(float32(time.Second) * tc.strength)
+			if on < expected-2*frame || on > expected+2*frame {
+				t.Errorf("expected about %v on, got %v", expected, on)
+			}
+			if m.sets > tc.maxSets {
+				t.Errorf("expected at most %d motor accesses, got %d", tc.maxSets, m.sets)
+			}
+		})
+	}
+}
+
+func TestEnd(t *testing.T) {
+	m := &fakeMotor{}
+	c := &fakeClock{time.Unix(0, 0)}
+	p := NewPlayer(m, c.now)
+	hit, err := Preset("hit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Play(hit)
+
+	run(t, p, m, c, hit.Duration()-frame)
+	if !p.Playing() {
+		t.Fatalf("expected pattern playing")
+	}
+	run(t, p, m, c, 2*frame)
+	if p.Playing() || m.on {
+		t.Errorf("expected pattern stopped and motor off")
+	}
+
+	if _, err := Preset("nope"); err != ErrUnknownPreset {
+		t.Errorf("expected %v, got %v", ErrUnknownPreset, err)
+	}
+}
+
+func TestLoop(t *testing.T) {
+	m := &fakeMotor{}
+	c := &fakeClock{time.Unix(0, 0)}
+	p := NewPlayer(m, c.now)
+	p.Play(Presets["engine idle"])
+
+	on := run(t, p, m, c, 10*time.Second)
+	if !p.Playing() {
+		t.Fatalf("expected looping pattern playing")
+	}
+	// 180ms at 0.3 and 70ms at 0.5
+	expected := 10 * time.Second * (180*3 + 70*5) / 2500
+	if on < expected*95/100 || on > expected*105/100 {
+		t.Errorf("expected about %v on, got %v", expected, on)
+	}
+
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if p.Playing() || m.on {
+		t.Errorf("expected pattern stopped and motor off")
+	}
+}
+
+func TestDetach(t *testing.T) {
+	m := &fakeMotor{}
+	c := &fakeClock{time.Unix(0, 0)}
+	p := NewPlayer(m, c.now)
+	p.Play(Pattern{Steps: []Step{Const(1, time.Second)}})
+	run(t, p, m, c, frame)
+
+	p.Detach()
+	sets := m.sets
+	run(t, p, m, c, time.Second)
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if m.sets != sets {
+		t.Errorf("expected no motor access after detach, got %d", m.sets-sets)
+	}
+
+	// A new pak is switched on again
+	p.Play(Pattern{Steps: []Step{Const(1, time.Second)}})
+	run(t, p, m, c, frame)
+	if !m.on {
+		t.Errorf("expected motor on")
+	}
+}
+
+func TestMotorError(t *testing.T) {
+	errPak := errors.New("pak removed")
+	m := &fakeMotor{err: errPak}
+	c := &fakeClock{time.Unix(0, 0)}
+	p := NewPlayer(m, c.now)
+	p.Play(Pattern{Steps: []Step{Const(1, time.Second)}})
+
+	if err := p.Update(); err != errPak {
+		t.Errorf("expected %v, got %v", errPak, err)
+	}
+	if p.Playing() || p.Err() != errPak {
+		t.Errorf("expected pattern stopped with %v, got %v", errPak, p.Err())
+	}
+}
@@ -0,0 +1,270 @@
+package transferpak
+
+import (
+	"bytes"
+	"io"
+)
+
+// The cartridge header at 0x100-0x14F of the ROM.
+const (
+	headerAddr = 0x100
+	headerSize = 0x50
+
+	hdrTitle    = 0x34
+	hdrCGB      = 0x43 // Game Boy Color flag, last byte of the title
+	hdrType     = 0x47
+	hdrROMSize  = 0x48
+	hdrRAMSize  = 0x49
+	hdrChecksum = 0x4d
+)
+
+// Header is the header of a cartridge.
+type Header struct {
+	Title   string
+	CGB     byte // Game Boy Color flag: 0x80 compatible, 0xC0 only
+	Type    byte // cartridge type, selects the MBC
+	ROMSize int
+	RAMSize int
+}
+
+// ramSizes maps the RAM size codes of the header to sizes.
+var ramSizes = [...]int{0, 2 << 10, 8 << 10, 32 << 10, 128 << 10, 64 << 10}
+
+func parseHeader(hdr []byte) (Header, error) {
+	var sum byte
+	for _, b := range hdr[hdrTitle:hdrChecksum] {
+		sum = sum - b - 1
+	}
+	if sum != hdr[hdrChecksum] || hdr[hdrROMSize] > 8 || int(hdr[hdrRAMSize]) >= len(ramSizes) {
+		return Header{}, ErrHeader
+	}
+
+	title := hdr[hdrTitle : hdrCGB+1]
+	if hdr[hdrCGB]&0x80 != 0 {
+		title = title[:len(title)-1]
+	}
+	if i := bytes.IndexByte(title, 0); i >= 0 {
+		title = title[:i]
+	}
+	return Header{
+		Title:   string(bytes.TrimSpace(title)),
+		CGB:     hdr[hdrCGB] & 0xc0,
+		Type:    hdr[hdrType],
+		ROMSize: 32 << 10 << hdr[hdrROMSize],
+		RAMSize: ramSizes[hdr[hdrRAMSize]],
+	}, nil
+}
+
+// MBC is the memory bank controller of a cartridge.
+type MBC int
+
+const (
+	NoMBC MBC = iota // 32 KiB ROM, up to 8 KiB RAM
+	MBC1
+	MBC2 // 512 half-bytes of RAM
+	MBC3
+	MBC5
+)
+
+// mbcs maps the supported cartridge types to their MBC.
+var mbcs = map[byte]MBC{
+	0x00: NoMBC, 0x08: NoMBC, 0x09: NoMBC,
+	0x01: MBC1, 0x02: MBC1, 0x03: MBC1,
+	0x05: MBC2, 0x06: MBC2,
+	0x0f: MBC3, 0x10: MBC3, 0x11: MBC3, 0x12: MBC3, 0x13: MBC3,
+	0x19: MBC5, 0x1a: MBC5, 0x1b: MBC5, 0x1c: MBC5, 0x1d: MBC5, 0x1e: MBC5,
+}
+
+const mbc2RAMSize = 512
+
+// MBC registers, written in the ROM address range
+const (
+	regRAMEnable   = 0x0000
+	regROMBank     = 0x2000
+	regMBC2ROMBank = 0x2100 // MBC2 decodes address bit 8 instead
+	regROMBankHigh = 0x3000 // MBC5 bit 8 of the ROM bank
+	regRAMBank     = 0x4000 // MBC1 bits 5-6 of the ROM bank or RAM bank
+	regMode        = 0x6000 // MBC1 banking mode
+
+	ramEnable = 0x0a
+)
+
+const (
+	ramAddr     = 0xa000
+	ramBankBits = 13
+	ramBankSize = 1 << ramBankBits
+	ramBankMask = ramBankSize - 1
+)
+
+// Cartridge is a Game Boy cartridge in a Transfer Pak.
+type Cartridge struct {
+	Header
+	MBC MBC
+
+	pak *Pak
+}
+
+// Close disables the access mode and powers the cartridge off.
+func (c *Cartridge) Close() error {
+	if err := c.pak.SetAccess(false); err != nil {
+		return err
+	}
+	return c.pak.SetPower(false)
+}
+
+type reg struct {
+	addr int64
+	v    byte
+}
+
+func (c *Cartridge) set(regs ...reg) error {
+	for _, r := range regs {
+		if err := writeReg(c.pak, r.addr, r.v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selectROM maps ROM bank to the cartridge address space and returns its
+// address.
+func (c *Cartridge) selectROM(bank int) (int64, error) {
+	if c.MBC == MBC1 && bank&0x1f == 0 {
+		// MBC1 maps banks 0x20, 0x40 and 0x60 to 0x0000 in mode 1 only
+		return 0, c.set(reg{regRAMBank, byte(bank >> 5)}, reg{regMode, 1})
+	}
+	if bank == 0 {
+		return 0, nil
+	}
+	var err error
+	switch c.MBC {
+	case MBC1:
+		err = c.set(reg{regMode, 0}, reg{regROMBank, byte(bank)}, reg{regRAMBank, byte(bank >> 5)})
+	case MBC2:
+		err = c.set(reg{regMBC2ROMBank, byte(bank)})
+	case MBC3:
+		err = c.set(reg{regROMBank, byte(bank)})
+	case MBC5:
+		err = c.set(reg{regROMBank, byte(bank)}, reg{regROMBankHigh, byte(bank >> 8)})
+	}
+	return windowSize, err
+}
+
+func (c *Cartridge) selectRAM(bank int) error {
+	switch c.MBC {
+	case MBC1:
+		return c.set(reg{regMode, 1}, reg{regRAMBank, byte(bank)})
+	case MBC3, MBC5:
+		return c.set(reg{regRAMBank, byte(bank)})
+	}
+	return nil
+}
+
+// ROM returns the ROM of the cartridge.
+func (c *Cartridge) ROM() *ROM {
+	return &ROM{c}
+}
+
+// RAM returns the battery backed RAM of the cartridge.
+func (c *Cartridge) RAM() *RAM {
+	return &RAM{c}
+}
+
+// ROM reads the ROM of a cartridge, switching banks as needed.
+type ROM struct {
+	c *Cartridge
+}
+
+func (r *ROM) Size() int64 {
+	return int64(r.c.ROMSize)
+}
+
+func (r *ROM) ReadAt(b []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, ErrRange
+	}
+	end := min(off+int64(len(b)), r.Size())
+	for off+int64(n) < end {
+		pos := off + int64(n)
+		var addr int64
+		if addr, err = r.c.selectROM(int(pos >> windowBits)); err != nil {
+			return
+		}
+		l := min(int(end-pos), windowSize-int(pos&windowMask))
+		var done int
+		done, err = r.c.pak.ReadAt(b[n:n+l], addr+pos&windowMask)
+		n += done
+		if err != nil {
+			return
+		}
+	}
+	if n < len(b) {
+		err = io.EOF
+	}
+	return
+}
+
+// RAM reads and writes the RAM of a cartridge, switching banks as needed.
+// The RAM is only enabled during an access, protecting it from writes while
+// a cartridge is removed.  The RAM of MBC2 stores the lower 4 bits of each
+// byte.
+type RAM struct {
+	c *Cartridge
+}
+
+func (r *RAM) Size() int64 {
+	return int64(r.c.RAMSize)
+}
+
+func (r *RAM) ReadAt(b []byte, off int64) (n int, err error) {
+	n, err = r.access(b, off, r.c.pak.ReadAt)
+	if r.c.MBC == MBC2 {
+		for i := range b[:n] {
+			b[i] &= 0x0f
+		}
+	}
+	if err == nil && n < len(b) {
+		err = io.EOF
+	}
+	return
+}
+
+func (r *RAM) WriteAt(b []byte, off int64) (n int, err error) {
+	n, err = r.access(b, off, r.c.pak.WriteAt)
+	if err == nil && n < len(b) {
+		err = io.ErrShortWrite
+	}
+	return
+}
+
+func (r *RAM) access(b []byte, off int64, access func([]byte, int64) (int, error)) (n int, err error) {
+	if off < 0 {
+		return 0, ErrRange
+	}
+	end := min(off+int64(len(b)), r.Size())
+	if off >= end {
+		return 0, nil
+	}
+	if err = r.c.set(reg{regRAMEnable, ramEnable}); err != nil {
+		return
+	}
+	defer func() {
+		if err1 := r.c.set(reg{regRAMEnable, 0}); err == nil {
+			err = err1
+		}
+	}()
+	for off+int64(n) < end {
+		pos := off + int64(n)
+		if err = r.c.selectRAM(int(pos >> ramBankBits)); err != nil {
+			return
+		}
+		l := min(int(end-pos), ramBankSize-int(pos&ramBankMask))
+		var done int
+		done, err = access(b[n:n+l], ramAddr+pos&ramBankMask)
+		n += done
+		if err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,188 @@
+// Package transferpak implements the Transfer Pak protocol and access to the
+// ROM and RAM of the inserted Game Boy cartridge.
+//
+// The Transfer Pak maps the 64 KiB address space of the cartridge in four
+// 16 KiB banks to the pak addresses 0xC000-0xFFFF.  The bank is selected by
+// writing to 0xA000, the pak is powered by writing to 0x8000 and the access
+// mode is set and the status read at 0xB000.  All registers are written as a
+// whole 32 byte block.
+package transferpak
+
+import (
+	"errors"
+	"io"
+)
+
+var (
+	ErrNoCartridge = errors.New("transferpak: no cartridge inserted")
+	ErrNotReady    = errors.New("transferpak: access mode not enabled")
+	ErrHeader      = errors.New("transferpak: invalid cartridge header")
+	ErrUnsupported = errors.New("transferpak: unsupported cartridge type")
+	ErrRange       = errors.New("transferpak: address out of range")
+)
+
+// Device is the address space of a pak, like controller.Pak.
+type Device interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+const (
+	addrPower  = 0x8000
+	addrBank   = 0xa000
+	addrStatus = 0xb000
+	addrWindow = 0xc000
+
+	windowBits = 14
+	windowSize = 1 << windowBits
+	windowMask = windowSize - 1
+
+	gbSize = 1 << 16 // Game Boy address space
+
+	blockSize = 32
+)
+
+const (
+	powerOn  = 0x84
+	powerOff = 0xfe
+)
+
+// Status bits read at 0xB000
+const (
+	StatusAccess    = 0x01 // access mode enabled
+	StatusReset     = 0x04 // cartridge was reset since the last status read
+	StatusResetting = 0x08 // cartridge is held in reset
+	StatusRemoved   = 0x40 // no cartridge inserted
+	StatusPowered   = 0x80
+)
+
+// Pak is a Transfer Pak.
+type Pak struct {
+	dev  Device
+	bank int // selected bank of the window, -1 if unknown
+}
+
+func New(dev Device) *Pak {
+	return &Pak{dev: dev, bank: -1}
+}
+
+// writeReg writes v to the whole block of the register at addr.
+func writeReg(dev io.WriterAt, addr int64, v byte) error {
+	var data [blockSize]byte
+	for i := range data {
+		data[i] = v
+	}
+	_, err := dev.WriteAt(data[:], addr)
+	return err
+}
+
+// SetPower powers the cartridge on or off.  The access mode is disabled by
+// powering off.
+func (p *Pak) SetPower(on bool) error {
+	v := byte(powerOff)
+	if on {
+		v = powerOn
+	}
+	p.bank = -1
+	return writeReg(p.dev, addrPower, v)
+}
+
+// SetAccess enables or disables the access mode, which connects the
+// cartridge bus to the pak.
+func (p *Pak) SetAccess(on bool) error {
+	var v byte
+	if on {
+		v = 1
+	}
+	return writeReg(p.dev, addrStatus, v)
+}
+
+// Status returns the status bits of the pak.
+func (p *Pak) Status() (byte, error) {
+	var data [blockSize]byte
+	if _, err := p.dev.ReadAt(data[:], addrStatus); err != nil && err != io.EOF {
+		return 0, err
+	}
+	return data[0], nil
+}
+
+// ReadAt reads the address space of the cartridge.  The pak must be powered
+// and in access mode.
+func (p *Pak) ReadAt(b []byte, addr int64) (int, error) {
+	return p.access(b, addr, p.dev.ReadAt)
+}
+
+// WriteAt writes the address space of the cartridge.  Writes to 0x0000-0x7FFF
+// set the registers of the memory bank controller, which sees every byte of a
+// block written in turn.
+func (p *Pak) WriteAt(b []byte, addr int64) (int, error) {
+	return p.access(b, addr, p.dev.WriteAt)
+}
+
+// access splits an access at addr into accesses within the window.
+func (p *Pak) access(b []byte, addr int64, access func([]byte, int64) (int, error)) (n int, err error) {
+	if addr < 0 || addr+int64(len(b)) > gbSize {
+		return 0, ErrRange
+	}
+	for n < len(b) {
+		pos := addr + int64(n)
+		if bank := int(pos >> windowBits); bank != p.bank {
+			p.bank = -1
+			if err = writeReg(p.dev, addrBank, byte(bank)); err != nil {
+				return
+			}
+			p.bank = bank
+		}
+		l := min(len(b)-n, windowSize-int(pos&windowMask))
+		var done int
+		done, err = access(b[n:n+l], addrWindow+pos&windowMask)
+		n += done
+		// The window ends with the address space of the pak
+		if err == io.EOF && done == l {
+			err = nil
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Open powers the pak on, enables the access mode and returns the inserted
+// cartridge.
+func (p *Pak) Open() (*Cartridge, error) {
+	if err := p.SetPower(true); err != nil {
+		return nil, err
+	}
+	if err := p.SetAccess(true); err != nil {
+		return nil, err
+	}
+	status, err := p.Status()
+	if err != nil {
+		return nil, err
+	}
+	if status&StatusRemoved != 0 {
+		return nil, ErrNoCartridge
+	}
+	if status&StatusAccess == 0 {
+		return nil, ErrNotReady
+	}
+
+	var hdr [headerSize]byte
+	if _, err := p.ReadAt(hdr[:], headerAddr); err != nil {
+		return nil, err
+	}
+	h, err := parseHeader(hdr[:])
+	if err != nil {
+		return nil, err
+	}
+	mbc, ok := mbcs[h.Type]
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	c := &Cartridge{Header: h, MBC: mbc, pak: p}
+	if mbc == MBC2 {
+		c.RAMSize = mbc2RAMSize
+	}
+	return c, nil
+}
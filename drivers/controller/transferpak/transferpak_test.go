@@ -0,0 +1,452 @@
+package transferpak
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// fakeCart emulates the memory bank controller of a Game Boy cartridge.
+type fakeCart struct {
+	rom, ram []byte
+	mbc      MBC
+
+	ramOn            bool
+	romBank, ramBank int
+	upper, mode      int // MBC1
+}
+
+func (c *fakeCart) romOffset(addr int) int {
+	bank := 0
+	switch {
+	case addr < windowSize:
+		if c.mbc == MBC1 && c.mode == 1 {
+			bank = c.upper << 5
+		}
+	case c.mbc == NoMBC:
+		bank = 1
+	case c.mbc == MBC1:
+		bank = max(c.romBank&0x1f, 1) | c.upper<<5
+	case c.mbc == MBC2:
+		bank = max(c.romBank&0x0f, 1)
+	case c.mbc == MBC3:
+		bank = max(c.romBank&0x7f, 1)
+	case c.mbc == MBC5:
+		bank = c.romBank & 0x1ff
+	}
+	return (bank<<windowBits | addr&windowMask) % len(c.rom)
+}
+
+func (c *fakeCart) ramOffset(addr int) int {
+	if c.mbc == MBC2 {
+		return addr & 0x1ff
+	}
+	bank := c.ramBank
+	if c.mbc == MBC1 {
+		bank = c.upper * c.mode
+	}
+	return (bank<<ramBankBits | addr&ramBankMask) % len(c.ram)
+}
+
+func (c *fakeCart) read(addr int) byte {
+	switch {
+	case addr < 0x8000:
+		return c.rom[c.romOffset(addr)]
+	case addr >= ramAddr && addr < 0xc000 && c.ramOn && len(c.ram) > 0:
+		return c.ram[c.ramOffset(addr)]
+	}
+	return 0xff
+}
+
+func (c *fakeCart) write(addr int, v byte) {
+	switch {
+	case addr < 0x4000 && c.mbc == MBC2:
+		if addr&0x100 == 0 {
+			c.ramOn = v&0x0f == ramEnable
+		} else {
+			c.romBank = int(v)
+		}
+	case addr < 0x2000:
+		c.ramOn = v&0x0f == ramEnable
+	case addr < 0x3000 && c.mbc == MBC5:
+		c.romBank = c.romBank&0x100 | int(v)
+	case addr < 0x4000 && c.mbc == MBC5:
+		c.romBank = c.romBank&0xff | int(v&1)<<8
+	case addr < 0x4000:
+		c.romBank = int(v)
+	case addr < 0x6000 && c.mbc == MBC1:
+		c.upper = int(v & 3)
+	case addr < 0x6000:
+		c.ramBank = int(v)
+	case addr < 0x8000 && c.mbc == MBC1:
+		c.mode = int(v & 1)
+	case addr >= ramAddr && addr < 0xc000 && c.ramOn && len(c.ram) > 0:
+		if c.mbc == MBC2 {
+			v &= 0x0f
+		}
+		c.ram[c.ramOffset(addr)] = v
+	}
+}
+
+// fakePak emulates a Transfer Pak on the joybus, which reads and writes
+// whole 32 byte blocks.
+type fakePak struct {
+	t     *testing.T
+	cart  *fakeCart // nil if no cartridge inserted
+	power bool
+	acc   bool
+	bank  int
+}
+
+func (p *fakePak) check(b []byte, off int64) {
+	if len(b) != blockSize || off&(blockSize-1) != 0 {
+		p.t.Fatalf("access of %d bytes at %#x isn't a joybus block", len(b), off)
+	}
+}
+
+func (p *fakePak) ReadAt(b []byte, off int64) (int, error) {
+	p.check(b, off)
+	for i := range b {
+		switch addr := int(off) + i; {
+		case addr >= addrWindow:
+			b[i] = 0
+			if p.power && p.acc && p.cart != nil {
+				b[i] = p.cart.read(p.bank<<windowBits | addr&windowMask)
+			}
+		case addr >= addrStatus:
+			b[i] = 0
+			if p.acc {
+				b[i] |= StatusAccess
+			}
+			if p.power {
+				b[i] |= StatusPowered
+			}
+			if p.cart == nil {
+				b[i] |= StatusRemoved
+			}
+		case addr >= addrPower:
+			b[i] = 0
+			if p.power {
+				b[i] = powerOn
+			}
+		default:
+			b[i] = 0
+		}
+	}
+	if off+blockSize == 1<<16 {
+		return blockSize, io.EOF
+	}
+	return blockSize, nil
+}
+
+func (p *fakePak) WriteAt(b []byte, off int64) (int, error) {
+	p.check(b, off)
+	addr := int(off)
+	if addr >= addrWindow {
+		if !p.power || !p.acc || p.cart == nil {
+			return blockSize, nil
+		}
+		gb := p.bank<<windowBits | addr&windowMask
+		if gb < 0x8000 && !bytes.Equal(b, bytes.Repeat(b[:1], blockSize)) {
+			p.t.Fatalf("MBC register at %#x written with %x", gb, b)
+		}
+		for i, v := range b {
+			p.cart.write(gb+i, v)
+		}
+		return blockSize, nil
+	}
+	switch v := b[blockSize-1]; {
+	case addr >= addrStatus:
+		p.acc = p.power && v == 1
+	case addr >= addrBank:
+		p.bank = int(v & 3)
+	case addr >= addrPower:
+		if v == powerOn {
+			p.power = true
+		} else if v == powerOff {
+			p.power, p.acc = false, false
+		}
+	}
+	return blockSize, nil
+}
+
+// blockDev splits accesses into aligned 32 byte blocks, like controller.Pak.
+type blockDev struct {
+	pak *fakePak
+}
+
+func (d blockDev) ReadAt(b []byte, off int64) (n int, err error) {
+	var tmp [blockSize]byte
+	for n < len(b) {
+		pos := off + int64(n)
+		if _, err = d.pak.ReadAt(tmp[:], pos&^(blockSize-1)); err != nil && err != io.EOF {
+			return
+		}
+		n += copy(b[n:], tmp[pos&(blockSize-1):])
+	}
+	return n, err
+}
+
+func (d blockDev) WriteAt(b []byte, off int64) (n int, err error) {
+	var tmp [blockSize]byte
+	for n < len(b) {
+		pos := off + int64(n)
+		start := pos & (blockSize - 1)
+		if start != 0 || len(b)-n < blockSize {
+			if _, err = d.pak.ReadAt(tmp[:], pos-start); err != nil && err != io.EOF {
+				return
+			}
+		}
+		done := copy(tmp[start:], b[n:])
+		if _, err = d.pak.WriteAt(tmp[:], pos-start); err != nil {
+			return
+		}
+		n += done
+	}
+	return n, nil
+}
+
+// newCart returns a cartridge with random ROM and RAM contents and a valid
+// header.
+func newCart(mbc MBC, cartType, romCode, ramCode byte) *fakeCart {
+	rng := rand.New(rand.NewSource(int64(cartType)))
+	c := &fakeCart{
+		rom: make([]byte, 32<<10<<romCode),
+		ram: make([]byte, ramSizes[ramCode]),
+		mbc: mbc,
+	}
+	if mbc == MBC2 {
+		c.ram = make([]byte, mbc2RAMSize)
+	}
+	rng.Read(c.rom)
+	rng.Read(c.ram)
+	if mbc == MBC2 {
+		for i := range c.ram {
+			c.ram[i] &= 0x0f
+		}
+	}
+
+	hdr := c.rom[headerAddr : headerAddr+headerSize]
+	copy(hdr[hdrTitle:hdrCGB+1], "POKEMON RED\x00\x00\x00\x00\x00")
+	hdr[hdrType] = cartType
+	hdr[hdrROMSize] = romCode
+	hdr[hdrRAMSize] = ramCode
+	c.setChecksum()
+	return c
+}
+
+func (c *fakeCart) setChecksum() {
+	hdr := c.rom[headerAddr : headerAddr+headerSize]
+	var sum byte
+	for _, b := range hdr[hdrTitle:hdrChecksum] {
+		sum = sum - b - 1
+	}
+	hdr[hdrChecksum] = sum
+}
+
+func newFake(t *testing.T, cart *fakeCart) (*fakePak, *Pak) {
+	fake := &fakePak{t: t, cart: cart}
+	return fake, New(blockDev{fake})
+}
+
+func TestOpen(t *testing.T) {
+	badChecksum := newCart(MBC1, 0x03, 0, 2)
+	badChecksum.rom[headerAddr+hdrChecksum]++
+	cgb := newCart(MBC5, 0x1b, 0, 2)
+	copy(cgb.rom[headerAddr+hdrTitle:], "ZELDA DX\x00\x00\x00\x00\x00\x00\x00\x80")
+	cgb.setChecksum()
+
+	tests := map[string]struct {
+		cart     *fakeCart
+		expected Header
+		mbc      MBC
+		err      error
+	}{
+		"NoMBC": {
+			cart:     newCart(NoMBC, 0x00, 0, 0),
+			expected: Header{Title: "POKEMON RED", Type: 0x00, ROMSize: 32 << 10},
+			mbc:      NoMBC,
+		},
+		"MBC2": {
+			cart:     newCart(MBC2, 0x06, 3, 0),
+			expected: Header{Title: "POKEMON RED", Type: 0x06, ROMSize: 256 << 10, RAMSize: 512},
+			mbc:      MBC2,
+		},
+		"MBC3": {
+			cart:     newCart(MBC3, 0x13, 5, 3),
+			expected: Header{Title: "POKEMON RED", Type: 0x13, ROMSize: 1 << 20, RAMSize: 32 << 10},
+			mbc:      MBC3,
+		},
+		"CGB": {
+			cart:     cgb,
+			expected: Header{Title: "ZELDA DX", CGB: 0x80, Type: 0x1b, ROMSize: 32 << 10, RAMSize: 8 << 10},
+			mbc:      MBC5,
+		},
+		"NoCartridge": {err: ErrNoCartridge},
+		"BadChecksum": {cart: badChecksum, err: ErrHeader},
+		"Unsupported": {cart: newCart(NoMBC, 0xfc, 0, 0), err: ErrUnsupported},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			fake, pak := newFake(t, tc.cart)
+			c, err := pak.Open()
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if c.Header != tc.expected {
+				t.Errorf("expected %+v, got %+v", tc.expected, c.Header)
+			}
+			if c.MBC != tc.mbc {
+				t.Errorf("expected MBC %v, got %v", tc.mbc, c.MBC)
+			}
+			if !fake.power || !fake.acc {
+				t.Errorf("expected pak powered in access mode")
+			}
+			status, err := pak.Status()
+			if err != nil || status != StatusPowered|StatusAccess {
+				t.Errorf("expected status %#x, got %#x, %v", StatusPowered|StatusAccess, status, err)
+			}
+
+			if err := c.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if fake.power || fake.acc {
+				t.Errorf("expected pak powered off")
+			}
+		})
+	}
+}
+
+func TestNotReady(t *testing.T) {
+	fake, pak := newFake(t, newCart(NoMBC, 0x00, 0, 0))
+	if err := pak.SetPower(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := pak.SetAccess(true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pak.ReadAt(make([]byte, 1), 0x10000); err != ErrRange {
+		t.Errorf("expected %v, got %v", ErrRange, err)
+	}
+	if err := pak.SetPower(false); err != nil {
+		t.Fatal(err)
+	}
+	if fake.acc {
+		t.Errorf("expected access mode disabled by power off")
+	}
+	if status, _ := pak.Status(); status != 0 {
+		t.Errorf("expected status 0, got %#x", status)
+	}
+}
+
+var carts = map[string]struct {
+	mbc              MBC
+	cartType         byte
+	romCode, ramCode byte
+}{
+	"NoMBC": {NoMBC, 0x09, 0, 2},
+	"MBC1":  {MBC1, 0x03, 6, 3}, // 2 MiB ROM needs the upper bank bits
+	"MBC2":  {MBC2, 0x06, 3, 0},
+	"MBC3":  {MBC3, 0x13, 6, 3},
+	"MBC5":  {MBC5, 0x1b, 8, 4}, // 8 MiB ROM needs bank bit 8
+}
+
+func TestROM(t *testing.T) {
+	for name, tc := range carts {
+		t.Run(name, func(t *testing.T) {
+			cart := newCart(tc.mbc, tc.cartType, tc.romCode, tc.ramCode)
+			_, pak := newFake(t, cart)
+			c, err := pak.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			rom := c.ROM()
+			if rom.Size() != int64(len(cart.rom)) {
+				t.Fatalf("expected size %d, got %d", len(cart.rom), rom.Size())
+			}
+
+			// Read the banks in reverse, so every bank is switched to
+			data := make([]byte, len(cart.rom))
+			for off := len(data) - windowSize; off >= 0; off -= windowSize {
+				if _, err := rom.ReadAt(data[off:off+windowSize], int64(off)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !bytes.Equal(data, cart.rom) {
+				t.Fatalf("ROM content mismatch")
+			}
+
+			// Across bank boundaries and past the end
+			off := int64(len(data) - windowSize - 7)
+			buf := make([]byte, windowSize+100)
+			n, err := rom.ReadAt(buf, off)
+			if err != io.EOF || n != windowSize+7 {
+				t.Fatalf("expected %d, %v, got %d, %v", windowSize+7, io.EOF, n, err)
+			}
+			if !bytes.Equal(buf[:n], cart.rom[off:]) {
+				t.Fatalf("ROM content mismatch at %#x", off)
+			}
+		})
+	}
+}
+
+func TestRAM(t *testing.T) {
+	for name, tc := range carts {
+		t.Run(name, func(t *testing.T) {
+			cart := newCart(tc.mbc, tc.cartType, tc.romCode, tc.ramCode)
+			_, pak := newFake(t, cart)
+			c, err := pak.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			ram := c.RAM()
+			if ram.Size() != int64(len(cart.ram)) {
+				t.Fatalf("expected size %d, got %d", len(cart.ram), ram.Size())
+			}
+
+			data := make([]byte, len(cart.ram))
+			if _, err := ram.ReadAt(data, 0); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, cart.ram) {
+				t.Fatalf("RAM content mismatch")
+			}
+			if cart.ramOn {
+				t.Errorf("expected RAM disabled after access")
+			}
+
+			// Unaligned write across all banks, interleaved with ROM reads
+			for i := range data {
+				data[i] = byte(i*7) & 0x0f
+			}
+			if _, err := ram.WriteAt(data[3:], 3); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := c.ROM().ReadAt(make([]byte, 1), int64(len(cart.rom)-1)); err != nil {
+				t.Fatal(err)
+			}
+			got := make([]byte, len(data))
+			if _, err := ram.ReadAt(got, 0); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got[3:], data[3:]) || !bytes.Equal(cart.ram[3:], data[3:]) {
+				t.Fatalf("RAM content mismatch after write")
+			}
+
+			n, err := ram.WriteAt(make([]byte, 10), int64(len(data)-4))
+			if err != io.ErrShortWrite || n != 4 {
+				t.Errorf("expected 4, %v, got %d, %v", io.ErrShortWrite, n, err)
+			}
+			n, err = ram.ReadAt(make([]byte, 10), int64(len(data)))
+			if err != io.EOF || n != 0 {
+				t.Errorf("expected 0, %v, got %d, %v", io.EOF, n, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package draw3d
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/drpaneas/n64/debug"
+)
+
+// Microcode commands, see gfx3d.S
+const (
+	cmdMatrix uint64 = iota + 1
+	cmdViewport
+	cmdLights
+	cmdVertices
+	cmdTriangle
+	cmdGeometry
+	cmdEnd
+)
+
+const (
+	cacheSize       = 32  // number of vertices in the microcode's vertex cache
+	triangleMaxSize = 176 // maximum size of an RDP triangle command in bytes
+	taskSize        = 24  // size of the task header at the start of DMEM
+)
+
+// commandList holds commands for the microcode and their payloads.
+type commandList struct {
+	cmds      []uint64
+	data      []uint64
+	triangles int // recorded triangles, clipping can emit more
+}
+
+func (l *commandList) reset() {
+	l.cmds = l.cmds[:0]
+	l.data = l.data[:0]
+	l.triangles = 0
+}
+
+// push adds a command with the payload starting at the current end of the
+// data buffer.
+func (l *commandList) push(op uint64, p1, p2, p3 uint8) {
+	l.cmds = append(l.cmds, op<<56|uint64(p1)<<48|uint64(p2)<<40|uint64(p3)<<32|uint64(len(l.data)*8))
+}
+
+// recorder tracks the pipeline state and records commands for the microcode.
+type recorder struct {
+	list commandList
+
+	projection, modelView Matrix
+	near                  int32 // s15.16
+
+	viewport image.Rectangle
+	ambient  [3]uint8
+	lights   []Light
+
+	mode  GeometryMode
+	tile  uint8
+	level uint8
+
+	slots []int8   // cache slot of each vertex in the current batch, or -1
+	batch []uint16 // vertices in the current batch, by cache slot
+	tris  [][3]uint8
+}
+
+// SetProjection sets the projection matrix.  near is the clip space w of
+// vertices on the near plane, i.e. the near distance of a perspective
+// projection or 1 for an orthographic projection.  Triangles crossing the
+// near plane are clipped.
+func (r *recorder) SetProjection(m Matrix, near float32) {
+	r.projection = m
+	r.near = max(int32(near*(1<<16)), 1<<8)
+}
+
+// SetModelView sets the matrix transforming object space to eye space.
+func (r *recorder) SetModelView(m Matrix) {
+	r.modelView = m
+}
+
+// SetViewport sets the screen area mapped to the clip space from -1 to 1.
+// Triangles extending far beyond the viewport are clipped to a guard band
+// four times its size, the RDP's scissor area should be used to restrict
+// drawing to the viewport.
+func (r *recorder) SetViewport(rect image.Rectangle) {
+	r.viewport = rect
+}
+
+// SetLights sets the ambient light and up to MaxLights directional lights,
+// which are used if Lighting is enabled.
+func (r *recorder) SetLights(ambient color.RGBA, lights ...Light) {
+	debug.Assert(len(lights) <= MaxLights, "draw3d: too many lights")
+	r.ambient = [3]uint8{ambient.R, ambient.G, ambient.B}
+	r.lights = append(r.lights[:0], lights...)
+}
+
+// SetGeometryMode sets the attributes of drawn triangles.
+func (r *recorder) SetGeometryMode(mode GeometryMode) {
+	r.mode = mode
+}
+
+// SetTextureTile sets the tile descriptor and the number of additional
+// mipmap levels used for texturing.
+func (r *recorder) SetTextureTile(idx, levels uint8) {
+	debug.Assert(idx < 8 && levels < 8, "draw3d: invalid texture tile")
+	r.tile, r.level = idx, levels
+}
+
+// record records the commands for drawing the triangles.
+func (r *recorder) record(vertices []Vertex, indices []uint16) {
+	l := &r.list
+	l.reset()
+	r.recordState()
+
+	n := len(indices)
+	if indices == nil {
+		n = len(vertices)
+	}
+	n -= n % 3
+
+	if cap(r.slots) < len(vertices) {
+		r.slots = make([]int8, len(vertices))
+	}
+	r.slots = r.slots[:len(vertices)]
+	for i := range r.slots {
+		r.slots[i] = -1
+	}
+
+	for i := 0; i < n; i += 3 {
+		var tri [3]uint16
+		for j := range tri {
+			if indices == nil {
+				tri[j] = uint16(i + j)
+			} else {
+				tri[j] = indices[i+j]
+			}
+		}
+
+		missing := 0
+		for j, v := range tri {
+			if r.slots[v] < 0 && (j < 1 || v != tri[0]) && (j < 2 || v != tri[1]) {
+				missing++
+			}
+		}
+		if len(r.batch)+missing > cacheSize {
+			r.recordBatch(vertices)
+		}
+
+		var slots [3]uint8
+		for j, v := range tri {
+			if r.slots[v] < 0 {
+				r.slots[v] = int8(len(r.batch))
+				r.batch = append(r.batch, v)
+			}
+			slots[j] = uint8(r.slots[v])
+		}
+		r.tris = append(r.tris, slots)
+	}
+	r.recordBatch(vertices)
+
+	l.push(cmdEnd, 0, 0, 0)
+}
+
+// recordBatch records the vertices and triangles of the current batch.
+func (r *recorder) recordBatch(vertices []Vertex) {
+	l := &r.list
+	if len(r.tris) == 0 {
+		return
+	}
+
+	l.push(cmdVertices, uint8(len(r.batch)), 0, 0)
+	for _, idx := range r.batch {
+		v := &vertices[idx]
+		l.data = append(l.data,
+			uint64(uint16(v.X))<<48|uint64(uint16(v.Y))<<32|uint64(uint16(v.Z))<<16,
+			uint64(uint16(v.S))<<48|uint64(uint16(v.T))<<32|
+				uint64(v.R)<<24|uint64(v.G)<<16|uint64(v.B)<<8|uint64(v.A))
+		r.slots[idx] = -1
+	}
+	for _, t := range r.tris {
+		l.push(cmdTriangle, t[0], t[1], t[2])
+	}
+	l.triangles += len(r.tris)
+
+	r.batch = r.batch[:0]
+	r.tris = r.tris[:0]
+}
+
+// recordState records the complete pipeline state.  It's sent with every
+// command list because other microcode might have run in between.
+func (r *recorder) recordState() {
+	l := &r.list
+
+	l.push(cmdMatrix, 0, 0, 0)
+	m := r.modelView.Mul(r.projection)
+	var frac [4]uint64
+	for i, row := range m {
+		var integer uint64
+		for j, x := range row {
+			v := fixed(x)
+			integer |= uint64(uint16(v>>16)) << (48 - 16*j)
+			frac[i] |= uint64(uint16(v)) << (48 - 16*j)
+		}
+		l.data = append(l.data, integer)
+	}
+	l.data = append(l.data, frac[:]...)
+
+	l.push(cmdViewport, 0, 0, 0)
+	w, h := int64(r.viewport.Dx()), int64(r.viewport.Dy())
+	x0, y0 := int64(r.viewport.Min.X), int64(r.viewport.Min.Y)
+	l.data = append(l.data,
+		halves(w*2, -h*2, 0x3fff, 0),
+		0,
+		halves(x0*4+w*2, y0*4+h*2, 0x3fff, 0),
+		0,
+		uint64(uint32(r.near))<<32)
+
+	l.push(cmdLights, uint8(len(r.lights)), 0, 0)
+	l.data = append(l.data, 0, halves(int64(r.ambient[0]), int64(r.ambient[1]), int64(r.ambient[2]), 0))
+	for _, light := range r.lights {
+		// Lighting is computed in object space
+		var d [3]float32
+		for i := range 3 {
+			d[i] = dot([3]float32(r.modelView[i][:3]), light.Direction)
+		}
+		d = normalize(d)
+		l.data = append(l.data,
+			0, halves(int64(d[0]*0x7fff), int64(d[1]*0x7fff), int64(d[2]*0x7fff), 0),
+			0, halves(int64(light.Color.R), int64(light.Color.G), int64(light.Color.B), 0))
+	}
+
+	l.cmds = append(l.cmds, cmdGeometry<<56|uint64(0x08|r.mode&7)<<48|
+		uint64(r.level<<3|r.tile)<<40|uint64(r.mode))
+}
+
+// fixed converts x to s15.16 fixed point, saturating on overflow.
+func fixed(x float32) int32 {
+	return int32(max(min(math.Round(float64(x)*(1<<16)), math.MaxInt32), math.MinInt32))
+}
+
+// halves packs four 16-bit values into a word.
+func halves(a, b, c, d int64) uint64 {
+	return uint64(uint16(a))<<48 | uint64(uint16(b))<<32 | uint64(uint16(c))<<16 | uint64(uint16(d))
+}
@@ -0,0 +1,195 @@
+// Package draw3d renders 3D triangles.  Vertices are transformed, lit and
+// projected by a microcode on the RSP, which converts triangles into RDP
+// triangle commands.  Colors, depth and textures are configured on the RDP as
+// usual, e.g. with SetOtherModes, SetCombineMode and SetTile.
+//
+// Matrices follow the row vector convention, i.e. a vertex is multiplied from
+// the left and translations are stored in the last row.  Clip space is the
+// same as in OpenGL, but without clipping at the far plane.
+//
+// Triangles entirely outside of a side of the viewport are culled, which the
+// RDP scissor would do as well.  Triangles crossing the near plane or the
+// guard band, four times the size of the viewport, are clipped into up to six
+// triangles.
+//
+// The microcode is only tested with the internal/rspsim simulator, which
+// doesn't model the hardware's timing and was written together with it.
+package draw3d
+
+import (
+	"image/color"
+	"math"
+)
+
+// Vertex is a vertex as consumed by the microcode.  The position is in object
+// space, the texture coordinates are in s10.5 texels.  If lighting is enabled,
+// the color components R, G and B hold the normal instead, see SetNormal.
+type Vertex struct {
+	X, Y, Z int16
+	S, T    int16
+
+	R, G, B, A uint8
+}
+
+// SetNormal stores the normal (x, y, z), which must be of unit length, in the
+// color components of v.
+func (v *Vertex) SetNormal(x, y, z float32) {
+	v.R = uint8(int8(x * 127))
+	v.G = uint8(int8(y * 127))
+	v.B = uint8(int8(z * 127))
+}
+
+// Light is a directional light.
+type Light struct {
+	Direction [3]float32 // pointing towards the light, in eye space
+	Color     color.RGBA
+}
+
+// MaxLights is the number of lights supported by the microcode.
+const MaxLights = 4
+
+// GeometryMode selects the RDP triangle variant and how vertices are
+// processed.
+type GeometryMode uint8
+
+const (
+	ZBuffer   GeometryMode = 1 << iota // Interpolate depth
+	Texture                            // Interpolate texture coordinates
+	Shade                              // Interpolate vertex colors
+	Lighting                           // Compute vertex colors from normals and lights
+	CullBack                           // Discard back faces
+	CullFront                          // Discard front faces
+)
+
+// Matrix is a 4x4 transformation matrix.
+type Matrix [4][4]float32
+
+// Identity returns the identity matrix.
+func Identity() Matrix {
+	return Matrix{
+		{1, 0, 0, 0},
+		{0, 1, 0, 0},
+		{0, 0, 1, 0},
+		{0, 0, 0, 1},
+	}
+}
+
+// Mul returns the matrix which applies m first, followed by n.
+func (m Matrix) Mul(n Matrix) (r Matrix) {
+	for i := range 4 {
+		for j := range 4 {
+			for k := range 4 {
+				r[i][j] += m[i][k] * n[k][j]
+			}
+		}
+	}
+	return r
+}
+
+// Translate returns a translation by (x, y, z).
+func Translate(x, y, z float32) Matrix {
+	m := Identity()
+	m[3] = [4]float32{x, y, z, 1}
+	return m
+}
+
+// Scale returns a scaling by (x, y, z).
+func Scale(x, y, z float32) Matrix {
+	return Matrix{
+		{x, 0, 0, 0},
+		{0, y, 0, 0},
+		{0, 0, z, 0},
+		{0, 0, 0, 1},
+	}
+}
+
+// RotateX returns a counterclockwise rotation around the x axis.
+func RotateX(rad float32) Matrix {
+	s, c := sincos(rad)
+	m := Identity()
+	m[1][1], m[1][2] = c, s
+	m[2][1], m[2][2] = -s, c
+	return m
+}
+
+// RotateY returns a counterclockwise rotation around the y axis.
+func RotateY(rad float32) Matrix {
+	s, c := sincos(rad)
+	m := Identity()
+	m[0][0], m[0][2] = c, -s
+	m[2][0], m[2][2] = s, c
+	return m
+}
+
+// RotateZ returns a counterclockwise rotation around the z axis.
+func RotateZ(rad float32) Matrix {
+	s, c := sincos(rad)
+	m := Identity()
+	m[0][0], m[0][1] = c, s
+	m[1][0], m[1][1] = -s, c
+	return m
+}
+
+// Perspective returns a perspective projection with the vertical field of view
+// fovy in radians.  The camera looks along the negative z axis.
+func Perspective(fovy, aspect, near, far float32) Matrix {
+	f := 1 / float32(math.Tan(float64(fovy)/2))
+	return Matrix{
+		{f / aspect, 0, 0, 0},
+		{0, f, 0, 0},
+		{0, 0, (far + near) / (near - far), -1},
+		{0, 0, 2 * far * near / (near - far), 0},
+	}
+}
+
+// Ortho returns an orthographic projection.
+func Ortho(left, right, bottom, top, near, far float32) Matrix {
+	return Matrix{
+		{2 / (right - left), 0, 0, 0},
+		{0, 2 / (top - bottom), 0, 0},
+		{0, 0, -2 / (far - near), 0},
+		{-(right + left) / (right - left), -(top + bottom) / (top - bottom), -(far + near) / (far - near), 1},
+	}
+}
+
+// LookAt returns a view matrix for a camera at eye looking at center.
+func LookAt(eye, center, up [3]float32) Matrix {
+	f := normalize(sub(center, eye))
+	s := normalize(cross(f, up))
+	u := cross(s, f)
+	m := Identity()
+	for i := range 3 {
+		m[i][0], m[i][1], m[i][2] = s[i], u[i], -f[i]
+	}
+	m[3][0], m[3][1], m[3][2] = -dot(s, eye), -dot(u, eye), dot(f, eye)
+	return m
+}
+
+func sincos(rad float32) (float32, float32) {
+	s, c := math.Sincos(float64(rad))
+	return float32(s), float32(c)
+}
+
+func sub(a, b [3]float32) [3]float32 {
+	return [3]float32{a[0] - b[0], a[1] - b[1], a[2] - b[2]}
+}
+
+func dot(a, b [3]float32) float32 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+func cross(a, b [3]float32) [3]float32 {
+	return [3]float32{
+		a[1]*b[2] - a[2]*b[1],
+		a[2]*b[0] - a[0]*b[2],
+		a[0]*b[1] - a[1]*b[0],
+	}
+}
+
+func normalize(a [3]float32) [3]float32 {
+	l := float32(math.Sqrt(float64(dot(a, a))))
+	if l == 0 {
+		return a
+	}
+	return [3]float32{a[0] / l, a[1] / l, a[2] / l}
+}
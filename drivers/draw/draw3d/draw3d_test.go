@@ -0,0 +1,535 @@
+package draw3d
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/drpaneas/n64/internal/rspsim"
+)
+
+const (
+	simCmds = 0x01000
+	simData = 0x10000
+	simOut  = 0x40000
+)
+
+// simulate runs the microcode with the commands recorded by r on a simulated
+// RSP and returns the resulting RDP commands.
+func simulate(t *testing.T, r *recorder, capacity int, vertices []Vertex, indices []uint16) (out []uint64, status uint32) {
+	t.Helper()
+	r.record(vertices, indices)
+	if capacity < 0 {
+		capacity = r.list.triangles * triangleMaxSize
+	}
+
+	sim := rspsim.New(1 << 20)
+	copy(sim.IMEM[:], ucodeText)
+	copy(sim.DMEM[:], ucodeData)
+	for i, w := range r.list.cmds {
+		binary.BigEndian.PutUint64(sim.RDRAM[simCmds+8*i:], w)
+	}
+	for i, w := range r.list.data {
+		binary.BigEndian.PutUint64(sim.RDRAM[simData+8*i:], w)
+	}
+	for i, w := range []uint32{simCmds, uint32(len(r.list.cmds) * 8), simData, simOut, uint32(capacity), 0} {
+		binary.BigEndian.PutUint32(sim.DMEM[4*i:], w)
+	}
+
+	if err := sim.Run(1_000_000); err != nil {
+		t.Fatal(err)
+	}
+
+	used := binary.BigEndian.Uint32(sim.DMEM[0x10:])
+	status = binary.BigEndian.Uint32(sim.DMEM[0x14:])
+	if int(used) > capacity {
+		t.Fatalf("output exceeds capacity: %d > %d", used, capacity)
+	}
+	for i := 0; i < int(used); i += 8 {
+		out = append(out, binary.BigEndian.Uint64(sim.RDRAM[simOut+i:]))
+	}
+	return out, status
+}
+
+type coefficient struct{ v, dx, de, dy float64 }
+
+type triangle struct {
+	op         uint8
+	left       bool
+	yh, ym, yl float64
+	xh, xm, xl float64
+	dxh, dxm   float64
+	dxl        float64
+	shade      [4]coefficient
+	texture    [3]coefficient
+	z          coefficient
+}
+
+func s1516(hi, lo uint16) float64 {
+	return float64(int32(uint32(hi)<<16|uint32(lo))) / (1 << 16)
+}
+
+// decode splits RDP triangle commands, failing on other commands.
+func decode(t *testing.T, out []uint64) (tris []triangle) {
+	t.Helper()
+	s11_2 := func(v uint64) float64 { return float64(int16(v<<2)>>2) / 4 }
+	half := func(w uint64, i int) uint16 { return uint16(w >> (48 - 16*i)) }
+	block := func(w []uint64, c []coefficient) {
+		for i := range c {
+			c[i] = coefficient{
+				v:  s1516(half(w[0], i), half(w[2], i)),
+				dx: s1516(half(w[1], i), half(w[3], i)),
+				de: s1516(half(w[4], i), half(w[6], i)),
+				dy: s1516(half(w[5], i), half(w[7], i)),
+			}
+		}
+	}
+
+	for len(out) > 0 {
+		w := out[0]
+		op := uint8(w >> 56)
+		if op&0xf8 != 0x08 || len(out) < 4 {
+			t.Fatalf("unexpected command %016x", w)
+		}
+		tri := triangle{
+			op:   op,
+			left: w>>55&1 != 0,
+			yl:   s11_2(w >> 32 & 0x3fff),
+			ym:   s11_2(w >> 16 & 0x3fff),
+			yh:   s11_2(w & 0x3fff),
+			xl:   s1516(half(out[1], 0), half(out[1], 1)),
+			dxl:  s1516(half(out[1], 2), half(out[1], 3)),
+			xh:   s1516(half(out[2], 0), half(out[2], 1)),
+			dxh:  s1516(half(out[2], 2), half(out[2], 3)),
+			xm:   s1516(half(out[3], 0), half(out[3], 1)),
+			dxm:  s1516(half(out[3], 2), half(out[3], 3)),
+		}
+		out = out[4:]
+		if op&4 != 0 {
+			block(out, tri.shade[:])
+			out = out[8:]
+		}
+		if op&2 != 0 {
+			block(out, tri.texture[:])
+			out = out[8:]
+		}
+		if op&1 != 0 {
+			tri.z = coefficient{
+				v:  s1516(half(out[0], 0), half(out[0], 1)),
+				dx: s1516(half(out[0], 2), half(out[0], 3)),
+				de: s1516(half(out[1], 0), half(out[1], 1)),
+				dy: s1516(half(out[1], 2), half(out[1], 3)),
+			}
+			out = out[2:]
+		}
+		tris = append(tris, tri)
+	}
+	return tris
+}
+
+// screen is a vertex projected by the reference implementation.
+type screen struct {
+	x, y  float64
+	attrs [8]float64 // s, t, w, z, r, g, b, a
+}
+
+func project(r *recorder, v Vertex) screen {
+	return projectClip(r, transform(r, v))
+}
+
+// clipVertex is a vertex in clip space with its unprojected attributes.
+type clipVertex struct {
+	pos   [4]float64
+	attrs [6]float64 // s, t, r, g, b, a
+}
+
+func transform(r *recorder, v Vertex) clipVertex {
+	m := r.modelView.Mul(r.projection)
+	c := clipVertex{attrs: [6]float64{
+		float64(v.S), float64(v.T), float64(v.R), float64(v.G), float64(v.B), float64(v.A),
+	}}
+	for j := range 4 {
+		c.pos[j] = float64(v.X)*float64(m[0][j]) + float64(v.Y)*float64(m[1][j]) +
+			float64(v.Z)*float64(m[2][j]) + float64(m[3][j])
+	}
+	return c
+}
+
+func projectClip(r *recorder, c clipVertex) screen {
+	clip := c.pos
+	w := clip[3]
+	p := float64(r.near) / (1 << 16) / w // perspective correction
+	vp := r.viewport
+	// Positions are truncated to the precision of the RDP
+	return screen{
+		x: math.Floor(4*(float64(vp.Min.X)+float64(vp.Dx())/2*(1+clip[0]/w))) / 4,
+		y: math.Floor(4*(float64(vp.Min.Y)+float64(vp.Dy())/2*(1-clip[1]/w))) / 4,
+		attrs: [8]float64{
+			c.attrs[0] * p, c.attrs[1] * p, 0x7fff * min(p, 1), 0x3fff * (1 + clip[2]/w),
+			c.attrs[2], c.attrs[3], c.attrs[4], c.attrs[5],
+		},
+	}
+}
+
+// clip clips a polygon against the near plane and the guard band like the
+// microcode, interpolating intersections from the vertex inside.  The
+// attributes of intersections are rounded to integers as in the cache.
+func clip(r *recorder, poly []clipVertex) []clipVertex {
+	nearW := float64(r.near) / (1 << 16)
+	for _, dist := range []func(p [4]float64) float64{
+		func(p [4]float64) float64 { return p[3] - nearW },
+		func(p [4]float64) float64 { return 4*p[3] + p[0] },
+		func(p [4]float64) float64 { return 4*p[3] + p[1] },
+		func(p [4]float64) float64 { return 4*p[3] - p[0] },
+		func(p [4]float64) float64 { return 4*p[3] - p[1] },
+	} {
+		var out []clipVertex
+		s := poly[len(poly)-1]
+		for _, e := range poly {
+			ds, de := dist(s.pos), dist(e.pos)
+			if (ds < 0) != (de < 0) {
+				in, o, t := s, e, ds/(ds-de)
+				if ds < 0 {
+					in, o, t = e, s, de/(de-ds)
+				}
+				for i := range in.pos {
+					in.pos[i] += t * (o.pos[i] - in.pos[i])
+				}
+				for i := range in.attrs {
+					in.attrs[i] = math.Round(in.attrs[i] + t*(o.attrs[i]-in.attrs[i]))
+				}
+				out = append(out, in)
+			}
+			if de >= 0 {
+				out = append(out, e)
+			}
+			s = e
+		}
+		poly = out
+	}
+	return poly
+}
+
+func near(got, want, tolerance float64) bool {
+	return math.Abs(got-want) <= tolerance*max(1, math.Abs(want))
+}
+
+// check compares tri against the triangle (a, b, c) of the reference.
+func check(t *testing.T, tri triangle, a, b, c screen) {
+	t.Helper()
+	v := []screen{a, b, c}
+	if v[1].y < v[0].y {
+		v[0], v[1] = v[1], v[0]
+	}
+	if v[2].y < v[1].y {
+		v[1], v[2] = v[2], v[1]
+	}
+	if v[1].y < v[0].y {
+		v[0], v[1] = v[1], v[0]
+	}
+	top, mid, low := v[0], v[1], v[2]
+
+	for _, e := range []struct {
+		name      string
+		got, want float64
+		tolerance float64
+	}{
+		{"YH", tri.yh, top.y, 0.25},
+		{"YM", tri.ym, mid.y, 0.25},
+		{"YL", tri.yl, low.y, 0.25},
+		{"XL", tri.xl, mid.x, 0.25},
+		{"DxHDy", tri.dxh, (low.x - top.x) / (low.y - top.y), 0.02},
+		{"DxMDy", tri.dxm, (mid.x - top.x) / (mid.y - top.y), 0.02},
+		{"DxLDy", tri.dxl, (low.x - mid.x) / (low.y - mid.y), 0.02},
+		{"XH", tri.xh, top.x + (math.Floor(tri.yh)-tri.yh)*tri.dxh, 0.3},
+		{"XM", tri.xm, top.x + (math.Floor(tri.yh)-tri.yh)*tri.dxm, 0.3},
+	} {
+		if !near(e.got, e.want, e.tolerance) {
+			t.Errorf("%s: expected %v, got %v", e.name, e.want, e.got)
+		}
+	}
+
+	// The middle vertex is right of the long edge for left major triangles
+	cross := (low.x-top.x)*(mid.y-top.y) - (low.y-top.y)*(mid.x-top.x)
+	if tri.left != (cross < 0) {
+		t.Errorf("expected left major %v, got %v", cross < 0, tri.left)
+	}
+
+	checkPlane := func(name string, got coefficient, i int, tolerance float64) {
+		t.Helper()
+		da1, da2 := mid.attrs[i]-top.attrs[i], low.attrs[i]-top.attrs[i]
+		dx1, dx2 := mid.x-top.x, low.x-top.x
+		dy1, dy2 := mid.y-top.y, low.y-top.y
+		det := dx1*dy2 - dx2*dy1
+		dx := (da1*dy2 - da2*dy1) / det
+		dy := (dx1*da2 - dx2*da1) / det
+		de := dy + dx*tri.dxh
+		v := top.attrs[i] + (math.Floor(tri.yh)-tri.yh)*de
+		// Values are compared relative to the variation across the triangle
+		span := max(1, math.Abs(da1), math.Abs(da2))
+		for _, e := range []struct {
+			name      string
+			got, want float64
+		}{
+			{"", (got.v - v) / span, 0}, {"/dx", got.dx, dx}, {"/de", got.de, de}, {"/dy", got.dy, dy},
+		} {
+			if !near(e.got, e.want, tolerance) {
+				t.Errorf("%s%s: expected %v, got %v", name, e.name, e.want, e.got)
+			}
+		}
+	}
+	if tri.op&4 != 0 {
+		for i, name := range []string{"R", "G", "B", "A"} {
+			checkPlane(name, tri.shade[i], 4+i, 0.02)
+		}
+	}
+	if tri.op&2 != 0 {
+		for i, name := range []string{"S", "T", "W"} {
+			checkPlane(name, tri.texture[i], i, 0.02)
+		}
+	}
+	if tri.op&1 != 0 {
+		checkPlane("Z", tri.z, 3, 0.02)
+	}
+}
+
+func newRecorder(mode GeometryMode) *recorder {
+	r := &recorder{}
+	r.SetProjection(Ortho(-160, 160, -120, 120, -1000, 1000), 1)
+	r.SetModelView(Identity())
+	r.SetViewport(image.Rect(0, 0, 320, 240))
+	r.SetGeometryMode(mode)
+	return r
+}
+
+func TestTriangle(t *testing.T) {
+	vertices := []Vertex{
+		{X: -100, Y: 80, Z: 10, S: 0, T: 0, R: 255, G: 0, B: 0, A: 255},
+		{X: -60, Y: -90, Z: -200, S: 32 << 5, T: 64 << 5, R: 0, G: 255, B: 0, A: 128},
+		{X: 110, Y: 30, Z: 300, S: 64 << 5, T: 0, R: 0, G: 0, B: 255, A: 0},
+	}
+	tests := map[string]struct {
+		mode    GeometryMode
+		indices []uint16
+	}{
+		"Flat":      {0, nil},
+		"Shade":     {Shade, nil},
+		"Texture":   {Texture, nil},
+		"ZBuffer":   {ZBuffer, nil},
+		"All":       {Shade | Texture | ZBuffer, nil},
+		"Clockwise": {Shade | Texture | ZBuffer, []uint16{0, 2, 1}},
+		"Rotated":   {Shade | Texture | ZBuffer, []uint16{2, 0, 1}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := newRecorder(tc.mode)
+			out, status := simulate(t, r, -1, vertices, tc.indices)
+			if status != 0 {
+				t.Fatalf("expected status 0, got %d", status)
+			}
+			tris := decode(t, out)
+			if len(tris) != 1 {
+				t.Fatalf("expected 1 triangle, got %d", len(tris))
+			}
+			if want := 0x08 | uint8(tc.mode); tris[0].op != want {
+				t.Fatalf("expected opcode %#x, got %#x", want, tris[0].op)
+			}
+			check(t, tris[0], project(r, vertices[0]), project(r, vertices[1]), project(r, vertices[2]))
+		})
+	}
+}
+
+func TestPerspective(t *testing.T) {
+	r := newRecorder(Shade | Texture | ZBuffer)
+	r.SetProjection(Perspective(math.Pi/3, 4.0/3, 10, 1000), 10)
+	r.SetModelView(RotateY(0.3).Mul(Translate(0, 0, -300)))
+	vertices := []Vertex{
+		{X: -100, Y: -80, Z: 50, S: 0, T: 0, R: 200, G: 100, B: 50, A: 255},
+		{X: 100, Y: -60, Z: -50, S: 32 << 5, T: 0, R: 10, G: 20, B: 30, A: 255},
+		{X: 20, Y: 90, Z: 0, S: 16 << 5, T: 32 << 5, R: 100, G: 200, B: 250, A: 255},
+	}
+	out, _ := simulate(t, r, -1, vertices, nil)
+	tris := decode(t, out)
+	if len(tris) != 1 {
+		t.Fatalf("expected 1 triangle, got %d", len(tris))
+	}
+	check(t, tris[0], project(r, vertices[0]), project(r, vertices[1]), project(r, vertices[2]))
+}
+
+func TestDiscard(t *testing.T) {
+	ccw := []Vertex{{X: -50, Y: -50}, {X: 50, Y: -50}, {X: 0, Y: 50}}
+	cw := []Vertex{ccw[0], ccw[2], ccw[1]}
+	tests := map[string]struct {
+		mode     GeometryMode
+		vertices []Vertex
+		want     int
+	}{
+		"Front":          {0, ccw, 1},
+		"Back":           {0, cw, 1},
+		"CullBackFront":  {CullBack, ccw, 1},
+		"CullBackBack":   {CullBack, cw, 0},
+		"CullFrontFront": {CullFront, ccw, 0},
+		"CullFrontBack":  {CullFront, cw, 1},
+		"Outside":        {0, []Vertex{{X: 200, Y: 0}, {X: 300, Y: 0}, {X: 250, Y: 50}}, 0},
+		"Degenerate":     {0, []Vertex{{X: 0, Y: 0}, {X: 10, Y: 0}, {X: 20, Y: 0}}, 0},
+		"Behind":         {0, []Vertex{{X: 0, Y: 0, Z: 95}, {X: 10, Y: 0, Z: 95}, {X: 0, Y: 10, Z: 95}}, 0},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := newRecorder(tc.mode)
+			r.SetProjection(Perspective(math.Pi/2, 4.0/3, 10, 1000), 10)
+			r.SetModelView(Translate(0, 0, -100))
+			if name == "Outside" {
+				r.SetModelView(Translate(0, 0, -10.5))
+			}
+			out, _ := simulate(t, r, -1, tc.vertices, nil)
+			if got := len(decode(t, out)); got != tc.want {
+				t.Fatalf("expected %d triangles, got %d", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestClip(t *testing.T) {
+	// The perspective correction of vertices is only accurate to about 10
+	// bits, which the large triangles in the guard band exceed for texture
+	// gradients.
+	tests := map[string]struct {
+		mode     GeometryMode
+		vertices []Vertex
+		want     int
+	}{
+		"NearOne": {Shade | Texture | ZBuffer, []Vertex{{X: -60, Y: -40, Z: -50}, {X: 60, Y: -40, Z: -50}, {X: 0, Y: 50, Z: 95}}, 2},
+		"NearTwo": {Shade | Texture | ZBuffer, []Vertex{{X: -40, Y: -30, Z: 95}, {X: 40, Y: -20, Z: 0}, {X: 10, Y: 30, Z: 97}}, 1},
+		"Guard":   {Shade | ZBuffer, []Vertex{{X: 0, Y: 0, Z: 0}, {X: 1000, Y: 0, Z: -5}, {X: 0, Y: 50, Z: 5}}, 2},
+		"Both":    {Shade | ZBuffer, []Vertex{{X: -30, Y: -20, Z: 20}, {X: 1000, Y: 200, Z: 0}, {X: -20, Y: 40, Z: 98}}, 3},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := newRecorder(tc.mode)
+			r.SetProjection(Perspective(math.Pi/2, 4.0/3, 10, 1000), 10)
+			r.SetModelView(Translate(0, 0, -100))
+			if name == "Guard" {
+				r.SetModelView(Translate(0, 0, -20))
+			}
+			for i := range tc.vertices {
+				v := &tc.vertices[i]
+				v.S, v.T = int16(i*16<<5), int16(i%2*32<<5)
+				v.R, v.G, v.B, v.A = uint8(60*i), uint8(200-50*i), 100, 255
+			}
+			out, status := simulate(t, r, tc.want*triangleMaxSize, tc.vertices, nil)
+			if status != 0 {
+				t.Fatalf("expected status 0, got %d", status)
+			}
+			tris := decode(t, out)
+			if len(tris) != tc.want {
+				t.Fatalf("expected %d triangles, got %d", tc.want, len(tris))
+			}
+
+			poly := clip(r, []clipVertex{
+				transform(r, tc.vertices[0]), transform(r, tc.vertices[1]), transform(r, tc.vertices[2]),
+			})
+			if len(poly) != tc.want+2 {
+				t.Fatalf("expected %d vertices, got %d", tc.want+2, len(poly))
+			}
+			for i, tri := range tris {
+				check(t, tri, projectClip(r, poly[0]), projectClip(r, poly[i+1]), projectClip(r, poly[i+2]))
+			}
+		})
+	}
+}
+
+func TestLighting(t *testing.T) {
+	r := newRecorder(Shade | Lighting)
+	r.SetModelView(RotateX(math.Pi / 2))
+	r.SetLights(color.RGBA{20, 30, 60, 255},
+		Light{Direction: [3]float32{0, 0, 1}, Color: color.RGBA{200, 100, 50, 255}},
+		Light{Direction: [3]float32{1, 0, 0}, Color: color.RGBA{100, 100, 255, 255}})
+
+	tests := map[string]struct {
+		normal [3]float32
+		want   [3]float64
+	}{
+		"Facing": {[3]float32{0, 1, 0}, [3]float64{220, 130, 110}}, // rotated to +z
+		"Away":   {[3]float32{0, -1, 0}, [3]float64{20, 30, 60}},
+		"Both":   {[3]float32{0.7071, 0.7071, 0}, [3]float64{232.1, 171.4, 255}}, // blue is clamped
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			vertices := []Vertex{{X: -50, Y: 0, Z: 50, A: 255}, {X: 50, Y: 0, Z: 50, A: 255}, {X: 0, Y: 0, Z: -50, A: 255}}
+			for i := range vertices {
+				vertices[i].SetNormal(tc.normal[0], tc.normal[1], tc.normal[2])
+			}
+			out, _ := simulate(t, r, -1, vertices, nil)
+			tris := decode(t, out)
+			if len(tris) != 1 {
+				t.Fatalf("expected 1 triangle, got %d", len(tris))
+			}
+			for i, want := range tc.want {
+				c := tris[0].shade[i]
+				if !near(c.v, want, 0.02) || !near(c.dx, 0, 0.02) || !near(c.dy, 0, 0.02) {
+					t.Errorf("lane %d: expected %v, got %+v", i, want, c)
+				}
+			}
+		})
+	}
+}
+
+func TestBatches(t *testing.T) {
+	// A strip of quads sharing vertices, exceeding the vertex cache
+	var vertices []Vertex
+	var indices []uint16
+	for i := range 40 {
+		x := int16(i*7 - 140)
+		vertices = append(vertices, Vertex{X: x, Y: -50, R: uint8(i)}, Vertex{X: x, Y: 50, G: uint8(i)})
+		if i > 0 {
+			a := uint16(2*i - 2)
+			indices = append(indices, a, a+2, a+1, a+1, a+2, a+3)
+		}
+	}
+
+	r := newRecorder(Shade)
+	out, status := simulate(t, r, -1, vertices, indices)
+	if status != 0 {
+		t.Fatalf("expected status 0, got %d", status)
+	}
+	tris := decode(t, out)
+	if len(tris) != len(indices)/3 {
+		t.Fatalf("expected %d triangles, got %d", len(indices)/3, len(tris))
+	}
+	for i, tri := range tris {
+		idx := indices[3*i : 3*i+3]
+		check(t, tri, project(r, vertices[idx[0]]), project(r, vertices[idx[1]]), project(r, vertices[idx[2]]))
+	}
+
+	batches := 0
+	for _, c := range r.list.cmds {
+		if c>>56 == cmdVertices {
+			batches++
+		}
+	}
+	if batches < 3 {
+		t.Fatalf("expected at least 3 batches, got %d", batches)
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	vertices := make([]Vertex, 3*30)
+	for i := range vertices {
+		vertices[i] = Vertex{X: int16(i%3*40 - 40), Y: int16(i % 3 / 2 * 40)}
+	}
+	r := newRecorder(Shade | Texture | ZBuffer)
+	out, status := simulate(t, r, 10*triangleMaxSize, vertices, nil)
+	if status != 1 {
+		t.Fatalf("expected status 1, got %d", status)
+	}
+	if len(decode(t, out)) == 0 {
+		t.Fatal("expected triangles before the overflow")
+	}
+}
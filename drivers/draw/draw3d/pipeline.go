@@ -0,0 +1,88 @@
+//go:build noos
+
+package draw3d
+
+import (
+	"encoding/binary"
+	"image"
+	"unsafe"
+
+	"github.com/drpaneas/n64/rcp/cpu"
+	"github.com/drpaneas/n64/rcp/rdp"
+	"github.com/drpaneas/n64/rcp/rsp"
+)
+
+var ucode = rsp.NewUCode("gfx3d", 0x1000, ucodeText, ucodeData)
+
+// Pipeline draws triangles with the microcode and passes the resulting RDP
+// commands to a display list.
+type Pipeline struct {
+	recorder
+
+	dl      *rdp.DisplayList
+	pending [][]uint64 // output buffers which might still be read by the RDP
+}
+
+// New returns a pipeline drawing to dl.  The viewport defaults to 320x240.
+func New(dl *rdp.DisplayList) *Pipeline {
+	p := &Pipeline{dl: dl}
+	p.SetProjection(Identity(), 1)
+	p.SetModelView(Identity())
+	p.SetViewport(image.Rect(0, 0, 320, 240))
+	return p
+}
+
+// DrawTriangles draws triangles using the current state.  Each three entries
+// of indices form a triangle, if indices is nil, each three vertices do.
+// vertices and indices can be reused after the call.
+func (p *Pipeline) DrawTriangles(vertices []Vertex, indices []uint16) {
+	p.record(vertices, indices)
+	if p.list.triangles == 0 {
+		return
+	}
+
+	cmds := cpu.CopyPaddedSlice(p.list.cmds)
+	data := cpu.CopyPaddedSlice(p.list.data)
+	cpu.WritebackSlice(cmds)
+	cpu.WritebackSlice(data)
+
+	// Clipping can split a triangle into several, the task is repeated with
+	// a larger output buffer in the rare case that they don't fit.
+	size := p.list.triangles * triangleMaxSize / 8
+	for {
+		out := cpu.MakePaddedSlice[uint64](size)
+		cpu.InvalidateSlice(out)
+
+		task := make([]byte, taskSize)
+		binary.BigEndian.PutUint32(task[0:], uint32(physicalAddress(cmds)))
+		binary.BigEndian.PutUint32(task[4:], uint32(len(cmds)*8))
+		binary.BigEndian.PutUint32(task[8:], uint32(physicalAddress(data)))
+		binary.BigEndian.PutUint32(task[12:], uint32(physicalAddress(out)))
+		binary.BigEndian.PutUint32(task[16:], uint32(len(out)*8))
+
+		ucode.Load()
+		rsp.DMAStore(0, task, rsp.DMEM)
+		ucode.Run()
+
+		task = rsp.DMALoad(0, taskSize, rsp.DMEM)
+		if binary.BigEndian.Uint32(task[20:]) != 0 {
+			size *= 2
+			continue
+		}
+		used := binary.BigEndian.Uint32(task[16:])
+		p.dl.Execute(out[:used/8])
+		p.pending = append(p.pending, out)
+		return
+	}
+}
+
+// Flush waits until the RDP processed all commands.
+func (p *Pipeline) Flush() {
+	p.dl.Flush()
+	clear(p.pending)
+	p.pending = p.pending[:0]
+}
+
+func physicalAddress(s []uint64) cpu.Addr {
+	return cpu.PhysicalAddress(uintptr(unsafe.Pointer(unsafe.SliceData(s))))
+}
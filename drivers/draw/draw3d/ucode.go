@@ -0,0 +1,13 @@
+package draw3d
+
+import _ "embed"
+
+//go:generate go run ../../../cmd/rspasm gfx3d.S
+
+var (
+	//go:embed gfx3d.text
+	ucodeText []byte
+
+	//go:embed gfx3d.data
+	ucodeData []byte
+)
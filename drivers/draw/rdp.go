@@ -118,13 +118,13 @@ func (fb *Rdp) drawUniformOver(r image.Rectangle, fill color.Color, mask color.C
 
 	// cc = fill*mask_alpha
 	cp := rdp.CombineParams{
-		rdp.CombinePrimitive, rdp.CombineBColorZero,
-		rdp.CombineCColorEnvironmentAlpha, rdp.CombineDColorZero,
+		A: rdp.CombinePrimitive, B: rdp.CombineBColorZero,
+		C: rdp.CombineCColorEnvironmentAlpha, D: rdp.CombineDColorZero,
 	}
 	// cc_alpha = 1-fill_alpha*mask_alpha
 	cpA := rdp.CombineParams{
-		rdp.CombineAAlphaZero, rdp.CombineEnvironment,
-		rdp.CombinePrimitive, rdp.CombineDAlphaOne,
+		A: rdp.CombineAAlphaZero, B: rdp.CombineEnvironment,
+		C: rdp.CombinePrimitive, D: rdp.CombineDAlphaOne,
 	}
 	fb.dlist.SetCombineMode(rdp.CombineMode{
 		Two: rdp.CombinePass{RGB: cp, Alpha: cpA},
@@ -202,10 +202,10 @@ func (fb *Rdp) drawColorImage(r image.Rectangle, src texture.Texture, p image.Po
 
 	fb.dlist.SetCombineMode(rdp.CombineMode{
 		Two: rdp.CombinePass{
-			RGB: rdp.CombineParams{0, 0, 0, colorSource}, // cc = src
+			RGB: rdp.CombineParams{D: colorSource}, // cc = src
 			Alpha: rdp.CombineParams{ // cc_alpha = 1-tex0_alpha
-				rdp.CombineAAlphaZero, rdp.CombineBAlphaOne,
-				rdp.CombineTex0, rdp.CombineDAlphaOne,
+				A: rdp.CombineAAlphaZero, B: rdp.CombineBAlphaOne,
+				C: rdp.CombineTex0, D: rdp.CombineDAlphaOne,
 			}},
 	})
 	fb.dlist.SetTextureImage(src)
@@ -262,10 +262,10 @@ func (fb *Rdp) DrawText(r image.Rectangle, font *fonts.Face, p image.Point, fg,
 
 	fb.dlist.SetCombineMode(rdp.CombineMode{
 		Two: rdp.CombinePass{
-			RGB: rdp.CombineParams{0, 0, 0, rdp.CombineEnvironment}, // cc = src
+			RGB: rdp.CombineParams{D: rdp.CombineEnvironment}, // cc = src
 			Alpha: rdp.CombineParams{ // cc_alpha = 1-tex0_alpha
-				rdp.CombineAAlphaZero, rdp.CombineBAlphaOne,
-				rdp.CombineTex0, rdp.CombineDAlphaOne,
+				A: rdp.CombineAAlphaZero, B: rdp.CombineBAlphaOne,
+				C: rdp.CombineTex0, D: rdp.CombineDAlphaOne,
 			}},
 	})
 
@@ -0,0 +1,152 @@
+// Package eeprom reads and writes the EEPROM save chip of cartridges, which
+// is connected to channel 4 of the PIF.  Flashcarts emulate it for games
+// saving to EEPROM.
+//
+// The EEPROM is written in blocks of 8 bytes, each taking a write cycle of
+// up to 15 ms, during which it doesn't respond to reads and writes.  Reads
+// and writes wait for the end of the previous write cycle.  Writes skip
+// blocks whose content doesn't change, sparing the limited write cycles of
+// the chip.
+package eeprom
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/drpaneas/n64/rcp/serial/joybus"
+)
+
+var (
+	ErrNotFound = errors.New("eeprom: no EEPROM found")
+	ErrTimeout  = errors.New("eeprom: write cycle timeout")
+	ErrRange    = errors.New("eeprom: offset out of range")
+)
+
+const (
+	Channel   = 4
+	BlockSize = joybus.EEPROMBlockSize
+
+	Size4k  = 512  // 4 Kibit, 64 blocks
+	Size16k = 2048 // 16 Kibit, 256 blocks
+)
+
+// writeTimeout is how long an access waits for the previous write cycle to
+// end, and pollInterval how often the status is read meanwhile.
+const (
+	writeTimeout = 50 * time.Millisecond
+	pollInterval = time.Millisecond
+)
+
+// bus executes commands on the EEPROM channel, which is done by the PIF on
+// hardware.
+type bus interface {
+	info() (dev joybus.Device, status byte, err error)
+	read(block uint8, p []byte) error
+	write(block uint8, p []byte) error
+}
+
+// Device is an EEPROM.
+type Device struct {
+	bus     bus
+	size    int
+	sleep   func(time.Duration)
+	writing bool // a write cycle may be running
+}
+
+func newDevice(b bus) (*Device, error) {
+	dev, _, err := b.info()
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	d := &Device{bus: b, sleep: time.Sleep}
+	switch dev {
+	case joybus.EEPROM4k:
+		d.size = Size4k
+	case joybus.EEPROM16k:
+		d.size = Size16k
+	default:
+		return nil, ErrNotFound
+	}
+	return d, nil
+}
+
+// Size returns the size in bytes, Size4k or Size16k.
+func (d *Device) Size() int64 {
+	return int64(d.size)
+}
+
+func (d *Device) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, ErrRange
+	}
+	if err = d.wait(); err != nil {
+		return
+	}
+	var buf [BlockSize]byte
+	for n < len(p) && off+int64(n) < d.Size() {
+		pos := off + int64(n)
+		if err = d.bus.read(uint8(pos/BlockSize), buf[:]); err != nil {
+			return
+		}
+		n += copy(p[n:], buf[pos%BlockSize:])
+	}
+	if n < len(p) {
+		err = io.EOF
+	}
+	return
+}
+
+// WriteAt writes p at off.  Partially written blocks are read first.  Blocks
+// whose content doesn't change aren't written.
+func (d *Device) WriteAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, ErrRange
+	}
+	var buf, old [BlockSize]byte
+	for n < len(p) && off+int64(n) < d.Size() {
+		pos := off + int64(n)
+		block := uint8(pos / BlockSize)
+		if err = d.wait(); err != nil {
+			return
+		}
+		if err = d.bus.read(block, old[:]); err != nil {
+			return
+		}
+		buf = old
+		done := copy(buf[pos%BlockSize:], p[n:])
+		if !bytes.Equal(buf[:], old[:]) {
+			if err = d.bus.write(block, buf[:]); err != nil {
+				return
+			}
+			d.writing = true
+		}
+		n += done
+	}
+	if n < len(p) {
+		err = io.ErrShortWrite
+	}
+	return
+}
+
+// wait waits for the end of the write cycle started by the last write.
+func (d *Device) wait() error {
+	if !d.writing {
+		return nil
+	}
+	for waited := time.Duration(0); ; waited += pollInterval {
+		_, status, err := d.bus.info()
+		if err != nil {
+			return err
+		}
+		if status&joybus.EEPROMBusy == 0 {
+			d.writing = false
+			return nil
+		}
+		if waited >= writeTimeout {
+			return ErrTimeout
+		}
+		d.sleep(pollInterval)
+	}
+}
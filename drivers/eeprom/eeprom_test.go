@@ -0,0 +1,182 @@
+package eeprom
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/drpaneas/n64/rcp/serial/joybus"
+)
+
+// fakeBus emulates an EEPROM, which is busy for a number of status reads
+// after each write.  Like the chip, it fails reads and writes while busy.
+type fakeBus struct {
+	dev    joybus.Device
+	data   []byte
+	busy   int // status reads until the write cycle ends
+	cycle  int // status reads per write cycle
+	writes []uint8
+	err    error
+}
+
+func newFakeBus(dev joybus.Device, size, cycle int) *fakeBus {
+	b := &fakeBus{dev: dev, data: make([]byte, size), cycle: cycle}
+	for i := range b.data {
+		b.data[i] = byte(i)
+	}
+	return b
+}
+
+func (b *fakeBus) info() (joybus.Device, byte, error) {
+	if b.err != nil {
+		return 0, 0, b.err
+	}
+	if b.busy > 0 {
+		b.busy--
+		return b.dev, joybus.EEPROMBusy, nil
+	}
+	return b.dev, 0, nil
+}
+
+func (b *fakeBus) read(block uint8, p []byte) error {
+	if b.busy > 0 {
+		return errors.New("read during write cycle")
+	}
+	copy(p, b.data[int(block)*BlockSize:])
+	return nil
+}
+
+func (b *fakeBus) write(block uint8, p []byte) error {
+	if b.busy > 0 {
+		return errors.New("write during write cycle")
+	}
+	copy(b.data[int(block)*BlockSize:], p)
+	b.writes = append(b.writes, block)
+	b.busy = b.cycle
+	return nil
+}
+
+func newFakeDevice(t *testing.T, b *fakeBus) (*Device, *time.Duration) {
+	d, err := newDevice(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var slept time.Duration
+	d.sleep = func(d time.Duration) { slept += d }
+	return d, &slept
+}
+
+func TestDetect(t *testing.T) {
+	tests := map[string]struct {
+		bus      *fakeBus
+		expected int64
+		err      error
+	}{
+		"4k":         {bus: newFakeBus(joybus.EEPROM4k, Size4k, 0), expected: Size4k},
+		"16k":        {bus: newFakeBus(joybus.EEPROM16k, Size16k, 0), expected: Size16k},
+		"Other":      {bus: newFakeBus(joybus.Controller, 0, 0), err: ErrNotFound},
+		"NoResponse": {bus: &fakeBus{err: joybus.ErrPIFNoResponse}, err: ErrNotFound},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			d, err := newDevice(tc.bus)
+			if err != tc.err {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+			if err == nil && d.Size() != tc.expected {
+				t.Errorf("expected %d, got %d", tc.expected, d.Size())
+			}
+		})
+	}
+}
+
+func TestReadAt(t *testing.T) {
+	b := newFakeBus(joybus.EEPROM4k, Size4k, 0)
+	d, _ := newFakeDevice(t, b)
+
+	buf := make([]byte, 21)
+	if n, err := d.ReadAt(buf, 5); err != nil || n != len(buf) {
+		t.Fatalf("expected %d, got %d, %v", len(buf), n, err)
+	}
+	if !bytes.Equal(buf, b.data[5:26]) {
+		t.Errorf("expected %x, got %x", b.data[5:26], buf)
+	}
+
+	n, err := d.ReadAt(buf, Size4k-3)
+	if err != io.EOF || n != 3 {
+		t.Errorf("expected 3, %v, got %d, %v", io.EOF, n, err)
+	}
+	if _, err := d.ReadAt(buf, -1); err != ErrRange {
+		t.Errorf("expected %v, got %v", ErrRange, err)
+	}
+}
+
+func TestWriteAt(t *testing.T) {
+	b := newFakeBus(joybus.EEPROM16k, Size16k, 12)
+	d, slept := newFakeDevice(t, b)
+	expected := bytes.Clone(b.data)
+
+	// Blocks 0 and 3 change partly, blocks 1 and 2 are unchanged
+	data := bytes.Clone(b.data[6:26])
+	data[0], data[19] = 0xaa, 0xbb
+	copy(expected[6:], data)
+	if n, err := d.WriteAt(data, 6); err != nil || n != len(data) {
+		t.Fatalf("expected %d, got %d, %v", len(data), n, err)
+	}
+	if !bytes.Equal(b.data, expected) {
+		t.Errorf("content mismatch after write")
+	}
+	if expected := []uint8{0, 3}; !bytes.Equal(b.writes, expected) {
+		t.Errorf("expected writes of blocks %v, got %v", expected, b.writes)
+	}
+	if *slept != 12*pollInterval {
+		t.Errorf("expected to wait %v for the write cycle, got %v", 12*pollInterval, *slept)
+	}
+
+	n, err := d.WriteAt(make([]byte, 16), Size16k-4)
+	if err != io.ErrShortWrite || n != 4 {
+		t.Errorf("expected 4, %v, got %d, %v", io.ErrShortWrite, n, err)
+	}
+}
+
+func TestReadAfterWrite(t *testing.T) {
+	b := newFakeBus(joybus.EEPROM4k, Size4k, 5)
+	d, slept := newFakeDevice(t, b)
+
+	// Both blocks change, the second is read during the first's write cycle
+	if n, err := d.WriteAt([]byte{0xaa, 0xbb}, 7); err != nil || n != 2 {
+		t.Fatalf("expected 2, got %d, %v", n, err)
+	}
+	buf := make([]byte, 2)
+	if n, err := d.ReadAt(buf, 7); err != nil || n != 2 {
+		t.Fatalf("expected 2, got %d, %v", n, err)
+	}
+	if !bytes.Equal(buf, []byte{0xaa, 0xbb}) {
+		t.Errorf("expected aabb, got %x", buf)
+	}
+	if *slept != 10*pollInterval {
+		t.Errorf("expected to wait %v for two write cycles, got %v", 10*pollInterval, *slept)
+	}
+
+	// No write cycle is running, reads don't check the status
+	b.err = errors.New("status read")
+	if _, err := d.ReadAt(buf, 7); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestWriteTimeout(t *testing.T) {
+	b := newFakeBus(joybus.EEPROM4k, Size4k, 1000)
+	d, _ := newFakeDevice(t, b)
+
+	if _, err := d.WriteAt([]byte{0xff}, 0); err != nil {
+		t.Fatal(err)
+	}
+	n, err := d.WriteAt([]byte{0xff}, 8)
+	if err != ErrTimeout || n != 0 {
+		t.Errorf("expected 0, %v, got %d, %v", ErrTimeout, n, err)
+	}
+}
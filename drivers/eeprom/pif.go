@@ -0,0 +1,76 @@
+//go:build noos
+
+package eeprom
+
+import (
+	"github.com/drpaneas/n64/rcp/serial"
+	"github.com/drpaneas/n64/rcp/serial/joybus"
+)
+
+// pifBus runs the EEPROM commands on the PIF, one command block each.
+type pifBus struct {
+	infoBlock  *serial.CommandBlock
+	infoCmd    joybus.InfoCommand
+	readBlock  *serial.CommandBlock
+	readCmd    joybus.ReadEEPROMCommand
+	writeBlock *serial.CommandBlock
+	writeCmd   joybus.WriteEEPROMCommand
+}
+
+func newPIFBus() (*pifBus, error) {
+	b := &pifBus{
+		infoBlock:  serial.NewCommandBlock(serial.CmdConfigureJoybus),
+		readBlock:  serial.NewCommandBlock(serial.CmdConfigureJoybus),
+		writeBlock: serial.NewCommandBlock(serial.CmdConfigureJoybus),
+	}
+	var err error
+	if b.infoCmd, err = joybus.NewChannelCommand(b.infoBlock, Channel, joybus.NewInfoCommand); err != nil {
+		return nil, err
+	}
+	if b.readCmd, err = joybus.NewChannelCommand(b.readBlock, Channel, joybus.NewReadEEPROMCommand); err != nil {
+		return nil, err
+	}
+	if b.writeCmd, err = joybus.NewChannelCommand(b.writeBlock, Channel, joybus.NewWriteEEPROMCommand); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *pifBus) info() (joybus.Device, byte, error) {
+	b.infoCmd.Reset()
+	serial.Run(b.infoBlock)
+	return b.infoCmd.Info()
+}
+
+func (b *pifBus) read(block uint8, p []byte) error {
+	b.readCmd.Reset()
+	b.readCmd.SetBlock(block)
+	serial.Run(b.readBlock)
+	data, err := b.readCmd.Data()
+	if err != nil {
+		return err
+	}
+	copy(p, data)
+	return nil
+}
+
+func (b *pifBus) write(block uint8, p []byte) error {
+	b.writeCmd.Reset()
+	b.writeCmd.SetBlock(block)
+	if err := b.writeCmd.SetData(p); err != nil {
+		return err
+	}
+	serial.Run(b.writeBlock)
+	_, err := b.writeCmd.Result()
+	return err
+}
+
+// Probe returns the EEPROM of the cartridge.  It returns ErrNotFound if the
+// cartridge has none.
+func Probe() (*Device, error) {
+	b, err := newPIFBus()
+	if err != nil {
+		return nil, err
+	}
+	return newDevice(b)
+}
@@ -0,0 +1,117 @@
+package mixer
+
+import "time"
+
+// Envelope describes an ADSR volume envelope.  After a voice was started, its
+// volume rises to the maximum during Attack, falls to the Sustain level during
+// Decay and is held there until the voice is released.  After release it
+// falls to silence during Release and the voice stops.
+type Envelope struct {
+	Attack  time.Duration
+	Decay   time.Duration
+	Sustain float32 // volume level in the range 0 to 1
+	Release time.Duration
+}
+
+type envStage uint8
+
+const (
+	envAttack envStage = iota
+	envDecay
+	envSustain
+	envRelease
+	envDone
+)
+
+// envelope is the state of an Envelope applied to a voice.  Levels and deltas
+// are fixed point with gainBits fractional bits.
+type envelope struct {
+	enabled bool
+
+	attack, decay int32 // level delta per frame
+	sustain       int32
+	releaseFrames int32
+	fade          int32 // level delta per frame, calculated on release
+
+	stage envStage
+	level int32
+}
+
+func (e *envelope) set(env *Envelope, rate int) {
+	if env == nil {
+		*e = envelope{}
+		return
+	}
+
+	frames := func(d time.Duration) int32 {
+		return int32(int64(d) * int64(rate) / int64(time.Second))
+	}
+	delta := func(level int32, frames int32) int32 {
+		if frames <= 0 {
+			return gainOne
+		}
+		return max(level/frames, 1)
+	}
+
+	e.enabled = true
+	e.sustain = int32(min(max(env.Sustain, 0), 1) * gainOne)
+	e.attack = delta(gainOne, frames(env.Attack))
+	e.decay = delta(gainOne-e.sustain, frames(env.Decay))
+	e.releaseFrames = frames(env.Release)
+}
+
+// trigger restarts the envelope from silence.
+func (e *envelope) trigger() {
+	e.stage = envAttack
+	e.level = 0
+}
+
+// release starts the release phase.  Returns false if the envelope is
+// disabled.
+func (e *envelope) release() bool {
+	if !e.enabled {
+		return false
+	}
+	e.stage = envRelease
+	if e.releaseFrames <= 0 {
+		e.fade = gainOne
+	} else {
+		e.fade = max(e.level/e.releaseFrames, 1)
+	}
+	return true
+}
+
+// next advances the envelope by one frame and returns the new level.
+func (e *envelope) next() int32 {
+	if !e.enabled {
+		return gainOne
+	}
+
+	switch e.stage {
+	case envAttack:
+		e.level += e.attack
+		if e.level >= gainOne {
+			e.level = gainOne
+			e.stage = envDecay
+		}
+	case envDecay:
+		e.level -= e.decay
+		if e.level <= e.sustain {
+			e.level = e.sustain
+			e.stage = envSustain
+		}
+	case envRelease:
+		e.level -= e.fade
+		if e.level <= 0 {
+			e.level = 0
+			e.stage = envDone
+		}
+	}
+
+	return e.level
+}
+
+// done returns true if the release phase finished.
+func (e *envelope) done() bool {
+	return e.enabled && e.stage == envDone
+}
@@ -0,0 +1,287 @@
+// Package mixer mixes multiple independent voices into a single stereo PCM
+// stream.  Each voice plays a Sample with its own pitch, volume, panning and
+// volume envelope.  The mixer runs on the CPU and has no hardware
+// dependencies, its output can be copied to the audio DAC, e.g. via
+// io.Copy(audio.Output, mixer).
+package mixer
+
+import (
+	"sync"
+)
+
+const (
+	fracBits = 32 // fractional bits of sample positions
+	gainBits = 16 // fractional bits of gains and envelope levels
+	gainOne  = 1 << gainBits
+)
+
+// A Sample holds 16-bit PCM data, either mono or interleaved stereo.
+type Sample struct {
+	Data   []int16
+	Stereo bool
+	Rate   int // sample rate in Hz
+
+	// A looping sample continues at LoopStart after reaching the end.  With
+	// LoopStart outside of the sample's frames, it is played once.
+	Loop      bool
+	LoopStart int
+}
+
+// Frames returns the number of frames in the sample, i.e. the number of
+// samples per channel.
+func (s *Sample) Frames() int {
+	if s.Stereo {
+		return len(s.Data) >> 1
+	}
+	return len(s.Data)
+}
+
+// frame returns left and right channel of frame i.
+func (s *Sample) frame(i int) (l, r int32) {
+	if s.Stereo {
+		return int32(s.Data[i<<1]), int32(s.Data[i<<1+1])
+	}
+	v := int32(s.Data[i])
+	return v, v
+}
+
+type voice struct {
+	sample *Sample
+	pos    uint64 // current frame, fixed point
+	step   uint64 // frames to advance per output frame, fixed point
+
+	loop      bool
+	loopStart int
+
+	pitch       float32
+	volume, pan float32
+	gainL       int64
+	gainR       int64
+
+	env     envelope
+	nextEnv envelope // applied on Play
+}
+
+// Mixer mixes a fixed number of voices into a stereo stream with the sample
+// rate of the output.
+type Mixer struct {
+	mtx    sync.Mutex
+	rate   int
+	voices []voice
+	buf    []int16
+}
+
+// New returns a mixer with n voices producing samples at rate Hz.
+func New(rate int, n int) *Mixer {
+	m := &Mixer{
+		rate:   rate,
+		voices: make([]voice, n),
+	}
+	for i := range m.voices {
+		v := &m.voices[i]
+		v.pitch = 1
+		v.volume = 1
+		v.updateGain()
+	}
+	return m
+}
+
+// Voices returns the number of voices.
+func (m *Mixer) Voices() int {
+	return len(m.voices)
+}
+
+// Play starts playing s on voice ch from the beginning.  A sample already
+// playing on the voice is stopped.  A nil or empty sample just stops the
+// voice.
+func (m *Mixer) Play(ch int, s *Sample) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	v := &m.voices[ch]
+	if s == nil || s.Frames() == 0 {
+		v.sample = nil
+		return
+	}
+	v.sample = s
+	v.loop = s.Loop && s.LoopStart >= 0 && s.LoopStart < s.Frames()
+	v.loopStart = s.LoopStart
+	v.pos = 0
+	v.updateStep(m.rate)
+	v.env = v.nextEnv
+	v.env.trigger()
+}
+
+// Stop stops playback on voice ch immediately.
+func (m *Mixer) Stop(ch int) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.voices[ch].sample = nil
+}
+
+// Release starts the release phase of the voice's envelope.  The voice stops
+// after the release phase finished.  Without an envelope the voice stops
+// immediately.
+func (m *Mixer) Release(ch int) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	v := &m.voices[ch]
+	if !v.env.release() {
+		v.sample = nil
+	}
+}
+
+// Playing returns true if voice ch is playing a sample.
+func (m *Mixer) Playing(ch int) bool {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	return m.voices[ch].sample != nil
+}
+
+// SetPitch sets the playback speed of voice ch relative to the sample's rate.
+func (m *Mixer) SetPitch(ch int, pitch float32) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	v := &m.voices[ch]
+	v.pitch = max(pitch, 0)
+	v.updateStep(m.rate)
+}
+
+// SetVolume sets the volume of voice ch in the range 0 to 1.
+func (m *Mixer) SetVolume(ch int, volume float32) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	v := &m.voices[ch]
+	v.volume = min(max(volume, 0), 1)
+	v.updateGain()
+}
+
+// SetPan sets the stereo panning of voice ch from -1 (left) to 1 (right).
+func (m *Mixer) SetPan(ch int, pan float32) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	v := &m.voices[ch]
+	v.pan = min(max(pan, -1), 1)
+	v.updateGain()
+}
+
+// SetEnvelope sets the volume envelope for voice ch, which is applied starting
+// with the next call to Play.  A sample already playing keeps its envelope.  A
+// nil envelope disables it.
+func (m *Mixer) SetEnvelope(ch int, env *Envelope) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.voices[ch].nextEnv.set(env, m.rate)
+}
+
+func (v *voice) updateStep(rate int) {
+	if v.sample == nil {
+		return
+	}
+	ratio := float64(v.sample.Rate) / float64(rate) * float64(v.pitch)
+	v.step = uint64(ratio * (1 << fracBits))
+}
+
+func (v *voice) updateGain() {
+	l, r := min(1-v.pan, 1), min(1+v.pan, 1)
+	v.gainL = int64(v.volume * l * gainOne)
+	v.gainR = int64(v.volume * r * gainOne)
+}
+
+// Mix mixes the next len(out)/2 frames of all voices into out, which holds
+// interleaved stereo samples.  Existing data in out is overwritten.
+func (m *Mixer) Mix(out []int16) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.mix(out)
+}
+
+func (m *Mixer) mix(out []int16) {
+	for i := 0; i+1 < len(out); i += 2 {
+		var l, r int64
+		for ch := range m.voices {
+			v := &m.voices[ch]
+			if v.sample == nil {
+				continue
+			}
+			sl, sr := v.next()
+			level := int64(v.env.next())
+			l += (sl * v.gainL >> gainBits) * level >> gainBits
+			r += (sr * v.gainR >> gainBits) * level >> gainBits
+			if v.env.done() {
+				v.sample = nil
+			}
+		}
+		out[i] = clamp(l)
+		out[i+1] = clamp(r)
+	}
+}
+
+// next returns the linear interpolated frame at the voice's current position
+// and advances the position.
+func (v *voice) next() (l, r int64) {
+	s := v.sample
+	frames := s.Frames()
+	idx := int(v.pos >> fracBits)
+	frac := int64(v.pos>>(fracBits-gainBits)) & (gainOne - 1)
+
+	nextIdx := idx + 1
+	if nextIdx >= frames {
+		if v.loop {
+			nextIdx = v.loopStart
+		} else {
+			nextIdx = idx
+		}
+	}
+
+	l0, r0 := s.frame(idx)
+	l1, r1 := s.frame(nextIdx)
+	l = int64(l0) + int64(l1-l0)*frac>>gainBits
+	r = int64(r0) + int64(r1-r0)*frac>>gainBits
+
+	v.pos += v.step
+	end := uint64(frames) << fracBits
+	for v.pos >= end && v.sample != nil {
+		if !v.loop {
+			v.sample = nil
+			break
+		}
+		v.pos -= uint64(frames-v.loopStart) << fracBits
+	}
+
+	return
+}
+
+func clamp(v int64) int16 {
+	return int16(min(max(v, -1<<15), 1<<15-1))
+}
+
+// Read implements io.Reader by mixing len(p)/4 frames and encoding them as
+// 16-bit big endian interleaved stereo samples, as expected by the audio DAC.
+// It never returns an error.
+func (m *Mixer) Read(p []byte) (n int, err error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	frames := len(p) >> 2
+	if cap(m.buf) < frames<<1 {
+		m.buf = make([]int16, frames<<1)
+	}
+	buf := m.buf[:frames<<1]
+	m.mix(buf)
+
+	for i, v := range buf {
+		p[i<<1] = byte(uint16(v) >> 8)
+		p[i<<1+1] = byte(v)
+	}
+
+	return frames << 2, nil
+}
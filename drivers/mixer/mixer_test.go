@@ -0,0 +1,208 @@
+package mixer
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+	"time"
+)
+
+const rate = 8000
+
+func mono(data ...int16) *Sample {
+	return &Sample{Data: data, Rate: rate}
+}
+
+// Duplicates each value for left and right channel
+func both(data ...int16) []int16 {
+	out := make([]int16, 0, 2*len(data))
+	for _, v := range data {
+		out = append(out, v, v)
+	}
+	return out
+}
+
+func TestMix(t *testing.T) {
+	type voiceConfig struct {
+		sample *Sample
+		pitch  float32
+		volume float32
+		pan    float32
+	}
+
+	tests := map[string]struct {
+		voices []voiceConfig
+		golden []int16
+	}{
+		"Silence": {
+			[]voiceConfig{},
+			both(0, 0, 0),
+		},
+		"Mono": {
+			[]voiceConfig{{mono(100, 200, -300, 400), 1, 1, 0}},
+			both(100, 200, -300, 400, 0),
+		},
+		"Stereo": {
+			[]voiceConfig{{&Sample{Data: []int16{1, 2, 3, 4}, Stereo: true, Rate: rate}, 1, 1, 0}},
+			[]int16{1, 2, 3, 4, 0, 0},
+		},
+		"Volume": {
+			[]voiceConfig{{mono(100, 200, -300, 400), 1, 0.5, 0}},
+			both(50, 100, -150, 200, 0),
+		},
+		"PanLeft": {
+			[]voiceConfig{{mono(100, 200), 1, 1, -1}},
+			[]int16{100, 0, 200, 0, 0, 0},
+		},
+		"PanRight": {
+			[]voiceConfig{{mono(100, 200), 1, 1, 1}},
+			[]int16{0, 100, 0, 200, 0, 0},
+		},
+		"Loop": {
+			[]voiceConfig{{&Sample{Data: []int16{10, 20, 30}, Rate: rate, Loop: true, LoopStart: 1}, 1, 1, 0}},
+			both(10, 20, 30, 20, 30, 20, 30),
+		},
+		"LoopStartEnd": {
+			[]voiceConfig{{&Sample{Data: []int16{10, 20, 30}, Rate: rate, Loop: true, LoopStart: 3}, 1, 1, 0}},
+			both(10, 20, 30, 0, 0),
+		},
+		"LoopStartNegative": {
+			[]voiceConfig{{&Sample{Data: []int16{10, 20, 30}, Rate: rate, Loop: true, LoopStart: -1}, 1, 1, 0}},
+			both(10, 20, 30, 0, 0),
+		},
+		"Nil": {
+			[]voiceConfig{{nil, 1, 1, 0}},
+			both(0, 0),
+		},
+		"PitchUp": {
+			[]voiceConfig{{mono(0, 1, 2, 3, 4, 5), 2, 1, 0}},
+			both(0, 2, 4, 0),
+		},
+		"PitchDown": {
+			[]voiceConfig{{mono(0, 100), 0.5, 1, 0}},
+			both(0, 50, 100, 100, 0),
+		},
+		"Resample": {
+			[]voiceConfig{{&Sample{Data: []int16{0, 100}, Rate: rate / 2}, 1, 1, 0}},
+			both(0, 50, 100, 100, 0),
+		},
+		"Sum": {
+			[]voiceConfig{
+				{mono(1000, 1000), 1, 1, 0},
+				{mono(2000, -2000), 1, 1, 0},
+			},
+			both(3000, -1000, 0),
+		},
+		"Clip": {
+			[]voiceConfig{
+				{mono(30000, -30000), 1, 1, 0},
+				{mono(30000, -30000), 1, 1, 0},
+			},
+			both(32767, -32768, 0),
+		},
+		"Empty": {
+			[]voiceConfig{{mono(), 1, 1, 0}},
+			both(0, 0),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := New(rate, max(len(tc.voices), 1))
+			for ch, v := range tc.voices {
+				m.SetPitch(ch, v.pitch)
+				m.SetVolume(ch, v.volume)
+				m.SetPan(ch, v.pan)
+				m.Play(ch, v.sample)
+			}
+
+			out := make([]int16, len(tc.golden))
+			m.Mix(out)
+			if !slices.Equal(out, tc.golden) {
+				t.Fatalf("expected %v, got %v", tc.golden, out)
+			}
+		})
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	frame := time.Second / rate
+	env := &Envelope{
+		Attack:  2 * frame,
+		Decay:   2 * frame,
+		Sustain: 0.5,
+		Release: 2 * frame,
+	}
+	sample := &Sample{Data: []int16{1000}, Rate: rate, Loop: true}
+
+	m := New(rate, 1)
+	m.SetEnvelope(0, env)
+	m.Play(0, sample)
+
+	out := make([]int16, 10)
+	m.Mix(out)
+	if golden := both(500, 1000, 750, 500, 500); !slices.Equal(out, golden) {
+		t.Fatalf("attack/decay: expected %v, got %v", golden, out)
+	}
+
+	m.Release(0)
+	if !m.Playing(0) {
+		t.Fatal("voice stopped on release")
+	}
+	out = make([]int16, 6)
+	m.Mix(out)
+	if golden := both(250, 0, 0); !slices.Equal(out, golden) {
+		t.Fatalf("release: expected %v, got %v", golden, out)
+	}
+	if m.Playing(0) {
+		t.Fatal("voice still playing after release")
+	}
+
+	// Restarting the voice must restart the envelope
+	m.Play(0, sample)
+	out = make([]int16, 2)
+	m.Mix(out)
+	if golden := both(500); !slices.Equal(out, golden) {
+		t.Fatalf("restart: expected %v, got %v", golden, out)
+	}
+
+	// A new envelope doesn't affect the playing sample
+	m.SetEnvelope(0, nil)
+	out = make([]int16, 4)
+	m.Mix(out)
+	if golden := both(1000, 750); !slices.Equal(out, golden) {
+		t.Fatalf("set while playing: expected %v, got %v", golden, out)
+	}
+
+	// Without envelope release stops immediately
+	m.Play(0, sample)
+	m.Release(0)
+	if m.Playing(0) {
+		t.Fatal("voice without envelope still playing after release")
+	}
+
+	m.Play(0, sample)
+	m.Play(0, nil)
+	if m.Playing(0) {
+		t.Fatal("voice still playing after playing nil")
+	}
+}
+
+func TestRead(t *testing.T) {
+	m := New(rate, 1)
+	m.SetPan(0, -1)
+	m.Play(0, mono(256, -2))
+
+	buf := make([]byte, 10) // trailing partial frame is ignored
+	n, err := m.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 8 {
+		t.Fatalf("expected 8 bytes, got %v", n)
+	}
+	golden := []byte{0x01, 0x00, 0x00, 0x00, 0xff, 0xfe, 0x00, 0x00}
+	if !bytes.Equal(buf[:n], golden) {
+		t.Fatalf("expected %x, got %x", golden, buf[:n])
+	}
+}
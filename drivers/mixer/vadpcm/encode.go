@@ -0,0 +1,257 @@
+package vadpcm
+
+import (
+	"math"
+)
+
+const maxScale = 12
+
+// DesignCodebook generates a codebook tuned to samples.  It estimates a linear
+// predictor for every frame and clusters them into the requested number of
+// predictors.
+func DesignCodebook(samples []int16, order, predictors int) (*Codebook, error) {
+	return designCodebook([][]int16{samples}, order, predictors)
+}
+
+// designCodebook generates a codebook shared by the channels chans.
+func designCodebook(chans [][]int16, order, predictors int) (*Codebook, error) {
+	book := &Codebook{
+		Order:      order,
+		Predictors: predictors,
+		Book:       make([]int16, predictors*order*8),
+	}
+	if !book.valid() {
+		return nil, ErrCodebook
+	}
+
+	var vecs [][]float64
+	for _, samples := range chans {
+		for start := 0; start < len(samples); start += FrameSamples {
+			// Use the preceding frame as well for a more stable estimation.
+			window := samples[max(start-FrameSamples, 0):min(start+FrameSamples, len(samples))]
+			if a, ok := lpc(window, order); ok {
+				vecs = append(vecs, a)
+			}
+		}
+	}
+
+	for p, a := range cluster(vecs, order, predictors) {
+		book.setPredictor(p, a)
+	}
+
+	return book, nil
+}
+
+// lpc returns the coefficients a[0:order] of a linear predictor for samples,
+// i.e. x[n] ≈ a[0]*x[n-1] + a[1]*x[n-2] + ...  It uses the autocorrelation
+// method, which guarantees a stable predictor.  Returns false for silence.
+func lpc(samples []int16, order int) ([]float64, bool) {
+	r := make([]float64, order+1)
+	for lag := range r {
+		for i := lag; i < len(samples); i++ {
+			r[lag] += float64(samples[i]) * float64(samples[i-lag])
+		}
+	}
+	if r[0] == 0 {
+		return nil, false
+	}
+
+	// Levinson-Durbin recursion
+	a := make([]float64, order+1)
+	tmp := make([]float64, order+1)
+	e := r[0]
+	for i := 1; i <= order; i++ {
+		acc := r[i]
+		for j := 1; j < i; j++ {
+			acc -= a[j] * r[i-j]
+		}
+		k := min(max(acc/e, -0.999), 0.999)
+
+		copy(tmp, a)
+		a[i] = k
+		for j := 1; j < i; j++ {
+			a[j] = tmp[j] - k*tmp[i-j]
+		}
+		e *= 1 - k*k
+	}
+
+	return a[1:], true
+}
+
+// cluster partitions vecs into n clusters with the LBG algorithm and returns
+// their centroids.
+func cluster(vecs [][]float64, order, n int) [][]float64 {
+	centroids := [][]float64{make([]float64, order)}
+	for _, v := range vecs {
+		for i := range v {
+			centroids[0][i] += v[i] / float64(len(vecs))
+		}
+	}
+
+	for len(centroids) < n {
+		// split clusters by slightly perturbing their centroids
+		for i := range min(len(centroids), n-len(centroids)) {
+			c := centroids[i]
+			split := make([]float64, order)
+			for j := range c {
+				split[j] = c[j] - 0.01
+				c[j] += 0.01
+			}
+			centroids = append(centroids, split)
+		}
+
+		// Lloyd iterations
+		for range 16 {
+			sums := make([][]float64, len(centroids))
+			counts := make([]int, len(centroids))
+			for i := range sums {
+				sums[i] = make([]float64, order)
+			}
+			for _, v := range vecs {
+				best, bestDist := 0, math.Inf(1)
+				for i, c := range centroids {
+					var dist float64
+					for j := range c {
+						dist += (v[j] - c[j]) * (v[j] - c[j])
+					}
+					if dist < bestDist {
+						best, bestDist = i, dist
+					}
+				}
+				counts[best] += 1
+				for j := range v {
+					sums[best][j] += v[j]
+				}
+			}
+			for i, c := range centroids {
+				if counts[i] == 0 {
+					continue // keep empty clusters as they are
+				}
+				for j := range c {
+					c[j] = sums[i][j] / float64(counts[i])
+				}
+			}
+		}
+	}
+
+	return centroids
+}
+
+// setPredictor converts the predictor coefficients a into the codebook
+// representation, which holds the response of the next 8 samples to each of
+// the last samples.
+func (b *Codebook) setPredictor(p int, a []float64) {
+	for j := range b.Order {
+		// history with a single impulse at the j-th sample, where the last
+		// one is the most recent
+		x := make([]float64, b.Order+8)
+		x[j] = 1
+		for k := range 8 {
+			for m := range a {
+				x[b.Order+k] += a[m] * x[b.Order+k-1-m]
+			}
+			v := math.Round(x[b.Order+k] * coefOne)
+			b.Book[(p*b.Order+j)*8+k] = int16(min(max(v, -1<<15), 1<<15-1))
+		}
+	}
+}
+
+// Encoder encodes samples into VADPCM frames.  It tracks the decoder's state,
+// so the residuals compensate for the prediction errors of the decoder.
+type Encoder struct {
+	order int
+	table [][8][]int32
+	state [FrameSamples]int32
+}
+
+func NewEncoder(book *Codebook) (*Encoder, error) {
+	if !book.valid() {
+		return nil, ErrCodebook
+	}
+	return &Encoder{
+		order: book.Order,
+		table: book.table(),
+	}, nil
+}
+
+// Reset clears the encoder state, as at the start of a sound.
+func (e *Encoder) Reset() {
+	e.state = [FrameSamples]int32{}
+}
+
+// EncodeFrame encodes FrameSamples samples into a single frame of FrameSize
+// bytes in dst.  It tries all predictors and scales and picks the one with the
+// least error.
+func (e *Encoder) EncodeFrame(dst []byte, samples []int16) {
+	_ = dst[FrameSize-1]
+	_ = samples[FrameSamples-1]
+
+	var (
+		best      [FrameSamples]int8
+		bestState [FrameSamples]int32
+		bestErr   = int64(math.MaxInt64)
+		header    byte
+	)
+	vec := make([]int32, e.order+8)
+	for p := range e.table {
+		for scale := range maxScale + 1 {
+			var (
+				nibbles [FrameSamples]int8
+				state   [FrameSamples]int32
+				err     int64
+			)
+			state = e.state
+			for half := 0; half < 2; half++ {
+				last := FrameSamples
+				if half == 1 {
+					last = 8
+				}
+				copy(vec[:e.order], state[last-e.order:])
+				clear(vec[e.order:])
+				for i := range 8 {
+					// The residual's coefficient is coefOne, so it
+					// adds to the prediction unscaled.
+					prediction := innerProduct(e.table[p][i], vec)
+					target := int64(samples[half*8+i])
+					nibble := math.Round(float64(target-prediction) / float64(int(1)<<scale))
+					nibble = min(max(nibble, -8), 7)
+					residual := int32(nibble) << scale
+					vec[e.order+i] = residual
+
+					decoded := clamp16(prediction + int64(residual))
+					state[half*8+i] = decoded
+					nibbles[half*8+i] = int8(nibble)
+					err += (target - int64(decoded)) * (target - int64(decoded))
+				}
+			}
+			if err < bestErr {
+				best, bestState, bestErr = nibbles, state, err
+				header = byte(scale)<<4 | byte(p)
+			}
+		}
+	}
+
+	e.state = bestState
+	dst[0] = header
+	for i := 0; i < FrameSamples; i += 2 {
+		dst[1+i/2] = byte(best[i])<<4 | byte(best[i+1])&0xf
+	}
+}
+
+// Encode encodes samples and appends the frames to dst.  The last frame is
+// padded with silence.
+func (e *Encoder) Encode(dst []byte, samples []int16) []byte {
+	var frame [FrameSize]byte
+	var pad [FrameSamples]int16
+	for len(samples) > 0 {
+		in := samples
+		if len(in) < FrameSamples {
+			copy(pad[:], in)
+			in = pad[:]
+		}
+		e.EncodeFrame(frame[:], in[:FrameSamples])
+		dst = append(dst, frame[:]...)
+		samples = samples[min(FrameSamples, len(samples)):]
+	}
+	return dst
+}
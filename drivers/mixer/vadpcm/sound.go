@@ -0,0 +1,171 @@
+package vadpcm
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/drpaneas/n64/drivers/mixer"
+)
+
+// Sound file layout, all values are big endian:
+//
+//	0x00 magic "VADP"
+//	0x04 version, channels, order, predictors (1 byte each)
+//	0x08 sample rate
+//	0x0c samples per channel
+//	0x10 loop start, or -1 if not looping
+//	0x14 codebook, int16 each
+//	.... frames, interleaved per channel
+const (
+	magic      = "VADP"
+	version    = 1
+	headerSize = 0x14
+)
+
+var ErrFormat = errors.New("invalid vadpcm sound")
+
+// Sound is a VADPCM encoded sound as written by cmd/mkaudio.
+type Sound struct {
+	Rate      int
+	Channels  int // 1 or 2
+	Samples   int // samples per channel
+	LoopStart int // sample where playback continues after the end, or -1
+	Book      Codebook
+	Data      []byte // frames, channels interleaved
+}
+
+// Encode encodes samples, which hold interleaved samples if channels is 2, into
+// a sound with a codebook of the given order and number of predictors.  Every
+// channel must have the same number of samples.
+func Encode(samples []int16, channels, rate, order, predictors int) (*Sound, error) {
+	if channels != 1 && channels != 2 {
+		return nil, ErrFormat
+	}
+	if len(samples)%channels != 0 {
+		return nil, ErrFormat
+	}
+
+	chans := make([][]int16, channels)
+	for i, v := range samples {
+		chans[i%channels] = append(chans[i%channels], v)
+	}
+
+	// A single codebook is shared by all channels, designed from the
+	// predictors of each channel's frames.
+	book, err := designCodebook(chans, order, predictors)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Sound{
+		Rate:      rate,
+		Channels:  channels,
+		Samples:   len(chans[0]),
+		LoopStart: -1,
+		Book:      *book,
+	}
+	s.Data = make([]byte, 0, s.frames()*channels*FrameSize)
+	encoded := make([][]byte, channels)
+	for i, ch := range chans {
+		enc, err := NewEncoder(book)
+		if err != nil {
+			return nil, err
+		}
+		encoded[i] = enc.Encode(nil, ch)
+	}
+	for f := range s.frames() {
+		for _, ch := range encoded {
+			s.Data = append(s.Data, ch[f*FrameSize:(f+1)*FrameSize]...)
+		}
+	}
+
+	return s, nil
+}
+
+// frames returns the number of VADPCM frames per channel.
+func (s *Sound) frames() int {
+	return (s.Samples + FrameSamples - 1) / FrameSamples
+}
+
+func (s *Sound) MarshalBinary() ([]byte, error) {
+	if !s.Book.valid() || (s.Channels != 1 && s.Channels != 2) ||
+		len(s.Data) != s.frames()*s.Channels*FrameSize {
+		return nil, ErrFormat
+	}
+
+	b := make([]byte, 0, headerSize+len(s.Book.Book)*2+len(s.Data))
+	b = append(b, magic...)
+	b = append(b, version, byte(s.Channels), byte(s.Book.Order), byte(s.Book.Predictors))
+	b = binary.BigEndian.AppendUint32(b, uint32(s.Rate))
+	b = binary.BigEndian.AppendUint32(b, uint32(s.Samples))
+	b = binary.BigEndian.AppendUint32(b, uint32(int32(s.LoopStart)))
+	for _, v := range s.Book.Book {
+		b = binary.BigEndian.AppendUint16(b, uint16(v))
+	}
+	b = append(b, s.Data...)
+	return b, nil
+}
+
+// UnmarshalBinary parses a sound.  The sound's Data references data, which
+// avoids copying sounds embedded in the ROM.
+func (s *Sound) UnmarshalBinary(data []byte) error {
+	if len(data) < headerSize || string(data[:4]) != magic || data[4] != version {
+		return ErrFormat
+	}
+	s.Channels = int(data[5])
+	s.Book.Order = int(data[6])
+	s.Book.Predictors = int(data[7])
+	s.Rate = int(binary.BigEndian.Uint32(data[8:]))
+	s.Samples = int(binary.BigEndian.Uint32(data[12:]))
+	s.LoopStart = int(int32(binary.BigEndian.Uint32(data[16:])))
+
+	data = data[headerSize:]
+	n := s.Book.Predictors * s.Book.Order * 8
+	if len(data) < 2*n {
+		return ErrFormat
+	}
+	s.Book.Book = make([]int16, n)
+	for i := range s.Book.Book {
+		s.Book.Book[i] = int16(binary.BigEndian.Uint16(data[2*i:]))
+	}
+	data = data[2*n:]
+
+	if !s.Book.valid() || (s.Channels != 1 && s.Channels != 2) ||
+		len(data) != s.frames()*s.Channels*FrameSize {
+		return ErrFormat
+	}
+	s.Data = data
+	return nil
+}
+
+// Sample decodes the sound into a sample for playback with the mixer.
+func (s *Sound) Sample() (*mixer.Sample, error) {
+	decoders := make([]*Decoder, s.Channels)
+	for i := range decoders {
+		var err error
+		if decoders[i], err = NewDecoder(&s.Book); err != nil {
+			return nil, err
+		}
+	}
+
+	data := make([]int16, s.frames()*s.Channels*FrameSamples)
+	var frame [FrameSamples]int16
+	src := s.Data
+	for f := range s.frames() {
+		for ch, d := range decoders {
+			d.DecodeFrame(frame[:], src[:FrameSize])
+			src = src[FrameSize:]
+			for i, v := range frame {
+				data[(f*FrameSamples+i)*s.Channels+ch] = v
+			}
+		}
+	}
+
+	return &mixer.Sample{
+		Data:      data[:s.Samples*s.Channels],
+		Stereo:    s.Channels == 2,
+		Rate:      s.Rate,
+		Loop:      s.LoopStart >= 0,
+		LoopStart: max(s.LoopStart, 0),
+	}, nil
+}
@@ -0,0 +1,149 @@
+// Package vadpcm implements the VADPCM codec used for N64 audio assets.
+//
+// VADPCM compresses 16 samples of 16-bit PCM into a frame of 9 bytes.  Each
+// frame selects one of several predictors from a codebook, which predicts the
+// next samples from previously decoded ones, and stores the scaled 4-bit
+// residuals.  Codebooks are generated per sound by DesignCodebook.
+package vadpcm
+
+import (
+	"errors"
+)
+
+const (
+	FrameSize    = 9  // Bytes per frame
+	FrameSamples = 16 // Samples per frame
+
+	MaxOrder = 8
+
+	coefBits = 11
+	coefOne  = 1 << coefBits
+)
+
+var ErrCodebook = errors.New("invalid codebook")
+
+// A Codebook holds the predictors used to encode and decode a sound.  Each
+// predictor consists of Order vectors of 8 coefficients, which are fixed point
+// with 11 fractional bits.  The j-th vector holds the influence of the j-th
+// last sample of the preceding 8 samples on each of the next 8 samples.
+type Codebook struct {
+	Order      int
+	Predictors int
+	Book       []int16 // Predictors*Order*8 coefficients
+}
+
+func (b *Codebook) valid() bool {
+	return b.Order > 0 && b.Order <= MaxOrder &&
+		b.Predictors > 0 && b.Predictors <= 16 &&
+		len(b.Book) == b.Predictors*b.Order*8
+}
+
+// table expands the codebook into one vector per predictor and sample, which
+// also contains the influence of the residuals on the sample.
+func (b *Codebook) table() [][8][]int32 {
+	table := make([][8][]int32, b.Predictors)
+	for p := range table {
+		entry := &table[p]
+		for k := range entry {
+			entry[k] = make([]int32, b.Order+8)
+		}
+		for j := range b.Order {
+			for k := range 8 {
+				entry[k][j] = int32(b.Book[(p*b.Order+j)*8+k])
+			}
+		}
+		for k := 1; k < 8; k++ {
+			entry[k][b.Order] = entry[k-1][b.Order-1]
+		}
+		entry[0][b.Order] = coefOne
+		for k := 1; k < 8; k++ {
+			for j := k; j < 8; j++ {
+				entry[j][k+b.Order] = entry[j-k][b.Order]
+			}
+		}
+	}
+	return table
+}
+
+// innerProduct returns the dot product of v1 and v2 divided by coefOne,
+// rounded down.
+func innerProduct(v1, v2 []int32) int64 {
+	var out int64
+	for i := range v1 {
+		out += int64(v1[i]) * int64(v2[i])
+	}
+	return out >> coefBits
+}
+
+func clamp16(v int64) int32 {
+	return int32(min(max(v, -1<<15), 1<<15-1))
+}
+
+// Decoder decodes a stream of VADPCM frames.  It keeps the last decoded
+// samples as state for predicting the next frame.
+type Decoder struct {
+	order int
+	table [][8][]int32
+	state [FrameSamples]int32
+	vec   []int32
+}
+
+func NewDecoder(book *Codebook) (*Decoder, error) {
+	if !book.valid() {
+		return nil, ErrCodebook
+	}
+	return &Decoder{
+		order: book.Order,
+		table: book.table(),
+		vec:   make([]int32, book.Order+8),
+	}, nil
+}
+
+// Reset clears the decoder state, as at the start of a sound.
+func (d *Decoder) Reset() {
+	d.state = [FrameSamples]int32{}
+}
+
+// DecodeFrame decodes a single frame of FrameSize bytes into FrameSamples
+// samples in dst.
+func (d *Decoder) DecodeFrame(dst []int16, frame []byte) {
+	_ = dst[FrameSamples-1]
+	_ = frame[FrameSize-1]
+
+	scale := int32(1) << (frame[0] >> 4)
+	predictor := int(frame[0]&0xf) % len(d.table)
+	coefs := &d.table[predictor]
+
+	var ix [FrameSamples]int32
+	for i := 0; i < FrameSamples; i += 2 {
+		c := frame[1+i/2]
+		ix[i] = int32(int8(c)>>4) * scale
+		ix[i+1] = int32(int8(c<<4)>>4) * scale
+	}
+
+	for half := 0; half < 2; half++ {
+		// predict from the last samples of the previous half
+		last := FrameSamples
+		if half == 1 {
+			last = 8
+		}
+		copy(d.vec[:d.order], d.state[last-d.order:])
+		copy(d.vec[d.order:], ix[half*8:half*8+8])
+		for i := range 8 {
+			v := clamp16(innerProduct(coefs[i], d.vec))
+			d.state[half*8+i] = v
+			dst[half*8+i] = int16(v)
+		}
+	}
+}
+
+// Decode decodes all complete frames in src and appends the samples to dst.
+func (d *Decoder) Decode(dst []int16, src []byte) []int16 {
+	var frame [FrameSamples]int16
+	for len(src) >= FrameSize {
+		d.DecodeFrame(frame[:], src[:FrameSize])
+		dst = append(dst, frame[:]...)
+		src = src[FrameSize:]
+	}
+	return dst
+}
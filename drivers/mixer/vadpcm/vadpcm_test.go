@@ -0,0 +1,209 @@
+package vadpcm
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func sine(n int, freqs ...float64) []int16 {
+	out := make([]int16, n)
+	for i := range out {
+		var v float64
+		for _, f := range freqs {
+			v += math.Sin(2 * math.Pi * f * float64(i) / 32000)
+		}
+		out[i] = int16(v / float64(len(freqs)) * 20000)
+	}
+	return out
+}
+
+// noise returns pseudo random samples, which are low pass filtered to
+// resemble real world audio.
+func noise(n int) []int16 {
+	out := make([]int16, n)
+	seed, v := uint32(1), 0.0
+	for i := range out {
+		seed = seed*1664525 + 1013904223
+		v = 0.9*v + 0.1*(float64(int32(seed))/(1<<31))*30000
+		out[i] = int16(v)
+	}
+	return out
+}
+
+func snr(ref, test []int16) float64 {
+	var signal, noise float64
+	for i := range ref {
+		d := float64(ref[i]) - float64(test[i])
+		signal += float64(ref[i]) * float64(ref[i])
+		noise += d * d
+	}
+	if noise == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(signal/noise)
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := map[string]struct {
+		samples           []int16
+		order, predictors int
+		minSNR            float64 // dB
+	}{
+		"Silence":    {make([]int16, 100), 2, 4, math.Inf(1)},
+		"Sine":       {sine(4000, 440), 2, 4, 40},
+		"Chord":      {sine(4000, 261.6, 329.6, 392), 2, 4, 40},
+		"Sweep":      {append(sine(2000, 200), sine(2000, 3000)...), 2, 4, 25},
+		"Noise":      {noise(4000), 2, 4, 15},
+		"Order1":     {sine(4000, 440), 1, 1, 20},
+		"HighOrder":  {sine(4000, 261.6, 329.6, 392), 4, 8, 25},
+		"ShortFrame": {sine(5, 440), 2, 2, 15},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			book, err := DesignCodebook(tc.samples, tc.order, tc.predictors)
+			if err != nil {
+				t.Fatal(err)
+			}
+			enc, err := NewEncoder(book)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dec, err := NewDecoder(book)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data := enc.Encode(nil, tc.samples)
+			frames := (len(tc.samples) + FrameSamples - 1) / FrameSamples
+			if len(data) != frames*FrameSize {
+				t.Fatalf("expected %v bytes, got %v", frames*FrameSize, len(data))
+			}
+
+			out := dec.Decode(nil, data)
+			if len(out) != frames*FrameSamples {
+				t.Fatalf("expected %v samples, got %v", frames*FrameSamples, len(out))
+			}
+			if v := snr(tc.samples, out); v < tc.minSNR {
+				t.Fatalf("expected SNR of at least %v dB, got %.1f dB", tc.minSNR, v)
+			}
+		})
+	}
+}
+
+func TestInvalidCodebook(t *testing.T) {
+	tests := map[string]Codebook{
+		"NoOrder":       {Order: 0, Predictors: 1},
+		"HighOrder":     {Order: MaxOrder + 1, Predictors: 1, Book: make([]int16, (MaxOrder+1)*8)},
+		"NoPredictors":  {Order: 2, Predictors: 0},
+		"ManyPredictor": {Order: 1, Predictors: 17, Book: make([]int16, 17*8)},
+		"ShortBook":     {Order: 2, Predictors: 1, Book: make([]int16, 8)},
+	}
+
+	for name, book := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewDecoder(&book); err != ErrCodebook {
+				t.Fatalf("expected %v, got %v", ErrCodebook, err)
+			}
+			if _, err := NewEncoder(&book); err != ErrCodebook {
+				t.Fatalf("expected %v, got %v", ErrCodebook, err)
+			}
+		})
+	}
+}
+
+func TestSound(t *testing.T) {
+	left, right := sine(1000, 440), sine(1000, 660)
+	stereo := make([]int16, 0, 2*len(left))
+	for i := range left {
+		stereo = append(stereo, left[i], right[i])
+	}
+
+	s, err := Encode(stereo, 2, 32000, 2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.LoopStart = 100
+
+	data, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ratio := float64(len(stereo)*2) / float64(len(s.Data)); ratio < 3.5 {
+		t.Errorf("expected compression ratio of at least 3.5, got %.2f", ratio)
+	}
+
+	var parsed Sound
+	if err := parsed.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Rate != s.Rate || parsed.Channels != s.Channels ||
+		parsed.Samples != s.Samples || parsed.LoopStart != s.LoopStart {
+		t.Fatalf("expected %+v, got %+v", s, parsed)
+	}
+	if !slices.Equal(parsed.Book.Book, s.Book.Book) {
+		t.Fatalf("expected codebook %v, got %v", s.Book.Book, parsed.Book.Book)
+	}
+
+	sample, err := parsed.Sample()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sample.Stereo || sample.Rate != 32000 || !sample.Loop || sample.LoopStart != 100 {
+		t.Fatalf("unexpected sample parameters %+v", sample)
+	}
+	if sample.Frames() != len(left) {
+		t.Fatalf("expected %v frames, got %v", len(left), sample.Frames())
+	}
+	if v := snr(stereo, sample.Data); v < 25 {
+		t.Fatalf("expected SNR of at least 25 dB, got %.1f dB", v)
+	}
+
+	for _, n := range []int{0, headerSize, len(data) - 1} {
+		if err := parsed.UnmarshalBinary(data[:n]); err != ErrFormat {
+			t.Errorf("truncated to %v bytes: expected %v, got %v", n, ErrFormat, err)
+		}
+	}
+}
+
+func TestSoundStereoCodebook(t *testing.T) {
+	// The predictors must be estimated per channel, interleaved samples of
+	// different signals don't resemble either of them.
+	left, right := sine(4000, 440), sine(4000, 660)
+	stereo := make([]int16, 0, 2*len(left))
+	for i := range left {
+		stereo = append(stereo, left[i], right[i])
+	}
+
+	s, err := Encode(stereo, 2, 32000, 2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sample, err := s.Sample()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := snr(stereo, sample.Data); v < 45 {
+		t.Fatalf("expected SNR of at least 45 dB, got %.1f dB", v)
+	}
+}
+
+func TestEncodeInvalid(t *testing.T) {
+	tests := map[string]struct {
+		samples  []int16
+		channels int
+	}{
+		"NoChannels":   {sine(32, 440), 0},
+		"Surround":     {sine(36, 440), 6},
+		"StereoOdd":    {sine(33, 440), 2},
+		"StereoSingle": {[]int16{1}, 2},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Encode(tc.samples, tc.channels, 32000, 2, 4); err != ErrFormat {
+				t.Errorf("expected %v, got %v", ErrFormat, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+//go:build noos
+
+package romfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/drpaneas/n64/rcp/periph"
+)
+
+const (
+	romAddr = 0x1000_0000
+	romSize = 0x0fc0_0000 // up to the end of PI bus domain 1 at 0x1fbf_ffff
+
+	// Reserved bytes of the ROM header, where cmd/mkrom stores the offset of
+	// the filesystem.
+	headerOffset = 0x18
+)
+
+var ErrNotFound = errors.New("romfs: no filesystem in ROM")
+
+// Mount returns the filesystem that cmd/mkrom -fs appended to the ROM.  Files
+// are read via PI DMA when read, not when mounted.
+func Mount() (*FS, error) {
+	rom := periph.NewDevice(romAddr, romSize)
+	var buf [4]byte
+	if err := readAt(rom, buf[:], headerOffset); err != nil {
+		return nil, err
+	}
+	offset := int64(binary.BigEndian.Uint32(buf[:]))
+	if offset == 0 || offset >= romSize {
+		return nil, ErrNotFound
+	}
+	return New(io.NewSectionReader(rom, offset, romSize-offset))
+}
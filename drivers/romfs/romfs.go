@@ -0,0 +1,246 @@
+// Package romfs implements a read-only filesystem, which cmd/mkrom appends to
+// the cartridge ROM.  Files are read on demand, so assets don't need to be
+// embedded into the program, which is loaded into RDRAM as a whole.
+//
+// The filesystem is a sorted table of file paths followed by the file data.
+// Directories are implicit, a directory exists if any file path starts with
+// its name.
+package romfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Filesystem layout, all values are big endian:
+//
+//	0x00 magic "N64F"
+//	0x04 version, reserved (3 bytes)
+//	0x08 size of the filesystem
+//	0x0c number of files
+//	0x10 files, 16 bytes each:
+//	     name offset, data offset, data size (relative to the filesystem)
+//	     name length, reserved (2 bytes)
+//	.... names
+//	.... file data, each aligned to dataAlign
+const (
+	magic      = "N64F"
+	version    = 1
+	headerSize = 0x10
+	entrySize  = 16
+	dataAlign  = 16 // cache line size, allows DMA into padded buffers
+)
+
+var ErrFormat = errors.New("romfs: invalid filesystem")
+
+type entry struct {
+	name         string
+	offset, size uint32
+}
+
+// FS is a filesystem read from an io.ReaderAt, e.g. the cartridge ROM.
+type FS struct {
+	r     io.ReaderAt
+	files []entry // sorted by name
+}
+
+// readAt reads exactly len(p) bytes at off.
+func readAt(r io.ReaderAt, p []byte, off int64) error {
+	n, err := r.ReadAt(p, off)
+	if n == len(p) {
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		return ErrFormat
+	}
+	return err
+}
+
+// New reads the file table of the filesystem in r.  File data is read when
+// files are read.
+func New(r io.ReaderAt) (*FS, error) {
+	var hdr [headerSize]byte
+	if err := readAt(r, hdr[:], 0); err != nil {
+		return nil, err
+	}
+	if string(hdr[:4]) != magic || hdr[4] != version {
+		return nil, ErrFormat
+	}
+	size := binary.BigEndian.Uint32(hdr[8:])
+	count := binary.BigEndian.Uint32(hdr[12:])
+	if uint64(count)*entrySize > uint64(size) {
+		return nil, ErrFormat
+	}
+
+	table := make([]byte, count*entrySize)
+	if err := readAt(r, table, headerSize); err != nil {
+		return nil, err
+	}
+
+	f := &FS{r: r, files: make([]entry, count)}
+	namesStart := headerSize + len(table)
+	namesEnd := namesStart
+	for i := range f.files {
+		e := table[i*entrySize:]
+		nameOff, nameLen := binary.BigEndian.Uint32(e), binary.BigEndian.Uint16(e[12:])
+		f.files[i].offset = binary.BigEndian.Uint32(e[4:])
+		f.files[i].size = binary.BigEndian.Uint32(e[8:])
+		if uint64(f.files[i].offset)+uint64(f.files[i].size) > uint64(size) ||
+			int(nameOff) < namesStart {
+			return nil, ErrFormat
+		}
+		namesEnd = max(namesEnd, int(nameOff)+int(nameLen))
+	}
+	if namesEnd > int(size) {
+		return nil, ErrFormat
+	}
+
+	names := make([]byte, namesEnd-namesStart)
+	if err := readAt(r, names, int64(namesStart)); err != nil {
+		return nil, err
+	}
+	for i := range f.files {
+		e := table[i*entrySize:]
+		nameOff := int(binary.BigEndian.Uint32(e)) - namesStart
+		f.files[i].name = string(names[nameOff : nameOff+int(binary.BigEndian.Uint16(e[12:]))])
+		if !fs.ValidPath(f.files[i].name) || f.files[i].name == "." ||
+			i > 0 && f.files[i-1].name >= f.files[i].name {
+			return nil, ErrFormat
+		}
+	}
+	return f, nil
+}
+
+// find returns the index of the first file whose name is not less than name.
+func (f *FS) find(name string) int {
+	i, _ := slices.BinarySearchFunc(f.files, name, func(e entry, name string) int {
+		return strings.Compare(e.name, name)
+	})
+	return i
+}
+
+// isDir reports whether any file is inside the directory name.
+func (f *FS) isDir(name string) bool {
+	if name == "." {
+		return true
+	}
+	i := f.find(name + "/")
+	return i < len(f.files) && strings.HasPrefix(f.files[i].name, name+"/")
+}
+
+func (f *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if i := f.find(name); i < len(f.files) && f.files[i].name == name {
+		e := &f.files[i]
+		return &file{
+			io.NewSectionReader(f.r, int64(e.offset), int64(e.size)),
+			fileInfo{path.Base(name), int64(e.size), false},
+		}, nil
+	}
+	if !f.isDir(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	entries, err := f.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	return &dir{fileInfo{path.Base(name), 0, true}, entries}, nil
+}
+
+// ReadDir returns the entries of the directory name, sorted by name.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	if !f.isDir(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	prefix := name + "/"
+	if name == "." {
+		prefix = ""
+	}
+	var entries []fs.DirEntry
+	lastDir := ""
+	for i := f.find(prefix); i < len(f.files) && strings.HasPrefix(f.files[i].name, prefix); i++ {
+		rest := f.files[i].name[len(prefix):]
+		if sub, _, ok := strings.Cut(rest, "/"); ok {
+			// Files of a subdirectory are consecutive
+			if sub != lastDir {
+				entries = append(entries, &fileInfo{sub, 0, true})
+				lastDir = sub
+			}
+			continue
+		}
+		entries = append(entries, &fileInfo{rest, int64(f.files[i].size), false})
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return entries, nil
+}
+
+// fileInfo implements fs.FileInfo and fs.DirEntry.
+type fileInfo struct {
+	name  string
+	size  int64
+	isDir bool
+}
+
+func (fi *fileInfo) Name() string               { return fi.name }
+func (fi *fileInfo) Size() int64                { return fi.size }
+func (fi *fileInfo) ModTime() time.Time         { return time.Time{} }
+func (fi *fileInfo) IsDir() bool                { return fi.isDir }
+func (fi *fileInfo) Sys() any                   { return nil }
+func (fi *fileInfo) Type() fs.FileMode          { return fi.Mode().Type() }
+func (fi *fileInfo) Info() (fs.FileInfo, error) { return fi, nil }
+
+func (fi *fileInfo) Mode() fs.FileMode {
+	if fi.isDir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// file implements fs.File, io.Seeker and io.ReaderAt.
+type file struct {
+	*io.SectionReader
+	info fileInfo
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return &f.info, nil }
+func (f *file) Close() error               { return nil }
+
+// dir implements fs.ReadDirFile.
+type dir struct {
+	info    fileInfo
+	entries []fs.DirEntry
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) { return &d.info, nil }
+func (d *dir) Close() error               { return nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
@@ -0,0 +1,156 @@
+package romfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+var testFiles = fstest.MapFS{
+	"a.txt":         {Data: []byte("hello")},
+	"a/b.bin":       {Data: []byte{1, 2, 3}},
+	"a/b/c.txt":     {Data: []byte("nested")},
+	"a/b.txt":       {Data: []byte{}},
+	"a-b/d.txt":     {Data: bytes.Repeat([]byte{0xaa}, 1000)},
+	"z/y/x/w.tex":   {Data: []byte("deep")},
+	"empty/.keep":   {Data: nil},
+	"textures/bg16": {Data: bytes.Repeat([]byte{0x55}, 33)},
+}
+
+func build(t *testing.T, fsys fs.FS) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Write(&buf, fsys); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestFS(t *testing.T) {
+	f, err := New(bytes.NewReader(build(t, testFiles)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(f, "a.txt", "a/b.bin", "a/b/c.txt", "a/b.txt",
+		"a-b/d.txt", "z/y/x/w.tex", "empty/.keep", "textures/bg16"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAlignment(t *testing.T) {
+	f, err := New(bytes.NewReader(build(t, testFiles)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range f.files {
+		if e.offset%dataAlign != 0 {
+			t.Errorf("%s: expected offset aligned to %d, got %#x", e.name, dataAlign, e.offset)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	f, err := New(bytes.NewReader(build(t, testFiles)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		name string
+		err  error
+	}{
+		"File":        {"a/b/c.txt", nil},
+		"Dir":         {"a/b", nil},
+		"Root":        {".", nil},
+		"NotExist":    {"a/c", fs.ErrNotExist},
+		"DirPrefix":   {"a/b.b", fs.ErrNotExist},
+		"Invalid":     {"/a.txt", fs.ErrInvalid},
+		"TrailingDot": {"a/.", fs.ErrInvalid},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			file, err := f.Open(tc.name)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+			if err == nil {
+				file.Close()
+			}
+		})
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	f, err := New(bytes.NewReader(build(t, fstest.MapFS{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := f.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected no entries, got %v", entries)
+	}
+}
+
+func TestNew(t *testing.T) {
+	valid := build(t, testFiles)
+	corrupt := func(fn func(b []byte) []byte) []byte {
+		return fn(bytes.Clone(valid))
+	}
+
+	tests := map[string]struct {
+		data []byte
+		err  error
+	}{
+		"Valid":        {valid, nil},
+		"Empty":        {nil, ErrFormat},
+		"Magic":        {corrupt(func(b []byte) []byte { b[0] = 'X'; return b }), ErrFormat},
+		"Version":      {corrupt(func(b []byte) []byte { b[4] = 2; return b }), ErrFormat},
+		"Truncated":    {valid[:headerSize+entrySize], ErrFormat},
+		"Count":        {corrupt(func(b []byte) []byte { b[12] = 0xff; return b }), ErrFormat},
+		"DataOffset":   {corrupt(func(b []byte) []byte { b[headerSize+4] = 0xff; return b }), ErrFormat},
+		"NameOffset":   {corrupt(func(b []byte) []byte { b[headerSize+3] = 0; return b }), ErrFormat},
+		"Unsorted":     {corrupt(func(b []byte) []byte { copy(b[headerSize:], b[headerSize+entrySize:headerSize+2*entrySize]); return b }), ErrFormat},
+		"TrailingData": {append(bytes.Clone(valid), 0), nil},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(bytes.NewReader(tc.data))
+			if err != tc.err {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestRead(t *testing.T) {
+	f, err := New(bytes.NewReader(build(t, testFiles)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, file := range testFiles {
+		data, err := fs.ReadFile(f, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, file.Data) {
+			t.Errorf("%s: expected %v, got %v", name, file.Data, data)
+		}
+	}
+
+	file, err := f.Open("textures/bg16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	buf := make([]byte, 8)
+	n, err := file.(io.ReaderAt).ReadAt(buf, 30)
+	if n != 3 || err != io.EOF {
+		t.Errorf("expected 3 bytes and EOF, got %d bytes and %v", n, err)
+	}
+}
@@ -0,0 +1,75 @@
+package romfs
+
+import (
+	"encoding/binary"
+	"io"
+	"io/fs"
+	"slices"
+)
+
+// Write writes the regular files of fsys, e.g. an os.DirFS, as filesystem to
+// w.  Empty directories are not preserved.
+func Write(w io.Writer, fsys fs.FS) error {
+	var names []string
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// WalkDir sorts each directory, but entries are sorted by full path
+	slices.Sort(names)
+
+	files := make([][]byte, len(names))
+	namesStart := headerSize + len(names)*entrySize
+	offset := namesStart
+	for i, name := range names {
+		if files[i], err = fs.ReadFile(fsys, name); err != nil {
+			return err
+		}
+		if len(name) > 0xffff {
+			return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+		}
+		offset += len(name)
+	}
+
+	b := make([]byte, headerSize, offset)
+	copy(b, magic)
+	b[4] = version
+	binary.BigEndian.PutUint32(b[12:], uint32(len(names)))
+	nameOff := namesStart
+	for i, name := range names {
+		offset = align(offset)
+		b = binary.BigEndian.AppendUint32(b, uint32(nameOff))
+		b = binary.BigEndian.AppendUint32(b, uint32(offset))
+		b = binary.BigEndian.AppendUint32(b, uint32(len(files[i])))
+		b = binary.BigEndian.AppendUint16(b, uint16(len(name)))
+		b = binary.BigEndian.AppendUint16(b, 0)
+		nameOff += len(name)
+		offset += len(files[i])
+	}
+	for _, name := range names {
+		b = append(b, name...)
+	}
+	if uint64(offset) > 0xffffffff {
+		return fs.ErrInvalid
+	}
+	binary.BigEndian.PutUint32(b[8:], uint32(offset))
+
+	for _, data := range files {
+		b = append(b, make([]byte, align(len(b))-len(b))...)
+		b = append(b, data...)
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func align(n int) int {
+	return (n + dataAlign - 1) &^ (dataAlign - 1)
+}
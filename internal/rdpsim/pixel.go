@@ -0,0 +1,199 @@
+package rdpsim
+
+import "encoding/binary"
+
+// rgba is a color with 8 bit channels.  Intermediate results of the color
+// combiner may exceed that range.
+type rgba [4]int32
+
+func (r *RDP) pixelAddr(x, y int) uint32 {
+	ci := r.colorImage
+	return ci.addr + (uint32(y)*ci.width+uint32(x))<<ci.size>>1
+}
+
+// fill writes the fill color, which holds two pixels in 16 bit and four
+// pixels in 8 bit color images.
+func (r *RDP) fill(x, y int) {
+	addr := r.pixelAddr(x, y)
+	switch r.colorImage.size {
+	case size32:
+		binary.BigEndian.PutUint32(r.rdram(addr, 4), r.fillColor)
+	case size16:
+		binary.BigEndian.PutUint16(r.rdram(addr, 2), uint16(r.fillColor>>(16-16*(x&1))))
+	case size8:
+		r.rdram(addr, 1)[0] = uint8(r.fillColor >> (24 - 8*(x&3)))
+	}
+}
+
+// readPixel returns the color of a pixel in the color image.  Like the
+// blender reads them, 5 bit channels are shifted, not scaled, to 8 bit.
+func (r *RDP) readPixel(x, y int) rgba {
+	addr := r.pixelAddr(x, y)
+	switch r.colorImage.size {
+	case size32:
+		b := r.rdram(addr, 4)
+		return rgba{int32(b[0]), int32(b[1]), int32(b[2]), int32(b[3])}
+	case size16:
+		v := int32(binary.BigEndian.Uint16(r.rdram(addr, 2)))
+		return rgba{v >> 8 & 0xf8, v >> 3 & 0xf8, v << 2 & 0xf8, (v & 1) * 0xff}
+	case size8:
+		i := int32(r.rdram(addr, 1)[0])
+		return rgba{i, i, i, i}
+	}
+	return rgba{}
+}
+
+// writePixel writes c to the color image, the alpha channel holds coverage.
+func (r *RDP) writePixel(x, y int, c rgba) {
+	addr := r.pixelAddr(x, y)
+	switch r.colorImage.size {
+	case size32:
+		copy(r.rdram(addr, 4), []byte{uint8(c[0]), uint8(c[1]), uint8(c[2]), uint8(c[3])})
+	case size16:
+		v := (c[0]>>3)<<11 | (c[1]>>3)<<6 | (c[2]>>3)<<1 | c[3]>>7
+		binary.BigEndian.PutUint16(r.rdram(addr, 2), uint16(v))
+	case size8:
+		r.rdram(addr, 1)[0] = uint8(c[0])
+	}
+}
+
+// copy writes a texel unmodified, except for the conversion to the color
+// image's format.  Texels with zero alpha are skipped if alpha compare is
+// enabled.
+func (r *RDP) copy(x, y int, idx uint32, s, t int32) {
+	c := r.texel(&r.tiles[idx], s, t, false)
+	if r.otherModes&alphaCompare != 0 && c[3] == 0 {
+		return
+	}
+	r.writePixel(x, y, c)
+}
+
+// shade runs a pixel through the texture unit, the color combiner and the
+// blender.  s and t are s10.5 texture coordinates.
+func (r *RDP) shade(x, y int, textured bool, idx uint32, s, t int32) {
+	twoCycle := r.cycleType() == cycle2
+	filter := r.otherModes&sample2x2 != 0
+
+	var tex0, tex1 rgba
+	if textured {
+		tex0 = r.texel(&r.tiles[idx], s, t, filter)
+		tex1 = tex0
+		if twoCycle {
+			tex1 = r.texel(&r.tiles[(idx+1)&7], s, t, filter)
+		}
+	}
+
+	// In 1 cycle mode only the second cycle's combiner is used
+	cycles := combinerCycles(r.combineMode)
+	var cc rgba
+	if twoCycle {
+		cc = r.combine(&cycles[0], tex0, tex1, cc)
+	}
+	cc = r.combine(&cycles[1], tex0, tex1, cc)
+
+	if r.otherModes&alphaCvgSel != 0 && r.otherModes&cvgTimesA == 0 {
+		cc[3] = 0xff // alpha is the coverage
+	}
+	if r.otherModes&alphaCompare != 0 && cc[3] < r.blendColor[3] {
+		return
+	}
+
+	var mem rgba
+	if r.otherModes&imageRead != 0 {
+		mem = r.readPixel(x, y)
+	}
+
+	// In 1 cycle mode only the first cycle's blender is used
+	var c rgba
+	if twoCycle {
+		c = r.blend(r.otherModes>>2, cc, cc, mem, true)
+		c = r.blend(r.otherModes, c, cc, mem, r.otherModes&forceBlend != 0)
+	} else {
+		c = r.blend(r.otherModes>>2, cc, cc, mem, r.otherModes&forceBlend != 0)
+	}
+	c[3] = 0xff // full coverage
+	r.writePixel(x, y, c)
+}
+
+// combinerCycle holds the inputs of a combiner cycle for color and alpha.
+type combinerCycle struct {
+	a, b, c, d     uint32
+	aa, ab, ac, ad uint32
+}
+
+func combinerCycles(w uint64) [2]combinerCycle {
+	return [2]combinerCycle{{
+		bits(w, 52, 4), bits(w, 28, 4), bits(w, 47, 5), bits(w, 15, 3),
+		bits(w, 44, 3), bits(w, 12, 3), bits(w, 41, 3), bits(w, 9, 3),
+	}, {
+		bits(w, 37, 4), bits(w, 24, 4), bits(w, 32, 5), bits(w, 6, 3),
+		bits(w, 21, 3), bits(w, 3, 3), bits(w, 18, 3), bits(w, 0, 3),
+	}}
+}
+
+// combine evaluates (a-b)*c+d of a combiner cycle for color and alpha.
+func (r *RDP) combine(cc *combinerCycle, tex0, tex1, combined rgba) rgba {
+	var shade, zero rgba // rectangles aren't shaded
+	one := rgba{0x100, 0x100, 0x100, 0x100}
+	lodFrac := int32(0)
+
+	inputs := [...]*rgba{&combined, &tex0, &tex1, &r.primColor, &shade, &r.envColor}
+	input := func(i uint32, extra ...*rgba) *rgba {
+		if i < uint32(len(inputs)) {
+			return inputs[i]
+		}
+		if i -= uint32(len(inputs)); i < uint32(len(extra)) {
+			return extra[i]
+		}
+		return &zero
+	}
+	splat := func(v int32) *rgba { return &rgba{v, v, v, v} }
+
+	a := input(cc.a, &one, &zero) // noise isn't emulated
+	b := input(cc.b, &r.keyCenter, splat(r.k4))
+	c := input(cc.c, &r.keyScale,
+		splat(combined[3]), splat(tex0[3]), splat(tex1[3]), splat(r.primColor[3]),
+		splat(shade[3]), splat(r.envColor[3]), splat(lodFrac), splat(r.primLODFrac), splat(r.k5))
+	d := input(cc.d, &one)
+
+	var out rgba
+	for i := range 3 {
+		out[i] = equation(a[i], b[i], c[i], d[i])
+	}
+
+	alphaC := input(cc.ac)[3]
+	switch cc.ac {
+	case 0:
+		alphaC = lodFrac
+	case 6:
+		alphaC = r.primLODFrac
+	}
+	out[3] = equation(input(cc.aa, &one)[3], input(cc.ab, &one)[3], alphaC, input(cc.ad, &one)[3])
+	return out
+}
+
+// equation computes (a-b)*c+d with rounding and clamps the result.
+func equation(a, b, c, d int32) int32 {
+	return min(max(((a-b)*c+d<<8+0x80)>>8, 0), 0xff)
+}
+
+// blend evaluates p*a+m*b of a blender cycle.  modes is the other modes word
+// shifted so that the fields of the cycle are at the positions of the second
+// cycle.  If enable is false, p is passed through.
+func (r *RDP) blend(modes uint64, in, cc, mem rgba, enable bool) rgba {
+	pm := [4]rgba{in, mem, r.blendColor, r.fogColor}
+	p, m := pm[bits(modes, 28, 2)], pm[bits(modes, 20, 2)]
+	if !enable {
+		return p
+	}
+
+	alpha := [4]int32{cc[3], r.fogColor[3], 0, 0}[bits(modes, 24, 2)] // shade alpha is zero
+	a := alpha >> 3
+	b := [4]int32{^alpha & 0xff, 0xff, 0xff, 0}[bits(modes, 16, 2)] >> 3 // coverage is full
+
+	var out rgba
+	for i := range 3 {
+		out[i] = min((p[i]*a+m[i]*(b+1))>>5, 0xff)
+	}
+	return out
+}
@@ -0,0 +1,295 @@
+// Package rdpsim executes RDP commands on the host, which allows testing
+// graphics code without hardware.  It implements the RDP features used by
+// this module: fill and texture rectangles in all cycle types, texture loads,
+// palettes, the color combiner, the blender and the scissor.  Triangles, depth
+// buffering, anti-aliasing, dithering, noise and texture LOD are not
+// emulated, all pixels are fully covered.
+//
+// The tests build their commands with rdp.DisplayList and draw.Rdp.  Their
+// golden images in testdata were rendered by rdpsim itself, not captured on
+// hardware, so they only detect changes in behavior.  Run the tests with
+// -update to regenerate them.
+package rdpsim
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/drpaneas/n64/rcp/rdp/disasm"
+)
+
+var (
+	ErrUnsupported = errors.New("rdpsim: unsupported command")
+	ErrAddress     = errors.New("rdpsim: address out of range")
+)
+
+// Image formats and sizes as encoded in commands
+const (
+	fmtRGBA = iota
+	fmtYUV
+	fmtCI
+	fmtIA
+	fmtI
+)
+
+const (
+	size4 = iota
+	size8
+	size16
+	size32
+)
+
+const (
+	cycle1 = iota
+	cycle2
+	cycleCopy
+	cycleFill
+)
+
+// Other modes flags
+const (
+	alphaCompare = 1 << 0
+	alphaCvgSel  = 1 << 13
+	cvgTimesA    = 1 << 12
+	imageRead    = 1 << 6
+	forceBlend   = 1 << 14
+	sample2x2    = 1 << 45
+	tlutType     = 1 << 46 // palette colors are IA16 instead of RGBA16
+	tlut         = 1 << 47
+)
+
+type imageDesc struct {
+	format, size, width, addr uint32
+}
+
+type tileAxis struct {
+	clamp, mirror bool
+	mask, shift   uint32
+	lo, hi        uint32 // 10.2
+}
+
+type tile struct {
+	format, size uint32
+	line, addr   uint32 // in bytes
+	palette      uint32
+	s, t         tileAxis
+}
+
+// RDP is the state of a simulated RDP and the RDRAM it renders to.
+type RDP struct {
+	RDRAM []byte
+	TMEM  [4096]byte
+
+	colorImage, textureImage imageDesc
+	tiles                    [8]tile
+
+	otherModes, combineMode uint64
+	scissor                 image.Rectangle // 10.2
+	field, odd              bool
+
+	fillColor                                 uint32
+	fogColor, blendColor, primColor, envColor rgba
+	primLODFrac                               int32
+	keyCenter, keyScale                       rgba
+	k4, k5                                    int32
+
+	err error // first error of the current command
+}
+
+// New returns an RDP with the given amount of RDRAM.
+func New(rdramSize int) *RDP {
+	return &RDP{RDRAM: make([]byte, rdramSize)}
+}
+
+// Run executes a command list.
+func (r *RDP) Run(cmds []uint64) error {
+	list, err := disasm.Decode(cmds)
+	for _, c := range list {
+		r.command(c)
+		if r.err != nil {
+			err, r.err = r.err, nil
+			return fmt.Errorf("%w at offset %#x", err, c.Offset)
+		}
+	}
+	return err
+}
+
+// ColorImage returns the upper height lines of the color image.  As on the
+// console, the alpha channel holds coverage and is ignored, pixels are
+// opaque.
+func (r *RDP) ColorImage(height int) *image.RGBA {
+	ci := r.colorImage
+	img := image.NewRGBA(image.Rect(0, 0, int(ci.width), height))
+	for y := range height {
+		for x := range int(ci.width) {
+			c := r.readPixel(x, y)
+			if ci.size == size16 {
+				c = rgba{c[0] | c[0]>>5, c[1] | c[1]>>5, c[2] | c[2]>>5}
+			}
+			img.SetRGBA(x, y, color.RGBA{uint8(c[0]), uint8(c[1]), uint8(c[2]), 0xff})
+		}
+	}
+	return img
+}
+
+func bits(w uint64, lo, n uint) uint32 {
+	return uint32(w >> lo & (1<<n - 1))
+}
+
+func colorOf(w uint64) rgba {
+	return rgba{int32(bits(w, 24, 8)), int32(bits(w, 16, 8)), int32(bits(w, 8, 8)), int32(bits(w, 0, 8))}
+}
+
+func (r *RDP) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+// rdram returns n bytes of RDRAM at addr.  Out of range accesses fail the
+// current command and return a scratch buffer.
+func (r *RDP) rdram(addr, n uint32) []byte {
+	addr &= 0x3ffffff
+	if uint64(addr)+uint64(n) > uint64(len(r.RDRAM)) {
+		r.fail(fmt.Errorf("%w: %#x", ErrAddress, addr))
+		return make([]byte, n)
+	}
+	return r.RDRAM[addr : addr+n]
+}
+
+func (r *RDP) command(c disasm.Command) {
+	w := c.Words[0]
+
+	switch c.Opcode() {
+	case disasm.OpNop, disasm.OpSyncLoad, disasm.OpSyncPipe, disasm.OpSyncTile,
+		disasm.OpSyncFull, disasm.OpSetPrimDepth, disasm.OpSetZImage:
+	case disasm.OpSetKeyGB:
+		r.keyCenter[1], r.keyScale[1] = int32(bits(w, 24, 8)), int32(bits(w, 16, 8))
+		r.keyCenter[2], r.keyScale[2] = int32(bits(w, 8, 8)), int32(bits(w, 0, 8))
+	case disasm.OpSetKeyR:
+		r.keyCenter[0], r.keyScale[0] = int32(bits(w, 8, 8)), int32(bits(w, 0, 8))
+	case disasm.OpSetConvert:
+		r.k4, r.k5 = int32(bits(w, 9, 9)), int32(bits(w, 0, 9))
+	case disasm.OpSetScissor:
+		r.scissor = image.Rect(int(bits(w, 44, 12)), int(bits(w, 32, 12)), int(bits(w, 12, 12)), int(bits(w, 0, 12)))
+		r.field, r.odd = bits(w, 25, 1) != 0, bits(w, 24, 1) != 0
+	case disasm.OpSetOtherModes:
+		r.otherModes = w
+	case disasm.OpSetTileSize:
+		t := &r.tiles[bits(w, 24, 3)]
+		t.s.lo, t.t.lo, t.s.hi, t.t.hi = bits(w, 44, 12), bits(w, 32, 12), bits(w, 12, 12), bits(w, 0, 12)
+	case disasm.OpLoadTile:
+		r.loadTile(w)
+	case disasm.OpLoadBlock:
+		r.loadBlock(w)
+	case disasm.OpLoadTLUT:
+		r.loadTLUT(w)
+	case disasm.OpSetTile:
+		r.tiles[bits(w, 24, 3)] = tile{
+			format:  bits(w, 53, 3),
+			size:    bits(w, 51, 2),
+			line:    bits(w, 41, 9) * 8,
+			addr:    bits(w, 32, 9) * 8,
+			palette: bits(w, 20, 4),
+			t:       axis(bits(w, 10, 10)),
+			s:       axis(bits(w, 0, 10)),
+		}
+	case disasm.OpFillRect:
+		r.fillRect(w)
+	case disasm.OpTextureRect, disasm.OpTextureRectFlip:
+		r.textureRect(c.Words[0], c.Words[1], c.Opcode() == disasm.OpTextureRectFlip)
+	case disasm.OpSetFillColor:
+		r.fillColor = uint32(w)
+	case disasm.OpSetFogColor:
+		r.fogColor = colorOf(w)
+	case disasm.OpSetBlendColor:
+		r.blendColor = colorOf(w)
+	case disasm.OpSetPrimColor:
+		r.primColor, r.primLODFrac = colorOf(w), int32(bits(w, 32, 8))
+	case disasm.OpSetEnvColor:
+		r.envColor = colorOf(w)
+	case disasm.OpSetCombineMode:
+		r.combineMode = w
+	case disasm.OpSetTextureImage:
+		r.textureImage = imageDesc{bits(w, 53, 3), bits(w, 51, 2), bits(w, 32, 10) + 1, bits(w, 0, 26)}
+	case disasm.OpSetColorImage:
+		r.colorImage = imageDesc{bits(w, 53, 3), bits(w, 51, 2), bits(w, 32, 10) + 1, bits(w, 0, 26)}
+	default:
+		r.fail(fmt.Errorf("%w %s", ErrUnsupported, c.Name()))
+	}
+}
+
+func axis(v uint32) tileAxis {
+	return tileAxis{
+		clamp:  v>>9&1 != 0,
+		mirror: v>>8&1 != 0,
+		mask:   v >> 4 & 15,
+		shift:  v & 15,
+	}
+}
+
+func (r *RDP) cycleType() uint32 {
+	return bits(r.otherModes, 52, 2)
+}
+
+// rect calls fn for all pixels of a rectangle in 10.2 coordinates which pass
+// the scissor test, with the pixel's offset from the rectangle's origin.  In
+// copy and fill mode the lower right edges are inclusive.
+func (r *RDP) rect(rc image.Rectangle, fn func(x, y int, dx, dy int32)) {
+	sc := image.Rect(r.scissor.Min.X>>2, r.scissor.Min.Y>>2, r.scissor.Max.X>>2, r.scissor.Max.Y>>2)
+	if ct := r.cycleType(); ct == cycleCopy || ct == cycleFill {
+		rc = image.Rect(rc.Min.X>>2, rc.Min.Y>>2, rc.Max.X>>2+1, rc.Max.Y>>2+1)
+		sc.Max.X++ // matches the scissor set up by rdp.DisplayList
+	} else {
+		rc = image.Rect((rc.Min.X+3)>>2, (rc.Min.Y+3)>>2, (rc.Max.X+3)>>2, (rc.Max.Y+3)>>2)
+	}
+	sc = sc.Intersect(image.Rect(0, 0, int(r.colorImage.width), sc.Max.Y))
+
+	start := rc.Min
+	rc = rc.Intersect(sc)
+	for y := rc.Min.Y; y < rc.Max.Y; y++ {
+		if r.field && (y&1 != 0) != r.odd {
+			continue
+		}
+		for x := rc.Min.X; x < rc.Max.X; x++ {
+			fn(x, y, int32(x-start.X), int32(y-start.Y))
+		}
+	}
+}
+
+func rectOf(w uint64) image.Rectangle {
+	return image.Rect(int(bits(w, 12, 12)), int(bits(w, 0, 12)), int(bits(w, 44, 12)), int(bits(w, 32, 12)))
+}
+
+func (r *RDP) fillRect(w uint64) {
+	if r.cycleType() == cycleFill {
+		r.rect(rectOf(w), func(x, y int, _, _ int32) { r.fill(x, y) })
+		return
+	}
+	r.rect(rectOf(w), func(x, y int, _, _ int32) { r.shade(x, y, false, 0, 0, 0) })
+}
+
+func (r *RDP) textureRect(w0, w1 uint64, flip bool) {
+	idx := bits(w0, 24, 3)
+	// Coordinates are s10.5 and gradients s5.10
+	s0, t0 := int32(int16(w1>>48))<<5, int32(int16(w1>>32))<<5
+	dsdx, dtdy := int32(int16(w1>>16)), int32(int16(w1))
+	copyMode := r.cycleType() == cycleCopy
+	if copyMode {
+		dsdx /= 4 // copy mode draws four pixels per cycle
+	}
+
+	r.rect(rectOf(w0), func(x, y int, dx, dy int32) {
+		if flip {
+			dx, dy = dy, dx
+		}
+		s, t := (s0+dsdx*dx)>>5, (t0+dtdy*dy)>>5
+		if copyMode {
+			r.copy(x, y, idx, s, t)
+		} else {
+			r.shade(x, y, true, idx, s, t)
+		}
+	})
+}
@@ -0,0 +1,458 @@
+package rdpsim
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	n64draw "github.com/drpaneas/n64/drivers/draw"
+	"github.com/drpaneas/n64/rcp/cpu"
+	"github.com/drpaneas/n64/rcp/rdp"
+	"github.com/drpaneas/n64/rcp/rdp/disasm"
+	"github.com/drpaneas/n64/rcp/texture"
+)
+
+var update = flag.Bool("update", false, "update golden images in testdata")
+
+const (
+	fbAddr  = 0x10000
+	texAddr = 0x80000
+)
+
+// simTexture is an image in the simulated RDRAM, its pixels are written by
+// the tests directly.
+type simTexture struct {
+	addr   cpu.Addr
+	size   image.Point
+	format texture.ImageFormat
+	bpp    texture.BitDepth
+}
+
+func newTexture(addr cpu.Addr, w, h int, format texture.ImageFormat, bpp texture.BitDepth) *simTexture {
+	return &simTexture{addr, image.Pt(w, h), format, bpp}
+}
+
+func (p *simTexture) ColorModel() color.Model     { return color.RGBAModel }
+func (p *simTexture) Bounds() image.Rectangle     { return image.Rectangle{Max: p.size} }
+func (p *simTexture) At(x, y int) color.Color     { return color.RGBA{} }
+func (p *simTexture) Addr() cpu.Addr              { return p.addr }
+func (p *simTexture) Stride() int                 { return p.size.X }
+func (p *simTexture) Format() texture.ImageFormat { return p.format }
+func (p *simTexture) BPP() texture.BitDepth       { return p.bpp }
+func (p *simTexture) Premult() bool               { return false }
+
+// setModes sets the other modes without dithering and depth buffering.
+func setModes(dl *rdp.DisplayList, flags rdp.ModeFlags, ct rdp.CycleType, blend rdp.BlendMode) {
+	dl.SetOtherModes(flags, ct, rdp.RGBDitherNone, rdp.AlphaDitherNone, rdp.ZmodeOpaque, rdp.CvgDestClamp, blend)
+}
+
+// pass and passAlpha return combiner inputs with the output d.
+func pass(d rdp.CombineSource) rdp.CombineParams {
+	return rdp.CombineParams{A: rdp.CombineAColorZero, B: rdp.CombineBColorZero, C: rdp.CombineCColorZero, D: d}
+}
+
+func passAlpha(d rdp.CombineSource) rdp.CombineParams {
+	return rdp.CombineParams{A: rdp.CombineAAlphaZero, B: rdp.CombineBAlphaZero, C: rdp.CombineCAlphaZero, D: d}
+}
+
+// both returns a combine mode which runs p in both cycles.
+func both(p rdp.CombinePass) rdp.CombineMode { return rdp.CombineMode{One: p, Two: p} }
+
+// tex0Prim multiplies the texel with the primitive color.
+var tex0Prim = rdp.CombinePass{
+	RGB:   rdp.CombineParams{A: rdp.CombineTex0, B: rdp.CombineBColorZero, C: rdp.CombinePrimitive, D: rdp.CombineDColorZero},
+	Alpha: passAlpha(rdp.CombineDAlphaOne),
+}
+
+// rdp.DisplayList doesn't provide LOAD_BLOCK and TEXTURE_RECTANGLE_FLIP, so
+// these are encoded by hand.
+
+func loadBlock(idx, texels, dxt uint64) uint64 {
+	return 0xf3<<56 | idx<<24 | (texels-1)<<12 | dxt
+}
+
+// textureRectFlip draws texels 1:1 from the tile's origin.
+func textureRectFlip(idx uint64, r image.Rectangle) []uint64 {
+	return []uint64{
+		0xe5<<56 | uint64(r.Max.X)<<46 | uint64(r.Max.Y)<<34 | idx<<24 | uint64(r.Min.X)<<14 | uint64(r.Min.Y)<<2,
+		1<<26 | 1<<10,
+	}
+}
+
+// texelA is the pattern of the 4x4 RGBA32 texture at texAddr
+func texelA(x, y int) color.RGBA {
+	return color.RGBA{uint8(x * 80), uint8(y * 80), uint8(255 - x*60), 255}
+}
+
+// writeTextures writes test textures to RDRAM: 4x4 RGBA32 at texAddr, 8x8
+// RGBA16 at texAddr+0x100, where texels on the diagonal are transparent,
+// 16x8 I4 at texAddr+0x200, 8x2 CI4 at texAddr+0x300, 4x1 CI8 at
+// texAddr+0x380 and their palettes of four colors, RGBA16 at texAddr+0x400
+// and IA16 at texAddr+0x480.
+func writeTextures(rdram []byte) {
+	for y := range 4 {
+		for x := range 4 {
+			c := texelA(x, y)
+			copy(rdram[texAddr+(y*4+x)*4:], []byte{c.R, c.G, c.B, c.A})
+		}
+	}
+	for y := range 8 {
+		for x := range 8 {
+			v := uint16(x*4)<<11 | uint16(y*4)<<6 | 31<<1
+			if x != y {
+				v |= 1
+			}
+			rdram[texAddr+0x100+(y*8+x)*2] = uint8(v >> 8)
+			rdram[texAddr+0x100+(y*8+x)*2+1] = uint8(v)
+		}
+	}
+	for y := range 8 {
+		for x := 0; x < 16; x += 2 {
+			rdram[texAddr+0x200+y*8+x/2] = uint8((x+y)&15)<<4 | uint8((x+1+y)&15)
+		}
+	}
+	for y := range 2 {
+		for x := 0; x < 8; x += 2 {
+			rdram[texAddr+0x300+y*4+x/2] = uint8((x+y)&3)<<4 | uint8((x+1+y)&3)
+		}
+	}
+	copy(rdram[texAddr+0x380:], []byte{3, 2, 1, 0})
+	copy(rdram[texAddr+0x400:], []byte{0xf8, 0x01, 0x07, 0xc1, 0x00, 0x3f, 0xff, 0xff})
+	copy(rdram[texAddr+0x480:], []byte{0x40, 0xff, 0x80, 0xff, 0xc0, 0xff, 0xff, 0xff})
+}
+
+func rgb(r, g, b uint8) color.RGBA { return color.RGBA{r, g, b, 0xff} }
+
+// run executes the commands recorded by dl with the test textures in RDRAM.
+func run(t *testing.T, dl *rdp.DisplayList) *RDP {
+	t.Helper()
+	r := New(1 << 20)
+	writeTextures(r.RDRAM)
+	if err := r.Run(dl.Commands()); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// check compares pixels of img with want and its golden image.
+func check(t *testing.T, img *image.RGBA, want map[image.Point]color.RGBA) {
+	t.Helper()
+	for p, want := range want {
+		if got := img.RGBAAt(p.X, p.Y); got != want {
+			t.Errorf("%v: expected %v, got %v", p, want, got)
+		}
+	}
+	golden(t, img)
+}
+
+func TestRun(t *testing.T) {
+	red, green, blue := rgb(0xff, 0, 0), rgb(0, 0xff, 0), rgb(0, 0, 0xff)
+	black, white := rgb(0, 0, 0), rgb(0xff, 0xff, 0xff)
+	i4 := func(x, y int) color.RGBA { // I4 texel times primitive color
+		i := int32((x+y)&15) * 0x11
+		return rgb(uint8(equation(i, 0, 255, 0)), uint8(equation(i, 0, 128, 0)), 0)
+	}
+	blendPrim := rdp.BlendMode{ // dst = cc_alpha*cc + (1-cc_alpha)*dst
+		P1: rdp.BlenderPMColorCombiner, A1: rdp.BlenderAColorCombinerAlpha,
+		M1: rdp.BlenderPMFramebuffer, B1: rdp.BlenderBOneMinusAlphaA,
+	}
+
+	tests := map[string]struct {
+		draw   func(dl *rdp.DisplayList)
+		height int
+		want   map[image.Point]color.RGBA
+	}{
+		"Fill": {
+			func(dl *rdp.DisplayList) {
+				dl.SetColorImage(newTexture(fbAddr, 32, 24, texture.RGBA, texture.BPP16))
+				dl.SetScissor(image.Rect(0, 0, 32, 24), rdp.InterlaceNone)
+				setModes(dl, 0, rdp.CycleTypeFill, rdp.BlendMode{})
+				dl.SetFillColor(red)
+				dl.FillRectangle(image.Rect(2, 2, 10, 10))
+				dl.SetFillColor(green)
+				dl.FillRectangle(image.Rect(6, 6, 30, 18))
+				dl.SetScissor(image.Rect(0, 0, 32, 24), rdp.InterlaceOdd)
+				dl.SetFillColor(white)
+				dl.FillRectangle(image.Rect(0, 20, 32, 24))
+			},
+			24,
+			map[image.Point]color.RGBA{
+				{2, 2}: red, {5, 9}: red, {9, 5}: red, {10, 2}: black,
+				{6, 6}: green, {7, 6}: green, {29, 17}: green, {30, 17}: black, {6, 18}: black,
+				{0, 20}: white, {31, 22}: white, {0, 21}: black,
+			},
+		},
+		"Scissor": {
+			func(dl *rdp.DisplayList) {
+				dl.SetColorImage(newTexture(fbAddr, 32, 24, texture.RGBA, texture.BPP32))
+				dl.SetScissor(image.Rect(4, 4, 28, 20), rdp.InterlaceNone)
+				setModes(dl, 0, rdp.CycleTypeFill, rdp.BlendMode{})
+				dl.SetFillColor(rgb(0x33, 0x66, 0x99))
+				dl.FillRectangle(image.Rect(0, 0, 32, 24))
+			},
+			24,
+			map[image.Point]color.RGBA{
+				{3, 4}: black, {4, 4}: rgb(0x33, 0x66, 0x99), {27, 19}: rgb(0x33, 0x66, 0x99),
+				{28, 19}: black, {27, 20}: black,
+			},
+		},
+		"Blend": {
+			func(dl *rdp.DisplayList) {
+				dl.SetColorImage(newTexture(fbAddr, 32, 24, texture.RGBA, texture.BPP32))
+				dl.SetScissor(image.Rect(0, 0, 32, 24), rdp.InterlaceNone)
+				setModes(dl, 0, rdp.CycleTypeFill, rdp.BlendMode{})
+				dl.SetFillColor(blue)
+				dl.FillRectangle(image.Rect(0, 0, 32, 24))
+
+				dl.SetCombineMode(both(rdp.CombinePass{RGB: pass(rdp.CombinePrimitive), Alpha: passAlpha(rdp.CombinePrimitive)}))
+				dl.SetPrimitiveColor(color.RGBA{0xff, 0, 0, 0x80})
+				setModes(dl, rdp.ForceBlend|rdp.ImageRead, rdp.CycleTypeOne, blendPrim)
+				dl.FillRectangle(image.Rect(8, 8, 24, 16))
+
+				// rejected by the alpha compare with the blend color
+				dl.SetBlendColor(color.RGBA{A: 0x20})
+				dl.SetPrimitiveColor(color.RGBA{0xff, 0, 0, 0x10})
+				setModes(dl, rdp.AlphaCompare|rdp.ForceBlend|rdp.ImageRead, rdp.CycleTypeOne, blendPrim)
+				dl.FillRectangle(image.Rect(0, 18, 32, 24))
+			},
+			24,
+			map[image.Point]color.RGBA{
+				{8, 8}: rgb(127, 0, 127), {23, 15}: rgb(127, 0, 127),
+				{7, 8}: blue, {24, 8}: blue, {8, 16}: blue, {0, 18}: blue,
+			},
+		},
+		"Copy": {
+			func(dl *rdp.DisplayList) {
+				dl.SetColorImage(newTexture(fbAddr, 32, 24, texture.RGBA, texture.BPP16))
+				dl.SetScissor(image.Rect(0, 0, 32, 24), rdp.InterlaceNone)
+				dl.SetTextureImage(newTexture(texAddr+0x100, 8, 8, texture.RGBA, texture.BPP16))
+				dl.SetTile(rdp.TileDescriptor{Format: texture.RGBA, Size: texture.BPP16, Line: 2})
+				dl.LoadTile(0, image.Rect(0, 0, 8, 8))
+				setModes(dl, 0, rdp.CycleTypeCopy, rdp.BlendMode{})
+				dl.TextureRectangle(image.Rect(2, 2, 10, 10), image.Point{}, image.Pt(1, 1), 0)
+				setModes(dl, rdp.AlphaCompare, rdp.CycleTypeCopy, rdp.BlendMode{})
+				dl.TextureRectangle(image.Rect(12, 2, 20, 10), image.Point{}, image.Pt(1, 1), 0)
+			},
+			24,
+			map[image.Point]color.RGBA{
+				{2, 2}: blue, {5, 3}: rgb(99, 33, 255), {9, 9}: rgb(231, 231, 255), {10, 2}: black,
+				{12, 2}: black, {13, 2}: rgb(33, 0, 255), {19, 8}: rgb(231, 198, 255),
+			},
+		},
+		"Texture": {
+			func(dl *rdp.DisplayList) {
+				dl.SetColorImage(newTexture(fbAddr, 48, 32, texture.RGBA, texture.BPP32))
+				dl.SetScissor(image.Rect(0, 0, 48, 32), rdp.InterlaceNone)
+				dl.SetTextureImage(newTexture(texAddr, 4, 4, texture.RGBA, texture.BPP32))
+				ts := rdp.TileDescriptor{Format: texture.RGBA, Size: texture.BPP32, Line: 2, MaskT: 2, MaskS: 2}
+				dl.SetTile(ts)
+				dl.LoadTile(0, image.Rect(0, 0, 4, 4))
+				dl.SetCombineMode(both(rdp.CombinePass{RGB: pass(rdp.CombineTex0), Alpha: passAlpha(rdp.CombineTex0)}))
+				setModes(dl, 0, rdp.CycleTypeOne, rdp.BlendMode{})
+				dl.TextureRectangle(image.Rect(0, 0, 16, 16), image.Point{}, image.Pt(4, 4), 0)
+				setModes(dl, rdp.SampleType, rdp.CycleTypeOne, rdp.BlendMode{})
+				dl.TextureRectangle(image.Rect(16, 0, 32, 16), image.Point{}, image.Pt(4, 4), 0)
+
+				setModes(dl, 0, rdp.CycleTypeOne, rdp.BlendMode{})
+				ts.Idx, ts.Flags = 1, rdp.MirrorS
+				dl.SetTile(ts)
+				dl.TextureRectangle(image.Rect(32, 0, 48, 4), image.Point{}, image.Pt(1, 1), 1)
+				ts.Idx, ts.Flags, ts.MaskT, ts.MaskS = 2, rdp.ClampS|rdp.ClampT, 0, 0
+				dl.SetTile(ts)
+				dl.SetTileSize(2, image.Rect(0, 0, 4, 4))
+				dl.TextureRectangle(image.Rect(0, 16, 8, 24), image.Point{}, image.Pt(1, 1), 2)
+				dl.Execute(textureRectFlip(0, image.Rect(32, 16, 36, 20)))
+
+				dl.SetTextureImage(newTexture(texAddr+0x200, 16, 8, texture.I, texture.BPP4))
+				dl.SetTile(rdp.TileDescriptor{Format: texture.I, Size: texture.BPP4, Line: 1, Addr: 64, Idx: 3})
+				dl.LoadTile(3, image.Rect(0, 0, 16, 8))
+				dl.SetCombineMode(both(tex0Prim))
+				dl.SetPrimitiveColor(color.RGBA{0xff, 0x80, 0, 0xff})
+				dl.TextureRectangle(image.Rect(16, 16, 32, 24), image.Point{}, image.Pt(1, 1), 3)
+
+				// The same texture loaded as a block of 16 bit texels
+				dl.SetTextureImage(newTexture(texAddr+0x200, 32, 1, texture.RGBA, texture.BPP16))
+				dl.SetTile(rdp.TileDescriptor{Format: texture.I, Size: texture.BPP4, Line: 1, Addr: 128, Idx: 4})
+				dl.Execute([]uint64{loadBlock(4, 32, 0x800)})
+				dl.SetTileSize(4, image.Rect(0, 0, 16, 8))
+				dl.TextureRectangle(image.Rect(32, 24, 48, 32), image.Point{}, image.Pt(1, 1), 4)
+			},
+			32,
+			map[image.Point]color.RGBA{
+				{0, 0}: texelA(0, 0), {3, 3}: texelA(0, 0), {4, 0}: texelA(1, 0), {15, 15}: texelA(3, 3),
+				{16, 0}: texelA(0, 0), {20, 0}: texelA(1, 0), {18, 0}: rgb(40, 0, 225),
+				{32, 0}: texelA(0, 0), {35, 1}: texelA(3, 1), {36, 1}: texelA(3, 1), {39, 2}: texelA(0, 2), {40, 3}: texelA(0, 3),
+				{2, 17}: texelA(2, 1), {7, 23}: texelA(3, 3),
+				{33, 16}: texelA(0, 1), {35, 17}: texelA(1, 3),
+				{16, 16}: i4(0, 0), {21, 16}: i4(5, 0), {31, 23}: i4(15, 7), {18, 19}: i4(2, 3),
+				{32, 24}: i4(0, 0), {47, 31}: i4(15, 7), {34, 27}: i4(2, 3),
+			},
+		},
+		"Palette": {
+			func(dl *rdp.DisplayList) {
+				dl.SetColorImage(newTexture(fbAddr, 32, 8, texture.RGBA, texture.BPP16))
+				dl.SetScissor(image.Rect(0, 0, 32, 8), rdp.InterlaceNone)
+				dl.SetTextureImage(newTexture(texAddr+0x400, 4, 1, texture.RGBA, texture.BPP16))
+				dl.LoadTLUT(7, 2, 4)
+				dl.SetTextureImage(newTexture(texAddr+0x300, 8, 2, texture.ColorIdx, texture.BPP4))
+				dl.SetTile(rdp.TileDescriptor{Format: texture.ColorIdx, Size: texture.BPP4, Line: 1, Palette: 2})
+				dl.LoadTile(0, image.Rect(0, 0, 8, 2))
+				setModes(dl, rdp.TLUT, rdp.CycleTypeCopy, rdp.BlendMode{})
+				dl.TextureRectangle(image.Rect(0, 0, 8, 2), image.Point{}, image.Pt(1, 1), 0)
+
+				dl.SetTextureImage(newTexture(texAddr+0x480, 4, 1, texture.IA, texture.BPP16))
+				dl.LoadTLUT(7, 0, 4)
+				dl.SetTextureImage(newTexture(texAddr+0x380, 4, 1, texture.ColorIdx, texture.BPP8))
+				dl.SetTile(rdp.TileDescriptor{Format: texture.ColorIdx, Size: texture.BPP8, Line: 1, Addr: 8, Idx: 1})
+				dl.LoadTile(1, image.Rect(0, 0, 4, 1))
+				setModes(dl, rdp.TLUT|rdp.TLUTType, rdp.CycleTypeCopy, rdp.BlendMode{})
+				dl.TextureRectangle(image.Rect(0, 4, 4, 5), image.Point{}, image.Pt(1, 1), 1)
+			},
+			8,
+			map[image.Point]color.RGBA{
+				{0, 0}: red, {1, 0}: green, {2, 0}: blue, {3, 0}: white, {4, 0}: red, {0, 1}: green, {7, 1}: red,
+				{0, 4}: white, {1, 4}: rgb(0xc6, 0xc6, 0xc6), {2, 4}: rgb(0x84, 0x84, 0x84), {3, 4}: rgb(0x42, 0x42, 0x42),
+				{8, 0}: black, {0, 2}: black, {4, 4}: black,
+			},
+		},
+		"TwoCycle": {
+			func(dl *rdp.DisplayList) {
+				dl.SetColorImage(newTexture(fbAddr, 32, 16, texture.RGBA, texture.BPP32))
+				dl.SetScissor(image.Rect(0, 0, 32, 16), rdp.InterlaceNone)
+				setModes(dl, 0, rdp.CycleTypeFill, rdp.BlendMode{})
+				dl.SetFillColor(rgb(0x80, 0x80, 0x80))
+				dl.FillRectangle(image.Rect(0, 0, 32, 16))
+
+				dl.SetTextureImage(newTexture(texAddr, 4, 4, texture.RGBA, texture.BPP32))
+				dl.SetTile(rdp.TileDescriptor{Format: texture.RGBA, Size: texture.BPP32, Line: 2, MaskT: 2, MaskS: 2})
+				dl.LoadTile(0, image.Rect(0, 0, 4, 4))
+				dl.SetPrimitiveColor(white)
+				dl.SetEnvironmentColor(color.RGBA{0, 0, 64, 128})
+				// The second cycle blends the texel with the environment color
+				dl.SetCombineMode(rdp.CombineMode{One: tex0Prim, Two: rdp.CombinePass{
+					RGB: rdp.CombineParams{
+						A: rdp.CombineCombined, B: rdp.CombineBColorZero,
+						C: rdp.CombineCColorEnvironmentAlpha, D: rdp.CombineEnvironment,
+					},
+					Alpha: passAlpha(rdp.CombineEnvironment),
+				}})
+				setModes(dl, rdp.ForceBlend|rdp.ImageRead, rdp.CycleTypeTwo, rdp.BlendMode{
+					P1: rdp.BlenderPMColorCombiner, A1: rdp.BlenderAZero, M1: rdp.BlenderPMColorCombiner, B1: rdp.BlenderBOne,
+					P2: rdp.BlenderPMColorCombiner, A2: rdp.BlenderAColorCombinerAlpha, M2: rdp.BlenderPMFramebuffer, B2: rdp.BlenderBOneMinusAlphaA,
+				})
+				dl.TextureRectangle(image.Rect(0, 0, 16, 16), image.Point{}, image.Pt(1, 1), 0)
+			},
+			16,
+			map[image.Point]color.RGBA{
+				{0, 0}: rgb(64, 64, 159), {15, 15}: rgb(124, 124, 115), {16, 0}: rgb(128, 128, 128),
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var dl rdp.DisplayList
+			tc.draw(&dl)
+			r := run(t, &dl)
+			check(t, r.ColorImage(tc.height), tc.want)
+		})
+	}
+}
+
+// TestDraw renders with draw.Rdp, which uses the global rdp.RDP.
+func TestDraw(t *testing.T) {
+	rdp.RDP = rdp.DisplayList{}
+	fb := n64draw.NewRdp()
+	fb.SetFramebuffer(newTexture(fbAddr, 32, 24, texture.RGBA, texture.BPP32))
+	fb.Draw(fb.Bounds(), image.NewUniform(rgb(0, 0, 0xff)), image.Point{}, draw.Src)
+	fb.Draw(image.Rect(2, 2, 10, 10), image.NewUniform(color.RGBA{0x80, 0, 0, 0x80}), image.Point{}, draw.Over)
+	fb.Draw(image.Rect(12, 2, 20, 10), newTexture(texAddr, 4, 4, texture.RGBA, texture.BPP32), image.Point{}, draw.Src)
+	fb.Draw(image.Rect(20, 12, 30, 22), newTexture(texAddr+0x100, 8, 8, texture.RGBA, texture.BPP16), image.Pt(1, 0), draw.Over)
+	fb.Flush()
+
+	// draw.Rdp's output must pass the validator
+	words := rdp.RDP.Commands()
+	cmds, err := disasm.Decode(words)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, issue := range disasm.Validate(cmds) {
+		t.Error(issue)
+	}
+
+	r := New(1 << 20)
+	writeTextures(r.RDRAM)
+	if err := r.Run(words); err != nil {
+		t.Fatal(err)
+	}
+	check(t, r.ColorImage(24), map[image.Point]color.RGBA{
+		{0, 0}: rgb(0, 0, 0xff), {31, 23}: rgb(0, 0, 0xff),
+		{2, 2}: rgb(0x80, 0, 0x7f), {9, 9}: rgb(0x80, 0, 0x7f), {10, 10}: rgb(0, 0, 0xff),
+		{12, 2}: texelA(0, 0), {15, 5}: texelA(3, 3), {16, 2}: rgb(0, 0, 0xff),
+	})
+}
+
+// golden compares img with the test's golden image in testdata.
+func golden(t *testing.T, img *image.RGBA) {
+	path := filepath.Join("testdata", filepath.Base(t.Name())+".png")
+	if *update {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	want, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !want.Bounds().Eq(img.Bounds()) {
+		t.Fatalf("expected size %v, got %v", want.Bounds(), img.Bounds())
+	}
+	for y := range img.Rect.Dy() {
+		for x := range img.Rect.Dx() {
+			if w, g := color.RGBAModel.Convert(want.At(x, y)), img.At(x, y); w != g {
+				t.Fatalf("expected %v at (%d,%d), got %v, see %s", w, x, y, g, path)
+			}
+		}
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	var dl rdp.DisplayList
+	dl.Triangle(0, 0, rdp.Vertex{X: 10, Y: 10}, rdp.Vertex{X: 20, Y: 10}, rdp.Vertex{X: 10, Y: 20})
+	err := New(1 << 20).Run(dl.Commands())
+	if err == nil || err.Error() != "rdpsim: unsupported command TRI_FILL at offset 0x0" {
+		t.Errorf("expected %v, got %v", ErrUnsupported, err)
+	}
+
+	// rdp.DisplayList loads 4-bit textures as 8-bit, so this is encoded by hand
+	err = New(1 << 20).Run([]uint64{0xfd00000f00080000, 0xf580020000000000, 0xf40000000003c000})
+	if err == nil || err.Error() != "rdpsim: unsupported command LOAD_TILE of 4-bit texture image at offset 0x10" {
+		t.Errorf("expected %v, got %v", ErrUnsupported, err)
+	}
+
+	dl.SetColorImage(newTexture(0x2000000, 32, 24, texture.RGBA, texture.BPP32))
+	dl.SetScissor(image.Rect(0, 0, 32, 24), rdp.InterlaceNone)
+	setModes(&dl, 0, rdp.CycleTypeFill, rdp.BlendMode{})
+	dl.FillRectangle(image.Rect(0, 0, 32, 24))
+	err = New(1 << 20).Run(dl.Commands())
+	if err == nil || err.Error() != "rdpsim: address out of range: 0x2000000 at offset 0x28" {
+		t.Errorf("expected %v, got %v", ErrAddress, err)
+	}
+}
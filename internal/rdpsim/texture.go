@@ -0,0 +1,228 @@
+package rdpsim
+
+import "fmt"
+
+// TMEM is organized in 64 bit words.  Words of odd lines are stored with
+// their 32 bit halves swapped.  32 bit texels are split, red and green are
+// stored in the lower half of TMEM, blue and alpha in the upper half.
+const (
+	tmemSize = 4096
+	tmemHalf = tmemSize / 2
+)
+
+func swapped(row uint32) uint32 {
+	return (row & 1) * 4
+}
+
+// loadTile copies a rectangle of the texture image into TMEM and sets the
+// tile size.
+func (r *RDP) loadTile(w uint64) {
+	t := &r.tiles[bits(w, 24, 3)]
+	t.s.lo, t.t.lo, t.s.hi, t.t.hi = bits(w, 44, 12), bits(w, 32, 12), bits(w, 12, 12), bits(w, 0, 12)
+
+	img := r.textureImage
+	if img.size == size4 {
+		r.fail(fmt.Errorf("%w LOAD_TILE of 4-bit texture image", ErrUnsupported))
+		return
+	}
+	sl, tl, sh, th := t.s.lo>>2, t.t.lo>>2, t.s.hi>>2, t.t.hi>>2
+	for y := tl; y <= th; y++ {
+		row := y - tl
+		base := t.addr + row*t.line
+		if img.size == size32 {
+			src := r.rdram(img.addr+(y*img.width+sl)*4, (sh-sl+1)*4)
+			for i := range sh - sl + 1 {
+				a := (base + i*2) ^ swapped(row)
+				r.TMEM[a%tmemHalf] = src[i*4]
+				r.TMEM[(a+1)%tmemHalf] = src[i*4+1]
+				r.TMEM[a%tmemHalf+tmemHalf] = src[i*4+2]
+				r.TMEM[(a+1)%tmemHalf+tmemHalf] = src[i*4+3]
+			}
+			continue
+		}
+
+		bits := uint32(4) << img.size
+		n := ((sh-sl+1)*bits + 7) / 8
+		src := r.rdram(img.addr+(y*img.width+sl)*bits/8, n)
+		for i := range n {
+			r.TMEM[((base+i)^swapped(row))%tmemSize] = src[i]
+		}
+	}
+}
+
+// loadBlock copies consecutive texels of the texture image into TMEM.  The
+// line counter is incremented by dxt per 64 bit word, words of odd lines are
+// swapped.
+func (r *RDP) loadBlock(w uint64) {
+	t := &r.tiles[bits(w, 24, 3)]
+	sl, tl, sh, dxt := bits(w, 44, 12), bits(w, 32, 12), bits(w, 12, 12), bits(w, 0, 12)
+	t.s.lo, t.t.lo, t.s.hi, t.t.hi = sl, tl, sh, dxt // like the hardware does
+
+	img := r.textureImage
+	if sh < sl {
+		return
+	}
+	bytes := ((sh-sl+1)<<img.size*4/8 + 7) &^ 7
+	src := r.rdram(img.addr+(tl*img.width+sl)<<img.size*4/8, bytes)
+	for word := range bytes / 8 {
+		swap := swapped(word * dxt >> 11)
+		if img.size == size32 {
+			for i := range uint32(2) {
+				a := (t.addr + word*4 + i*2) ^ swap
+				texel := src[word*8+i*4:]
+				r.TMEM[a%tmemHalf] = texel[0]
+				r.TMEM[(a+1)%tmemHalf] = texel[1]
+				r.TMEM[a%tmemHalf+tmemHalf] = texel[2]
+				r.TMEM[(a+1)%tmemHalf+tmemHalf] = texel[3]
+			}
+			continue
+		}
+		for i := range uint32(8) {
+			r.TMEM[((t.addr+word*8+i)^swap)%tmemSize] = src[word*8+i]
+		}
+	}
+}
+
+// loadTLUT copies 16 bit palette colors into TMEM.  Each color is stored four
+// times, for the four texels sampled in parallel.
+func (r *RDP) loadTLUT(w uint64) {
+	t := &r.tiles[bits(w, 24, 3)]
+	t.s.lo, t.t.lo, t.s.hi, t.t.hi = bits(w, 44, 12), bits(w, 32, 12), bits(w, 12, 12), bits(w, 0, 12)
+
+	img := r.textureImage
+	sl, tl, sh := t.s.lo>>2, t.t.lo>>2, t.s.hi>>2
+	if sh < sl {
+		return
+	}
+	src := r.rdram(img.addr+(tl*img.width+sl)*2, (sh-sl+1)*2)
+	for i := range sh - sl + 1 {
+		for k := range uint32(4) {
+			a := (t.addr + i*8 + k*2) % tmemSize
+			r.TMEM[a], r.TMEM[a+1] = src[i*2], src[i*2+1]
+		}
+	}
+}
+
+// coord converts a s10.5 texture coordinate to the tile's space, returning
+// the integer texel coordinate and its 5 bit fraction.
+func (a *tileAxis) coord(v int32) (int32, int32) {
+	v -= int32(a.lo) << 3
+	switch {
+	case a.shift == 0:
+	case a.shift <= 10:
+		v >>= a.shift
+	default:
+		v <<= 16 - a.shift
+	}
+	return v >> 5, v & 31
+}
+
+// wrap applies clamping, mirroring and masking to a texel coordinate.
+func (a *tileAxis) wrap(i int32) int32 {
+	if a.clamp || a.mask == 0 {
+		i = min(max(i, 0), int32(a.hi>>2)-int32(a.lo>>2))
+	}
+	if a.mask != 0 {
+		if a.mirror && i&(1<<a.mask) != 0 {
+			i = ^i
+		}
+		i &= 1<<a.mask - 1
+	}
+	return i
+}
+
+// texel samples the tile at s10.5 coordinates.  With filter, three texels
+// are interpolated like the hardware's bilinear filter does.
+func (r *RDP) texel(t *tile, s, tt int32, filter bool) rgba {
+	si, sf := t.s.coord(s)
+	ti, tf := t.t.coord(tt)
+	t00 := r.fetch(t, t.s.wrap(si), t.t.wrap(ti))
+	if !filter {
+		return t00
+	}
+
+	t10 := r.fetch(t, t.s.wrap(si+1), t.t.wrap(ti))
+	t01 := r.fetch(t, t.s.wrap(si), t.t.wrap(ti+1))
+	var out rgba
+	if sf+tf < 32 {
+		for i := range out {
+			out[i] = t00[i] + (sf*(t10[i]-t00[i])+tf*(t01[i]-t00[i])+16)>>5
+		}
+		return out
+	}
+	t11 := r.fetch(t, t.s.wrap(si+1), t.t.wrap(ti+1))
+	for i := range out {
+		out[i] = t11[i] + ((32-sf)*(t01[i]-t11[i])+(32-tf)*(t10[i]-t11[i])+16)>>5
+	}
+	return out
+}
+
+// fetch reads a texel from TMEM and converts it to RGBA.  Like on the
+// hardware, 4 and 8 bit RGBA texels are read as intensity and in TLUT mode
+// all 4 and 8 bit texels are palette indices.
+func (r *RDP) fetch(t *tile, s, tt int32) rgba {
+	base := t.addr + uint32(tt)*t.line
+	swap := swapped(uint32(tt))
+
+	var v uint32
+	switch t.size {
+	case size4:
+		v = uint32(r.TMEM[((base+uint32(s)/2)^swap)%tmemSize])
+		v = v >> (4 - 4*(uint32(s)&1)) & 15
+	case size8:
+		v = uint32(r.TMEM[((base+uint32(s))^swap)%tmemSize])
+	case size16:
+		a := ((base + uint32(s)*2) ^ swap) % tmemSize
+		v = uint32(r.TMEM[a])<<8 | uint32(r.TMEM[a+1])
+	case size32:
+		a := ((base + uint32(s)*2) ^ swap) % tmemHalf
+		v = uint32(r.TMEM[a])<<24 | uint32(r.TMEM[a+1])<<16 |
+			uint32(r.TMEM[a+tmemHalf])<<8 | uint32(r.TMEM[a+tmemHalf+1])
+	}
+
+	if r.otherModes&tlut != 0 && t.size <= size8 {
+		if t.size == size4 {
+			v |= t.palette << 4
+		}
+		a := tmemHalf + v*8
+		v = uint32(r.TMEM[a])<<8 | uint32(r.TMEM[a+1])
+		if r.otherModes&tlutType != 0 {
+			return ia16(v)
+		}
+		return rgba16(v)
+	}
+
+	switch t.format<<2 | t.size {
+	case fmtRGBA<<2 | size16:
+		return rgba16(v)
+	case fmtRGBA<<2 | size32:
+		return rgba{int32(v >> 24), int32(v >> 16 & 0xff), int32(v >> 8 & 0xff), int32(v & 0xff)}
+	case fmtIA<<2 | size16:
+		return ia16(v)
+	case fmtIA<<2 | size8:
+		i, a := int32(v>>4)*0x11, int32(v&15)*0x11
+		return rgba{i, i, i, a}
+	case fmtIA<<2 | size4:
+		i := int32(v >> 1)
+		i = i<<5 | i<<2 | i>>1
+		return rgba{i, i, i, int32(v&1) * 0xff}
+	case fmtI<<2 | size8, fmtRGBA<<2 | size8:
+		i := int32(v)
+		return rgba{i, i, i, i}
+	case fmtI<<2 | size4, fmtRGBA<<2 | size4:
+		i := int32(v) * 0x11
+		return rgba{i, i, i, i}
+	}
+	r.fail(fmt.Errorf("%w texture format %d size %d", ErrUnsupported, t.format, t.size))
+	return rgba{}
+}
+
+func rgba16(v uint32) rgba {
+	c := rgba{int32(v >> 11 & 31), int32(v >> 6 & 31), int32(v >> 1 & 31), int32(v&1) * 0xff}
+	return rgba{c[0]<<3 | c[0]>>2, c[1]<<3 | c[1]>>2, c[2]<<3 | c[2]>>2, c[3]}
+}
+
+func ia16(v uint32) rgba {
+	i, a := int32(v>>8), int32(v&0xff)
+	return rgba{i, i, i, a}
+}
@@ -0,0 +1,263 @@
+// Package rspsim interprets RSP microcode on the host, which allows testing
+// microcode without hardware.  It implements the scalar unit, the vector unit
+// and the DMA engine as far as needed for the microcode in this module.
+// Timing, interrupts and the RDP command interface are not emulated.
+package rspsim
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const memSize = 0x1000
+
+var (
+	ErrTimeout     = errors.New("rspsim: step limit exceeded")
+	ErrUnsupported = errors.New("rspsim: unsupported instruction")
+)
+
+// RSP is the state of a simulated RSP and the RDRAM it can access via DMA.
+type RSP struct {
+	IMEM  [memSize]byte
+	DMEM  [memSize]byte
+	RDRAM []byte
+
+	PC  uint32
+	GPR [32]uint32
+
+	vpr [32][8]uint16
+	acc [8]uint64 // 48 bit
+	vco uint16
+	vcc uint16
+	vce uint8
+	div struct {
+		in, out int16
+		dp      bool
+	}
+	next uint32 // address of the next instruction, for delay slots
+
+	dmaMem, dmaDRAM uint32
+}
+
+// New returns an RSP with the given amount of RDRAM.
+func New(rdramSize int) *RSP {
+	return &RSP{RDRAM: make([]byte, rdramSize)}
+}
+
+// Run executes instructions starting at PC until a break instruction is
+// reached or maxSteps instructions were executed.
+func (r *RSP) Run(maxSteps int) error {
+	r.next = r.PC + 4
+	for range maxSteps {
+		pc := r.PC & 0xffc
+		instr := binary.BigEndian.Uint32(r.IMEM[pc:])
+		r.PC, r.next = r.next&0xffc, r.next+4
+		if instr&0xfc00003f == 0x0000000d { // break
+			r.PC = (pc + 4) & 0xffc
+			return nil
+		}
+		if err := r.step(pc, instr); err != nil {
+			return fmt.Errorf("%w %08x at %03x", err, instr, pc)
+		}
+		r.GPR[0] = 0
+	}
+	return ErrTimeout
+}
+
+// V returns the lanes of vector register n.
+func (r *RSP) V(n int) [8]uint16 {
+	return r.vpr[n]
+}
+
+func sext16(v uint32) uint32 { return uint32(int32(int16(v))) }
+
+func (r *RSP) jump(target uint32) {
+	r.next = target & 0xffc
+}
+
+func (r *RSP) branch(pc, instr uint32, cond bool) {
+	if cond {
+		r.jump(pc + 4 + sext16(instr)<<2)
+	}
+}
+
+func (r *RSP) step(pc, instr uint32) error {
+	op := instr >> 26
+	rs, rt := instr>>21&31, instr>>16&31
+	rd, sa := instr>>11&31, instr>>6&31
+	imm := sext16(instr)
+	s, t := r.GPR[rs], r.GPR[rt]
+
+	switch op {
+	case 0x00:
+		switch instr & 0x3f {
+		case 0x00:
+			r.GPR[rd] = t << sa
+		case 0x02:
+			r.GPR[rd] = t >> sa
+		case 0x03:
+			r.GPR[rd] = uint32(int32(t) >> sa)
+		case 0x04:
+			r.GPR[rd] = t << (s & 31)
+		case 0x06:
+			r.GPR[rd] = t >> (s & 31)
+		case 0x07:
+			r.GPR[rd] = uint32(int32(t) >> (s & 31))
+		case 0x08:
+			r.jump(s)
+		case 0x09:
+			r.GPR[rd] = pc + 8
+			r.jump(s)
+		case 0x20, 0x21:
+			r.GPR[rd] = s + t
+		case 0x22, 0x23:
+			r.GPR[rd] = s - t
+		case 0x24:
+			r.GPR[rd] = s & t
+		case 0x25:
+			r.GPR[rd] = s | t
+		case 0x26:
+			r.GPR[rd] = s ^ t
+		case 0x27:
+			r.GPR[rd] = ^(s | t)
+		case 0x2a:
+			r.GPR[rd] = b2u(int32(s) < int32(t))
+		case 0x2b:
+			r.GPR[rd] = b2u(s < t)
+		default:
+			return ErrUnsupported
+		}
+	case 0x01:
+		if rt&0x10 != 0 {
+			r.GPR[31] = pc + 8
+		}
+		switch rt & 0xf {
+		case 0x00:
+			r.branch(pc, instr, int32(s) < 0)
+		case 0x01:
+			r.branch(pc, instr, int32(s) >= 0)
+		default:
+			return ErrUnsupported
+		}
+	case 0x02:
+		r.jump(instr << 2)
+	case 0x03:
+		r.GPR[31] = pc + 8
+		r.jump(instr << 2)
+	case 0x04:
+		r.branch(pc, instr, s == t)
+	case 0x05:
+		r.branch(pc, instr, s != t)
+	case 0x06:
+		r.branch(pc, instr, int32(s) <= 0)
+	case 0x07:
+		r.branch(pc, instr, int32(s) > 0)
+	case 0x08, 0x09:
+		r.GPR[rt] = s + imm
+	case 0x0a:
+		r.GPR[rt] = b2u(int32(s) < int32(imm))
+	case 0x0b:
+		r.GPR[rt] = b2u(s < imm)
+	case 0x0c:
+		r.GPR[rt] = s & (instr & 0xffff)
+	case 0x0d:
+		r.GPR[rt] = s | (instr & 0xffff)
+	case 0x0e:
+		r.GPR[rt] = s ^ (instr & 0xffff)
+	case 0x0f:
+		r.GPR[rt] = instr << 16
+	case 0x10:
+		return r.cop0(rs, rt, rd)
+	case 0x12:
+		return r.cop2(instr)
+	case 0x20:
+		r.GPR[rt] = uint32(int32(int8(r.load8(s + imm))))
+	case 0x21:
+		r.GPR[rt] = sext16(uint32(r.load8(s+imm))<<8 | uint32(r.load8(s+imm+1)))
+	case 0x23:
+		r.GPR[rt] = uint32(r.load8(s+imm))<<24 | uint32(r.load8(s+imm+1))<<16 |
+			uint32(r.load8(s+imm+2))<<8 | uint32(r.load8(s+imm+3))
+	case 0x24:
+		r.GPR[rt] = uint32(r.load8(s + imm))
+	case 0x25:
+		r.GPR[rt] = uint32(r.load8(s+imm))<<8 | uint32(r.load8(s+imm+1))
+	case 0x28:
+		r.store8(s+imm, byte(t))
+	case 0x29:
+		r.store8(s+imm, byte(t>>8))
+		r.store8(s+imm+1, byte(t))
+	case 0x2b:
+		for i := range uint32(4) {
+			r.store8(s+imm+i, byte(t>>(24-8*i)))
+		}
+	case 0x32:
+		return r.loadVector(instr)
+	case 0x3a:
+		return r.storeVector(instr)
+	default:
+		return ErrUnsupported
+	}
+	return nil
+}
+
+func b2u(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (r *RSP) load8(addr uint32) byte     { return r.DMEM[addr&0xfff] }
+func (r *RSP) store8(addr uint32, v byte) { r.DMEM[addr&0xfff] = v }
+
+// cop0 implements the DMA registers.  DMA transfers complete immediately.
+func (r *RSP) cop0(rs, rt, rd uint32) error {
+	switch rs {
+	case 0: // mfc0
+		switch rd {
+		case 0:
+			r.GPR[rt] = r.dmaMem
+		case 1:
+			r.GPR[rt] = r.dmaDRAM
+		default: // status, DMA full, DMA busy and semaphore read as zero
+			r.GPR[rt] = 0
+		}
+	case 4: // mtc0
+		v := r.GPR[rt]
+		switch rd {
+		case 0:
+			r.dmaMem = v & 0x1ff8
+		case 1:
+			r.dmaDRAM = v & 0xfffff8
+		case 2, 3:
+			return r.dma(v, rd == 3)
+		}
+	default:
+		return ErrUnsupported
+	}
+	return nil
+}
+
+func (r *RSP) dma(length uint32, write bool) error {
+	n := (length&0xfff | 7) + 1
+	if length>>12 != 0 {
+		return fmt.Errorf("rspsim: strided DMA %08x", length)
+	}
+	mem := r.DMEM[:]
+	if r.dmaMem&0x1000 != 0 {
+		mem = r.IMEM[:]
+	}
+	for i := range n {
+		m := (r.dmaMem + i) & 0xfff
+		d := (r.dmaDRAM + i) % uint32(len(r.RDRAM))
+		if write {
+			r.RDRAM[d] = mem[m]
+		} else {
+			mem[m] = r.RDRAM[d]
+		}
+	}
+	r.dmaMem = r.dmaMem&0x1000 | (r.dmaMem+n)&0xfff
+	r.dmaDRAM += n
+	return nil
+}
@@ -0,0 +1,407 @@
+package rspsim
+
+import "math/bits"
+
+// reciprocals is the ROM used by VRCP, which holds the fraction of 1/x for
+// x in [1, 2) with 16 bits of precision.
+var reciprocals [512]uint16
+
+func init() {
+	for i := range reciprocals {
+		v := ((uint64(1)<<34)/uint64(i+512) + 1) >> 8
+		reciprocals[i] = uint16(min(v, 0x1ffff))
+	}
+}
+
+func (r *RSP) byteOf(v int, i uint32) byte {
+	lane := r.vpr[v][i/2&7]
+	if i&1 == 0 {
+		return byte(lane >> 8)
+	}
+	return byte(lane)
+}
+
+func (r *RSP) setByte(v int, i uint32, b byte) {
+	lane := &r.vpr[v][i/2&7]
+	if i&1 == 0 {
+		*lane = *lane&0x00ff | uint16(b)<<8
+	} else {
+		*lane = *lane&0xff00 | uint16(b)
+	}
+}
+
+// elements returns vt with the element selector e applied, which broadcasts
+// lanes to halves, quarters or the whole vector.
+func (r *RSP) elements(vt int, e uint32) (out [8]uint16) {
+	for i := range uint32(8) {
+		switch {
+		case e < 2:
+			out[i] = r.vpr[vt][i]
+		case e < 4:
+			out[i] = r.vpr[vt][i&^1+e-2]
+		case e < 8:
+			out[i] = r.vpr[vt][i&^3+e-4]
+		default:
+			out[i] = r.vpr[vt][e-8]
+		}
+	}
+	return out
+}
+
+const accMask = 1<<48 - 1
+
+func (r *RSP) accGet(i int) int64 {
+	return int64(r.acc[i]<<16) >> 16
+}
+
+func (r *RSP) accSet(i int, v int64) {
+	r.acc[i] = uint64(v) & accMask
+}
+
+func (r *RSP) accLo(i int) uint16 { return uint16(r.acc[i]) }
+func (r *RSP) accMd(i int) uint16 { return uint16(r.acc[i] >> 16) }
+func (r *RSP) accHi(i int) uint16 { return uint16(r.acc[i] >> 32) }
+
+func clamp16(v int64) uint16 {
+	return uint16(max(min(v, 0x7fff), -0x8000))
+}
+
+// clampSigned returns the middle of the accumulator, clamped to 16 bits.
+func (r *RSP) clampSigned(i int) uint16 {
+	return clamp16(r.accGet(i) >> 16)
+}
+
+// clampLow returns the low part of the accumulator, or zero or 0xffff if
+// the upper 32 bits exceed 16 bits.
+func (r *RSP) clampLow(i int) uint16 {
+	switch v := r.accGet(i) >> 16; {
+	case v < -0x8000:
+		return 0
+	case v > 0x7fff:
+		return 0xffff
+	}
+	return r.accLo(i)
+}
+
+func (r *RSP) cop2(instr uint32) error {
+	rt := instr >> 16 & 31
+	if instr&(1<<25) == 0 {
+		v, e := int(instr>>11&31), instr>>7&15
+		switch instr >> 21 & 31 {
+		case 0: // mfc2
+			r.GPR[rt] = sext16(uint32(r.byteOf(v, e))<<8 | uint32(r.byteOf(v, e+1&15)))
+		case 2: // cfc2
+			switch v & 3 {
+			case 0:
+				r.GPR[rt] = sext16(uint32(r.vco))
+			case 1:
+				r.GPR[rt] = sext16(uint32(r.vcc))
+			default:
+				r.GPR[rt] = uint32(r.vce)
+			}
+		case 4: // mtc2
+			r.setByte(v, e, byte(r.GPR[rt]>>8))
+			if e < 15 {
+				r.setByte(v, e+1, byte(r.GPR[rt]))
+			}
+		case 6: // ctc2
+			switch v & 3 {
+			case 0:
+				r.vco = uint16(r.GPR[rt])
+			case 1:
+				r.vcc = uint16(r.GPR[rt])
+			default:
+				r.vce = uint8(r.GPR[rt])
+			}
+		default:
+			return ErrUnsupported
+		}
+		return nil
+	}
+
+	e := instr >> 21 & 15
+	vs, vd := int(instr>>11&31), int(instr>>6&31)
+	vt := r.elements(int(rt), e)
+	a := r.vpr[vs]
+	var res [8]uint16
+
+	switch funct := instr & 0x3f; funct {
+	case 0x00, 0x08: // vmulf, vmacf
+		for i := range 8 {
+			p := int64(int16(a[i])) * int64(int16(vt[i])) * 2
+			if funct == 0x00 {
+				r.accSet(i, p+0x8000)
+			} else {
+				r.accSet(i, r.accGet(i)+p)
+			}
+			res[i] = r.clampSigned(i)
+		}
+	case 0x04, 0x0c: // vmudl, vmadl
+		for i := range 8 {
+			p := int64(uint32(a[i]) * uint32(vt[i]) >> 16)
+			if funct == 0x0c {
+				p += r.accGet(i)
+			}
+			r.accSet(i, p)
+			res[i] = r.clampLow(i)
+		}
+	case 0x05, 0x0d: // vmudm, vmadm
+		for i := range 8 {
+			p := int64(int16(a[i])) * int64(vt[i])
+			if funct == 0x0d {
+				p += r.accGet(i)
+			}
+			r.accSet(i, p)
+			res[i] = r.clampSigned(i)
+		}
+	case 0x06, 0x0e: // vmudn, vmadn
+		for i := range 8 {
+			p := int64(a[i]) * int64(int16(vt[i]))
+			if funct == 0x0e {
+				p += r.accGet(i)
+			}
+			r.accSet(i, p)
+			res[i] = r.clampLow(i)
+		}
+	case 0x07, 0x0f: // vmudh, vmadh
+		for i := range 8 {
+			p := int64(int16(a[i])) * int64(int16(vt[i])) << 16
+			if funct == 0x0f {
+				p += r.accGet(i)
+			}
+			r.accSet(i, p)
+			res[i] = r.clampSigned(i)
+		}
+	case 0x10, 0x11: // vadd, vsub
+		for i := range 8 {
+			carry := int64(r.vco >> i & 1)
+			v := int64(int16(a[i])) + int64(int16(vt[i])) + carry
+			if funct == 0x11 {
+				v = int64(int16(a[i])) - int64(int16(vt[i])) - carry
+			}
+			r.acc[i] = r.acc[i]&^0xffff | uint64(uint16(v))
+			res[i] = clamp16(v)
+		}
+		r.vco = 0
+	case 0x13: // vabs
+		for i := range 8 {
+			switch s := int16(a[i]); {
+			case s < 0:
+				res[i] = -vt[i]
+				r.acc[i] = r.acc[i]&^0xffff | uint64(res[i])
+				if vt[i] == 0x8000 {
+					res[i] = 0x7fff
+				}
+			case s > 0:
+				res[i] = vt[i]
+				r.acc[i] = r.acc[i]&^0xffff | uint64(res[i])
+			default:
+				r.acc[i] &^= 0xffff
+			}
+		}
+	case 0x14, 0x15: // vaddc, vsubc
+		r.vco = 0
+		for i := range 8 {
+			v := int32(a[i]) + int32(vt[i])
+			if funct == 0x15 {
+				v = int32(a[i]) - int32(vt[i])
+				if v != 0 {
+					r.vco |= 1 << (i + 8)
+				}
+				if v < 0 {
+					r.vco |= 1 << i
+				}
+			} else if v > 0xffff {
+				r.vco |= 1 << i
+			}
+			res[i] = uint16(v)
+			r.acc[i] = r.acc[i]&^0xffff | uint64(res[i])
+		}
+	case 0x1d: // vsar
+		for i := range 8 {
+			switch e {
+			case 8:
+				res[i] = r.accHi(i)
+			case 9:
+				res[i] = r.accMd(i)
+			case 10:
+				res[i] = r.accLo(i)
+			}
+		}
+	case 0x20, 0x21, 0x22, 0x23: // vlt, veq, vne, vge
+		r.vcc = 0
+		for i := range 8 {
+			s, t := int16(a[i]), int16(vt[i])
+			eq := r.vco>>(i+8)&1 == 0 || r.vco>>i&1 == 0
+			var cond bool
+			switch funct {
+			case 0x20:
+				cond = s < t || (s == t && !eq)
+			case 0x21:
+				cond = s == t && r.vco>>(i+8)&1 == 0
+			case 0x22:
+				cond = s != t || r.vco>>(i+8)&1 != 0
+			case 0x23:
+				cond = s > t || (s == t && eq)
+			}
+			res[i] = vt[i]
+			if cond {
+				r.vcc |= 1 << i
+				if funct != 0x21 {
+					res[i] = a[i]
+				}
+			}
+			r.acc[i] = r.acc[i]&^0xffff | uint64(res[i])
+		}
+		r.vco = 0
+	case 0x27: // vmrg
+		for i := range 8 {
+			res[i] = vt[i]
+			if r.vcc>>i&1 != 0 {
+				res[i] = a[i]
+			}
+			r.acc[i] = r.acc[i]&^0xffff | uint64(res[i])
+		}
+		r.vco = 0
+	case 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d: // vand, vnand, vor, vnor, vxor, vnxor
+		for i := range 8 {
+			switch funct {
+			case 0x28:
+				res[i] = a[i] & vt[i]
+			case 0x29:
+				res[i] = ^(a[i] & vt[i])
+			case 0x2a:
+				res[i] = a[i] | vt[i]
+			case 0x2b:
+				res[i] = ^(a[i] | vt[i])
+			case 0x2c:
+				res[i] = a[i] ^ vt[i]
+			case 0x2d:
+				res[i] = ^(a[i] ^ vt[i])
+			}
+			r.acc[i] = r.acc[i]&^0xffff | uint64(res[i])
+		}
+	case 0x30, 0x31: // vrcp, vrcpl
+		src := r.vpr[rt][e&7]
+		input := int32(int16(src))
+		if funct == 0x31 && r.div.dp {
+			input = int32(r.div.in)<<16 | int32(src)
+		}
+		result := reciprocal(input)
+		r.div.dp = false
+		r.div.out = int16(result >> 16)
+		r.singleLane(vd, vs, vt, uint16(result))
+		return nil
+	case 0x32: // vrcph
+		r.div.in = int16(r.vpr[rt][e&7])
+		r.div.dp = true
+		r.singleLane(vd, vs, vt, uint16(r.div.out))
+		return nil
+	case 0x33: // vmov
+		r.singleLane(vd, vs, vt, vt[vs&7])
+		return nil
+	case 0x37: // vnop
+		return nil
+	default:
+		return ErrUnsupported
+	}
+
+	r.vpr[vd] = res
+	return nil
+}
+
+// singleLane writes v to lane de of vd, which is encoded in the vs field.
+// The low accumulator receives the selected elements of vt.
+func (r *RSP) singleLane(vd, de int, vt [8]uint16, v uint16) {
+	for i := range 8 {
+		r.acc[i] = r.acc[i]&^0xffff | uint64(vt[i])
+	}
+	r.vpr[vd][de&7] = v
+}
+
+// reciprocal returns 2^31/input with the precision of the reciprocal ROM.
+func reciprocal(input int32) int32 {
+	mask := input >> 31
+	data := input ^ mask
+	if input > -32768 {
+		data -= mask
+	}
+	switch {
+	case data == 0:
+		return 0x7fffffff
+	case input == -32768:
+		return -0x10000
+	}
+	shift := bits.LeadingZeros32(uint32(data))
+	index := (uint64(data) << shift & 0x7fc00000) >> 22
+	result := int32(0x10000|uint32(reciprocals[index])) << 14
+	return result>>(31-shift) ^ mask
+}
+
+func (r *RSP) loadVector(instr uint32) error {
+	base, vt := instr>>21&31, int(instr>>16&31)
+	opcode, e := instr>>11&31, instr>>7&15
+	offset := uint32(int32(instr<<25) >> 25)
+
+	switch opcode {
+	case 0, 1, 2, 3, 4: // lbv, lsv, llv, ldv, lqv
+		size := uint32(1) << opcode
+		addr := r.GPR[base] + offset*size
+		n := size
+		if opcode == 4 {
+			n = 16 - addr&15
+		}
+		for i := range n {
+			if e+i < 16 {
+				r.setByte(vt, e+i, r.load8(addr+i))
+			}
+		}
+	case 6, 7: // lpv, luv
+		addr := r.GPR[base] + offset*8
+		shift := 8
+		if opcode == 7 {
+			shift = 7
+		}
+		for i := range uint32(8) {
+			b := r.load8(addr&^7 + (addr&7-e+i)&15)
+			r.vpr[vt][i] = uint16(b) << shift
+		}
+	default:
+		return ErrUnsupported
+	}
+	return nil
+}
+
+func (r *RSP) storeVector(instr uint32) error {
+	base, vt := instr>>21&31, int(instr>>16&31)
+	opcode, e := instr>>11&31, instr>>7&15
+	offset := uint32(int32(instr<<25) >> 25)
+
+	switch opcode {
+	case 0, 1, 2, 3, 4: // sbv, ssv, slv, sdv, sqv
+		size := uint32(1) << opcode
+		addr := r.GPR[base] + offset*size
+		n := size
+		if opcode == 4 {
+			n = 16 - addr&15
+		}
+		for i := range n {
+			r.store8(addr+i, r.byteOf(vt, (e+i)&15))
+		}
+	case 6, 7: // spv, suv
+		if e != 0 {
+			return ErrUnsupported
+		}
+		addr := r.GPR[base] + offset*8
+		shift := 8
+		if opcode == 7 {
+			shift = 7
+		}
+		for i := range uint32(8) {
+			r.store8(addr+i, byte(r.vpr[vt][i]>>shift))
+		}
+	default:
+		return ErrUnsupported
+	}
+	return nil
+}
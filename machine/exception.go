@@ -30,12 +30,14 @@ func Exception(cause, epc, status, badvaddr, ra uint64) {
 	DefaultWrite(0, itoa(buf[:], cause))
 	DefaultWrite(0, []byte("\nepc      0x"))
 	DefaultWrite(0, itoa(buf[:], epc))
+	printSymbol(epc)
 	DefaultWrite(0, []byte("\nstatus   0x"))
 	DefaultWrite(0, itoa(buf[:], status))
 	DefaultWrite(0, []byte("\nbadvaddr 0x"))
 	DefaultWrite(0, itoa(buf[:], badvaddr))
 	DefaultWrite(0, []byte("\nra       0x"))
 	DefaultWrite(0, itoa(buf[:], ra))
+	printSymbol(ra)
 	DefaultWrite(0, []byte("\n"))
 }
 
@@ -21,6 +21,12 @@ TEXT _rt0_mips64_noos(SB),NOSPLIT|NOFRAME,$0
 	MOVW $8, R2
 	MOVW R2, (0xbfc007fc) // trigger PIF command 'terminate boot process'
 
+	// Programs compressed by mkrom are loaded entirely by its boot stage,
+	// which is flagged in bit 0 of the reserved ROM header word at 0x1c.
+	MOVW (0xb000001c), R9
+	AND  $1, R9
+	BGTZ R9, wait_dma_end
+
 	// Check if PI DMA transfer is required, knowing that IPL3 loads 1 MiB
 	// of ROM to RAM.
 	MOVW $_rt0_mips64_noos(SB), R4
@@ -0,0 +1,176 @@
+package machine
+
+import (
+	"runtime"
+	"runtime/debug"
+	"unsafe"
+
+	"github.com/drpaneas/n64/debug/symtab"
+	"github.com/drpaneas/n64/rcp/cpu"
+	"github.com/drpaneas/n64/rcp/periph"
+)
+
+const romBase uintptr = cpu.KSEG1 | 0x1000_0000
+
+// romSymbols reads the symbol table appended to the ROM by mkrom -symbols.
+// The ROM header word at 0x1c holds its offset in the upper bits.
+type romSymbols struct {
+	base uintptr
+}
+
+var symbols romSymbols
+
+func init() {
+	// Only from this level on the runtime prints the pc of each frame in
+	// tracebacks, which traceSymbol needs to symbolize them.  Without a
+	// symbol table the default level is kept.
+	if findSymbols() {
+		debug.SetTraceback("system")
+	}
+}
+
+//go:nosplit
+func (t *romSymbols) Word(off uint32) uint32 {
+	return (*periph.U32)(unsafe.Pointer(t.base + uintptr(off))).LoadSafe()
+}
+
+// findSymbols locates the symbol table and reports whether it is valid.
+//
+//go:nosplit
+func findSymbols() bool {
+	off := (*periph.U32)(unsafe.Pointer(romBase+0x1c)).LoadSafe() &^ 0xf
+	if off == 0 {
+		return false
+	}
+	symbols.base = romBase + uintptr(off)
+	return symtab.Valid(&symbols)
+}
+
+//go:nosplit
+func lookupSymbol(pc uint64) (symtab.Frame, bool) {
+	if !findSymbols() {
+		return symtab.Frame{}, false
+	}
+	// Code runs mapped at 0x0 or, before rt0 set up the TLB, in KSEG0
+	return symtab.Lookup(&symbols, uint32(pc)&0x1fff_ffff)
+}
+
+// Symbolize returns the function, file and line of pc, if the ROM has a symbol
+// table.  The file is empty and the line zero if the table has no line
+// information.
+func Symbolize(pc uintptr) (function, file string, line int, ok bool) {
+	f, ok := lookupSymbol(uint64(pc))
+	if !ok {
+		return "", "", 0, false
+	}
+	return readSymbol(f.Func), readSymbol(f.File), f.Line, true
+}
+
+func readSymbol(s symtab.String) string {
+	buf := make([]byte, s.Len)
+	return string(buf[:symtab.ReadString(&symbols, s, buf)])
+}
+
+// PrintStack writes the symbolized frames of the calling goroutine to
+// DefaultWrite.  Panics and fatal errors don't need it, their tracebacks are
+// symbolized by DefaultWrite.
+func PrintStack() {
+	var pcs [32]uintptr
+	var buf [16]byte
+	n := runtime.Callers(2, pcs[:])
+	for _, pc := range pcs[:n] {
+		DefaultWrite(0, []byte("0x"))
+		DefaultWrite(0, itoa(buf[:], uint64(pc)))
+		printSymbol(uint64(pc - 1)) // return address points after the call
+		DefaultWrite(0, []byte("\n"))
+	}
+}
+
+// trace follows the runtime's traceback output, which prints the pc of a
+// frame as " pc=", followed by the address in hex and the end of the line.
+var trace struct {
+	next    bool // the runtime printed " pc=", the address follows
+	pending bool // pc is symbolized at the end of the line
+	pc      uint64
+}
+
+// traceSymbol appends the symbol of each frame's pc to a traceback, before p
+// is written.
+//
+//go:nosplit
+func traceSymbol(p []byte) {
+	switch {
+	case trace.next:
+		trace.next = false
+		trace.pc, trace.pending = parseHex(p)
+	case string(p) == " pc=":
+		trace.next = true
+	case trace.pending && len(p) > 0 && p[0] == '\n':
+		trace.pending = false
+		printSymbol(trace.pc - 1) // return address points after the call
+	}
+}
+
+//go:nosplit
+func parseHex(p []byte) (v uint64, ok bool) {
+	if len(p) < 3 || p[0] != '0' || p[1] != 'x' {
+		return 0, false
+	}
+	for _, c := range p[2:] {
+		switch {
+		case c >= '0' && c <= '9':
+			c -= '0'
+		case c >= 'a' && c <= 'f':
+			c -= 'a' - 10
+		default:
+			return 0, false
+		}
+		v = v<<4 | uint64(c)
+	}
+	return v, true
+}
+
+// printSymbol writes " function (file:line)" of pc, if the ROM has a symbol
+// table.
+//
+//go:nosplit
+func printSymbol(pc uint64) {
+	f, ok := lookupSymbol(pc)
+	if !ok {
+		return
+	}
+	DefaultWrite(0, []byte(" "))
+	printROMString(f.Func)
+	if f.Line != 0 {
+		var buf [10]byte
+		DefaultWrite(0, []byte(" ("))
+		printROMString(f.File)
+		DefaultWrite(0, []byte(":"))
+		DefaultWrite(0, utoa(buf[:], uint32(f.Line)))
+		DefaultWrite(0, []byte(")"))
+	}
+}
+
+//go:nosplit
+func printROMString(s symtab.String) {
+	var buf [32]byte
+	for s.Len > 0 {
+		n := symtab.ReadString(&symbols, s, buf[:])
+		DefaultWrite(0, buf[:n])
+		s.Off += uint32(n)
+		s.Len -= uint32(n)
+	}
+}
+
+//go:nosplit
+func utoa(buf []byte, num uint32) []byte {
+	i := len(buf)
+	for {
+		i--
+		buf[i] = byte('0' + num%10)
+		num /= 10
+		if num == 0 {
+			return buf[i:]
+		}
+	}
+}
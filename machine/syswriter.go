@@ -30,6 +30,8 @@ type registers struct {
 //go:nosplit
 //go:linkname DefaultWrite runtime.defaultWrite
 func DefaultWrite(fd int, p []byte) int {
+	traceSymbol(p)
+
 	written := len(p)
 	for len(p) > 0 {
 		n := len(p)
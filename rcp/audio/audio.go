@@ -0,0 +1,109 @@
+// The audio interface fetches PCM samples from RDRAM via DMA and feeds them to
+// the audio DAC.  Samples are 16-bit signed big endian, interleaved stereo.
+// The DAC has a two entry DMA FIFO, which raises the audio interrupt each time
+// playback of a buffer starts.
+package audio
+
+// Clock rates of the video DAC in Hz.  The audio DAC derives its sample rate
+// from it, so it depends on the console's video type.
+const (
+	clockNTSC = 48_681_812
+	clockPAL  = 49_656_530
+	clockMPAL = 48_628_316
+)
+
+// Indexed by machine.VideoType
+var clocks = [...]int{
+	0: clockPAL,
+	1: clockNTSC,
+	2: clockMPAL,
+}
+
+const (
+	minDACRate = 132
+	maxBitRate = 16
+)
+
+// rates calculates the register values for the DAC rate and bit rate to
+// achieve a sample rate of freq at the given video clock.  Returns the actual
+// sample rate, which might differ slightly from freq due to integer division.
+func rates(clock, freq int) (dacRate, bitRate uint32, actual int) {
+	div := (2*clock/freq + 1) / 2 // round to nearest
+	div = max(div, minDACRate)
+	bits := min(div/66, maxBitRate)
+
+	return uint32(div - 1), uint32(bits - 1), clock / div
+}
+
+// dac is the interface to the DMA FIFO of the audio interface.
+type dac interface {
+	full() bool         // true if no more buffers can be enqueued
+	busy() bool         // true if a buffer is playing
+	enqueue(buf []byte) // hands buf to the DMA FIFO
+}
+
+// source provides the next buffer to be played.  It's implemented by
+// rcp.IntrQueue.
+type source interface {
+	Pop() (*[]byte, bool)
+}
+
+// intrMask masks the audio interrupt.
+type intrMask interface {
+	enable()
+	disable()
+}
+
+// fifo tracks buffers that were handed to the DAC's DMA FIFO.  Buffers are
+// played in order, so it's enough to count them.
+type fifo struct {
+	queued  int // buffers handed to the DAC and not yet released
+	started int // queued buffers which started playback
+}
+
+// start must be called on each audio interrupt, i.e. whenever the DAC starts
+// playback of a buffer.
+//
+//go:nosplit
+func (f *fifo) start() {
+	f.started = min(f.started+1, f.queued)
+}
+
+// feed releases all buffers which finished playback and refills the DAC with
+// buffers from src.  Returns the number of released buffers.
+//
+//go:nosplit
+func (f *fifo) feed(d dac, src source) (released int) {
+	if !d.busy() { // all queued buffers have been played
+		f.started = f.queued
+		released = f.queued
+	} else if f.started > 1 { // playback of a later buffer has started
+		released = f.started - 1
+	}
+	f.queued -= released
+	f.started -= released
+
+	for f.queued < 2 && !d.full() {
+		buf, ok := src.Pop()
+		if !ok {
+			break
+		}
+		d.enqueue(*buf)
+		f.queued += 1
+	}
+
+	return
+}
+
+// kick refills the DAC if it ran dry, without a buffer playing no interrupt
+// will be triggered to do that.  The interrupt is masked while doing so and
+// only unmasked afterwards if playback is started, so writing after Stop
+// doesn't enable it again.  Returns the number of released buffers.
+func (f *fifo) kick(d dac, src source, m intrMask, started bool) (released int) {
+	m.disable()
+	released = f.feed(d, src)
+	if started {
+		m.enable()
+	}
+	return
+}
@@ -0,0 +1,220 @@
+package audio
+
+import (
+	"testing"
+)
+
+func TestRates(t *testing.T) {
+	// Expected values were calculated the same way as libultra's
+	// osAiSetFrequency does.
+	tests := map[string]struct {
+		clock, freq      int
+		dacRate, bitRate uint32
+		actual           int
+	}{
+		"NTSC44100":  {clocks[1], 44100, 1103, 15, 44095},
+		"NTSC32000":  {clocks[1], 32000, 1520, 15, 32006},
+		"NTSC22050":  {clocks[1], 22050, 2207, 15, 22047},
+		"PAL44100":   {clocks[0], 44100, 1125, 15, 44099},
+		"PAL32000":   {clocks[0], 32000, 1551, 15, 31995},
+		"PAL22050":   {clocks[0], 22050, 2251, 15, 22049},
+		"MPAL44100":  {clocks[2], 44100, 1102, 15, 44087},
+		"MPAL32000":  {clocks[2], 32000, 1519, 15, 31992},
+		"MPAL22050":  {clocks[2], 22050, 2204, 15, 22053},
+		"MinDACRate": {clocks[1], 1000000, 131, 1, 368801},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			dacRate, bitRate, actual := rates(tc.clock, tc.freq)
+			if dacRate != tc.dacRate {
+				t.Errorf("dacRate: expected %v, got %v", tc.dacRate, dacRate)
+			}
+			if bitRate != tc.bitRate {
+				t.Errorf("bitRate: expected %v, got %v", tc.bitRate, bitRate)
+			}
+			if actual != tc.actual {
+				t.Errorf("sample rate: expected %v, got %v", tc.actual, actual)
+			}
+		})
+	}
+}
+
+// Emulates the two entry DMA FIFO of the audio interface.
+type fakeDAC struct {
+	pending [][]byte // pending[0] is playing if len(pending) > 0
+	intr    int      // number of raised interrupts
+}
+
+func (d *fakeDAC) full() bool { return len(d.pending) >= 2 }
+func (d *fakeDAC) busy() bool { return len(d.pending) > 0 }
+
+func (d *fakeDAC) enqueue(buf []byte) {
+	if d.full() {
+		panic("enqueue on full fifo")
+	}
+	d.pending = append(d.pending, buf)
+	if len(d.pending) == 1 {
+		d.intr += 1 // playback starts immediately
+	}
+}
+
+// finish ends playback of the current buffer.
+func (d *fakeDAC) finish() {
+	d.pending = d.pending[1:]
+	if len(d.pending) > 0 {
+		d.intr += 1
+	}
+}
+
+type fakeSource [][]byte
+
+func (s *fakeSource) Pop() (*[]byte, bool) {
+	if len(*s) == 0 {
+		return nil, false
+	}
+	v := &(*s)[0]
+	*s = (*s)[1:]
+	return v, true
+}
+
+func TestFifo(t *testing.T) {
+	type step int
+	const (
+		push   step = iota // writer pushes a buffer and kicks the DAC
+		finish             // DAC finishes playback of the current buffer
+	)
+
+	// After all steps the DAC is kicked once more, so released buffers are
+	// in sync with the DAC.
+	tests := map[string]struct {
+		steps    []step
+		released int
+		queued   int
+	}{
+		"Empty":      {[]step{}, 0, 0},
+		"Single":     {[]step{push}, 0, 1},
+		"Double":     {[]step{push, push}, 0, 2},
+		"Overflow":   {[]step{push, push, push}, 0, 2},
+		"PlaySingle": {[]step{push, finish}, 1, 0},
+		"PlayRefill": {[]step{push, push, push, finish}, 1, 2},
+		"PlayAll":    {[]step{push, push, finish, finish}, 2, 0},
+		"Underrun":   {[]step{push, push, finish, finish, push}, 2, 1},
+		"Continuous": {[]step{push, push, push, push, finish, finish}, 2, 2},
+		"Drain":      {[]step{push, push, push, push, finish, finish, finish, finish, push}, 4, 1},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var (
+				f         fifo
+				dac       fakeDAC
+				src       fakeSource
+				released  int
+				delivered int
+				played    [][]byte
+			)
+			intr := func() {
+				for ; delivered < dac.intr; delivered++ {
+					f.start()
+					released += f.feed(&dac, &src)
+				}
+			}
+
+			for i, s := range tc.steps {
+				switch s {
+				case push:
+					src = append(src, []byte{byte(i)})
+					released += f.feed(&dac, &src)
+				case finish:
+					played = append(played, dac.pending[0])
+					dac.finish()
+				}
+				intr()
+			}
+			released += f.feed(&dac, &src)
+			intr()
+
+			if released != tc.released {
+				t.Errorf("released: expected %v, got %v", tc.released, released)
+			}
+			if f.queued != tc.queued {
+				t.Errorf("queued: expected %v, got %v", tc.queued, f.queued)
+			}
+			if f.queued != len(dac.pending) {
+				t.Errorf("queued %v buffers, dac has %v", f.queued, len(dac.pending))
+			}
+			for i := 1; i < len(played); i++ {
+				if played[i][0] <= played[i-1][0] {
+					t.Fatalf("buffers played out of order")
+				}
+			}
+		})
+	}
+}
+
+type fakeMask struct{ enabled bool }
+
+func (m *fakeMask) enable()  { m.enabled = true }
+func (m *fakeMask) disable() { m.enabled = false }
+
+func TestKick(t *testing.T) {
+	type step int
+	const (
+		start step = iota // Start enables the interrupt
+		stop              // Stop disables the interrupt
+		write             // writer pushes a buffer and kicks the DAC
+	)
+
+	// Stopped, the DAC plays nothing and releases no buffer, so Output.Write
+	// blocks until Start once all four buffers are filled.  Buffers queued
+	// meanwhile are played after Start.
+	tests := map[string]struct {
+		steps   []step
+		enabled bool
+		queued  int
+		pending int // buffers not handed to the DAC
+	}{
+		"WriteBeforeStart": {[]step{write}, false, 1, 0},
+		"StartWrite":       {[]step{start, write}, true, 1, 0},
+		"StopWrite":        {[]step{start, write, stop, write}, false, 2, 0},
+		"Restart":          {[]step{start, stop, write, start, write}, true, 2, 0},
+		"StoppedOverflow":  {[]step{write, write, write, write, write}, false, 2, 3},
+		"StartOverflow":    {[]step{stop, write, write, write, write, write, start, write}, true, 2, 4},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var (
+				f       fifo
+				dac     fakeDAC
+				src     fakeSource
+				mask    fakeMask
+				started bool
+			)
+			for i, s := range tc.steps {
+				switch s {
+				case start:
+					mask.enable()
+					started = true
+				case stop:
+					mask.disable()
+					started = false
+				case write:
+					src = append(src, []byte{byte(i)})
+					f.kick(&dac, &src, &mask, started)
+				}
+			}
+
+			if mask.enabled != tc.enabled {
+				t.Errorf("interrupt enabled: expected %v, got %v", tc.enabled, mask.enabled)
+			}
+			if f.queued != tc.queued {
+				t.Errorf("queued: expected %v, got %v", tc.queued, f.queued)
+			}
+			if len(src) != tc.pending {
+				t.Errorf("pending: expected %v, got %v", tc.pending, len(src))
+			}
+		})
+	}
+}
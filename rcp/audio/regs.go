@@ -0,0 +1,48 @@
+//go:build noos
+
+package audio
+
+import (
+	"embedded/mmio"
+	"unsafe"
+
+	"github.com/drpaneas/n64/rcp/cpu"
+)
+
+var regs *registers = (*registers)(unsafe.Pointer(baseAddr))
+
+const baseAddr uintptr = cpu.KSEG1 | 0x0450_0000
+
+type statusFlags uint32
+
+// Read access to status register.  Any write clears the audio interrupt.
+const (
+	dmaEnabled statusFlags = 1 << 25
+	dmaBusy    statusFlags = 1 << 30
+	dmaFull    statusFlags = 1 << 31
+)
+
+const dmaEnable = 1
+
+type registers struct {
+	dramAddr mmio.R32[cpu.Addr] // 8 byte aligned start of next buffer
+	length   mmio.U32           // Length of next buffer, multiple of 8 bytes
+	control  mmio.U32
+	status   mmio.R32[statusFlags]
+	dacRate  mmio.U32 // 14 bit; DAC clock divider minus one
+	bitRate  mmio.U32 // 4 bit; serial clock divider minus one
+}
+
+//go:nosplit
+func (r *registers) full() bool { return r.status.LoadBits(dmaFull) != 0 }
+
+//go:nosplit
+func (r *registers) busy() bool { return r.status.LoadBits(dmaBusy) != 0 }
+
+// The buffer must have been written back to RDRAM before.
+//
+//go:nosplit
+func (r *registers) enqueue(buf []byte) {
+	r.dramAddr.Store(cpu.PhysicalAddressSlice(buf))
+	r.length.Store(uint32(len(buf)))
+}
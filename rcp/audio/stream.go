@@ -0,0 +1,192 @@
+//go:build noos
+
+package audio
+
+import (
+	"embedded/rtos"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/drpaneas/n64/machine"
+	"github.com/drpaneas/n64/rcp"
+	"github.com/drpaneas/n64/rcp/cpu"
+)
+
+const (
+	bufferCount = 4
+	BufferSize  = 4096 // Bytes per DMA buffer, i.e. 1024 stereo samples
+)
+
+var (
+	mtx        sync.Mutex
+	sampleRate int
+	started    bool      // between Start and Stop
+	startCond  sync.Cond // signaled by Start, uses mtx
+
+	buffers [bufferCount][]byte
+	current int // index of the buffer being filled by Write
+	filled  int // bytes written to the current buffer
+)
+
+// state shared with interrupt handler
+var (
+	playback fifo // must only be accessed with audio interrupt disabled
+	queue    rcp.IntrQueue[[]byte]
+	free     atomic.Int32
+	released rtos.Note
+)
+
+func init() {
+	for i := range buffers {
+		buffers[i] = cpu.MakePaddedSlice[byte](BufferSize)
+	}
+	free.Store(bufferCount)
+	startCond.L = &mtx
+
+	rcp.SetHandler(rcp.IntrAudio, handler)
+}
+
+//go:nosplit
+//go:nowritebarrierrec
+func handler() {
+	regs.status.Store(0) // clears interrupt
+
+	playback.start()
+	release(playback.feed(regs, &queue))
+}
+
+//go:nosplit
+func release(n int) {
+	if n > 0 {
+		free.Add(int32(n))
+		released.Wakeup()
+	}
+}
+
+// Start configures the DAC to play samples at freq Hz and enables audio output.
+// Returns the actual sample rate, which depends on the video clock and might
+// differ slightly from freq.
+func Start(freq int) int {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	dacRate, bitRate, actual := rates(clocks[machine.Video], freq)
+	regs.dacRate.Store(dacRate)
+	regs.bitRate.Store(bitRate)
+	regs.control.Store(dmaEnable)
+	rcp.EnableInterrupts(rcp.IntrAudio)
+
+	started = true
+	sampleRate = actual
+	startCond.Broadcast()
+	return actual
+}
+
+// Stop disables audio output.  Buffers already handed to the DAC will still be
+// played.  Writes after Stop are queued, once all buffers are filled they
+// block until the next Start.
+func Stop() {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	regs.control.Store(0)
+	rcp.DisableInterrupts(rcp.IntrAudio)
+	started = false
+}
+
+// SampleRate returns the sample rate configured by Start.
+func SampleRate() int {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	return sampleRate
+}
+
+type output struct{}
+
+// Output implements io.Writer for streaming PCM samples to the DAC.  Samples
+// must be 16-bit signed big endian, interleaved stereo.  Writes block until a
+// buffer is available, which while stopped is only after Start.
+var Output output
+
+func (output) Write(p []byte) (n int, err error) {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	for len(p) > 0 {
+		if filled == 0 {
+			waitFree()
+		}
+
+		copied := copy(buffers[current][filled:], p)
+		filled += copied
+		n += copied
+		p = p[copied:]
+
+		if filled == BufferSize {
+			submit()
+		}
+	}
+
+	return
+}
+
+// Flush hands a partially filled buffer to the DAC.  The buffer is padded with
+// silence to the DMA's 8 byte granularity.
+func (output) Flush() {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if filled == 0 {
+		return
+	}
+	pad := (8 - filled&7) & 7
+	clear(buffers[current][filled : filled+pad])
+	filled += pad
+	submit()
+}
+
+// submit passes the current buffer to the interrupt handler and advances to
+// the next one.
+func submit() {
+	buf := buffers[current]
+	cpu.WritebackSlice(buf)
+
+	free.Add(-1)
+	queue.Push(buf[:filled])
+	kick()
+
+	current = (current + 1) % bufferCount
+	filled = 0
+}
+
+// kick refills the DAC if it ran dry.
+func kick() {
+	release(playback.kick(regs, &queue, audioIntr{}, started))
+}
+
+// audioIntr masks the audio interrupt in the RCP.
+type audioIntr struct{}
+
+func (audioIntr) enable()  { rcp.EnableInterrupts(rcp.IntrAudio) }
+func (audioIntr) disable() { rcp.DisableInterrupts(rcp.IntrAudio) }
+
+// waitFree blocks until at least one buffer finished playback.  No buffer is
+// played while stopped, so it waits for Start first.
+func waitFree() {
+	for free.Load() == 0 {
+		if !started {
+			startCond.Wait()
+			continue
+		}
+		released.Clear()
+		kick()
+		if free.Load() != 0 {
+			return
+		}
+		if !released.Sleep(1 * time.Second) {
+			panic("audio timeout")
+		}
+	}
+}
@@ -21,16 +21,6 @@ const cacheLineMask = ^(CacheLineSize - 1)
 // beginning and end.
 type CacheLinePad struct{ _ [CacheLineSize]byte }
 
-// Causes the cache to be written back to RAM.  Call this before requesting
-// another component to read from this address range.  If the specified address
-// is currently not cached, this is a no-op.
-func Writeback(addr uintptr, length int)
-
-// Causes the cache to be read from RAM before next access.  Call this before
-// the address range is to be written by another component.  If the specified
-// address is currently not cached, this is a no-op.
-func Invalidate(addr uintptr, length int)
-
 // Only types with CacheLineSize%unsafe.Sizeof(T) == 0
 type Paddable interface {
 	~uint8 | ~uint16 | ~uint32 | ~uint64 | ~int8 | ~int16 | ~int32 | ~int64
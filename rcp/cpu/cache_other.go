@@ -0,0 +1,10 @@
+//go:build !mips64
+
+package cpu
+
+// The host, e.g. when running tests, has no cache to maintain for other
+// components.
+
+func Writeback(addr uintptr, length int) {}
+
+func Invalidate(addr uintptr, length int) {}
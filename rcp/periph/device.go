@@ -33,8 +33,9 @@ type Device struct {
 
 func NewDevice(piAddr cpu.Addr, size uint32) *Device {
 	addr := uint32(piAddr)
-	debug.Assert((addr >= piBus0Start && addr+size <= piBus0End) ||
-		(addr >= piBus1Start && addr+size <= piBus1End),
+	last := addr + size - 1 // bus ends are the last addresses
+	debug.Assert((addr >= piBus0Start && last <= piBus0End) ||
+		(addr >= piBus1Start && last <= piBus1End),
 		"invalid pi bus address")
 	return &Device{addr: piAddr, size: size}
 }
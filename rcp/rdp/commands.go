@@ -6,8 +6,7 @@ package rdp
 import (
 	"image"
 	"image/color"
-	"time"
-	"unsafe"
+	_ "unsafe" // for go:linkname
 
 	"github.com/drpaneas/n64/debug"
 	"github.com/drpaneas/n64/rcp/cpu"
@@ -25,7 +24,7 @@ const (
 
 	// Stalls pipeline for exactly 25 GCLK cycles.  Guarantees loading
 	// pipeline is safe for use.
-	SyncLoad command = 0xf1 << 56
+	SyncLoad command = 0xe6 << 56
 
 	// Stalls pipeline for exactly 50 GCLK cycles.  Guarantees any
 	// preceeding primitives have finished rendering and it's safe to change
@@ -40,9 +39,7 @@ const (
 
 type DisplayList struct {
 	state
-
-	commands   [64]command
-	start, end uintptr
+	buffer
 }
 
 type state struct {
@@ -58,49 +55,19 @@ type state struct {
 
 	size image.Point
 	bpp  texture.BitDepth
-}
-
-var RDP DisplayList
-
-func init() {
-	RDP.start = uintptr(unsafe.Pointer(&RDP.commands))
-	RDP.end = RDP.start
 
-	regs.status.Store(clrFlush | clrFreeze | clrXbus) // TODO why? see libdragon
-	regs.start.Store(cpu.PhysicalAddress(RDP.start))
-	regs.end.Store(cpu.PhysicalAddress(RDP.end))
+	textureBPP texture.BitDepth
+	tiles      [8]TileDescriptor
 }
 
-func (dl *DisplayList) Flush() {
-	FullSync.Clear()
-	dl.Push(SyncFull)
-	if !FullSync.Sleep(1 * time.Second) {
-		panic("rdp timeout")
-	}
-}
-
-//go:nosplit
-func (dl *DisplayList) Push(cmd command) {
-	regs := regs // avoid multiple nilcheck() on regs
-	retries := 0
-	for regs.status.LoadBits(startPending) != 0 && regs.current.Load() <= cpu.PhysicalAddress(dl.end) {
-		if retries += 1; retries > 1024*1024 { // wait max ~1 sec
-			panic("rdp stall")
-		}
-	}
-
-	idx := int(dl.end-dl.start) >> 3
-	dl.commands[idx] = cmd
-
-	cpu.Writeback(dl.end, 8)
-	dl.end += 8
-
-	regs.end.Store(cpu.PhysicalAddress(dl.end))
+var RDP DisplayList
 
-	if idx == len(dl.commands)-1 {
-		regs.start.Store(cpu.PhysicalAddress(dl.start))
-		regs.end.Store(cpu.PhysicalAddress(dl.start))
-		dl.end = dl.start
+// Triangle draws a triangle with the variant selected by flags.  tile is the
+// tile descriptor used for texturing.
+func (dl *DisplayList) Triangle(flags TriangleFlags, tile uint8, v0, v1, v2 Vertex) {
+	var buf [maxTriangleWords]uint64
+	for _, cmd := range appendTriangle(buf[:0], flags, tile, &v0, &v1, &v2) {
+		dl.Push(command(cmd))
 	}
 }
 
@@ -133,8 +100,16 @@ func (dl *DisplayList) SetTextureImage(img texture.Texture) {
 	debug.Assert(img.Addr()%8 == 0, "rdp texture must be 8 byte aligned")
 	debug.Assert(img.Stride() <= 1<<9, "rdp texture width too big")
 
+	// LOAD_TILE doesn't support 4bpp, so these are set up as 8bpp with half
+	// the width and converted back in LoadTile().
+	bpp, stride := img.BPP(), img.Stride()
+	if bpp == texture.BPP4 {
+		bpp, stride = texture.BPP8, stride>>1
+	}
+	dl.textureBPP = img.BPP()
+
 	// according to wiki, format[23:21] has no effect
-	dl.Push((0xfd << 56) | command(img.BPP()) | command(img.Stride()-1)<<32 |
+	dl.Push((0xfd << 56) | command(bpp) | command(stride-1)<<32 |
 		command(img.Addr()))
 }
 
@@ -189,6 +164,8 @@ func (dl *DisplayList) SetTile(ts TileDescriptor) {
 	debug.Assert(ts.ShiftS < 1<<4, "tile shift out of bounds")
 	debug.Assert(supportedFormat(ts.Format, ts.Size), "tile unsupported format")
 
+	dl.tiles[ts.Idx] = ts
+
 	// some formats must indicate 16 byte instead of 8 byte texels
 	if ts.Size == texture.BPP32 && (ts.Format == texture.RGBA || ts.Format == texture.YUV) {
 		ts.Line = ts.Line >> 1
@@ -208,7 +185,29 @@ func (dl *DisplayList) SetTile(ts TileDescriptor) {
 // Copies a tile into TMEM.  The tile is copied from the texture image, which
 // must be set prior via SetTextureImage().
 func (dl *DisplayList) LoadTile(idx uint8, r image.Rectangle) {
+	if dl.textureBPP == texture.BPP4 {
+		dl.loadTile4(idx, r)
+		return
+	}
+	dl.loadTile(idx, r)
+}
+
+// Loads a 4bpp tile as 8bpp with half the width.  Afterwards the tile
+// descriptor is restored and its size set to the loaded pixels, which start
+// at an even x coordinate.
+func (dl *DisplayList) loadTile4(idx uint8, r image.Rectangle) {
+	ts := dl.tiles[idx]
+	load := ts
+	load.Format, load.Size = texture.I, texture.BPP8
+	dl.SetTile(load)
+	dl.loadTile(idx, image.Rect(r.Min.X>>1, r.Min.Y, (r.Max.X+1)>>1, r.Max.Y))
+	dl.SetTile(ts)
+	dl.SetTileSize(idx, image.Rect(r.Min.X&^1, r.Min.Y, r.Max.X, r.Max.Y))
+}
+
+func (dl *DisplayList) loadTile(idx uint8, r image.Rectangle) {
 	dl.Push(SyncTile)
+	dl.Push(SyncLoad)
 
 	cmd := 0xf4<<56 | command(r.Min.X)<<46 | command(r.Min.Y)<<34
 	cmd |= command(idx)<<24 | command(r.Max.X-1)<<14 | command(r.Max.Y-1)<<2
@@ -216,6 +215,27 @@ func (dl *DisplayList) LoadTile(idx uint8, r image.Rectangle) {
 	dl.Push(cmd)
 }
 
+// Copies colors of a palette into the upper half of TMEM, where color indexed
+// textures look them up if the TLUT mode flag is set.  The colors are copied
+// from the texture image, which must be set prior via SetTextureImage(),
+// usually to the TLUT of a CI4 or CI8 texture.  TMEM holds 16 palettes of 16
+// colors.  CI4 textures select theirs with TileDescriptor.Palette, CI8
+// textures use all 256 colors starting at palette 0.  The tile descriptor idx
+// is overwritten.
+func (dl *DisplayList) LoadTLUT(idx uint8, palette uint8, colors int) {
+	debug.Assert(palette < 16, "tlut palette index out of bounds")
+	debug.Assert(colors > 0 && int(palette)*16+colors <= 256, "tlut exceeds TMEM")
+
+	dl.SetTile(TileDescriptor{
+		Format: texture.I,
+		Size:   texture.BPP4,
+		Addr:   256 + uint16(palette)*16, // entries are quadrupled
+		Idx:    idx,
+	})
+	dl.Push(SyncLoad)
+	dl.Push(0xf0<<56 | command(idx)<<24 | command(colors-1)<<14)
+}
+
 // Tile size is automatically set on LoadTile(), but can be overidden with
 // SetTileSize().
 func (dl *DisplayList) SetTileSize(idx uint8, r image.Rectangle) {
@@ -371,6 +391,23 @@ func (dl *DisplayList) SetOtherModes(
 	dl.Push(command(cmd))
 }
 
+// Coefficients to convert YUV to RGB as specified by ITU-R BT.601.
+var ConvertBT601 = [6]int16{175, -43, -89, 222, 114, 42}
+
+// Sets the coefficients of the YUV to RGB conversion.  K0 to K3 are used by
+// the texture unit to convert YUV textures, K4 and K5 by the color combiner
+// to finish the conversion.  Coefficients are 9 bit signed.
+func (dl *DisplayList) SetConvert(k [6]int16) {
+	dl.Push(SyncPipe)
+
+	var cmd command = 0xec << 56
+	for i, v := range k {
+		debug.Assert(v >= -256 && v < 256, "convert coefficient out of bounds")
+		cmd |= command(uint16(v)&0x1ff) << (45 - 9*i)
+	}
+	dl.Push(cmd)
+}
+
 type InterlaceFrame uint64
 
 const (
@@ -385,7 +422,7 @@ const (
 func (dl *DisplayList) SetScissor(r image.Rectangle, il InterlaceFrame) {
 	dl.scissorSet = r
 
-	if dl.otherModes&ModeFlags(CycleTypeCopy|CycleTypeFill) != 0 {
+	if dl.copyOrFill() {
 		r.Max = r.Max.Sub(image.Point{1, 0})
 	}
 
@@ -416,7 +453,7 @@ func (dl *DisplayList) SetFillColor(c color.Color) {
 	if dl.bpp == texture.BPP32 {
 		ci = (r << 24) | (g << 16) | (b << 8) | a
 	} else if dl.bpp == texture.BPP16 {
-		ci = ((r >> 3) << 11) | ((g >> 3) << 6) | ((b >> 3) << 1) | (a >> 15)
+		ci = ((r >> 3) << 11) | ((g >> 3) << 6) | ((b >> 3) << 1) | (a >> 7)
 		ci |= ci << 16
 	} else if dl.bpp == texture.BPP8 {
 		ci = (a << 24) | (a << 16) | (a << 8) | a
@@ -491,7 +528,7 @@ func (dl *DisplayList) SetCombineMode(m CombineMode) {
 func (dl *DisplayList) FillRectangle(r image.Rectangle) {
 	r = r.Intersect(image.Rectangle{Max: dl.size})
 
-	if dl.otherModes&ModeFlags(CycleTypeCopy|CycleTypeFill) != 0 {
+	if dl.copyOrFill() {
 		r.Max = r.Max.Sub(image.Point{1, 1})
 	}
 
@@ -506,15 +543,25 @@ func (dl *DisplayList) TextureRectangle(r image.Rectangle, p image.Point, scale
 	r = r.Intersect(image.Rectangle{Max: dl.size})
 	p = p.Add(r.Min.Sub(full.Min))
 
-	if dl.otherModes&ModeFlags(CycleTypeCopy|CycleTypeFill) != 0 {
+	if dl.copyOrFill() {
 		r.Max = r.Max.Sub(image.Point{1, 1})
 	}
 
 	cmd := 0xe4<<56 | command(r.Max.X)<<46 | command(r.Max.Y)<<34
 	cmd |= command(tileIdx)<<24 | command(r.Min.X)<<14 | command(r.Min.Y)<<2
+	dsdx := (0x8000 / scale.X) >> 5
+	if CycleType(dl.otherModes)&CycleTypeFill == CycleTypeCopy {
+		dsdx <<= 2 // copy mode draws four pixels per cycle
+	}
+
 	dl.Push(cmd)
 	dl.Push(command(p.X<<53) | command(p.Y<<37) |
-		command(((0x8000/scale.X)>>5)<<16|(0x8000/scale.Y)>>5))
+		command(dsdx<<16|(0x8000/scale.Y)>>5))
+}
+
+// In copy and fill mode rectangles include their lower right edges.
+func (dl *DisplayList) copyOrFill() bool {
+	return CycleType(dl.otherModes)&CycleTypeCopy != 0
 }
 
 func MaxTileSize(bpp texture.BitDepth) image.Rectangle {
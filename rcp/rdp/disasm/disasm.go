@@ -0,0 +1,420 @@
+// Package disasm decodes RDP command lists into readable text and checks them
+// for common mistakes, like missing syncs.  It's meant to be used on the host
+// with command lists captured from the console, see cmd/rdpdis.
+package disasm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrTruncated = errors.New("disasm: truncated command")
+
+// Opcodes of RDP commands
+const (
+	OpNop             = 0x00
+	OpTriangle        = 0x08 // 0x08 to 0x0f, see TriShade, TriTexture and TriZBuffer
+	OpTextureRect     = 0x24
+	OpTextureRectFlip = 0x25
+	OpSyncLoad        = 0x26
+	OpSyncPipe        = 0x27
+	OpSyncTile        = 0x28
+	OpSyncFull        = 0x29
+	OpSetKeyGB        = 0x2a
+	OpSetKeyR         = 0x2b
+	OpSetConvert      = 0x2c
+	OpSetScissor      = 0x2d
+	OpSetPrimDepth    = 0x2e
+	OpSetOtherModes   = 0x2f
+	OpLoadTLUT        = 0x30
+	OpSetTileSize     = 0x32
+	OpLoadBlock       = 0x33
+	OpLoadTile        = 0x34
+	OpSetTile         = 0x35
+	OpFillRect        = 0x36
+	OpSetFillColor    = 0x37
+	OpSetFogColor     = 0x38
+	OpSetBlendColor   = 0x39
+	OpSetPrimColor    = 0x3a
+	OpSetEnvColor     = 0x3b
+	OpSetCombineMode  = 0x3c
+	OpSetTextureImage = 0x3d
+	OpSetZImage       = 0x3e
+	OpSetColorImage   = 0x3f
+)
+
+// Attribute flags of triangle opcodes
+const (
+	TriZBuffer = 1 << iota
+	TriTexture
+	TriShade
+)
+
+var names = map[uint8]string{
+	OpNop:             "NOP",
+	OpTextureRect:     "TEXTURE_RECT",
+	OpTextureRectFlip: "TEXTURE_RECT_FLIP",
+	OpSyncLoad:        "SYNC_LOAD",
+	OpSyncPipe:        "SYNC_PIPE",
+	OpSyncTile:        "SYNC_TILE",
+	OpSyncFull:        "SYNC_FULL",
+	OpSetKeyGB:        "SET_KEY_GB",
+	OpSetKeyR:         "SET_KEY_R",
+	OpSetConvert:      "SET_CONVERT",
+	OpSetScissor:      "SET_SCISSOR",
+	OpSetPrimDepth:    "SET_PRIM_DEPTH",
+	OpSetOtherModes:   "SET_OTHER_MODES",
+	OpLoadTLUT:        "LOAD_TLUT",
+	OpSetTileSize:     "SET_TILE_SIZE",
+	OpLoadBlock:       "LOAD_BLOCK",
+	OpLoadTile:        "LOAD_TILE",
+	OpSetTile:         "SET_TILE",
+	OpFillRect:        "FILL_RECT",
+	OpSetFillColor:    "SET_FILL_COLOR",
+	OpSetFogColor:     "SET_FOG_COLOR",
+	OpSetBlendColor:   "SET_BLEND_COLOR",
+	OpSetPrimColor:    "SET_PRIM_COLOR",
+	OpSetEnvColor:     "SET_ENV_COLOR",
+	OpSetCombineMode:  "SET_COMBINE_MODE",
+	OpSetTextureImage: "SET_TEXTURE_IMAGE",
+	OpSetZImage:       "SET_Z_IMAGE",
+	OpSetColorImage:   "SET_COLOR_IMAGE",
+}
+
+// Command is a decoded RDP command.
+type Command struct {
+	Offset int      // byte offset in the command list
+	Words  []uint64 // all words of the command
+}
+
+// Opcode returns the command's opcode.
+func (c Command) Opcode() uint8 {
+	return uint8(c.Words[0]>>56) & 0x3f
+}
+
+// Known reports whether the opcode is a valid RDP command.
+func (c Command) Known() bool {
+	op := c.Opcode()
+	_, ok := names[op]
+	return ok || isTriangle(op)
+}
+
+// Name returns the command's mnemonic.
+func (c Command) Name() string {
+	op := c.Opcode()
+	if isTriangle(op) {
+		name := "TRI"
+		if op&TriShade != 0 {
+			name += "_SHADE"
+		}
+		if op&TriTexture != 0 {
+			name += "_TEX"
+		}
+		if op&TriZBuffer != 0 {
+			name += "_ZBUF"
+		}
+		if op&(TriShade|TriTexture) == 0 {
+			name = strings.Replace(name, "TRI", "TRI_FILL", 1)
+		}
+		return name
+	}
+	if name, ok := names[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("UNKNOWN_%02X", op)
+}
+
+func isTriangle(op uint8) bool {
+	return op&^7 == OpTriangle
+}
+
+// size returns the number of words of the command starting with w.
+func size(w uint64) int {
+	op := uint8(w>>56) & 0x3f
+	switch {
+	case isTriangle(op):
+		n := 4
+		if op&TriShade != 0 {
+			n += 8
+		}
+		if op&TriTexture != 0 {
+			n += 8
+		}
+		if op&TriZBuffer != 0 {
+			n += 2
+		}
+		return n
+	case op == OpTextureRect || op == OpTextureRectFlip:
+		return 2
+	}
+	return 1
+}
+
+// Decode splits a command list into commands.  Unknown opcodes are decoded
+// as single words.  If the last command is incomplete, the commands before it
+// are returned together with ErrTruncated.
+func Decode(words []uint64) ([]Command, error) {
+	var cmds []Command
+	for i := 0; i < len(words); {
+		n := size(words[i])
+		if i+n > len(words) {
+			return cmds, fmt.Errorf("%w at offset %#x", ErrTruncated, i*8)
+		}
+		cmds = append(cmds, Command{Offset: i * 8, Words: words[i : i+n]})
+		i += n
+	}
+	return cmds, nil
+}
+
+// String returns the command's mnemonic followed by its decoded parameters.
+func (c Command) String() string {
+	params := c.params()
+	if params == "" {
+		return c.Name()
+	}
+	return c.Name() + " " + params
+}
+
+func bits(w uint64, lo, n uint) uint64 {
+	return w >> lo & (1<<n - 1)
+}
+
+// sbits returns the n bit wide signed field starting at bit lo.
+func sbits(w uint64, lo, n uint) int64 {
+	return int64(w<<(64-lo-n)) >> (64 - n)
+}
+
+// fixed formats an unsigned fixed point field with frac fractional bits.
+func fixed(v uint64, frac uint) string {
+	return fmt.Sprintf("%g", float64(v)/float64(uint64(1)<<frac))
+}
+
+// sfixed formats a signed fixed point field with frac fractional bits.
+func sfixed(v int64, frac uint) string {
+	return fmt.Sprintf("%g", float64(v)/float64(uint64(1)<<frac))
+}
+
+func (c Command) params() string {
+	w := c.Words[0]
+	op := c.Opcode()
+
+	switch {
+	case isTriangle(op):
+		return triangle(c.Words)
+	}
+
+	switch op {
+	case OpTextureRect, OpTextureRectFlip:
+		w1 := c.Words[1]
+		return fmt.Sprintf("tile=%d (%s,%s)-(%s,%s) st=(%s,%s) dsdx=%s dtdy=%s",
+			bits(w, 24, 3),
+			fixed(bits(w, 12, 12), 2), fixed(bits(w, 0, 12), 2),
+			fixed(bits(w, 44, 12), 2), fixed(bits(w, 32, 12), 2),
+			sfixed(sbits(w1, 48, 16), 5), sfixed(sbits(w1, 32, 16), 5),
+			sfixed(sbits(w1, 16, 16), 10), sfixed(sbits(w1, 0, 16), 10))
+	case OpSetKeyGB:
+		return fmt.Sprintf("width_g=%s width_b=%s center_g=%d scale_g=%d center_b=%d scale_b=%d",
+			fixed(bits(w, 44, 12), 8), fixed(bits(w, 32, 12), 8),
+			bits(w, 24, 8), bits(w, 16, 8), bits(w, 8, 8), bits(w, 0, 8))
+	case OpSetKeyR:
+		return fmt.Sprintf("width_r=%s center_r=%d scale_r=%d",
+			fixed(bits(w, 16, 12), 8), bits(w, 8, 8), bits(w, 0, 8))
+	case OpSetConvert:
+		return fmt.Sprintf("k0=%d k1=%d k2=%d k3=%d k4=%d k5=%d",
+			sbits(w, 45, 9), sbits(w, 36, 9), sbits(w, 27, 9),
+			sbits(w, 18, 9), bits(w, 9, 9), bits(w, 0, 9))
+	case OpSetScissor:
+		field := "none"
+		if bits(w, 25, 1) != 0 {
+			field = [2]string{"even", "odd"}[bits(w, 24, 1)]
+		}
+		return fmt.Sprintf("(%s,%s)-(%s,%s) interlace=%s",
+			fixed(bits(w, 44, 12), 2), fixed(bits(w, 32, 12), 2),
+			fixed(bits(w, 12, 12), 2), fixed(bits(w, 0, 12), 2), field)
+	case OpSetPrimDepth:
+		return fmt.Sprintf("z=%d dz=%d", bits(w, 16, 16), bits(w, 0, 16))
+	case OpSetOtherModes:
+		return otherModes(w)
+	case OpLoadTLUT, OpSetTileSize, OpLoadTile:
+		return fmt.Sprintf("tile=%d (%s,%s)-(%s,%s)", bits(w, 24, 3),
+			fixed(bits(w, 44, 12), 2), fixed(bits(w, 32, 12), 2),
+			fixed(bits(w, 12, 12), 2), fixed(bits(w, 0, 12), 2))
+	case OpLoadBlock:
+		return fmt.Sprintf("tile=%d sl=%d tl=%d sh=%d dxt=%s", bits(w, 24, 3),
+			bits(w, 44, 12), bits(w, 32, 12), bits(w, 12, 12), fixed(bits(w, 0, 12), 11))
+	case OpSetTile:
+		return fmt.Sprintf("tile=%d fmt=%s line=%d addr=%#x palette=%d s=%s t=%s",
+			bits(w, 24, 3), format(w), bits(w, 41, 9), bits(w, 32, 9)*8, bits(w, 20, 4),
+			tileAxis(bits(w, 0, 10)), tileAxis(bits(w, 10, 10)))
+	case OpFillRect:
+		return fmt.Sprintf("(%s,%s)-(%s,%s)",
+			fixed(bits(w, 12, 12), 2), fixed(bits(w, 0, 12), 2),
+			fixed(bits(w, 44, 12), 2), fixed(bits(w, 32, 12), 2))
+	case OpSetFillColor:
+		return fmt.Sprintf("color=%#08x", uint32(w))
+	case OpSetFogColor, OpSetBlendColor, OpSetEnvColor:
+		return rgba(w)
+	case OpSetPrimColor:
+		return fmt.Sprintf("%s min_lod=%d lod_frac=%d", rgba(w), bits(w, 40, 5), bits(w, 32, 8))
+	case OpSetCombineMode:
+		return combineMode(w)
+	case OpSetTextureImage, OpSetColorImage:
+		return fmt.Sprintf("fmt=%s width=%d addr=%#x", format(w), bits(w, 32, 10)+1, bits(w, 0, 26))
+	case OpSetZImage:
+		return fmt.Sprintf("addr=%#x", bits(w, 0, 26))
+	}
+	return ""
+}
+
+func triangle(words []uint64) string {
+	w := words[0]
+	var b strings.Builder
+	fmt.Fprintf(&b, "left=%d level=%d tile=%d yl=%s ym=%s yh=%s",
+		bits(w, 55, 1), bits(w, 51, 3), bits(w, 48, 3),
+		sfixed(sbits(w, 32, 14), 2), sfixed(sbits(w, 16, 14), 2), sfixed(sbits(w, 0, 14), 2))
+	for i, edge := range []string{"l", "h", "m"} {
+		e := words[1+i]
+		fmt.Fprintf(&b, " x%s=%s dx%sdy=%s", edge,
+			sfixed(sbits(e, 32, 32), 16), edge, sfixed(sbits(e, 0, 32), 16))
+	}
+
+	words = words[4:]
+	op := uint8(w>>56) & 0x3f
+	if op&TriShade != 0 {
+		b.WriteString(attributes(words[:8], []string{"r", "g", "b", "a"}))
+		words = words[8:]
+	}
+	if op&TriTexture != 0 {
+		b.WriteString(attributes(words[:8], []string{"s", "t", "w"}))
+		words = words[8:]
+	}
+	if op&TriZBuffer != 0 {
+		fmt.Fprintf(&b, " z=%s dzdx=%s dzde=%s dzdy=%s",
+			sfixed(sbits(words[0], 32, 32), 16), sfixed(sbits(words[0], 0, 32), 16),
+			sfixed(sbits(words[1], 32, 32), 16), sfixed(sbits(words[1], 0, 32), 16))
+	}
+	return b.String()
+}
+
+// attributes formats shade or texture coefficients, which are split into
+// integer and fractional parts.
+func attributes(w []uint64, names []string) string {
+	var b strings.Builder
+	value := func(hi, lo uint64, i int) string {
+		shift := uint(48 - 16*i)
+		v := int32(uint32(bits(hi, shift, 16))<<16 | uint32(bits(lo, shift, 16)))
+		return sfixed(int64(v), 16)
+	}
+	for i, name := range names {
+		fmt.Fprintf(&b, " %s=%s d%sdx=%s d%sde=%s d%sdy=%s", name,
+			value(w[0], w[2], i), name, value(w[1], w[3], i),
+			name, value(w[4], w[6], i), name, value(w[5], w[7], i))
+	}
+	return b.String()
+}
+
+func rgba(w uint64) string {
+	return fmt.Sprintf("rgba=(%d,%d,%d,%d)", bits(w, 24, 8), bits(w, 16, 8), bits(w, 8, 8), bits(w, 0, 8))
+}
+
+var (
+	formats = []string{"rgba", "yuv", "ci", "ia", "i", "fmt5", "fmt6", "fmt7"}
+	sizes   = []string{"4", "8", "16", "32"}
+)
+
+func format(w uint64) string {
+	return formats[bits(w, 53, 3)] + sizes[bits(w, 51, 2)]
+}
+
+// tileAxis formats the clamp, mirror, mask and shift fields of a tile axis.
+func tileAxis(v uint64) string {
+	s := fmt.Sprintf("mask=%d shift=%d", bits(v, 4, 4), bits(v, 0, 4))
+	if bits(v, 9, 1) != 0 {
+		s += ",clamp"
+	}
+	if bits(v, 8, 1) != 0 {
+		s += ",mirror"
+	}
+	return "(" + strings.Replace(s, " ", ",", 1) + ")"
+}
+
+var (
+	cycleTypes   = []string{"1cycle", "2cycle", "copy", "fill"}
+	rgbDithers   = []string{"square", "bayer", "noise", "none"}
+	alphaDithers = []string{"pattern", "inv_pattern", "noise", "none"}
+	zModes       = []string{"opaque", "interpenetrating", "transparent", "decal"}
+	cvgDests     = []string{"clamp", "wrap", "zap", "save"}
+
+	blendPM = []string{"cc", "mem", "blend", "fog"}
+	blendA  = []string{"cc_alpha", "fog_alpha", "shade_alpha", "0"}
+	blendB  = []string{"(1-a)", "mem_cvg", "1", "0"}
+
+	modeFlags = []struct {
+		bit  uint
+		name string
+	}{
+		{55, "atomic"}, {51, "persp"}, {50, "detail"}, {49, "sharpen"},
+		{48, "lod"}, {47, "tlut"}, {46, "tlut_ia"}, {45, "sample_2x2"},
+		{44, "mid_texel"}, {43, "bilerp0"}, {42, "bilerp1"}, {41, "convert_one"},
+		{40, "key"}, {14, "force_blend"}, {13, "alpha_cvg_sel"}, {12, "cvg_x_alpha"},
+		{7, "color_on_cvg"}, {6, "image_read"}, {5, "z_update"}, {4, "z_compare"},
+		{3, "aa"}, {2, "z_prim"}, {1, "dither_alpha"}, {0, "alpha_compare"},
+	}
+)
+
+func otherModes(w uint64) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "cycle=%s rgb_dither=%s alpha_dither=%s z_mode=%s cvg_dest=%s",
+		cycleTypes[bits(w, 52, 2)], rgbDithers[bits(w, 38, 2)], alphaDithers[bits(w, 36, 2)],
+		zModes[bits(w, 10, 2)], cvgDests[bits(w, 8, 2)])
+	fmt.Fprintf(&b, " blend=%s*%s+%s*%s,%s*%s+%s*%s",
+		blendPM[bits(w, 30, 2)], blendA[bits(w, 26, 2)], blendPM[bits(w, 22, 2)], blendB[bits(w, 18, 2)],
+		blendPM[bits(w, 28, 2)], blendA[bits(w, 24, 2)], blendPM[bits(w, 20, 2)], blendB[bits(w, 16, 2)])
+
+	var flags []string
+	for _, f := range modeFlags {
+		if bits(w, f.bit, 1) != 0 {
+			flags = append(flags, f.name)
+		}
+	}
+	if len(flags) > 0 {
+		b.WriteString(" flags=" + strings.Join(flags, "|"))
+	}
+	return b.String()
+}
+
+var (
+	ccInputs = []string{"combined", "tex0", "tex1", "prim", "shade", "env"}
+	ccA      = append(ccInputs[:6:6], "1", "noise")
+	ccB      = append(ccInputs[:6:6], "key_center", "k4")
+	ccC      = append(ccInputs[:6:6], "key_scale", "combined_alpha", "tex0_alpha", "tex1_alpha",
+		"prim_alpha", "shade_alpha", "env_alpha", "lod_frac", "prim_lod_frac", "k5")
+	ccD      = append(ccInputs[:6:6], "1", "0")
+	ccAlpha  = append(ccInputs[:6:6], "1", "0")
+	ccAlphaC = []string{"lod_frac", "tex0", "tex1", "prim", "shade", "env", "prim_lod_frac", "0"}
+)
+
+// ccInput returns the name of a combiner input, inputs beyond the table are
+// zero.
+func ccInput(table []string, v uint64) string {
+	if v < uint64(len(table)) {
+		return table[v]
+	}
+	return "0"
+}
+
+func combineMode(w uint64) string {
+	equation := func(a, b, c, d string) string {
+		return fmt.Sprintf("(%s-%s)*%s+%s", a, b, c, d)
+	}
+	return fmt.Sprintf("rgb0=%s alpha0=%s rgb1=%s alpha1=%s",
+		equation(ccInput(ccA, bits(w, 52, 4)), ccInput(ccB, bits(w, 28, 4)),
+			ccInput(ccC, bits(w, 47, 5)), ccInput(ccD, bits(w, 15, 3))),
+		equation(ccInput(ccAlpha, bits(w, 44, 3)), ccInput(ccAlpha, bits(w, 12, 3)),
+			ccInput(ccAlphaC, bits(w, 41, 3)), ccInput(ccAlpha, bits(w, 9, 3))),
+		equation(ccInput(ccA, bits(w, 37, 4)), ccInput(ccB, bits(w, 24, 4)),
+			ccInput(ccC, bits(w, 32, 5)), ccInput(ccD, bits(w, 6, 3))),
+		equation(ccInput(ccAlpha, bits(w, 21, 3)), ccInput(ccAlpha, bits(w, 3, 3)),
+			ccInput(ccAlphaC, bits(w, 18, 3)), ccInput(ccAlpha, bits(w, 0, 3))))
+}
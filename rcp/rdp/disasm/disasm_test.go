@@ -0,0 +1,174 @@
+package disasm
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+const (
+	syncLoad     = 0xe600000000000000
+	syncPipe     = 0xe700000000000000
+	syncTile     = 0xe800000000000000
+	syncFull     = 0xe900000000000000
+	colorImage16 = 0xff10013f00100000 // rgba16, 320 pixels wide
+	colorImage32 = 0xff18013f00100000
+	fillMode     = 0xef3000f000000000
+	copyMode     = 0xef2000f000000000
+	oneCycle     = 0xef0000f000000000
+	depthTest    = 0xef0000f000000030
+	fillColor    = 0xf7000000ff00ff00
+	fillRect     = 0xf60780a000028050 // (10,20)-(30,40)
+	textureImage = 0xfd10001f00200000 // rgba16, 32 pixels wide
+	setTile      = 0xf510100001000000 // tile 1, rgba16, 64 bytes per line
+	loadTile     = 0xf40000000107c03c // tile 1, 32x16 texels
+	texRect      = 0xe408004001000000 // tile 1, (0,0)-(32,16)
+	texRectST    = 0x0000000010000400
+)
+
+// Flat triangle from (10,10) over (30,20) to (10,30)
+var flatTriangle = []uint64{0x0880007800500028, 0x001e0000fffe0000, 0x000a000000000000, 0x000a000000020000}
+
+func TestDecode(t *testing.T) {
+	words := slices.Concat([]uint64{syncPipe, texRect, texRectST}, flatTriangle, []uint64{syncFull})
+	cmds, err := Decode(words)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, c := range cmds {
+		got = append(got, c.Name())
+	}
+	want := []string{"SYNC_PIPE", "TEXTURE_RECT", "TRI_FILL", "SYNC_FULL"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if cmds[3].Offset != 7*8 {
+		t.Errorf("expected offset %v, got %v", 7*8, cmds[3].Offset)
+	}
+
+	cmds, err = Decode(words[:5])
+	if !errors.Is(err, ErrTruncated) {
+		t.Errorf("expected %v, got %v", ErrTruncated, err)
+	}
+	if len(cmds) != 2 {
+		t.Errorf("expected %v commands, got %v", 2, len(cmds))
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := map[string]struct {
+		words []uint64
+		want  string
+	}{
+		"SyncPipe":       {[]uint64{syncPipe}, "SYNC_PIPE"},
+		"Unknown":        {[]uint64{0xc100000000000000}, "UNKNOWN_01"},
+		"FillColor":      {[]uint64{fillColor}, "SET_FILL_COLOR color=0xff00ff00"},
+		"FillRect":       {[]uint64{fillRect}, "FILL_RECT (10,20)-(30,40)"},
+		"Scissor":        {[]uint64{0xed000000005003c0}, "SET_SCISSOR (0,0)-(320,240) interlace=none"},
+		"ColorImage":     {[]uint64{colorImage16}, "SET_COLOR_IMAGE fmt=rgba16 width=320 addr=0x100000"},
+		"PrimColor":      {[]uint64{0xfa0000ff10203040}, "SET_PRIM_COLOR rgba=(16,32,48,64) min_lod=0 lod_frac=255"},
+		"TextureRect":    {[]uint64{texRect, texRectST}, "TEXTURE_RECT tile=1 (0,0)-(32,16) st=(0,0) dsdx=4 dtdy=1"},
+		"Tile":           {[]uint64{0xf540040000340240}, "SET_TILE tile=0 fmt=ci4 line=2 addr=0x0 palette=3 s=(mask=4,shift=0,clamp) t=(mask=0,shift=0,mirror)"},
+		"LoadBlock":      {[]uint64{0xf3000000017ff800}, "LOAD_BLOCK tile=1 sl=0 tl=0 sh=2047 dxt=1"},
+		"OtherModesFill": {[]uint64{depthTest | fillMode}, "SET_OTHER_MODES cycle=fill rgb_dither=none alpha_dither=none z_mode=opaque cvg_dest=clamp blend=cc*cc_alpha+cc*(1-a),cc*cc_alpha+cc*(1-a) flags=z_update|z_compare"},
+		"OtherModesBlend": {[]uint64{0xef0000a004404008},
+			"SET_OTHER_MODES cycle=1cycle rgb_dither=noise alpha_dither=noise z_mode=opaque cvg_dest=clamp blend=cc*fog_alpha+mem*(1-a),cc*cc_alpha+cc*(1-a) flags=force_blend|aa"},
+		"CombineMode": {[]uint64{0xfc127e2488fff9fc},
+			"SET_COMBINE_MODE rgb0=(tex0-0)*shade+0 alpha0=(0-0)*0+shade rgb1=(tex0-0)*shade+0 alpha1=(0-0)*0+shade"},
+		"Triangle": {flatTriangle,
+			"TRI_FILL left=1 level=0 tile=0 yl=30 ym=20 yh=10 xl=30 dxldy=-2 xh=10 dxhdy=0 xm=10 dxmdy=2"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := Command{Words: tc.words}.String()
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := map[string]struct {
+		words []uint64
+		want  []string
+	}{
+		"Valid": {
+			slices.Concat([]uint64{
+				colorImage16, fillMode, fillColor, fillRect, syncPipe, oneCycle,
+				textureImage, setTile, loadTile, texRect, texRectST,
+				syncPipe, syncLoad, syncTile, setTile, loadTile, texRect, texRectST,
+			}, flatTriangle, []uint64{syncFull}),
+			nil,
+		},
+		"MissingSyncPipe": {
+			[]uint64{colorImage16, fillMode, fillRect, fillColor},
+			[]string{"command 3: missing SYNC_PIPE before SET_FILL_COLOR"},
+		},
+		"MissingSyncTile": {
+			[]uint64{colorImage16, oneCycle, textureImage, setTile, loadTile, texRect, texRectST, syncLoad, setTile},
+			[]string{"command 7: missing SYNC_TILE before SET_TILE of tile 1"},
+		},
+		"MissingSyncLoad": {
+			[]uint64{colorImage16, oneCycle, textureImage, setTile, loadTile, texRect, texRectST, syncTile, loadTile},
+			[]string{"command 7: missing SYNC_LOAD before LOAD_TILE"},
+		},
+		"LoadTileOverflow": {
+			[]uint64{textureImage, setTile, 0xf40000000107c13c},
+			[]string{"command 2: LOAD_TILE of 5120 bytes at 0x0 exceeds TMEM"},
+		},
+		"LoadBlockOverflow": {
+			[]uint64{textureImage, setTile, 0xf300000001fff000},
+			[]string{
+				"command 2: LOAD_BLOCK of 4096 texels exceeds limit of 2048",
+				"command 2: LOAD_BLOCK of 8192 bytes at 0x0 exceeds TMEM",
+			},
+		},
+		"LoadTile4": {
+			[]uint64{0xfd00001f00200000, setTile, loadTile},
+			[]string{"command 2: LOAD_TILE of 4-bit texture image, load as 8-bit instead"},
+		},
+		"TLUT": {
+			[]uint64{textureImage, 0xf500000007000000, 0xf0000000073fc000},
+			[]string{"command 2: LOAD_TLUT into lower half of TMEM at 0x0"},
+		},
+		"CopyMode32": {
+			[]uint64{colorImage32, copyMode, textureImage, setTile, loadTile, texRect, texRectST},
+			[]string{"command 5: TEXTURE_RECT in copy mode with 32-bit color image"},
+		},
+		"TriangleFillMode": {
+			append([]uint64{colorImage16, fillMode}, flatTriangle...),
+			[]string{"command 2: TRI_FILL unsupported in fill mode"},
+		},
+		"MissingImages": {
+			[]uint64{depthTest, fillRect},
+			[]string{
+				"command 1: FILL_RECT without SET_COLOR_IMAGE",
+				"command 1: FILL_RECT with depth test or update without SET_Z_IMAGE",
+			},
+		},
+		"UnknownOpcode": {
+			[]uint64{0xc100000000000000},
+			[]string{"command 0: unknown opcode 0x01"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cmds, err := Decode(tc.words)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, issue := range Validate(cmds) {
+				got = append(got, issue.String())
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package disasm
+
+import "fmt"
+
+const tmemSize = 4096
+
+// Issue describes a likely mistake in a command list.
+type Issue struct {
+	Command int // index of the offending command
+	Message string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("command %d: %s", i.Command, i.Message)
+}
+
+type tile struct {
+	set        bool
+	line, addr uint64 // in bytes
+}
+
+// validator tracks the RDP state needed to validate commands.
+type validator struct {
+	issues []Issue
+	index  int
+
+	pipeBusy bool    // primitives were drawn since the last SYNC_PIPE
+	loadBusy bool    // textured primitives were drawn since the last SYNC_LOAD
+	tileBusy [8]bool // tile was used since the last SYNC_TILE
+
+	otherModes               uint64
+	otherModesSet            bool
+	colorImageSet, zImageSet bool
+	colorImageSize           uint64
+	textureImageSet          bool
+	textureImageSize         uint64
+	tiles                    [8]tile
+}
+
+// Validate checks a command list for common mistakes:
+//
+//   - missing SYNC_PIPE, SYNC_TILE or SYNC_LOAD before changing state that
+//     might still be used by previous primitives
+//   - texture loads exceeding TMEM or of unsupported texture image sizes
+//   - primitives drawn without color image or depth buffer, or in a cycle
+//     type not supported by them or the color image's format
+//
+// Validation assumes the command list starts from an idle RDP.
+func Validate(cmds []Command) []Issue {
+	var v validator
+	for i, c := range cmds {
+		v.index = i
+		v.command(c)
+	}
+	return v.issues
+}
+
+func (v *validator) report(format string, args ...any) {
+	v.issues = append(v.issues, Issue{v.index, fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) command(c Command) {
+	w := c.Words[0]
+	op := c.Opcode()
+	if !c.Known() {
+		v.report("unknown opcode 0x%02x", op)
+		return
+	}
+
+	if isTriangle(op) {
+		v.triangle(c)
+		return
+	}
+
+	switch op {
+	case OpSyncFull:
+		v.pipeBusy, v.loadBusy, v.tileBusy = false, false, [8]bool{}
+	case OpSyncPipe:
+		v.pipeBusy = false
+	case OpSyncLoad:
+		v.loadBusy = false
+	case OpSyncTile:
+		v.tileBusy = [8]bool{}
+
+	case OpSetOtherModes:
+		v.syncPipe(c)
+		v.otherModes, v.otherModesSet = w, true
+	case OpSetCombineMode, OpSetFillColor, OpSetFogColor, OpSetBlendColor,
+		OpSetEnvColor, OpSetKeyGB, OpSetKeyR, OpSetConvert:
+		v.syncPipe(c)
+	case OpSetColorImage:
+		v.syncPipe(c)
+		v.colorImageSet, v.colorImageSize = true, bits(w, 51, 2)
+	case OpSetZImage:
+		v.syncPipe(c)
+		v.zImageSet = true
+	case OpSetTextureImage:
+		v.textureImageSet, v.textureImageSize = true, bits(w, 51, 2)
+
+	case OpSetTile:
+		idx := bits(w, 24, 3)
+		v.syncTile(c, idx)
+		v.tiles[idx] = tile{
+			set:  true,
+			line: bits(w, 41, 9) * 8,
+			addr: bits(w, 32, 9) * 8,
+		}
+	case OpSetTileSize:
+		v.syncTile(c, bits(w, 24, 3))
+	case OpLoadTile, OpLoadBlock, OpLoadTLUT:
+		v.load(c)
+
+	case OpTextureRect, OpTextureRectFlip:
+		v.primitive(c)
+		if v.cycleType() == cycleFill {
+			v.report("%s unsupported in fill mode", c.Name())
+		}
+		v.texture(c, bits(w, 24, 3))
+	case OpFillRect:
+		v.primitive(c)
+	}
+}
+
+const (
+	cycle1 = iota
+	cycle2
+	cycleCopy
+	cycleFill
+)
+
+func (v *validator) cycleType() uint64 {
+	return bits(v.otherModes, 52, 2)
+}
+
+func (v *validator) syncPipe(c Command) {
+	if v.pipeBusy {
+		v.report("missing SYNC_PIPE before %s", c.Name())
+		v.pipeBusy = false
+	}
+}
+
+func (v *validator) syncTile(c Command, idx uint64) {
+	if v.tileBusy[idx] {
+		v.report("missing SYNC_TILE before %s of tile %d", c.Name(), idx)
+		v.tileBusy[idx] = false
+	}
+}
+
+// primitive checks state common to all primitives.
+func (v *validator) primitive(c Command) {
+	v.pipeBusy = true
+	if !v.otherModesSet {
+		v.report("%s without SET_OTHER_MODES", c.Name())
+		v.otherModesSet = true // report once
+	}
+	if !v.colorImageSet {
+		v.report("%s without SET_COLOR_IMAGE", c.Name())
+		v.colorImageSet = true
+		v.colorImageSize = 2
+	}
+
+	switch v.cycleType() {
+	case cycleCopy:
+		if v.colorImageSize == 3 {
+			v.report("%s in copy mode with 32-bit color image", c.Name())
+		}
+	case cycleFill:
+		if v.colorImageSize < 2 && c.Opcode() == OpFillRect {
+			v.report("%s in fill mode with %s-bit color image", c.Name(), sizes[v.colorImageSize])
+		}
+	default:
+		if v.otherModes&(1<<5|1<<4) != 0 && !v.zImageSet {
+			v.report("%s with depth test or update without SET_Z_IMAGE", c.Name())
+			v.zImageSet = true
+		}
+	}
+}
+
+// texture marks tiles as used by a primitive.
+func (v *validator) texture(c Command, idx uint64) {
+	v.loadBusy = true
+	tiles := []uint64{idx}
+	if v.cycleType() == cycle2 {
+		tiles = append(tiles, (idx+1)&7)
+	}
+	for _, idx := range tiles {
+		v.tileBusy[idx] = true
+		if !v.tiles[idx].set {
+			v.report("%s uses tile %d without SET_TILE", c.Name(), idx)
+			v.tiles[idx].set = true
+		}
+	}
+}
+
+func (v *validator) triangle(c Command) {
+	v.primitive(c)
+	if cycle := v.cycleType(); cycle == cycleCopy || cycle == cycleFill {
+		v.report("%s unsupported in %s mode", c.Name(), cycleTypes[cycle])
+	}
+	if c.Opcode()&TriTexture != 0 {
+		v.texture(c, bits(c.Words[0], 48, 3))
+	}
+}
+
+// load checks texture loads into TMEM.
+func (v *validator) load(c Command) {
+	w := c.Words[0]
+	idx := bits(w, 24, 3)
+	if v.loadBusy {
+		v.report("missing SYNC_LOAD before %s", c.Name())
+		v.loadBusy = false
+	}
+	v.syncTile(c, idx)
+	if !v.textureImageSet {
+		v.report("%s without SET_TEXTURE_IMAGE", c.Name())
+	}
+	t := v.tiles[idx]
+	if !t.set {
+		v.report("%s into tile %d without SET_TILE", c.Name(), idx)
+		return
+	}
+
+	var bytes uint64
+	switch c.Opcode() {
+	case OpLoadTile:
+		if v.textureImageSize == 0 {
+			v.report("LOAD_TILE of 4-bit texture image, load as 8-bit instead")
+		}
+		rows := max(bits(w, 0, 12)>>2+1, bits(w, 32, 12)>>2) - bits(w, 32, 12)>>2
+		bytes = t.line * rows
+	case OpLoadBlock:
+		texels := max(bits(w, 12, 12)+1, bits(w, 44, 12)) - bits(w, 44, 12)
+		if texels > 2048 {
+			v.report("LOAD_BLOCK of %d texels exceeds limit of 2048", texels)
+		}
+		bytes = (texels<<(v.textureImageSize+2)/8 + 7) &^ 7
+	case OpLoadTLUT:
+		if t.addr < tmemSize/2 {
+			v.report("LOAD_TLUT into lower half of TMEM at %#x", t.addr)
+		}
+		entries := max(bits(w, 12, 12)>>2+1, bits(w, 44, 12)>>2) - bits(w, 44, 12)>>2
+		bytes = entries * 8 // entries are quadrupled
+	}
+	if t.addr+bytes > tmemSize {
+		v.report("%s of %d bytes at %#x exceeds TMEM", c.Name(), bytes, t.addr)
+	}
+}
@@ -1,3 +1,5 @@
+//go:build noos
+
 // The diplay processor is a hardware rasterizer.  It controls the texture cache
 // and draws primitives directly into a framebuffer in RDRAM.  It's usually not
 // used directly but through the RSP instead.
@@ -0,0 +1,88 @@
+//go:build noos
+
+package rdp
+
+import (
+	"time"
+	"unsafe"
+
+	"github.com/drpaneas/n64/rcp/cpu"
+)
+
+// buffer is a ring of commands, which the RDP reads via DMA.
+type buffer struct {
+	commands   [64]command
+	start, end uintptr
+}
+
+func init() {
+	RDP.start = uintptr(unsafe.Pointer(&RDP.commands))
+	RDP.end = RDP.start
+
+	regs.status.Store(clrFlush | clrFreeze | clrXbus) // TODO why? see libdragon
+	regs.start.Store(cpu.PhysicalAddress(RDP.start))
+	regs.end.Store(cpu.PhysicalAddress(RDP.end))
+}
+
+func (dl *DisplayList) Flush() {
+	FullSync.Clear()
+	dl.Push(SyncFull)
+	if !FullSync.Sleep(1 * time.Second) {
+		panic("rdp timeout")
+	}
+}
+
+//go:nosplit
+func (dl *DisplayList) Push(cmd command) {
+	regs := regs // avoid multiple nilcheck() on regs
+	retries := 0
+	for regs.status.LoadBits(startPending) != 0 && regs.current.Load() <= cpu.PhysicalAddress(dl.end) {
+		if retries += 1; retries > 1024*1024 { // wait max ~1 sec
+			panic("rdp stall")
+		}
+	}
+
+	idx := int(dl.end-dl.start) >> 3
+	dl.commands[idx] = cmd
+
+	cpu.Writeback(dl.end, 8)
+	dl.end += 8
+
+	regs.end.Store(cpu.PhysicalAddress(dl.end))
+
+	if idx == len(dl.commands)-1 {
+		regs.start.Store(cpu.PhysicalAddress(dl.start))
+		regs.end.Store(cpu.PhysicalAddress(dl.start))
+		dl.end = dl.start
+	}
+}
+
+// Execute makes the RDP process the commands in buf after the previously
+// pushed commands.  buf must have been written back to RDRAM and must not be
+// modified until the commands were processed, e.g. until the next Flush.
+func (dl *DisplayList) Execute(buf []uint64) {
+	if len(buf) == 0 {
+		return
+	}
+
+	waitStartPending()
+	addr := cpu.PhysicalAddress(uintptr(unsafe.Pointer(unsafe.SliceData(buf))))
+	regs.start.Store(addr)
+	regs.end.Store(addr + cpu.Addr(len(buf)*8))
+
+	// Continue with the beginning of the command ring once the RDP started
+	// reading buf.
+	waitStartPending()
+	regs.start.Store(cpu.PhysicalAddress(dl.start))
+	regs.end.Store(cpu.PhysicalAddress(dl.start))
+	dl.end = dl.start
+}
+
+func waitStartPending() {
+	retries := 0
+	for regs.status.LoadBits(startPending) != 0 {
+		if retries += 1; retries > 1024*1024 { // wait max ~1 sec
+			panic("rdp stall")
+		}
+	}
+}
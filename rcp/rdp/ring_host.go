@@ -0,0 +1,28 @@
+//go:build !noos
+
+package rdp
+
+// buffer records the commands on the host, which has no RDP.  They can be run
+// with a simulator, see internal/rdpsim.
+type buffer struct {
+	commands []uint64
+}
+
+func (dl *DisplayList) Flush() {
+	dl.Push(SyncFull)
+}
+
+func (dl *DisplayList) Push(cmd command) {
+	dl.commands = append(dl.commands, uint64(cmd))
+}
+
+func (dl *DisplayList) Execute(buf []uint64) {
+	dl.commands = append(dl.commands, buf...)
+}
+
+// Commands returns the commands pushed since the last call.
+func (dl *DisplayList) Commands() []uint64 {
+	cmds := dl.commands
+	dl.commands = nil
+	return cmds
+}
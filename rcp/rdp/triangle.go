@@ -0,0 +1,180 @@
+package rdp
+
+import (
+	"image/color"
+	"math"
+)
+
+// Vertex is a triangle vertex in screen space.  Only the attributes used by
+// the variant of the triangle command are read.
+type Vertex struct {
+	X, Y float32 // position in pixels
+	Z    float32 // depth from 0 to 1
+
+	S, T float32 // texture coordinates in texels
+	W    float32 // 1/w in clip space for perspective correction, zero means 1
+
+	Color color.RGBA
+}
+
+// TriangleFlags select the variant of the triangle command.  Without flags
+// triangles are filled with the color combiner's output for constant inputs,
+// e.g. the primitive color.
+type TriangleFlags uint8
+
+const (
+	TriangleZBuffer TriangleFlags = 1 << iota // Interpolate depth
+	TriangleTexture                           // Interpolate texture coordinates
+	TriangleShade                             // Interpolate vertex colors
+)
+
+// maxTriangleWords is the size of a triangle command with all attributes.
+const maxTriangleWords = 4 + 8 + 8 + 2
+
+// attribute holds the value of an attribute at the start of the major edge
+// and its gradients along x, the major edge and y.
+type attribute struct{ v, dx, de, dy float32 }
+
+// appendTriangle appends the triangle command for the vertices to buf.  The
+// edge and attribute coefficients are computed like libdragon's rdpq_triangle
+// does on the CPU, in single precision and with y truncated to the quarter
+// pixels of the command.  Explicit conversions of products keep the compiler
+// from fusing them into multiply-add instructions, which round differently.
+func appendTriangle(buf []uint64, flags TriangleFlags, tile uint8, v0, v1, v2 *Vertex) []uint64 {
+	// Sort vertices by y into top, middle and low
+	if v1.Y < v0.Y {
+		v0, v1 = v1, v0
+	}
+	if v2.Y < v1.Y {
+		v1, v2 = v2, v1
+	}
+	if v1.Y < v0.Y {
+		v0, v1 = v1, v0
+	}
+
+	// The major edge h goes from top to low, the middle edge m from top to
+	// middle and the low edge l from middle to low.
+	x0, y0 := v0.X, quarter(v0.Y)
+	x1, y1 := v1.X, quarter(v1.Y)
+	x2, y2 := v2.X, quarter(v2.Y)
+	hx, hy := x2-x0, y2-y0
+	mx, my := x1-x0, y1-y0
+	lx, ly := x2-x1, y2-y1
+	nz := float32(hx*my) - float32(hy*mx)
+
+	var left uint64
+	if nz < 0 {
+		left = 1 // middle vertex is right of the major edge
+	}
+	buf = append(buf, uint64(0x08|flags&7)<<56|left<<55|uint64(tile&7)<<48|
+		uint64(s11_2(v2.Y))<<32|uint64(s11_2(v1.Y))<<16|uint64(s11_2(v0.Y)))
+
+	// Edges start at the scanline containing the top vertex
+	ish, ism, isl := slope(hx, hy), slope(mx, my), slope(lx, ly)
+	fy := float32(math.Floor(float64(y0))) - y0
+	buf = append(buf,
+		pair(x1, isl),
+		pair(x0+float32(fy*ish), ish),
+		pair(x0+float32(fy*ism), ism))
+
+	var factor float32
+	if nz != 0 {
+		factor = -1 / nz
+	}
+	// gradients takes the value a0 at the top vertex and its differences
+	// ma and ha to the middle and low vertex.
+	gradients := func(a0, ma, ha float32) attribute {
+		dx := (float32(hy*ma) - float32(my*ha)) * factor
+		dy := (float32(mx*ha) - float32(hx*ma)) * factor
+		de := dy + float32(dx*ish)
+		return attribute{a0 + float32(fy*de), dx, de, dy}
+	}
+
+	if flags&TriangleShade != 0 {
+		c0, c1, c2 := v0.Color, v1.Color, v2.Color
+		shade := func(a0, a1, a2 uint8) attribute {
+			return gradients(float32(a0), float32(a1)-float32(a0), float32(a2)-float32(a0))
+		}
+		buf = appendAttributes(buf, [4]attribute{
+			shade(c0.R, c1.R, c2.R),
+			shade(c0.G, c1.G, c2.G),
+			shade(c0.B, c1.B, c2.B),
+			shade(c0.A, c1.A, c2.A),
+		})
+	}
+
+	if flags&TriangleTexture != 0 {
+		// Texture coordinates are divided by w, which is normalized to
+		// the largest 1/w of the triangle.
+		w0, w1, w2 := perspective(v0.W), perspective(v1.W), perspective(v2.W)
+		wmax := 1 / max(w0, w1, w2)
+		w0, w1, w2 = w0*wmax, w1*wmax, w2*wmax
+		s0, s1, s2 := v0.S*32*w0, v1.S*32*w1, v2.S*32*w2 // s10.5
+		t0, t1, t2 := v0.T*32*w0, v1.T*32*w1, v2.T*32*w2
+		w0, w1, w2 = w0*0x7fff, w1*0x7fff, w2*0x7fff
+		buf = appendAttributes(buf, [4]attribute{
+			gradients(s0, s1-s0, s2-s0),
+			gradients(t0, t1-t0, t2-t0),
+			gradients(w0, w1-w0, w2-w0),
+		})
+	}
+
+	if flags&TriangleZBuffer != 0 {
+		z := gradients(v0.Z*0x7fff, (v1.Z-v0.Z)*0x7fff, (v2.Z-v0.Z)*0x7fff)
+		buf = append(buf, pair(z.v, z.dx), pair(z.de, z.dy))
+	}
+
+	return buf
+}
+
+// appendAttributes appends the coefficients of shade or texture attributes,
+// which are split into integer and fractional parts.
+func appendAttributes(buf []uint64, attrs [4]attribute) []uint64 {
+	var w [8]uint64
+	for i, a := range attrs {
+		shift := 48 - 16*i
+		for j, v := range [4]float32{a.v, a.dx, a.de, a.dy} {
+			x := uint32(s15_16(v))
+			// Words: v, dx, v frac, dx frac, de, dy, de frac, dy frac
+			idx := [4]int{0, 1, 4, 5}[j]
+			w[idx] |= uint64(x>>16) << shift
+			w[idx+2] |= uint64(x&0xffff) << shift
+		}
+	}
+	return append(buf, w[:]...)
+}
+
+func slope(dx, dy float32) float32 {
+	if dy == 0 {
+		return 0
+	}
+	return dx / dy
+}
+
+func perspective(w float32) float32 {
+	if w == 0 {
+		return 1
+	}
+	return w
+}
+
+// pair packs two s15.16 values into a word.
+func pair(hi, lo float32) uint64 {
+	return uint64(uint32(s15_16(hi)))<<32 | uint64(uint32(s15_16(lo)))
+}
+
+// s15_16 converts x to s15.16 fixed point, rounding down and saturating on
+// overflow.
+func s15_16(x float32) int32 {
+	return int32(max(min(math.Floor(float64(x)*(1<<16)), math.MaxInt32), math.MinInt32))
+}
+
+// quarter truncates y to quarter pixels.
+func quarter(y float32) float32 {
+	return float32(math.Floor(float64(y)*4)) / 4
+}
+
+// s11_2 converts a y coordinate to s11.2 fixed point.
+func s11_2(y float32) uint16 {
+	return uint16(int32(math.Floor(float64(y)*4))) & 0x3fff
+}
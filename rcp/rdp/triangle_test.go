@@ -0,0 +1,83 @@
+package rdp
+
+import (
+	"image/color"
+	"slices"
+	"testing"
+)
+
+func TestTriangle(t *testing.T) {
+	// Fill was checked by hand.  The other commands were generated by a C
+	// port of libdragon's CPU triangle setup, rdpq_triangle_cpu in
+	// src/rdpq/rdpq_tri.c, with colors divided by 255 for its float input.
+	// Vertices in arbitrary order, sorted top to bottom: (10,10), (30,20)
+	// and (10,30).  The middle vertex is right of the major edge.
+	a := [3]Vertex{
+		{X: 30, Y: 20, Z: 0.5, S: 32, T: 0, Color: color.RGBA{0, 255, 0, 255}},
+		{X: 10, Y: 30, Z: 1, S: 0, T: 32, Color: color.RGBA{0, 0, 255, 255}},
+		{X: 10, Y: 10, Z: 0, S: 0, T: 0, Color: color.RGBA{255, 0, 0, 255}},
+	}
+	// Starting between scanlines with perspective correct texturing, the
+	// middle vertex is left of the major edge.
+	b := [3]Vertex{
+		{X: 40, Y: 25.5, Z: 0.75, S: 0, T: 16, W: 1},
+		{X: 20, Y: 5.5, Z: 0.25, S: 0, T: 0, W: 0.25},
+		{X: 10, Y: 15.5, Z: 0.5, S: 16, T: 0, W: 0.5},
+	}
+	// Fractional coordinates with all attributes.
+	c := [3]Vertex{
+		{X: 12.25, Y: 7.75, Z: 0.125, S: 4, T: 60, W: 0.5, Color: color.RGBA{16, 128, 240, 255}},
+		{X: 70.5, Y: 18.25, Z: 0.875, S: 60, T: 2, W: 1, Color: color.RGBA{200, 8, 64, 128}},
+		{X: 33.75, Y: 52.5, Z: 0.5, S: 30, T: 40, W: 0.75, Color: color.RGBA{96, 255, 0, 32}},
+	}
+
+	tests := map[string]struct {
+		flags    TriangleFlags
+		tile     uint8
+		vertices [3]Vertex
+		want     []uint64
+	}{
+		"Fill": {0, 0, a, []uint64{
+			0x0880007800500028, 0x001e0000fffe0000, 0x000a000000000000, 0x000a000000020000,
+		}},
+		"Shade": {TriangleShade, 0, a, []uint64{
+			0x0c80007800500028, 0x001e0000fffe0000, 0x000a000000000000, 0x000a000000020000,
+			0x00ff0000000000ff, 0xfff9000cfff90000, 0x0000000000000000, 0xa000c000a0000000,
+			0xfff30000000c0000, 0xfff30000000c0000, 0x40000000c0000000, 0x40000000c0000000,
+		}},
+		"TextureZBuffer": {TriangleTexture | TriangleZBuffer, 1, a, []uint64{
+			0x0b81007800500028, 0x001e0000fffe0000, 0x000a000000000000, 0x000a000000020000,
+			0x000000007fff0000, 0x0033ffe600000000, 0x0000000000000000, 0x3333666600000000,
+			0x0000003300000000, 0x0000003300000000, 0x0000333300000000, 0x0000333300000000,
+			0x0000000000000000, 0x0666599806665998,
+		}},
+		"Perspective": {TriangleTexture | TriangleZBuffer, 2, b, []uint64{
+			0x0b020066003e0016, 0x000a000000030000, 0x0013800000010000, 0x00148000ffff0000,
+			0x0000fff31d990000, 0xfff3000c00cc0000, 0x000033335e600000, 0x3333cccccb330000,
+			0x0000001904cc0000, 0x000c000c03ff0000, 0x00009999c3300000, 0xccccccccf8000000,
+			0x1e6629a000000000, 0x03332ccc03332ccc,
+		}},
+		"All": {TriangleShade | TriangleTexture | TriangleZBuffer, 3, c, []uint64{
+			0x0f8300d20049001f, 0x00468000fffeed50, 0x000be3c100007afe, 0x000816db00058c30,
+			0x000e007d00f40102, 0x0003fffdfffdfffe, 0xa8c2df1b05b8bcc8, 0x1b022f3cc01e98b1,
+			0x00010002fffafffb, 0x00000004fffbfffb, 0xc9a7d686a30a044a, 0x4bb130d0b7b8b0eb,
+			0x003503c03f760000, 0x001fffef010f0000, 0x016e000035400000, 0xfda228d9cdd00000,
+			0x000effff00b70000, 0xffff000800340000, 0xa8c2ffff0e4d0000, 0x4a13174777ee0000,
+			0x0f31eff00197b4ba, 0x01129574004eb3e5,
+		}},
+		"Degenerate": {TriangleShade, 0, [3]Vertex{{X: 5, Y: 5}, {X: 5, Y: 5}, {X: 5, Y: 5}}, []uint64{
+			0x0c00001400140014, 0x0005000000000000, 0x0005000000000000, 0x0005000000000000,
+			0, 0, 0, 0, 0, 0, 0, 0,
+		}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			v := tc.vertices
+			got := appendTriangle(nil, tc.flags, tc.tile, &v[0], &v[1], &v[2])
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("expected %016x, got %016x", tc.want, got)
+			}
+		})
+	}
+}
@@ -40,6 +40,22 @@ func ControlByte(alloc Allocator, ctrl byte) error {
 	return nil
 }
 
+// NewChannelCommand adds a command created by newCmd to alloc, preceded by
+// the bytes skipping the channels before channel and followed by the end of
+// the commands.
+func NewChannelCommand[T any](alloc Allocator, channel uint8, newCmd func(Allocator) (T, error)) (cmd T, err error) {
+	for range channel {
+		if err = ControlByte(alloc, CtrlSkip); err != nil {
+			return
+		}
+	}
+	if cmd, err = newCmd(alloc); err != nil {
+		return
+	}
+	err = ControlByte(alloc, CtrlAbort)
+	return
+}
+
 const headerLen = 3
 
 const (
@@ -66,6 +82,14 @@ const (
 	cmdRTCInfo         = "\x01\x03\x06"
 	cmdReadRTC         = "\x02\x09\x07"
 	cmdWriteRTC        = "\x0a\x01\x08"
+	cmdReadVRU36       = "\x03\x25\x09"
+	cmdWriteVRU20      = "\x17\x01\x0a"
+	cmdReadVRU2        = "\x03\x03\x0b"
+	cmdWriteVRU4       = "\x07\x01\x0c"
+	cmdShortWriteVRU   = "\x03\x01\x0d"
+	cmdReadKeyboard    = "\x02\x07\x13"
+	cmdGameCubeState   = "\x03\x08\x40"
+	cmdGameCubeOrigin  = "\x01\x0a\x41"
 )
 
 type Command []byte
@@ -123,6 +147,7 @@ const (
 	LinkCable  Device = 0x0003
 	EEPROM4k   Device = 0x0080
 	EEPROM16k  Device = 0x00c0
+	GameCube   Device = 0x0900
 )
 
 type InfoCommand struct{ Command }
@@ -240,7 +265,13 @@ func NewReadPakCommand(alloc Allocator) (ReadPakCommand, error) {
 }
 
 func (c ReadPakCommand) Data() (data []byte, err error) {
-	err = validate(c.Command, cmdReadPak)
+	return readData(c.Command, cmdReadPak)
+}
+
+// readData returns the received data of a command followed by a checksum
+// byte, like reading a pak.
+func readData(c Command, header string) (data []byte, err error) {
+	err = validate(c, header)
 	if err != nil {
 		return
 	}
@@ -248,17 +279,19 @@ func (c ReadPakCommand) Data() (data []byte, err error) {
 	data = c.rxData()
 	data = data[:len(data)-1] // exclude checksum byte
 
-	csum := crc8.Init(pakCRC8)
-	csum = crc8.Update(csum, data, pakCRC8)
-	csum = crc8.Complete(csum, pakCRC8)
-
-	if csum != c.rxData()[len(data)] {
+	if dataCRC(data) != c.rxData()[len(data)] {
 		err = ErrChecksum
 	}
 
 	return
 }
 
+func dataCRC(data []byte) byte {
+	csum := crc8.Init(pakCRC8)
+	csum = crc8.Update(csum, data, pakCRC8)
+	return crc8.Complete(csum, pakCRC8)
+}
+
 type WritePakCommand struct {
 	PakCommand
 	csum byte
@@ -271,7 +304,18 @@ func NewWritePakCommand(alloc Allocator) (WritePakCommand, error) {
 
 // len(src) must match the payload size, i.e. 32 bytes.
 func (c *WritePakCommand) SetData(src []byte) (err error) {
-	err = validate(c.Command, cmdWritePak)
+	c.csum, err = setData(c.Command, cmdWritePak, src)
+	return
+}
+
+func (c WritePakCommand) Result() error {
+	return writeResult(c.Command, cmdWritePak, c.csum)
+}
+
+// setData copies src after the command byte and address of a command, like
+// writing a pak, and returns the checksum of the data.
+func setData(c Command, header string, src []byte) (csum byte, err error) {
+	err = validate(c, header)
 	if err != nil {
 		return
 	}
@@ -280,23 +324,19 @@ func (c *WritePakCommand) SetData(src []byte) (err error) {
 	data = data[3:] // exclude addr
 
 	if len(src) != len(data) {
-		return ErrDataLength
+		return 0, ErrDataLength
 	}
 
 	copy(data, src)
-
-	c.csum = crc8.Init(pakCRC8)
-	c.csum = crc8.Update(c.csum, data, pakCRC8)
-	c.csum = crc8.Complete(c.csum, pakCRC8)
-
-	return
+	return dataCRC(data), nil
 }
 
-func (c WritePakCommand) Result() error {
-	err := validate(c.Command, cmdWritePak)
+// writeResult checks the checksum received in response to setData.
+func writeResult(c Command, header string, csum byte) error {
+	err := validate(c, header)
 	if err != nil {
 		return err
-	} else if c.rxData()[0] != c.csum {
+	} else if c.rxData()[0] != csum {
 		return ErrChecksum
 	}
 	return nil
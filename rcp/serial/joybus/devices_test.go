@@ -0,0 +1,302 @@
+package joybus
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// buffer allocates from a PIF RAM sized buffer, like serial.CommandBlock.
+type buffer struct {
+	buf []byte
+}
+
+func newBuffer() *buffer {
+	return &buffer{make([]byte, 0, 63)}
+}
+
+func (b *buffer) Alloc(n int) ([]byte, error) {
+	l := len(b.buf)
+	if l+n > cap(b.buf) {
+		return nil, io.EOF
+	}
+	b.buf = b.buf[:l+n]
+	return b.buf[l:], nil
+}
+
+// respond writes rx to the receive buffer of c, like the PIF does.
+func respond(c Command, rx ...byte) {
+	copy(c.rxData(), rx)
+}
+
+func TestChannelCommand(t *testing.T) {
+	tests := map[string]struct {
+		channel  uint8
+		newCmd   func(a Allocator, channel uint8) error
+		expected string
+	}{
+		"Controller1": {
+			channel: 0,
+			newCmd: func(a Allocator, channel uint8) error {
+				_, err := NewChannelCommand(a, channel, NewInfoCommand)
+				return err
+			},
+			expected: "\x01\x03\x00\x00\x00\x00\xfe",
+		},
+		"Controller3": {
+			channel: 2,
+			newCmd: func(a Allocator, channel uint8) error {
+				_, err := NewChannelCommand(a, channel, NewControllerStateCommand)
+				return err
+			},
+			expected: "\x00\x00\x01\x04\x01\x00\x00\x00\x00\xfe",
+		},
+		"ReadEEPROM": {
+			channel: 4,
+			newCmd: func(a Allocator, channel uint8) error {
+				cmd, err := NewChannelCommand(a, channel, NewReadEEPROMCommand)
+				if err == nil {
+					cmd.SetBlock(0x12)
+				}
+				return err
+			},
+			expected: "\x00\x00\x00\x00\x02\x08\x04\x12\x00\x00\x00\x00\x00\x00\x00\x00\xfe",
+		},
+		"WriteEEPROM": {
+			channel: 4,
+			newCmd: func(a Allocator, channel uint8) error {
+				cmd, err := NewChannelCommand(a, channel, NewWriteEEPROMCommand)
+				if err == nil {
+					cmd.SetBlock(0xff)
+					err = cmd.SetData([]byte("saveGame"))
+				}
+				return err
+			},
+			expected: "\x00\x00\x00\x00\x0a\x01\x05\xffsaveGame\x00\xfe",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			b := newBuffer()
+			if err := tc.newCmd(b, tc.channel); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b.buf, []byte(tc.expected)) {
+				t.Errorf("expected %x, got %x", tc.expected, b.buf)
+			}
+		})
+	}
+
+	if _, err := NewChannelCommand(&buffer{make([]byte, 0, 8)}, 4, NewReadEEPROMCommand); err != io.EOF {
+		t.Errorf("expected %v, got %v", io.EOF, err)
+	}
+}
+
+func TestMouse(t *testing.T) {
+	b := newBuffer()
+	c, err := NewMouseStateCommand(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []byte("\x01\x04\x01\x00\x00\x00\x00"); !bytes.Equal(b.buf, expected) {
+		t.Errorf("expected %x, got %x", expected, b.buf)
+	}
+
+	respond(c.Command, 0xc0|0x20, 0x0f, 0xfb, 0x07) // A+B+Z, stray bits
+	buttons, dx, dy, err := c.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buttons != MouseLeft|MouseRight || dx != -5 || dy != 7 {
+		t.Errorf("expected %v, -5, 7, got %v, %d, %d", MouseLeft|MouseRight, buttons, dx, dy)
+	}
+
+	c.Command[1] |= flagNoResponse
+	if _, _, _, err := c.State(); err != ErrPIFNoResponse {
+		t.Errorf("expected %v, got %v", ErrPIFNoResponse, err)
+	}
+}
+
+func TestKeyboard(t *testing.T) {
+	b := newBuffer()
+	c, err := NewKeyboardCommand(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetLEDs(LEDCapsLock | LEDPower)
+	if expected := []byte("\x02\x07\x13\x06\x00\x00\x00\x00\x00\x00\x00"); !bytes.Equal(b.buf, expected) {
+		t.Errorf("expected %x, got %x", expected, b.buf)
+	}
+
+	respond(c.Command, 0x05, 0x02, 0x0c, 0x07, 0x00, 0x00, 0x11)
+	keys, status, err := c.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := [3]Key{NewKey(5, 2), NewKey(12, 7), 0}; keys != expected {
+		t.Errorf("expected %v, got %v", expected, keys)
+	}
+	if keys[1].Row() != 12 || keys[1].Col() != 7 {
+		t.Errorf("expected 12, 7, got %d, %d", keys[1].Row(), keys[1].Col())
+	}
+	if status != KeyboardHome|KeyboardOverflow {
+		t.Errorf("expected %#x, got %#x", KeyboardHome|KeyboardOverflow, status)
+	}
+}
+
+func TestVRU(t *testing.T) {
+	b := newBuffer()
+	r2, err := NewVRURead2Command(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w4, err := NewVRUWrite4Command(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sw, err := NewVRUShortWriteCommand(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewVRURead36Command(b); err != io.EOF {
+		t.Errorf("expected %v for a full buffer, got %v", io.EOF, err)
+	}
+
+	r2.SetAddress(0x0000)
+	w4.SetAddress(0x8000)
+	if err := w4.SetData([]byte{1, 2, 3}); err != ErrDataLength {
+		t.Errorf("expected %v, got %v", ErrDataLength, err)
+	}
+	if err := w4.SetData([]byte{1, 2, 3, 4}); err != nil {
+		t.Fatal(err)
+	}
+	sw.SetAddress(0x0200)
+	expected := []byte("" +
+		"\x03\x03\x0b\x00\x00\x00\x00\x00" +
+		"\x07\x01\x0c\x80\x01\x01\x02\x03\x04\x00" +
+		"\x03\x01\x0d\x02\x19\x00")
+	if !bytes.Equal(b.buf, expected) {
+		t.Errorf("expected %x, got %x", expected, b.buf)
+	}
+
+	respond(r2.Command, 0x12, 0x34, dataCRC([]byte{0x12, 0x34}))
+	data, err := r2.Data()
+	if err != nil || !bytes.Equal(data, []byte{0x12, 0x34}) {
+		t.Errorf("expected 1234, got %x, %v", data, err)
+	}
+	respond(r2.Command, 0x12, 0x35)
+	if _, err := r2.Data(); err != ErrChecksum {
+		t.Errorf("expected %v, got %v", ErrChecksum, err)
+	}
+
+	respond(w4.Command, dataCRC([]byte{1, 2, 3, 4}))
+	if err := w4.Result(); err != nil {
+		t.Error(err)
+	}
+	respond(w4.Command, 0)
+	if err := w4.Result(); err != ErrChecksum {
+		t.Errorf("expected %v, got %v", ErrChecksum, err)
+	}
+
+	respond(sw.Command, 0x01)
+	if status, err := sw.Result(); err != nil || status != 0x01 {
+		t.Errorf("expected 1, got %d, %v", status, err)
+	}
+
+	w20, err := NewVRUWrite20Command(newBuffer())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r36, err := NewVRURead36Command(newBuffer())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(w20.txData()) != 23 || len(r36.rxData()) != 37 {
+		t.Errorf("expected 23 and 37 bytes, got %d and %d", len(w20.txData()), len(r36.rxData()))
+	}
+}
+
+func TestGameCube(t *testing.T) {
+	b := newBuffer()
+	c, err := NewGameCubeStateCommand(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := NewGameCubeOriginCommand(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetRumble(true)
+	expected := []byte("" +
+		"\x03\x08\x40\x03\x01\x00\x00\x00\x00\x00\x00\x00\x00" +
+		"\x01\x0a\x41\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")
+	if !bytes.Equal(b.buf, expected) {
+		t.Errorf("expected %x, got %x", expected, b.buf)
+	}
+
+	respond(c.Command, 0x31, 0xc8, 0x80, 0x7f, 0x10, 0xf0, 0x00, 0xff)
+	s, err := c.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := GameCubeState{
+		Buttons: GameCubeStart | GameCubeA | GameCubeL | GameCubeDUp,
+		StickX:  0x80, StickY: 0x7f, CStickX: 0x10, CStickY: 0xf0, L: 0x00, R: 0xff,
+	}
+	if s != state {
+		t.Errorf("expected %+v, got %+v", state, s)
+	}
+	if str := s.Buttons.String(); str != "↑ + L + A + Start" {
+		t.Errorf("expected %q, got %q", "↑ + L + A + Start", str)
+	}
+
+	respond(o.Command, 0x00, 0x80, 0x81, 0x7e, 0x80, 0x80, 0x1f, 0x20, 0x00, 0x00)
+	origin, err := o.Origin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if origin.Buttons != 0 || origin.StickX != 0x81 || origin.R != 0x20 {
+		t.Errorf("expected origin 0x81, 0x20, got %+v", origin)
+	}
+}
+
+func TestEEPROM(t *testing.T) {
+	b := newBuffer()
+	r, err := NewReadEEPROMCommand(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWriteEEPROMCommand(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetBlock(0x3f)
+	w.SetBlock(0xff)
+	if err := w.SetData([]byte("too short")[:7]); err != ErrDataLength {
+		t.Errorf("expected %v, got %v", ErrDataLength, err)
+	}
+	if err := w.SetData([]byte("8 bytes!")); err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte("" +
+		"\x02\x08\x04\x3f\x00\x00\x00\x00\x00\x00\x00\x00" +
+		"\x0a\x01\x05\xff8 bytes!\x00")
+	if !bytes.Equal(b.buf, expected) {
+		t.Errorf("expected %x, got %x", expected, b.buf)
+	}
+
+	respond(r.Command, []byte("abcdefgh")...)
+	if data, err := r.Data(); err != nil || string(data) != "abcdefgh" {
+		t.Errorf("expected %q, got %q, %v", "abcdefgh", data, err)
+	}
+	respond(w.Command, EEPROMBusy)
+	if status, err := w.Result(); err != nil || status != EEPROMBusy {
+		t.Errorf("expected %#x, got %#x, %v", EEPROMBusy, status, err)
+	}
+
+	r.Command[1] |= flagNoResponse
+	if _, err := r.Data(); err != ErrPIFNoResponse {
+		t.Errorf("expected %v, got %v", ErrPIFNoResponse, err)
+	}
+}
@@ -0,0 +1,59 @@
+package joybus
+
+// EEPROMs are accessed in blocks on channel 4 of the PIF.  Their size is
+// identified by InfoCommand, whose flags hold the EEPROMBusy bit during a
+// write cycle.
+const (
+	EEPROMBlockSize = 8
+	EEPROMBusy      = 0x80
+)
+
+type ReadEEPROMCommand struct{ Command }
+
+func NewReadEEPROMCommand(alloc Allocator) (ReadEEPROMCommand, error) {
+	cmd, err := newCommand(alloc, cmdReadEEPROM)
+	return ReadEEPROMCommand{cmd}, err
+}
+
+func (c ReadEEPROMCommand) SetBlock(block uint8) {
+	c.txData()[1] = block
+}
+
+func (c ReadEEPROMCommand) Data() ([]byte, error) {
+	if err := validate(c.Command, cmdReadEEPROM); err != nil {
+		return nil, err
+	}
+	return c.rxData(), nil
+}
+
+type WriteEEPROMCommand struct{ Command }
+
+func NewWriteEEPROMCommand(alloc Allocator) (WriteEEPROMCommand, error) {
+	cmd, err := newCommand(alloc, cmdWriteEEPROM)
+	return WriteEEPROMCommand{cmd}, err
+}
+
+func (c WriteEEPROMCommand) SetBlock(block uint8) {
+	c.txData()[1] = block
+}
+
+// len(src) must match the block size, i.e. 8 bytes.
+func (c WriteEEPROMCommand) SetData(src []byte) error {
+	if err := validate(c.Command, cmdWriteEEPROM); err != nil {
+		return err
+	}
+	data := c.txData()[2:] // exclude block
+	if len(src) != len(data) {
+		return ErrDataLength
+	}
+	copy(data, src)
+	return nil
+}
+
+// Result returns the status byte sent in response.
+func (c WriteEEPROMCommand) Result() (byte, error) {
+	if err := validate(c.Command, cmdWriteEEPROM); err != nil {
+		return 0, err
+	}
+	return c.rxData()[0], nil
+}
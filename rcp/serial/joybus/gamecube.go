@@ -0,0 +1,109 @@
+package joybus
+
+import "strings"
+
+// GameCubeButtonMask are the buttons of a GameCube controller, as the first
+// two bytes of its state.
+type GameCubeButtonMask uint16
+
+const (
+	GameCubeDLeft GameCubeButtonMask = 1 << iota
+	GameCubeDRight
+	GameCubeDDown
+	GameCubeDUp
+	GameCubeZ
+	GameCubeR
+	GameCubeL
+	_ // always set
+	GameCubeA
+	GameCubeB
+	GameCubeX
+	GameCubeY
+	GameCubeStart
+
+	gameCubeButtons = (1<<13 - 1) &^ 0x80
+)
+
+var gameCubeButtonNames = [...]string{
+	"←", "→", "↓", "↑", "Z", "R", "L", "", "A", "B", "X", "Y", "Start",
+}
+
+func (b GameCubeButtonMask) String() string {
+	var sb strings.Builder
+	for i, v := range gameCubeButtonNames {
+		if v != "" && b&(1<<i) != 0 {
+			if sb.Len() != 0 {
+				sb.WriteString(" + ")
+			}
+			sb.WriteString(v)
+		}
+	}
+	return sb.String()
+}
+
+// GameCubeState is the state of a GameCube controller.  The sticks and
+// triggers are unsigned, with the sticks centered around their origin.
+type GameCubeState struct {
+	Buttons          GameCubeButtonMask
+	StickX, StickY   uint8
+	CStickX, CStickY uint8
+	L, R             uint8 // analog triggers
+}
+
+func gameCubeState(rx []byte) GameCubeState {
+	return GameCubeState{
+		Buttons: GameCubeButtonMask(uint16(rx[0])<<8|uint16(rx[1])) & gameCubeButtons,
+		StickX:  rx[2],
+		StickY:  rx[3],
+		CStickX: rx[4],
+		CStickY: rx[5],
+		L:       rx[6],
+		R:       rx[7],
+	}
+}
+
+// GameCubeStateCommand polls a GameCube controller, e.g. connected through an
+// adapter, and controls its rumble motor.
+type GameCubeStateCommand struct{ Command }
+
+// gameCubeMode selects the layout of the state with a full byte per axis.
+const gameCubeMode = 0x03
+
+func NewGameCubeStateCommand(alloc Allocator) (GameCubeStateCommand, error) {
+	cmd, err := newCommand(alloc, cmdGameCubeState)
+	if err == nil {
+		cmd.txData()[1] = gameCubeMode
+	}
+	return GameCubeStateCommand{cmd}, err
+}
+
+func (c GameCubeStateCommand) SetRumble(on bool) {
+	var v byte
+	if on {
+		v = 1
+	}
+	c.txData()[2] = v
+}
+
+func (c GameCubeStateCommand) State() (s GameCubeState, err error) {
+	if err = validate(c.Command, cmdGameCubeState); err != nil {
+		return
+	}
+	return gameCubeState(c.rxData()), nil
+}
+
+// GameCubeOriginCommand reads the state of a GameCube controller when it was
+// powered on, which is the neutral position of its sticks and triggers.
+type GameCubeOriginCommand struct{ Command }
+
+func NewGameCubeOriginCommand(alloc Allocator) (GameCubeOriginCommand, error) {
+	cmd, err := newCommand(alloc, cmdGameCubeOrigin)
+	return GameCubeOriginCommand{cmd}, err
+}
+
+func (c GameCubeOriginCommand) Origin() (s GameCubeState, err error) {
+	if err = validate(c.Command, cmdGameCubeOrigin); err != nil {
+		return
+	}
+	return gameCubeState(c.rxData()), nil
+}
@@ -0,0 +1,60 @@
+package joybus
+
+// KeyboardLEDs are the LEDs of the Randnet keyboard, sent with every read.
+type KeyboardLEDs byte
+
+const (
+	LEDNumLock KeyboardLEDs = 1 << iota
+	LEDCapsLock
+	LEDPower
+)
+
+// KeyboardStatus are the status bits of a keyboard read.
+type KeyboardStatus byte
+
+const (
+	KeyboardHome     KeyboardStatus = 0x01 // Home key pressed
+	KeyboardOverflow KeyboardStatus = 0x10 // more than three keys pressed
+)
+
+// Key is the position of a key in the key matrix of the Randnet keyboard, or
+// zero for no key.
+type Key uint16
+
+func NewKey(row, col int) Key {
+	return Key(row<<8 | col)
+}
+
+func (k Key) Row() int {
+	return int(k >> 8)
+}
+
+func (k Key) Col() int {
+	return int(k & 0xff)
+}
+
+// KeyboardCommand reads the keys pressed on a Randnet keyboard and sets its
+// LEDs.
+type KeyboardCommand struct{ Command }
+
+func NewKeyboardCommand(alloc Allocator) (KeyboardCommand, error) {
+	cmd, err := newCommand(alloc, cmdReadKeyboard)
+	return KeyboardCommand{cmd}, err
+}
+
+func (c KeyboardCommand) SetLEDs(leds KeyboardLEDs) {
+	c.txData()[1] = byte(leds)
+}
+
+// Keys returns up to three pressed keys, in the order they were pressed.
+// Unused entries are zero.
+func (c KeyboardCommand) Keys() (keys [3]Key, status KeyboardStatus, err error) {
+	if err = validate(c.Command, cmdReadKeyboard); err != nil {
+		return
+	}
+	rx := c.rxData()
+	for i := range keys {
+		keys[i] = Key(uint16(rx[2*i])<<8 | uint16(rx[2*i+1]))
+	}
+	return keys, KeyboardStatus(rx[6]), nil
+}
@@ -0,0 +1,29 @@
+package joybus
+
+// The buttons of the N64 Mouse are reported like the A and B buttons of a
+// controller.
+const (
+	MouseLeft  = ButtonA
+	MouseRight = ButtonB
+)
+
+// MouseStateCommand reads the N64 Mouse.  It is the controller state
+// command, but the axes report the motion since the last read instead of a
+// stick position.
+type MouseStateCommand struct{ Command }
+
+func NewMouseStateCommand(alloc Allocator) (MouseStateCommand, error) {
+	cmd, err := newCommand(alloc, cmdControllerState)
+	return MouseStateCommand{cmd}, err
+}
+
+// State returns the pressed buttons and the relative motion.  Positive dy
+// is a motion away from the user.
+func (c MouseStateCommand) State() (b ButtonMask, dx, dy int8, err error) {
+	if err = validate(c.Command, cmdControllerState); err != nil {
+		return
+	}
+	rx := c.rxData()
+	b = ButtonMask(uint16(rx[0])<<8|uint16(rx[1])) & (MouseLeft | MouseRight)
+	return b, int8(rx[2]), int8(rx[3]), nil
+}
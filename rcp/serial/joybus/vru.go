@@ -0,0 +1,69 @@
+package joybus
+
+// The Voice Recognition Unit is accessed like a pak, by reading and writing
+// at addresses with a checksum in their lower 5 bits.  Its status is the
+// flags byte returned by InfoCommand.
+
+// VRUReadCommand reads 2 or 36 bytes from the VRU.
+type VRUReadCommand struct {
+	PakCommand
+	header string
+}
+
+func NewVRURead2Command(alloc Allocator) (VRUReadCommand, error) {
+	cmd, err := newCommand(alloc, cmdReadVRU2)
+	return VRUReadCommand{PakCommand{cmd}, cmdReadVRU2}, err
+}
+
+func NewVRURead36Command(alloc Allocator) (VRUReadCommand, error) {
+	cmd, err := newCommand(alloc, cmdReadVRU36)
+	return VRUReadCommand{PakCommand{cmd}, cmdReadVRU36}, err
+}
+
+func (c VRUReadCommand) Data() ([]byte, error) {
+	return readData(c.Command, c.header)
+}
+
+// VRUWriteCommand writes 4 or 20 bytes to the VRU.
+type VRUWriteCommand struct {
+	PakCommand
+	header string
+	csum   byte
+}
+
+func NewVRUWrite4Command(alloc Allocator) (VRUWriteCommand, error) {
+	cmd, err := newCommand(alloc, cmdWriteVRU4)
+	return VRUWriteCommand{PakCommand{cmd}, cmdWriteVRU4, 0}, err
+}
+
+func NewVRUWrite20Command(alloc Allocator) (VRUWriteCommand, error) {
+	cmd, err := newCommand(alloc, cmdWriteVRU20)
+	return VRUWriteCommand{PakCommand{cmd}, cmdWriteVRU20, 0}, err
+}
+
+// len(src) must match the payload size, i.e. 4 or 20 bytes.
+func (c *VRUWriteCommand) SetData(src []byte) (err error) {
+	c.csum, err = setData(c.Command, c.header, src)
+	return
+}
+
+func (c VRUWriteCommand) Result() error {
+	return writeResult(c.Command, c.header, c.csum)
+}
+
+// VRUShortWriteCommand sends only an address to the VRU, whose upper bits
+// are the value, e.g. to set the A/D converter.
+type VRUShortWriteCommand struct{ PakCommand }
+
+func NewVRUShortWriteCommand(alloc Allocator) (VRUShortWriteCommand, error) {
+	cmd, err := newCommand(alloc, cmdShortWriteVRU)
+	return VRUShortWriteCommand{PakCommand{cmd}}, err
+}
+
+// Result returns the status byte sent in response.
+func (c VRUShortWriteCommand) Result() (byte, error) {
+	if err := validate(c.Command, cmdShortWriteVRU); err != nil {
+		return 0, err
+	}
+	return c.rxData()[0], nil
+}
@@ -6,8 +6,10 @@ package texture
 
 import (
 	"image"
+	"image/color"
 	"image/draw"
 
+	"github.com/drpaneas/n64/debug"
 	"github.com/drpaneas/n64/rcp/cpu"
 )
 
@@ -106,6 +108,11 @@ func (p *RGBA16) Premult() bool       { return true }
 func (p *RGBA16) Writeback()          { cpu.WritebackSlice(p.Pix) }
 func (p *RGBA16) Invalidate()         { cpu.InvalidateSlice(p.Pix) }
 
+func (p *RGBA16) SubImage(r image.Rectangle) *RGBA16 {
+	subImg, _ := p.imageRGBA16.SubImage(r).(*imageRGBA16)
+	return &RGBA16{*subImg}
+}
+
 // Stores pixels intensity with 8bit
 type I8 struct{ image.Alpha }
 
@@ -136,3 +143,208 @@ func (p *I8) SubImage(r image.Rectangle) *I8 {
 	subImg, _ := p.Alpha.SubImage(r).(*image.Alpha)
 	return &I8{*subImg}
 }
+
+// Stores pixels intensity with 4bit
+type I4 struct{ imageI4 }
+
+func NewI4(r image.Rectangle) *I4 {
+	return &I4{imageI4{newPix4(r, AlignFramebuffer)}}
+}
+
+func (p *I4) Image() draw.Image   { return &p.imageI4 }
+func (p *I4) Addr() cpu.Addr      { return cpu.PhysicalAddressSlice(p.Pix) }
+func (p *I4) Stride() int         { return p.pix4.Stride << 1 }
+func (p *I4) Format() ImageFormat { return I }
+func (p *I4) BPP() BitDepth       { return BPP4 }
+func (p *I4) Premult() bool       { return false }
+func (p *I4) Writeback()          { cpu.WritebackSlice(p.Pix) }
+func (p *I4) Invalidate()         { cpu.InvalidateSlice(p.Pix) }
+
+func (p *I4) SubImage(r image.Rectangle) *I4 {
+	return &I4{imageI4{p.subImage(r)}}
+}
+
+// Stores pixels intensity with alpha with 4bit (3:1)
+type IA4 struct{ imageIA4 }
+
+func NewIA4(r image.Rectangle) *IA4 {
+	return &IA4{imageIA4{newPix4(r, AlignFramebuffer)}}
+}
+
+func (p *IA4) Image() draw.Image   { return &p.imageIA4 }
+func (p *IA4) Addr() cpu.Addr      { return cpu.PhysicalAddressSlice(p.Pix) }
+func (p *IA4) Stride() int         { return p.pix4.Stride << 1 }
+func (p *IA4) Format() ImageFormat { return IA }
+func (p *IA4) BPP() BitDepth       { return BPP4 }
+func (p *IA4) Premult() bool       { return false }
+func (p *IA4) Writeback()          { cpu.WritebackSlice(p.Pix) }
+func (p *IA4) Invalidate()         { cpu.InvalidateSlice(p.Pix) }
+
+func (p *IA4) SubImage(r image.Rectangle) *IA4 {
+	return &IA4{imageIA4{p.subImage(r)}}
+}
+
+// Stores pixels intensity with alpha with 8bit (4:4)
+type IA8 struct{ imageIA8 }
+
+func NewIA8(r image.Rectangle) *IA8 {
+	return &IA8{imageIA8{
+		Pix:    cpu.MakePaddedSliceAligned[byte](r.Dx()*r.Dy(), AlignFramebuffer),
+		Stride: r.Dx(),
+		Rect:   r,
+	}}
+}
+
+func (p *IA8) Image() draw.Image   { return &p.imageIA8 }
+func (p *IA8) Addr() cpu.Addr      { return cpu.PhysicalAddressSlice(p.Pix) }
+func (p *IA8) Stride() int         { return p.imageIA8.Stride }
+func (p *IA8) Format() ImageFormat { return IA }
+func (p *IA8) BPP() BitDepth       { return BPP8 }
+func (p *IA8) Premult() bool       { return false }
+func (p *IA8) Writeback()          { cpu.WritebackSlice(p.Pix) }
+func (p *IA8) Invalidate()         { cpu.InvalidateSlice(p.Pix) }
+
+func (p *IA8) SubImage(r image.Rectangle) *IA8 {
+	subImg, _ := p.imageIA8.SubImage(r).(*imageIA8)
+	return &IA8{*subImg}
+}
+
+// Stores pixels intensity with alpha with 16bit (8:8)
+type IA16 struct{ imageIA16 }
+
+func NewIA16(r image.Rectangle) *IA16 {
+	return &IA16{imageIA16{
+		Pix:    cpu.MakePaddedSliceAligned[byte](r.Dx()*r.Dy()*2, AlignFramebuffer),
+		Stride: 2 * r.Dx(),
+		Rect:   r,
+	}}
+}
+
+func (p *IA16) Image() draw.Image   { return &p.imageIA16 }
+func (p *IA16) Addr() cpu.Addr      { return cpu.PhysicalAddressSlice(p.Pix) }
+func (p *IA16) Stride() int         { return p.imageIA16.Stride >> 1 }
+func (p *IA16) Format() ImageFormat { return IA }
+func (p *IA16) BPP() BitDepth       { return BPP16 }
+func (p *IA16) Premult() bool       { return false }
+func (p *IA16) Writeback()          { cpu.WritebackSlice(p.Pix) }
+func (p *IA16) Invalidate()         { cpu.InvalidateSlice(p.Pix) }
+
+func (p *IA16) SubImage(r image.Rectangle) *IA16 {
+	subImg, _ := p.imageIA16.SubImage(r).(*imageIA16)
+	return &IA16{*subImg}
+}
+
+// Stores pixels as 4bit indices into a palette of up to 16 colors.  The
+// palette is kept in a TLUT (texture lookup table) with 16bit RGBA colors,
+// which must be loaded into TMEM with rdp.LoadTLUT() before drawing.
+type CI4 struct {
+	imageCI4
+	tlut *RGBA16
+}
+
+func NewCI4(r image.Rectangle, palette color.Palette) *CI4 {
+	debug.Assert(len(palette) <= 16, "texture: CI4 palette too big")
+	tex := &CI4{imageCI4: imageCI4{pix4: newPix4(r, AlignFramebuffer)}}
+	tex.SetPalette(palette)
+	return tex
+}
+
+// Sets the palette and its TLUT.  Colors are converted to 16bit RGBA, which
+// is what At() will return.
+func (p *CI4) SetPalette(palette color.Palette) {
+	p.Palette, p.tlut = newTLUT(palette)
+}
+
+func (p *CI4) TLUT() *RGBA16       { return p.tlut }
+func (p *CI4) Image() draw.Image   { return &p.imageCI4 }
+func (p *CI4) Addr() cpu.Addr      { return cpu.PhysicalAddressSlice(p.Pix) }
+func (p *CI4) Stride() int         { return p.pix4.Stride << 1 }
+func (p *CI4) Format() ImageFormat { return ColorIdx }
+func (p *CI4) BPP() BitDepth       { return BPP4 }
+func (p *CI4) Premult() bool       { return true }
+func (p *CI4) Writeback()          { cpu.WritebackSlice(p.Pix); p.tlut.Writeback() }
+func (p *CI4) Invalidate()         { cpu.InvalidateSlice(p.Pix) }
+
+func (p *CI4) SubImage(r image.Rectangle) *CI4 {
+	return &CI4{imageCI4{p.subImage(r), p.Palette}, p.tlut}
+}
+
+// Stores pixels as 8bit indices into a palette of up to 256 colors.  See CI4
+// for how the palette is stored.
+type CI8 struct {
+	image.Paletted
+	tlut *RGBA16
+}
+
+func NewCI8(r image.Rectangle, palette color.Palette) *CI8 {
+	debug.Assert(len(palette) <= 256, "texture: CI8 palette too big")
+	tex := &CI8{Paletted: image.Paletted{
+		Pix:    cpu.MakePaddedSliceAligned[byte](r.Dx()*r.Dy(), AlignFramebuffer),
+		Stride: r.Dx(),
+		Rect:   r,
+	}}
+	tex.SetPalette(palette)
+	return tex
+}
+
+// Sets the palette and its TLUT.  Colors are converted to 16bit RGBA, which
+// is what At() will return.
+func (p *CI8) SetPalette(palette color.Palette) {
+	p.Palette, p.tlut = newTLUT(palette)
+}
+
+func (p *CI8) TLUT() *RGBA16       { return p.tlut }
+func (p *CI8) Image() draw.Image   { return &p.Paletted }
+func (p *CI8) Addr() cpu.Addr      { return cpu.PhysicalAddressSlice(p.Pix) }
+func (p *CI8) Stride() int         { return p.Paletted.Stride }
+func (p *CI8) Format() ImageFormat { return ColorIdx }
+func (p *CI8) BPP() BitDepth       { return BPP8 }
+func (p *CI8) Premult() bool       { return true }
+func (p *CI8) Writeback()          { cpu.WritebackSlice(p.Pix); p.tlut.Writeback() }
+func (p *CI8) Invalidate()         { cpu.InvalidateSlice(p.Pix) }
+
+func (p *CI8) SubImage(r image.Rectangle) *CI8 {
+	subImg, _ := p.Paletted.SubImage(r).(*image.Paletted)
+	return &CI8{*subImg, p.tlut}
+}
+
+// newTLUT stores palette as 16bit RGBA colors and returns the converted
+// palette.
+func newTLUT(palette color.Palette) (color.Palette, *RGBA16) {
+	tlut := NewRGBA16(image.Rect(0, 0, len(palette), 1))
+	converted := make(color.Palette, len(palette))
+	for i, c := range palette {
+		tlut.Set(i, 0, c)
+		converted[i] = tlut.At(i, 0)
+	}
+	tlut.Writeback()
+	return converted, tlut
+}
+
+// Stores pixels in YUV with 16bit, two adjacent pixels sharing their chroma
+// (U, Y0, V, Y1).  The RDP converts YUV textures to RGB with the coefficients
+// set by rdp.SetConvert().
+type YUV16 struct{ imageYUV16 }
+
+func NewYUV16(r image.Rectangle) *YUV16 {
+	stride := 2 * ((r.Max.X+1)&^1 - r.Min.X&^1)
+	return &YUV16{imageYUV16{
+		Pix:    cpu.MakePaddedSliceAligned[byte](stride*r.Dy(), AlignFramebuffer),
+		Stride: stride,
+		Rect:   r,
+	}}
+}
+
+func (p *YUV16) Image() draw.Image   { return &p.imageYUV16 }
+func (p *YUV16) Addr() cpu.Addr      { return cpu.PhysicalAddressSlice(p.Pix) }
+func (p *YUV16) Stride() int         { return p.imageYUV16.Stride >> 1 }
+func (p *YUV16) Format() ImageFormat { return YUV }
+func (p *YUV16) BPP() BitDepth       { return BPP16 }
+func (p *YUV16) Premult() bool       { return true }
+func (p *YUV16) Writeback()          { cpu.WritebackSlice(p.Pix) }
+func (p *YUV16) Invalidate()         { cpu.InvalidateSlice(p.Pix) }
+
+func (p *YUV16) SubImage(r image.Rectangle) *YUV16 {
+	subImg, _ := p.imageYUV16.SubImage(r).(*imageYUV16)
+	return &YUV16{*subImg}
+}
@@ -3,6 +3,8 @@ package texture
 import (
 	"image"
 	"image/color"
+
+	"github.com/drpaneas/n64/rcp/cpu"
 )
 
 type imageRGBA16 struct {
@@ -55,3 +57,338 @@ func rgba16Model(c color.Color) color.Color {
 	r, g, b, a := c.RGBA()
 	return colorRGBA16((r & 0xf800) | (g&0xf800)>>5 | (b&0xf800)>>10 | a>>15)
 }
+
+func (p *imageRGBA16) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(p.Rect)
+	if r.Empty() {
+		return &imageRGBA16{}
+	}
+	return &imageRGBA16{
+		Pix:    p.Pix[p.PixOffset(r.Min.X, r.Min.Y):],
+		Stride: p.Stride,
+		Rect:   r,
+	}
+}
+
+// pix4 stores two 4bit pixels per byte, the pixel with even x coordinate in
+// the upper nibble.  Pix starts at the byte holding the pixel at Rect.Min, so
+// subimages keep the nibble order of their parent.
+type pix4 struct {
+	Pix    []uint8
+	Stride int // in bytes
+	Rect   image.Rectangle
+}
+
+func newPix4(r image.Rectangle, align uintptr) pix4 {
+	stride := (r.Max.X+1)>>1 - r.Min.X>>1
+	return pix4{
+		Pix:    cpu.MakePaddedSliceAligned[byte](stride*r.Dy(), align),
+		Stride: stride,
+		Rect:   r,
+	}
+}
+
+func (p *pix4) Bounds() image.Rectangle {
+	return p.Rect
+}
+
+func (p *pix4) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + x>>1 - p.Rect.Min.X>>1
+}
+
+func (p *pix4) nibble(x, y int) uint8 {
+	return p.Pix[p.PixOffset(x, y)] >> (4 - 4*(x&1)) & 0xf
+}
+
+func (p *pix4) setNibble(x, y int, v uint8) {
+	offset, shift := p.PixOffset(x, y), 4-4*(x&1)
+	p.Pix[offset] = p.Pix[offset]&^(0xf<<shift) | (v&0xf)<<shift
+}
+
+func (p *pix4) subImage(r image.Rectangle) pix4 {
+	r = r.Intersect(p.Rect)
+	if r.Empty() {
+		return pix4{}
+	}
+	return pix4{
+		Pix:    p.Pix[p.PixOffset(r.Min.X, r.Min.Y):],
+		Stride: p.Stride,
+		Rect:   r,
+	}
+}
+
+// Intensity with 4bit.  Like I8, which is an image.Alpha, the intensity is
+// taken from the alpha channel.
+type imageI4 struct{ pix4 }
+
+func (p *imageI4) ColorModel() color.Model { return I4Model }
+
+func (p *imageI4) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return color.Alpha{}
+	}
+	return color.Alpha{p.nibble(x, y) * 0x11}
+}
+
+func (p *imageI4) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	p.setNibble(x, y, i4Model(c).(color.Alpha).A>>4)
+}
+
+func (p *imageI4) SubImage(r image.Rectangle) image.Image {
+	return &imageI4{p.subImage(r)}
+}
+
+var I4Model color.Model = color.ModelFunc(i4Model)
+
+func i4Model(c color.Color) color.Color {
+	_, _, _, a := c.RGBA()
+	return color.Alpha{uint8(a>>12) * 0x11}
+}
+
+// Intensity with alpha (3:1)
+type imageIA4 struct{ pix4 }
+
+func (p *imageIA4) ColorModel() color.Model { return IA4Model }
+
+func (p *imageIA4) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return colorIA{}
+	}
+	v := p.nibble(x, y)
+	i := v >> 1
+	return colorIA{i<<5 | i<<2 | i>>1, (v & 1) * 0xff}
+}
+
+func (p *imageIA4) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	col := iaModel(c)
+	p.setNibble(x, y, col.I>>5<<1|col.A>>7)
+}
+
+func (p *imageIA4) SubImage(r image.Rectangle) image.Image {
+	return &imageIA4{p.subImage(r)}
+}
+
+// Color indices with 4bit
+type imageCI4 struct {
+	pix4
+	Palette color.Palette
+}
+
+func (p *imageCI4) ColorModel() color.Model { return p.Palette }
+
+func (p *imageCI4) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return color.RGBA{}
+	}
+	idx := int(p.nibble(x, y))
+	if idx >= len(p.Palette) {
+		return color.RGBA{}
+	}
+	return p.Palette[idx]
+}
+
+func (p *imageCI4) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	p.setNibble(x, y, uint8(p.Palette.Index(c)))
+}
+
+func (p *imageCI4) SubImage(r image.Rectangle) image.Image {
+	return &imageCI4{p.subImage(r), p.Palette}
+}
+
+// Intensity with alpha (4:4)
+type imageIA8 struct {
+	Pix    []uint8
+	Stride int
+	Rect   image.Rectangle
+}
+
+func (p *imageIA8) ColorModel() color.Model { return IA8Model }
+
+func (p *imageIA8) Bounds() image.Rectangle {
+	return p.Rect
+}
+
+func (p *imageIA8) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return colorIA{}
+	}
+	v := p.Pix[p.PixOffset(x, y)]
+	return colorIA{v >> 4 * 0x11, v & 0xf * 0x11}
+}
+
+func (p *imageIA8) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	col := iaModel(c)
+	p.Pix[p.PixOffset(x, y)] = col.I&0xf0 | col.A>>4
+}
+
+func (p *imageIA8) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x - p.Rect.Min.X)
+}
+
+func (p *imageIA8) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(p.Rect)
+	if r.Empty() {
+		return &imageIA8{}
+	}
+	return &imageIA8{
+		Pix:    p.Pix[p.PixOffset(r.Min.X, r.Min.Y):],
+		Stride: p.Stride,
+		Rect:   r,
+	}
+}
+
+// Intensity with alpha (8:8)
+type imageIA16 struct {
+	Pix    []uint8
+	Stride int
+	Rect   image.Rectangle
+}
+
+func (p *imageIA16) ColorModel() color.Model { return IA16Model }
+
+func (p *imageIA16) Bounds() image.Rectangle {
+	return p.Rect
+}
+
+func (p *imageIA16) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return colorIA{}
+	}
+	offset := p.PixOffset(x, y)
+	return colorIA{p.Pix[offset], p.Pix[offset+1]}
+}
+
+func (p *imageIA16) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	offset := p.PixOffset(x, y)
+	col := iaModel(c)
+	p.Pix[offset] = col.I
+	p.Pix[offset+1] = col.A
+}
+
+func (p *imageIA16) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*2
+}
+
+func (p *imageIA16) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(p.Rect)
+	if r.Empty() {
+		return &imageIA16{}
+	}
+	return &imageIA16{
+		Pix:    p.Pix[p.PixOffset(r.Min.X, r.Min.Y):],
+		Stride: p.Stride,
+		Rect:   r,
+	}
+}
+
+// colorIA is an intensity with non-premultiplied alpha.
+type colorIA struct{ I, A uint8 }
+
+func (c colorIA) RGBA() (r, g, b, a uint32) {
+	i := uint32(c.I)
+	i |= i << 8
+	i *= uint32(c.A)
+	i /= 0xff
+	a = uint32(c.A)
+	a |= a << 8
+	return i, i, i, a
+}
+
+var (
+	IA4Model  color.Model = color.ModelFunc(ia4Model)
+	IA8Model  color.Model = color.ModelFunc(ia8Model)
+	IA16Model color.Model = color.ModelFunc(ia16Model)
+)
+
+// iaModel converts c to its luminance and alpha with 8bit each.
+func iaModel(c color.Color) colorIA {
+	if c, ok := c.(colorIA); ok {
+		return c
+	}
+	r, g, b, a := c.RGBA()
+	if a == 0 {
+		return colorIA{}
+	}
+	// Same coefficients as color.GrayModel, unpremultiplied afterwards
+	y := (19595*r + 38470*g + 7471*b + 1<<15) >> 16
+	return colorIA{uint8(y * 0xffff / a >> 8), uint8(a >> 8)}
+}
+
+func ia4Model(c color.Color) color.Color {
+	col := iaModel(c)
+	i := col.I >> 5
+	return colorIA{i<<5 | i<<2 | i>>1, col.A >> 7 * 0xff}
+}
+
+func ia8Model(c color.Color) color.Color {
+	col := iaModel(c)
+	return colorIA{col.I >> 4 * 0x11, col.A >> 4 * 0x11}
+}
+
+func ia16Model(c color.Color) color.Color {
+	return iaModel(c)
+}
+
+// YUV with 16bit per pixel.  Two horizontally adjacent pixels share their
+// chroma and are stored as U, Y0, V, Y1.  Like for pix4, Pix starts at the
+// pair holding the pixel at Rect.Min.
+type imageYUV16 struct {
+	Pix    []uint8
+	Stride int
+	Rect   image.Rectangle
+}
+
+func (p *imageYUV16) ColorModel() color.Model { return color.YCbCrModel }
+
+func (p *imageYUV16) Bounds() image.Rectangle {
+	return p.Rect
+}
+
+func (p *imageYUV16) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return color.YCbCr{}
+	}
+	pair := p.Pix[p.PixOffset(x&^1, y):]
+	return color.YCbCr{pair[1+2*(x&1)], pair[0], pair[2]}
+}
+
+// Set writes the luma of the pixel and the chroma of both pixels of the pair.
+func (p *imageYUV16) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	col := color.YCbCrModel.Convert(c).(color.YCbCr)
+	pair := p.Pix[p.PixOffset(x&^1, y):]
+	pair[0], pair[1+2*(x&1)], pair[2] = col.Cb, col.Y, col.Cr
+}
+
+func (p *imageYUV16) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X&^1)*2
+}
+
+func (p *imageYUV16) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(p.Rect)
+	if r.Empty() {
+		return &imageYUV16{}
+	}
+	return &imageYUV16{
+		Pix:    p.Pix[p.PixOffset(r.Min.X&^1, r.Min.Y):],
+		Stride: p.Stride,
+		Rect:   r,
+	}
+}
@@ -0,0 +1,79 @@
+package texture
+
+import (
+	"image"
+	"image/color"
+	"unsafe"
+
+	"github.com/drpaneas/n64/rcp/cpu"
+	"github.com/drpaneas/n64/rcp/texture/texfile"
+)
+
+// Load returns the first level of a texture file written by cmd/mktex.
+func Load(data []byte) (Texture, error) {
+	levels, err := LoadMipmaps(data)
+	if err != nil {
+		return nil, err
+	}
+	return levels[0], nil
+}
+
+// LoadMipmaps returns all levels of a texture file written by cmd/mktex.  The
+// textures reference data, which avoids copying textures embedded in the ROM,
+// if data is aligned to AlignTexture.  Otherwise data is copied once.
+//
+// go:embed doesn't guarantee any alignment, the Go files written by mktex -go
+// do.  Files read from a romfs.FS are aligned if they are read into a buffer
+// made by cpu.MakePaddedSliceAligned.
+func LoadMipmaps(data []byte) ([]Texture, error) {
+	if uintptr(unsafe.Pointer(unsafe.SliceData(data)))%AlignTexture != 0 {
+		aligned := cpu.MakePaddedSliceAligned[byte](len(data), AlignTexture)
+		copy(aligned, data)
+		cpu.WritebackSlice(aligned)
+		data = aligned
+	}
+
+	var f texfile.File
+	if err := f.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+
+	var tlut *RGBA16
+	var palette color.Palette
+	if len(f.Palette) > 0 {
+		colors := len(f.Palette) / 2
+		tlut = &RGBA16{imageRGBA16{f.Palette, len(f.Palette), image.Rect(0, 0, colors, 1)}}
+		palette = make(color.Palette, colors)
+		for i := range palette {
+			palette[i] = tlut.At(i, 0)
+		}
+	}
+
+	levels := make([]Texture, len(f.Levels))
+	for i, pix := range f.Levels {
+		r, stride := f.Bounds(i), f.Stride(i)
+		switch f.Format {
+		case texfile.RGBA16:
+			levels[i] = &RGBA16{imageRGBA16{pix, stride, r}}
+		case texfile.RGBA32:
+			levels[i] = &NRGBA32{image.NRGBA{Pix: pix, Stride: stride, Rect: r}}
+		case texfile.YUV16:
+			levels[i] = &YUV16{imageYUV16{pix, stride, r}}
+		case texfile.CI4:
+			levels[i] = &CI4{imageCI4{pix4{pix, stride, r}, palette}, tlut}
+		case texfile.CI8:
+			levels[i] = &CI8{image.Paletted{Pix: pix, Stride: stride, Rect: r, Palette: palette}, tlut}
+		case texfile.IA4:
+			levels[i] = &IA4{imageIA4{pix4{pix, stride, r}}}
+		case texfile.IA8:
+			levels[i] = &IA8{imageIA8{pix, stride, r}}
+		case texfile.IA16:
+			levels[i] = &IA16{imageIA16{pix, stride, r}}
+		case texfile.I4:
+			levels[i] = &I4{imageI4{pix4{pix, stride, r}}}
+		case texfile.I8:
+			levels[i] = &I8{image.Alpha{Pix: pix, Stride: stride, Rect: r}}
+		}
+	}
+	return levels, nil
+}
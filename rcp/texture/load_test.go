@@ -0,0 +1,123 @@
+package texture
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+
+	"github.com/drpaneas/n64/rcp/cpu"
+	"github.com/drpaneas/n64/rcp/texture/texfile"
+)
+
+// checker returns an image of black and white pixels.
+func checker(w, h int) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, w, h), color.Palette{color.Black, color.White})
+	for y := range h {
+		for x := range w {
+			img.Pix[y*w+x] = uint8((x ^ y) & 1)
+		}
+	}
+	return img
+}
+
+// encode returns a texture file of img with one additional mip map level.
+func encode(t *testing.T, img image.Image, format texfile.Format) (*texfile.File, []byte) {
+	t.Helper()
+	f, err := texfile.Encode(img, format, texfile.Options{Mipmaps: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, data
+}
+
+func TestLoadMipmaps(t *testing.T) {
+	tests := map[texfile.Format]struct {
+		typ          Texture
+		black, white color.Color
+	}{
+		texfile.RGBA16: {&RGBA16{}, colorRGBA16(0x0001), colorRGBA16(0xffff)},
+		texfile.RGBA32: {&NRGBA32{}, color.NRGBA{0, 0, 0, 0xff}, color.NRGBA{0xff, 0xff, 0xff, 0xff}},
+		texfile.YUV16:  {&YUV16{}, color.YCbCr{0, 0x80, 0x80}, color.YCbCr{0xff, 0x80, 0x80}},
+		texfile.CI4:    {&CI4{}, colorRGBA16(0x0001), colorRGBA16(0xffff)},
+		texfile.CI8:    {&CI8{}, colorRGBA16(0x0001), colorRGBA16(0xffff)},
+		texfile.IA4:    {&IA4{}, colorIA{0, 0xff}, colorIA{0xff, 0xff}},
+		texfile.IA8:    {&IA8{}, colorIA{0, 0xff}, colorIA{0xff, 0xff}},
+		texfile.IA16:   {&IA16{}, colorIA{0, 0xff}, colorIA{0xff, 0xff}},
+		texfile.I4:     {&I4{}, color.Alpha{0}, color.Alpha{0xff}},
+		texfile.I8:     {&I8{}, color.Alpha{0}, color.Alpha{0xff}},
+	}
+
+	img := checker(16, 4)
+	for format, tc := range tests {
+		t.Run(format.String(), func(t *testing.T) {
+			f, file := encode(t, img, format)
+
+			aligned := cpu.MakePaddedSliceAligned[byte](len(file), AlignTexture)
+			copy(aligned, file)
+			unaligned := cpu.MakePaddedSliceAligned[byte](len(file)+1, AlignTexture)[1:]
+			copy(unaligned, file)
+
+			// The levels follow the header and palette in the file
+			offsets := make([]int, len(f.Levels))
+			off := len(file)
+			for i := len(f.Levels) - 1; i >= 0; i-- {
+				off -= len(f.Levels[i])
+				offsets[i] = off
+			}
+
+			for name, data := range map[string][]byte{"Aligned": aligned, "Unaligned": unaligned} {
+				levels, err := LoadMipmaps(data)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(levels) != 2 {
+					t.Fatalf("%s: expected 2 levels, got %d", name, len(levels))
+				}
+				for i, tex := range levels {
+					if reflect.TypeOf(tex) != reflect.TypeOf(tc.typ) {
+						t.Fatalf("%s: expected %T, got %T", name, tc.typ, tex)
+					}
+					aliased := tex.Addr() == cpu.PhysicalAddressSlice(data[offsets[i]:])
+					if aliased != (name == "Aligned") {
+						t.Errorf("%s: level %d references data: %v", name, i, aliased)
+					}
+					if b := f.Bounds(i); tex.Bounds() != b {
+						t.Errorf("%s: expected bounds %v, got %v", name, b, tex.Bounds())
+					}
+				}
+
+				tex := levels[0]
+				for y := range img.Rect.Dy() {
+					for x := range img.Rect.Dx() {
+						want := tc.black
+						if img.ColorIndexAt(x, y) == 1 {
+							want = tc.white
+						}
+						if got := tex.At(x, y); got != want {
+							t.Fatalf("%s: expected %v at (%d,%d), got %v", name, want, x, y, got)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	_, file := encode(t, checker(4, 4), texfile.IA8)
+	if _, err := Load(file[:len(file)-1]); err != texfile.ErrFormat {
+		t.Errorf("expected %v, got %v", texfile.ErrFormat, err)
+	}
+	tex, err := Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tex.Bounds() != image.Rect(0, 0, 4, 4) {
+		t.Errorf("expected first level, got bounds %v", tex.Bounds())
+	}
+}
@@ -0,0 +1,307 @@
+package texfile
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/draw"
+	"slices"
+)
+
+// Options control the conversion of images by Encode.
+type Options struct {
+	Dither  bool // dither colors reduced to less than 8 bits per channel
+	Mipmaps int  // number of additional levels, each half the size
+	Colors  int  // palette size of CI textures, zero for the format's maximum
+}
+
+// Encode converts img into a texture file.  CI textures use the palette of img
+// if it is an *image.Paletted with few enough colors, otherwise a palette is
+// generated by median cut.  Mip map levels are downscaled with a box filter.
+func Encode(img image.Image, format Format, opts Options) (*File, error) {
+	if !format.valid() {
+		return nil, ErrFormat
+	}
+	b := img.Bounds()
+	if b.Dx() <= 0 || b.Dx() > MaxWidth || b.Dy() <= 0 || b.Dy() > 0xffff ||
+		opts.Mipmaps < 0 || opts.Mipmaps >= MaxLevels {
+		return nil, ErrSize
+	}
+
+	f := &File{Format: format, Width: b.Dx(), Height: b.Dy()}
+	src := image.NewRGBA64(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Rect, img, b.Min, draw.Src)
+
+	var pal color.Palette
+	if colors := format.Colors(); colors > 0 {
+		if opts.Colors > 0 {
+			colors = min(colors, opts.Colors)
+		}
+		if p, ok := img.(*image.Paletted); ok && len(p.Palette) <= colors {
+			pal = make(color.Palette, len(p.Palette))
+			for i, c := range p.Palette {
+				pal[i] = fromRGBA16(toRGBA16(c))
+			}
+		} else {
+			pal = medianCut(src, colors)
+		}
+		for _, c := range pal {
+			f.Palette = binary.BigEndian.AppendUint16(f.Palette, toRGBA16(c))
+		}
+	}
+
+	for level := range opts.Mipmaps + 1 {
+		if level > 0 {
+			src = downscale(src)
+		}
+		f.Levels = append(f.Levels, f.encode(level, src, pal, opts.Dither))
+	}
+	return f, nil
+}
+
+// bayer is the threshold matrix for ordered dithering.
+var bayer = [4][4]uint32{
+	{0, 8, 2, 10},
+	{12, 4, 14, 6},
+	{3, 11, 1, 9},
+	{15, 7, 13, 5},
+}
+
+// quantize reduces an 8 bit value to bits.  With dither, a threshold of up to
+// one step is added depending on the pixel's position.
+func quantize(v uint32, bits uint, x, y int, dither bool) uint32 {
+	if dither {
+		v += bayer[y&3][x&3] << 8 >> bits >> 4
+	}
+	return min(v>>(8-bits), 1<<bits-1)
+}
+
+// unpremultiply returns the 8 bit straight alpha color of a premultiplied
+// 16 bit color.
+func unpremultiply(c color.RGBA64) (r, g, b, a uint32) {
+	if c.A == 0 {
+		return 0, 0, 0, 0
+	}
+	a = uint32(c.A)
+	return uint32(c.R) * 0xffff / a >> 8, uint32(c.G) * 0xffff / a >> 8,
+		uint32(c.B) * 0xffff / a >> 8, a >> 8
+}
+
+// luminance returns the 16 bit luminance of a premultiplied color, using the
+// coefficients of color.GrayModel.
+func luminance(c color.RGBA64) uint32 {
+	return (19595*uint32(c.R) + 38470*uint32(c.G) + 7471*uint32(c.B) + 1<<15) >> 16
+}
+
+// encode converts a level's pixels to the file's format.
+func (f *File) encode(level int, src *image.RGBA64, pal color.Palette, dither bool) []byte {
+	stride, bits := f.Stride(level), f.Format.Bits()
+	pix := make([]byte, f.levelSize(level))
+	put := func(x, y int, v uint32) {
+		i := y*stride + x*bits/8
+		switch bits {
+		case 4:
+			pix[i] |= uint8(v) << (4 - 4*(x&1))
+		case 8:
+			pix[i] = uint8(v)
+		case 16:
+			binary.BigEndian.PutUint16(pix[i:], uint16(v))
+		case 32:
+			binary.BigEndian.PutUint32(pix[i:], v)
+		}
+	}
+
+	bounds := src.Rect
+	var indices *image.Paletted
+	if pal != nil {
+		indices = image.NewPaletted(bounds, pal)
+		drawer := draw.Drawer(draw.Src)
+		if dither {
+			drawer = draw.FloydSteinberg
+		}
+		drawer.Draw(indices, bounds, src, bounds.Min)
+	}
+
+	for y := range bounds.Dy() {
+		for x := range bounds.Dx() {
+			c := src.RGBA64At(x, y)
+			switch f.Format {
+			case RGBA32:
+				r, g, b, a := unpremultiply(c)
+				put(x, y, r<<24|g<<16|b<<8|a)
+			case RGBA16:
+				if r, g, b, a := unpremultiply(c); a >= 0x80 {
+					put(x, y, quantize(r, 5, x, y, dither)<<11|quantize(g, 5, x, y, dither)<<6|
+						quantize(b, 5, x, y, dither)<<1|1)
+				}
+			case YUV16:
+				if x&1 == 0 {
+					f.putYUV(pix[y*stride+x*2:], src, x, y)
+				}
+			case CI4, CI8:
+				put(x, y, uint32(indices.ColorIndexAt(x, y)))
+			case IA16, IA8, IA4:
+				var i uint32
+				if c.A != 0 {
+					i = min(luminance(c)*0xffff/uint32(c.A)>>8, 0xff)
+				}
+				a := uint32(c.A >> 8)
+				switch f.Format {
+				case IA16:
+					put(x, y, i<<8|a)
+				case IA8:
+					put(x, y, quantize(i, 4, x, y, dither)<<4|quantize(a, 4, x, y, dither))
+				case IA4:
+					put(x, y, quantize(i, 3, x, y, dither)<<1|a>>7)
+				}
+			case I8:
+				put(x, y, luminance(c)>>8)
+			case I4:
+				put(x, y, quantize(luminance(c)>>8, 4, x, y, dither))
+			}
+		}
+	}
+	return pix
+}
+
+// putYUV writes the pixel pair starting at x as U, Y0, V, Y1.  The pair's
+// chroma is averaged.
+func (f *File) putYUV(dst []byte, src *image.RGBA64, x, y int) {
+	var luma, cb, cr [2]uint8
+	for i := range 2 {
+		r, g, b, _ := unpremultiply(src.RGBA64At(min(x+i, src.Rect.Max.X-1), y))
+		luma[i], cb[i], cr[i] = color.RGBToYCbCr(uint8(r), uint8(g), uint8(b))
+	}
+	dst[0] = uint8((uint32(cb[0]) + uint32(cb[1]) + 1) / 2)
+	dst[1] = luma[0]
+	dst[2] = uint8((uint32(cr[0]) + uint32(cr[1]) + 1) / 2)
+	dst[3] = luma[1]
+}
+
+// downscale halves the size of img by averaging 2x2 pixels.
+func downscale(img *image.RGBA64) *image.RGBA64 {
+	r := img.Rect
+	dst := image.NewRGBA64(image.Rect(0, 0, max(r.Dx()/2, 1), max(r.Dy()/2, 1)))
+	for y := range dst.Rect.Dy() {
+		for x := range dst.Rect.Dx() {
+			var sum [4]uint32
+			for i := range 4 {
+				c := img.RGBA64At(min(2*x+i&1, r.Max.X-1), min(2*y+i>>1, r.Max.Y-1))
+				sum[0] += uint32(c.R)
+				sum[1] += uint32(c.G)
+				sum[2] += uint32(c.B)
+				sum[3] += uint32(c.A)
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{
+				uint16((sum[0] + 2) / 4), uint16((sum[1] + 2) / 4),
+				uint16((sum[2] + 2) / 4), uint16((sum[3] + 2) / 4),
+			})
+		}
+	}
+	return dst
+}
+
+// toRGBA16 converts c to 16 bit RGBA (5:5:5:1).  Colors with less than half
+// alpha are fully transparent.
+func toRGBA16(c color.Color) uint16 {
+	r, g, b, a := c.RGBA()
+	if a < 0x8000 {
+		return 0
+	}
+	r, g, b = r*0xffff/a, g*0xffff/a, b*0xffff/a
+	return uint16(r>>11<<11 | g>>11<<6 | b>>11<<1 | 1)
+}
+
+// fromRGBA16 expands a 16 bit color the same way the RDP does.
+func fromRGBA16(v uint16) color.RGBA {
+	if v&1 == 0 {
+		return color.RGBA{}
+	}
+	expand := func(c uint16) uint8 { return uint8(c<<3 | c>>2) }
+	return color.RGBA{expand(v >> 11 & 31), expand(v >> 6 & 31), expand(v >> 1 & 31), 0xff}
+}
+
+// channel returns a channel of a RGBA16 color with 5 bits.
+func channel(v uint16, ch int) int {
+	if ch == 3 {
+		return int(v&1) * 31
+	}
+	return int(v >> (11 - 5*ch) & 31)
+}
+
+type histEntry struct {
+	color uint16 // RGBA16
+	count int
+}
+
+// medianCut generates a palette of up to n colors for img.  It starts with a
+// box holding all colors and repeatedly splits the box with the widest range
+// of a channel at its median.  Colors are reduced to RGBA16 first.
+func medianCut(img *image.RGBA64, n int) color.Palette {
+	hist := make(map[uint16]int)
+	for y := range img.Rect.Dy() {
+		for x := range img.Rect.Dx() {
+			hist[toRGBA16(img.RGBA64At(x, y))]++
+		}
+	}
+	entries := make([]histEntry, 0, len(hist))
+	for c, count := range hist {
+		entries = append(entries, histEntry{c, count})
+	}
+	slices.SortFunc(entries, func(a, b histEntry) int { return int(a.color) - int(b.color) })
+
+	boxes := [][]histEntry{entries}
+	for len(boxes) < n {
+		split, splitCh, width := -1, 0, 0
+		for i, box := range boxes {
+			for ch := range 4 {
+				lo, hi := 31, 0
+				for _, e := range box {
+					lo, hi = min(lo, channel(e.color, ch)), max(hi, channel(e.color, ch))
+				}
+				if hi-lo > width {
+					split, splitCh, width = i, ch, hi-lo
+				}
+			}
+		}
+		if split < 0 {
+			break // all boxes hold a single color
+		}
+
+		box := boxes[split]
+		slices.SortStableFunc(box, func(a, b histEntry) int {
+			return channel(a.color, splitCh) - channel(b.color, splitCh)
+		})
+		total := 0
+		for _, e := range box {
+			total += e.count
+		}
+		k, sum := 1, box[0].count
+		for ; k < len(box)-1 && sum+box[k].count <= total/2; k++ {
+			sum += box[k].count
+		}
+		boxes[split] = box[:k:k]
+		boxes = append(boxes, box[k:])
+	}
+
+	pal := make(color.Palette, len(boxes))
+	for i, box := range boxes {
+		var sum [4]int
+		total := 0
+		for _, e := range box {
+			for ch := range sum {
+				sum[ch] += channel(e.color, ch) * e.count
+			}
+			total += e.count
+		}
+		var v uint16
+		if sum[3]*2 >= 31*total {
+			for ch := range 3 {
+				v |= uint16((sum[ch]+total/2)/total) << (11 - 5*ch)
+			}
+			v |= 1
+		}
+		pal[i] = fromRGBA16(v)
+	}
+	return pal
+}
@@ -0,0 +1,202 @@
+// Package texfile implements the texture file format written by cmd/mktex and
+// the conversion of images into it.  Pixels are stored in the RDP's native
+// formats, so texture.Load can reference them without conversion or copying.
+//
+// Rows are padded to 64 bit words, which is the unit of TMEM lines, so each
+// level can be loaded with a single LOAD_TILE or LOAD_BLOCK.
+package texfile
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+)
+
+// File layout, all values are big endian:
+//
+//	0x00 magic "N64T"
+//	0x04 version, format, mip map levels, reserved (1 byte each)
+//	0x08 width, height of the first level
+//	0x0c palette colors, reserved
+//	0x10 palette, RGBA16 each, padded to 8 bytes
+//	.... levels, each half the size of the previous
+const (
+	magic      = "N64T"
+	version    = 1
+	headerSize = 0x10
+
+	MaxLevels = 8 // LOD selects one of eight tiles
+	MaxWidth  = 1024
+)
+
+var (
+	ErrFormat = errors.New("texfile: invalid texture file")
+	ErrSize   = errors.New("texfile: unsupported image size")
+)
+
+// Format is a texture format as encoded in RDP commands, with the image
+// format in the upper and the pixel size in the lower two bits.
+type Format uint8
+
+const (
+	RGBA16 Format = 0<<2 | 2
+	RGBA32 Format = 0<<2 | 3
+	YUV16  Format = 1<<2 | 2
+	CI4    Format = 2<<2 | 0
+	CI8    Format = 2<<2 | 1
+	IA4    Format = 3<<2 | 0
+	IA8    Format = 3<<2 | 1
+	IA16   Format = 3<<2 | 2
+	I4     Format = 4<<2 | 0
+	I8     Format = 4<<2 | 1
+)
+
+var formatNames = map[Format]string{
+	RGBA16: "rgba16", RGBA32: "rgba32", YUV16: "yuv16", CI4: "ci4", CI8: "ci8",
+	IA4: "ia4", IA8: "ia8", IA16: "ia16", I4: "i4", I8: "i8",
+}
+
+// ParseFormat returns the format with the given name, e.g. "rgba16".
+func ParseFormat(name string) (Format, error) {
+	for f, n := range formatNames {
+		if n == name {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("texfile: unknown format %q", name)
+}
+
+func (f Format) String() string {
+	if name, ok := formatNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("Format(%d)", uint8(f))
+}
+
+func (f Format) valid() bool {
+	_, ok := formatNames[f]
+	return ok
+}
+
+// Bits returns the size of a pixel in bits.
+func (f Format) Bits() int {
+	return 4 << (f & 3)
+}
+
+// Colors returns the maximum palette size, which is zero for formats without
+// palette.
+func (f Format) Colors() int {
+	switch f {
+	case CI4:
+		return 16
+	case CI8:
+		return 256
+	}
+	return 0
+}
+
+// File is a texture as written by cmd/mktex.
+type File struct {
+	Format        Format
+	Width, Height int
+	Palette       []byte   // RGBA16 colors of CI textures
+	Levels        [][]byte // pixels of each mip map level
+}
+
+// Bounds returns the size of a mip map level.
+func (f *File) Bounds(level int) image.Rectangle {
+	return image.Rect(0, 0, max(f.Width>>level, 1), max(f.Height>>level, 1))
+}
+
+// Stride returns the bytes per row of a mip map level.
+func (f *File) Stride(level int) int {
+	return pad((f.Bounds(level).Dx()*f.Format.Bits() + 7) / 8)
+}
+
+func (f *File) levelSize(level int) int {
+	return f.Stride(level) * f.Bounds(level).Dy()
+}
+
+// TMEMSize returns the bytes needed to load all levels into TMEM, not
+// counting the palette.
+func (f *File) TMEMSize() int {
+	size := 0
+	for level := range f.Levels {
+		size += f.levelSize(level)
+	}
+	return size
+}
+
+func pad(n int) int {
+	return (n + 7) &^ 7
+}
+
+func (f *File) valid() bool {
+	if !f.Format.valid() || f.Width <= 0 || f.Width > MaxWidth ||
+		f.Height <= 0 || f.Height > 0xffff ||
+		len(f.Levels) == 0 || len(f.Levels) > MaxLevels ||
+		len(f.Palette) > 2*f.Format.Colors() || len(f.Palette)%2 != 0 {
+		return false
+	}
+	for level, pix := range f.Levels {
+		if len(pix) != f.levelSize(level) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *File) MarshalBinary() ([]byte, error) {
+	if !f.valid() {
+		return nil, ErrFormat
+	}
+
+	b := make([]byte, 0, headerSize+pad(len(f.Palette))+f.TMEMSize())
+	b = append(b, magic...)
+	b = append(b, version, byte(f.Format), byte(len(f.Levels)), 0)
+	b = binary.BigEndian.AppendUint16(b, uint16(f.Width))
+	b = binary.BigEndian.AppendUint16(b, uint16(f.Height))
+	b = binary.BigEndian.AppendUint16(b, uint16(len(f.Palette)/2))
+	b = binary.BigEndian.AppendUint16(b, 0)
+	b = append(b, f.Palette...)
+	b = append(b, make([]byte, pad(len(f.Palette))-len(f.Palette))...)
+	for _, pix := range f.Levels {
+		b = append(b, pix...)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary parses a texture file.  The palette and levels reference
+// data, which avoids copying textures embedded in the ROM.
+func (f *File) UnmarshalBinary(data []byte) error {
+	if len(data) < headerSize || string(data[:4]) != magic || data[4] != version {
+		return ErrFormat
+	}
+	f.Format = Format(data[5])
+	levels := int(data[6])
+	f.Width = int(binary.BigEndian.Uint16(data[8:]))
+	f.Height = int(binary.BigEndian.Uint16(data[10:]))
+	colors := int(binary.BigEndian.Uint16(data[12:]))
+
+	data = data[headerSize:]
+	if len(data) < pad(2*colors) || levels > MaxLevels {
+		return ErrFormat
+	}
+	f.Palette = data[:2*colors]
+	data = data[pad(2*colors):]
+
+	f.Levels = make([][]byte, levels)
+	for level := range f.Levels {
+		n := f.levelSize(level)
+		if len(data) < n {
+			return ErrFormat
+		}
+		f.Levels[level], data = data[:n:n], data[n:]
+	}
+
+	if !f.valid() || len(data) != 0 {
+		return ErrFormat
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package texfile
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+// testImage has an opaque orange and a half transparent gray pixel.
+func testImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{0xff, 0x80, 0x00, 0xff})
+	img.SetNRGBA(1, 0, color.NRGBA{0x40, 0x40, 0x40, 0x80})
+	return img
+}
+
+func TestEncode(t *testing.T) {
+	y0, cb0, cr0 := color.RGBToYCbCr(0xff, 0x80, 0x00)
+	y1, cb1, cr1 := color.RGBToYCbCr(0x40, 0x40, 0x40)
+
+	tests := map[string]struct {
+		format Format
+		want   []byte
+	}{
+		"RGBA32": {RGBA32, []byte{0xff, 0x80, 0x00, 0xff, 0x40, 0x40, 0x40, 0x80}},
+		"RGBA16": {RGBA16, []byte{0xfc, 0x01, 0x42, 0x11, 0, 0, 0, 0}},
+		"YUV16":  {YUV16, []byte{uint8((int(cb0) + int(cb1) + 1) / 2), y0, uint8((int(cr0) + int(cr1) + 1) / 2), y1, 0, 0, 0, 0}},
+		"IA16":   {IA16, []byte{0x97, 0xff, 0x40, 0x80, 0, 0, 0, 0}},
+		"IA8":    {IA8, []byte{0x9f, 0x48, 0, 0, 0, 0, 0, 0}},
+		"IA4":    {IA4, []byte{0x95, 0, 0, 0, 0, 0, 0, 0}},
+		"I8":     {I8, []byte{0x97, 0x20, 0, 0, 0, 0, 0, 0}},
+		"I4":     {I4, []byte{0x92, 0, 0, 0, 0, 0, 0, 0}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, err := Encode(testImage(), tc.format, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(f.Levels) != 1 || !bytes.Equal(f.Levels[0], tc.want) {
+				t.Errorf("expected %x, got %x", tc.want, f.Levels)
+			}
+		})
+	}
+}
+
+func TestEncodePaletted(t *testing.T) {
+	pal := color.Palette{color.RGBA{0xff, 0, 0, 0xff}, color.RGBA{0, 0xff, 0, 0xff}, color.RGBA{}}
+	img := image.NewPaletted(image.Rect(0, 0, 3, 2), pal)
+	copy(img.Pix, []uint8{0, 1, 2, 2, 1, 0})
+
+	f, err := Encode(img, CI4, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0xf8, 0x01, 0x07, 0xc1, 0, 0}; !bytes.Equal(f.Palette, want) {
+		t.Errorf("expected palette %x, got %x", want, f.Palette)
+	}
+	want := []byte{0x01, 0x20, 0, 0, 0, 0, 0, 0, 0x21, 0x00, 0, 0, 0, 0, 0, 0}
+	if !bytes.Equal(f.Levels[0], want) {
+		t.Errorf("expected %x, got %x", want, f.Levels[0])
+	}
+}
+
+func TestMedianCut(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 1))
+	img.SetRGBA(0, 0, color.RGBA{0xff, 0, 0, 0xff})
+	img.SetRGBA(1, 0, color.RGBA{0xf0, 0x10, 0, 0xff})
+	img.SetRGBA(2, 0, color.RGBA{0, 0, 0xff, 0xff})
+	img.SetRGBA(3, 0, color.RGBA{0, 0x10, 0xf0, 0xff})
+
+	f, err := Encode(img, CI8, Options{Colors: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Palette) != 4 {
+		t.Fatalf("expected %v colors, got %v", 2, len(f.Palette)/2)
+	}
+	pix := f.Levels[0]
+	if pix[0] != pix[1] || pix[2] != pix[3] || pix[0] == pix[2] {
+		t.Errorf("expected reds and blues to share their colors, got %v", pix[:4])
+	}
+}
+
+func TestMipmaps(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for x := range 4 {
+		img.SetRGBA(x, 0, color.RGBA{0xff, 0, 0, 0xff})
+		img.SetRGBA(x, 1, color.RGBA{0, 0, 0xff, 0xff})
+	}
+
+	f, err := Encode(img, RGBA32, Options{Mipmaps: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizes := []image.Rectangle{image.Rect(0, 0, 4, 2), image.Rect(0, 0, 2, 1), image.Rect(0, 0, 1, 1)}
+	if len(f.Levels) != len(sizes) {
+		t.Fatalf("expected %v levels, got %v", len(sizes), len(f.Levels))
+	}
+	for level, want := range sizes {
+		if got := f.Bounds(level); got != want {
+			t.Errorf("level %d: expected %v, got %v", level, want, got)
+		}
+	}
+	if want := []byte{0x80, 0, 0x80, 0xff}; !bytes.Equal(f.Levels[2][:4], want) {
+		t.Errorf("expected %x, got %x", want, f.Levels[2][:4])
+	}
+	if got := f.TMEMSize(); got != 32+8+8 {
+		t.Errorf("expected %v, got %v", 48, got)
+	}
+}
+
+func TestDither(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(img, img.Rect, image.NewUniform(color.RGBA{0x84, 0x84, 0x84, 0xff}), image.Point{}, draw.Src)
+
+	f, err := Encode(img, RGBA16, Options{Dither: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[uint8]bool)
+	for i := 0; i < len(f.Levels[0]); i += 2 {
+		seen[f.Levels[0][i]>>3] = true
+	}
+	if !seen[16] || !seen[17] || len(seen) != 2 {
+		t.Errorf("expected red values 16 and 17, got %v", seen)
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	f, err := Encode(testImage(), CI4, Options{Mipmaps: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data)%8 != 0 {
+		t.Errorf("expected size aligned to 8 bytes, got %v", len(data))
+	}
+
+	var got File
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if got.Format != f.Format || got.Width != f.Width || got.Height != f.Height ||
+		!bytes.Equal(got.Palette, f.Palette) || len(got.Levels) != len(f.Levels) {
+		t.Fatalf("expected %v, got %v", f, got)
+	}
+	for level := range f.Levels {
+		if !bytes.Equal(got.Levels[level], f.Levels[level]) {
+			t.Errorf("level %d: expected %x, got %x", level, f.Levels[level], got.Levels[level])
+		}
+	}
+
+	corrupt := map[string]func([]byte) []byte{
+		"Magic":     func(b []byte) []byte { b[0] = 'X'; return b },
+		"Version":   func(b []byte) []byte { b[4] = 2; return b },
+		"Format":    func(b []byte) []byte { b[5] = 0xff; return b },
+		"Levels":    func(b []byte) []byte { b[6] = 9; return b },
+		"Truncated": func(b []byte) []byte { return b[:len(b)-8] },
+		"Trailing":  func(b []byte) []byte { return append(b, make([]byte, 8)...) },
+	}
+	for name, fn := range corrupt {
+		t.Run(name, func(t *testing.T) {
+			var f File
+			if err := f.UnmarshalBinary(fn(bytes.Clone(data))); !errors.Is(err, ErrFormat) {
+				t.Errorf("expected %v, got %v", ErrFormat, err)
+			}
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for f := range formatNames {
+		if got, err := ParseFormat(f.String()); err != nil || got != f {
+			t.Errorf("expected %v, got %v, %v", f, got, err)
+		}
+	}
+	if _, err := ParseFormat("rgba8"); err == nil {
+		t.Errorf("expected error for rgba8")
+	}
+}
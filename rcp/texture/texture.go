@@ -49,11 +49,12 @@ type CachedTexture interface {
 	Invalidate()
 }
 
-// For a number of pixels returns their size in bytes.
+// For a number of pixels returns their size in bytes.  With 4bit pixels, an
+// odd number of pixels is rounded up to the next full byte.
 func PixelsToBytes(pixels int, bpp BitDepth) int {
 	shift := int(bpp)>>51 - 1
 	if shift < 0 {
-		return pixels >> -shift
+		return (pixels + 1) >> -shift
 	}
 	return pixels << shift
 }
@@ -0,0 +1,61 @@
+package draw3d_test
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/drpaneas/n64/drivers/draw/draw3d"
+	"github.com/drpaneas/n64/rcp/rdp"
+	"github.com/drpaneas/n64/rcp/texture"
+)
+
+func TestDrawTriangles(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	img := texture.NewRGBA32(image.Rect(0, 0, 32, 32))
+
+	dl := &rdp.RDP
+	dl.SetColorImage(img)
+	dl.SetScissor(img.Bounds(), rdp.InterlaceNone)
+	dl.SetCombineMode(rdp.CombineMode{
+		Two: rdp.CombinePass{
+			RGB: rdp.CombineParams{
+				rdp.CombineAColorZero, rdp.CombineBColorZero,
+				rdp.CombineCColorZero, rdp.CombineShade,
+			},
+			Alpha: rdp.CombineParams{
+				rdp.CombineAAlphaZero, rdp.CombineBAlphaZero,
+				rdp.CombineCAlphaZero, rdp.CombineDAlphaOne,
+			},
+		},
+	})
+	dl.SetOtherModes(
+		rdp.ForceBlend,
+		rdp.CycleTypeOne, rdp.RGBDitherNone, rdp.AlphaDitherNone, rdp.ZmodeOpaque, rdp.CvgDestClamp, rdp.BlendMode{},
+	)
+
+	p := draw3d.New(dl)
+	p.SetProjection(draw3d.Ortho(-16, 16, -16, 16, -1, 1), 1)
+	p.SetViewport(img.Bounds())
+	p.SetGeometryMode(draw3d.Shade | draw3d.CullBack)
+
+	img.Invalidate()
+
+	// The lower left half of the image, and the same triangle facing away
+	p.DrawTriangles([]draw3d.Vertex{
+		{X: -16, Y: -16, R: 0xff, A: 0xff},
+		{X: 16, Y: -16, R: 0xff, A: 0xff},
+		{X: -16, Y: 16, R: 0xff, A: 0xff},
+	}, []uint16{0, 1, 2, 0, 2, 1})
+	p.Flush()
+
+	for _, pt := range []image.Point{{2, 29}, {10, 20}, {20, 10}, {29, 2}} {
+		want := color.RGBA{}
+		if pt.Y > pt.X {
+			want = red
+		}
+		if result := img.At(pt.X, pt.Y); result != want {
+			t.Errorf("expected %v at %v, got %v", want, pt, result)
+		}
+	}
+}
@@ -17,11 +17,13 @@ import (
 
 	"github.com/drpaneas/n64/test/drivers/carts/summercart64_test"
 	"github.com/drpaneas/n64/test/drivers/controller_test"
+	"github.com/drpaneas/n64/test/drivers/draw3d_test"
 	"github.com/drpaneas/n64/test/drivers/draw_test"
 	"github.com/drpaneas/n64/test/rcp/cpu_test"
 	"github.com/drpaneas/n64/test/rcp/periph_test"
 	"github.com/drpaneas/n64/test/rcp/rdp_test"
 	"github.com/drpaneas/n64/test/rcp/rsp_test"
+	"github.com/drpaneas/n64/test/rcp/texture_test"
 	"github.com/drpaneas/n64/test/runtime_test"
 
 	"github.com/embeddedgo/fs/termfs"
@@ -69,7 +71,11 @@ func main() {
 			newInternalTest(rsp_test.TestRun),
 			newInternalTest(rsp_test.TestInterrupt),
 			newInternalTest(rdp_test.TestFillRect),
+			newInternalTest(texture_test.TestFormats),
+			newInternalTest(texture_test.TestDrawCI8),
+			newInternalTest(texture_test.TestPixelsToBytes),
 			newInternalTest(draw_test.TestDrawMask),
+			newInternalTest(draw3d_test.TestDrawTriangles),
 			newInternalTest(periph_test.TestReaderWriterAt),
 			newInternalTest(periph_test.TestReadWriteIO),
 			newInternalTest(periph_test.TestConcurrent),
@@ -0,0 +1,86 @@
+package texture_test
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/drpaneas/n64/rcp/texture"
+)
+
+func TestFormats(t *testing.T) {
+	// Palettes are stored as RGBA16
+	red, blue := color.RGBA{0xf8, 0, 0, 0xff}, color.RGBA{0, 0, 0xf8, 0xff}
+	palette := color.Palette{red, blue}
+	r := image.Rect(1, 0, 6, 2)
+
+	tests := map[string]struct {
+		tex    texture.Texture
+		in     color.Color
+		want   color.Color
+		stride int
+	}{
+		"I4":    {texture.NewI4(r), color.Alpha{0x99}, color.Alpha{0x99}, 6},
+		"IA4":   {texture.NewIA4(r), color.NRGBA{0xff, 0xff, 0xff, 0xff}, color.Gray{0xff}, 6},
+		"IA8":   {texture.NewIA8(r), color.Gray{0x77}, color.Gray{0x77}, 5},
+		"IA16":  {texture.NewIA16(r), color.Gray{0x12}, color.Gray{0x12}, 5},
+		"CI4":   {texture.NewCI4(r, palette), color.RGBA{0, 0, 0xf0, 0xff}, blue, 6},
+		"CI8":   {texture.NewCI8(r, palette), color.RGBA{0xf0, 0, 0, 0xff}, red, 5},
+		"YUV16": {texture.NewYUV16(r), color.YCbCr{0x80, 0x40, 0xc0}, color.YCbCr{0x80, 0x40, 0xc0}, 6},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			img := tc.tex.(texture.ImageTexture).Image()
+			img.Set(3, 1, tc.in)
+
+			want := color.RGBAModel.Convert(tc.want)
+			if got := color.RGBAModel.Convert(img.At(3, 1)); got != want {
+				t.Errorf("expected %v, got %v", want, got)
+			}
+			sub := img.(interface {
+				SubImage(image.Rectangle) image.Image
+			}).SubImage(image.Rect(3, 1, 5, 2))
+			if got := color.RGBAModel.Convert(sub.At(3, 1)); got != want {
+				t.Errorf("subimage: expected %v, got %v", want, got)
+			}
+			if got := tc.tex.Stride(); got != tc.stride {
+				t.Errorf("stride: expected %v, got %v", tc.stride, got)
+			}
+		})
+	}
+}
+
+func TestDrawCI8(t *testing.T) {
+	src := image.NewUniform(color.RGBA{0, 0, 0xff, 0xff})
+	tex := texture.NewCI8(image.Rect(0, 0, 8, 8), color.Palette{color.Black, color.RGBA{0, 0, 0xff, 0xff}})
+	draw.Draw(tex.Image(), tex.Bounds(), src, image.Point{}, draw.Src)
+	for _, idx := range tex.Pix {
+		if idx != 1 {
+			t.Fatalf("expected %v, got %v", 1, idx)
+		}
+	}
+}
+
+func TestPixelsToBytes(t *testing.T) {
+	tests := map[string]struct {
+		pixels int
+		bpp    texture.BitDepth
+		want   int
+	}{
+		"BPP4":    {4, texture.BPP4, 2},
+		"BPP4Odd": {5, texture.BPP4, 3},
+		"BPP8":    {5, texture.BPP8, 5},
+		"BPP16":   {5, texture.BPP16, 10},
+		"BPP32":   {5, texture.BPP32, 20},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := texture.PixelsToBytes(tc.pixels, tc.bpp); got != tc.want {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}